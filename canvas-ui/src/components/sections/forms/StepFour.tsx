@@ -6,6 +6,9 @@ import { useLocation } from "wouter";
 import { body } from "motion/react-client";
 import { validateTescoCopy } from "@/lib/tescoCopyValidator";
 
+// Requests go through the dev server's /api proxy, which adds the
+// workspace API key; the key is never shipped to the browser.
+const API_URL = "/api";
 
 interface StepFourProps {
   onBack: () => void;
@@ -96,7 +99,7 @@ export default function StepFour({ onBack }: StepFourProps) {
     const fd = new FormData();
     fd.append(`${type}_file`, file);
 
-    const res = await fetch(`http://localhost:8080/upload-${type}`, {
+    const res = await fetch(`${API_URL}/upload-${type}`, {
       method: "POST",
       body: fd,
     });
@@ -185,7 +188,7 @@ export default function StepFour({ onBack }: StepFourProps) {
       };
 
       // create brand kit
-      const kitRes = await fetch("http://localhost:8080/create-brand-kit", {
+      const kitRes = await fetch(`${API_URL}/create-brand-kit`, {
         method: "POST",
         headers: { "Content-Type": "application/json" },
         body: JSON.stringify({
@@ -205,7 +208,7 @@ export default function StepFour({ onBack }: StepFourProps) {
 
       // generate creative
       const genRes = await fetch(
-        `http://localhost:8080/brand-kit/${kitId}/generate`,
+        `${API_URL}/brand-kit/${kitId}/generate`,
         {
           method: "POST",
           headers: { "Content-Type": "application/json" },
@@ -215,7 +218,21 @@ export default function StepFour({ onBack }: StepFourProps) {
       const genJson = await genRes.json();
       if (!genRes.ok) throw new Error(genJson.message);
 
-      setAiDesign(genJson.data);
+      // generation runs as a background job; poll until it finishes
+      const jobId = genJson.data.id;
+      let job = genJson.data;
+      while (job.status === "queued" || job.status === "running") {
+        await new Promise((resolve) => setTimeout(resolve, 1500));
+        const jobRes = await fetch(`${API_URL}/jobs/${jobId}`);
+        const jobJson = await jobRes.json();
+        if (!jobRes.ok) throw new Error(jobJson.message);
+        job = jobJson.data;
+      }
+      if (job.status !== "succeeded") {
+        throw new Error(job.error || `Generation ${job.status}`);
+      }
+
+      setAiDesign(job.result.layout);
       setLocation("/canvas");
     } catch (err: any) {
       console.error(err);
@@ -1,14 +1,32 @@
-import { defineConfig } from 'vite'
+import { defineConfig, loadEnv, type ProxyOptions } from 'vite'
 import react from '@vitejs/plugin-react'
 import path from "path"
 import tailwindcss from "@tailwindcss/vite"
 
 // https://vite.dev/config/
-export default defineConfig({
-  plugins: [react(), tailwindcss()],
-  resolve: {
-    alias: {
-      "@": path.resolve(__dirname, "./src"),
+export default defineConfig(({ mode }) => {
+  // For local development only. API_KEY has no VITE_ prefix, so it stays on
+  // the server and never ends up in the bundle, but the proxy adds it to
+  // every /api request: whoever can reach this server acts with the key.
+  // Keep it on localhost and never deploy it.
+  const env = loadEnv(mode, process.cwd(), "")
+  const api: Record<string, ProxyOptions> = {
+    "/api": {
+      target: env.API_URL || "http://localhost:8080",
+      changeOrigin: true,
+      rewrite: (p) => p.replace(/^\/api/, ""),
+      headers: env.API_KEY ? { Authorization: `Bearer ${env.API_KEY}` } : {},
     },
-  },
+  }
+
+  return {
+    plugins: [react(), tailwindcss()],
+    resolve: {
+      alias: {
+        "@": path.resolve(__dirname, "./src"),
+      },
+    },
+    server: { proxy: api },
+    preview: { proxy: api },
+  }
 })
@@ -0,0 +1,127 @@
+// Package accounting records what every model call cost and who it was
+// made for, so AI spend can be charged back per workspace and brand kit.
+package accounting
+
+import (
+	"canvas-backend/internal/db"
+	"canvas-backend/llm"
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	OPERATION_DESCRIBE_IMAGE  = "describe_image"
+	OPERATION_GENERATE_LAYOUT = "generate_layout"
+)
+
+// Price is US dollars per million tokens.
+type Price struct {
+	Prompt   float64
+	Response float64
+}
+
+// PRICES are list prices by model name prefix; the longest matching prefix
+// wins. Models not listed are recorded at no cost.
+var PRICES = map[string]Price{
+	"gemini-2.5-pro":        {Prompt: 1.25, Response: 10.00},
+	"gemini-2.5-flash":      {Prompt: 0.30, Response: 2.50},
+	"gemini-2.5-flash-lite": {Prompt: 0.10, Response: 0.40},
+	"gemini-2.0-flash":      {Prompt: 0.10, Response: 0.40},
+	"gemini-2.0-flash-lite": {Prompt: 0.075, Response: 0.30},
+}
+
+// PriceOf looks up the price of model.
+func PriceOf(model string) (Price, bool) {
+	best, found := "", false
+	for prefix := range PRICES {
+		if strings.HasPrefix(model, prefix) && len(prefix) >= len(best) {
+			best, found = prefix, true
+		}
+	}
+	return PRICES[best], found
+}
+
+// CostMicros is the estimated cost of usage on model in millionths of a
+// dollar. Dollars per million tokens times tokens is exactly that.
+func CostMicros(model string, usage llm.Usage) int64 {
+	price, ok := PriceOf(model)
+	if !ok {
+		return 0
+	}
+	return int64(math.Round(float64(usage.PromptTokens)*price.Prompt + float64(usage.ResponseTokens)*price.Response))
+}
+
+// Attribution is who a model call is charged to.
+type Attribution struct {
+	WorkspaceID pgtype.UUID
+	BrandKitID  pgtype.UUID
+	JobID       pgtype.UUID
+}
+
+type attributionKey struct{}
+
+func WithAttribution(ctx context.Context, attribution Attribution) context.Context {
+	return context.WithValue(ctx, attributionKey{}, attribution)
+}
+
+func AttributionFrom(ctx context.Context) Attribution {
+	attribution, _ := ctx.Value(attributionKey{}).(Attribution)
+	return attribution
+}
+
+// Call adds up the attempts of one model call.
+type Call struct {
+	Operation string
+	Provider  string
+	Model     string
+	Usage     llm.Usage
+	Latency   time.Duration
+	Attempts  int
+}
+
+// Attempt adds one request to the model, successful or not. response may
+// be empty when the request failed before the model answered.
+func (c *Call) Attempt(response llm.Response, latency time.Duration) {
+	c.Attempts++
+	c.Latency += latency
+	c.Usage.PromptTokens += response.Usage.PromptTokens
+	c.Usage.ResponseTokens += response.Usage.ResponseTokens
+	if response.Model != "" {
+		c.Model = response.Model
+	}
+}
+
+// Record writes the call, attributed from ctx, with err as its outcome.
+// Calls that never reached the model are not recorded.
+func Record(ctx context.Context, queries *db.Queries, call Call, err error) error {
+	if call.Attempts == 0 {
+		return nil
+	}
+
+	attribution := AttributionFrom(ctx)
+	var error_text pgtype.Text
+	if err != nil {
+		error_text = pgtype.Text{String: err.Error(), Valid: true}
+	}
+
+	// The call has been paid for even if the request that made it is gone.
+	return queries.CreateModelCall(context.WithoutCancel(ctx), db.CreateModelCallParams{
+		WorkspaceID:         attribution.WorkspaceID,
+		BrandKitID:          attribution.BrandKitID,
+		GenerationJobID:     attribution.JobID,
+		Operation:           call.Operation,
+		Provider:            call.Provider,
+		Model:               call.Model,
+		PromptTokens:        call.Usage.PromptTokens,
+		ResponseTokens:      call.Usage.ResponseTokens,
+		LatencyMs:           int32(call.Latency.Milliseconds()),
+		Retries:             int32(call.Attempts - 1),
+		Succeeded:           err == nil,
+		Error:               error_text,
+		EstimatedCostMicros: CostMicros(call.Model, call.Usage),
+	})
+}
@@ -0,0 +1,200 @@
+package accounting
+
+import (
+	"canvas-backend/internal/db"
+	"canvas-backend/llm"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeDB keeps the model calls written to it.
+type fakeDB struct {
+	calls []db.CreateModelCallParams
+	// ctx_err is the error of the context the last call was written with.
+	ctx_err error
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if !strings.Contains(sql, "-- name: CreateModelCall ") {
+		return pgconn.CommandTag{}, errors.New("unexpected exec")
+	}
+	f.ctx_err = ctx.Err()
+	f.calls = append(f.calls, db.CreateModelCallParams{
+		WorkspaceID:         args[0].(pgtype.UUID),
+		BrandKitID:          args[1].(pgtype.UUID),
+		GenerationJobID:     args[2].(pgtype.UUID),
+		Operation:           args[3].(string),
+		Provider:            args[4].(string),
+		Model:               args[5].(string),
+		PromptTokens:        args[6].(int32),
+		ResponseTokens:      args[7].(int32),
+		LatencyMs:           args[8].(int32),
+		Retries:             args[9].(int32),
+		Succeeded:           args[10].(bool),
+		Error:               args[11].(pgtype.Text),
+		EstimatedCostMicros: args[12].(int64),
+	})
+	return pgconn.NewCommandTag("INSERT 0 1"), nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return nil
+}
+
+func TestPriceOf(t *testing.T) {
+	tests := []struct {
+		model string
+		price Price
+		found bool
+	}{
+		{model: "gemini-2.5-flash", price: PRICES["gemini-2.5-flash"], found: true},
+		{model: "gemini-2.5-flash-lite", price: PRICES["gemini-2.5-flash-lite"], found: true},
+		{model: "gemini-2.5-flash-lite-preview-06-17", price: PRICES["gemini-2.5-flash-lite"], found: true},
+		{model: "gemini-2.5-flash-001", price: PRICES["gemini-2.5-flash"], found: true},
+		{model: "gemini-2.5-pro", price: PRICES["gemini-2.5-pro"], found: true},
+		{model: "fake"},
+		{model: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, found := PriceOf(tt.model)
+			if price != tt.price || found != tt.found {
+				t.Errorf("PriceOf(%q) = %v, %v; want %v, %v", tt.model, price, found, tt.price, tt.found)
+			}
+		})
+	}
+}
+
+func TestCostMicros(t *testing.T) {
+	tests := []struct {
+		name  string
+		model string
+		usage llm.Usage
+		want  int64
+	}{
+		{name: "prompt and response", model: "gemini-2.5-flash", usage: llm.Usage{PromptTokens: 1000, ResponseTokens: 200}, want: 300 + 500},
+		{name: "a million tokens cost the list price", model: "gemini-2.5-pro", usage: llm.Usage{PromptTokens: 1_000_000, ResponseTokens: 1_000_000}, want: 11_250_000},
+		{name: "fractions are rounded", model: "gemini-2.0-flash-lite", usage: llm.Usage{PromptTokens: 10}, want: 1},
+		{name: "unpriced models are free", model: "fake", usage: llm.Usage{PromptTokens: 1000, ResponseTokens: 1000}},
+		{name: "no usage", model: "gemini-2.5-flash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CostMicros(tt.model, tt.usage); got != tt.want {
+				t.Errorf("CostMicros() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	attribution := Attribution{
+		WorkspaceID: pgtype.UUID{Bytes: [16]byte{1}, Valid: true},
+		BrandKitID:  pgtype.UUID{Bytes: [16]byte{2}, Valid: true},
+		JobID:       pgtype.UUID{Bytes: [16]byte{3}, Valid: true},
+	}
+
+	tests := []struct {
+		name string
+		// attempts are the responses to each request to the model.
+		attempts []llm.Response
+		err      error
+		want     []db.CreateModelCallParams
+	}{
+		{
+			name:     "a call that never reached the model is not recorded",
+			attempts: nil,
+			err:      errors.New("unable to download the image"),
+		},
+		{
+			name:     "a successful call",
+			attempts: []llm.Response{{Model: "gemini-2.5-flash-001", Usage: llm.Usage{PromptTokens: 1000, ResponseTokens: 200}}},
+			want: []db.CreateModelCallParams{{
+				WorkspaceID:         attribution.WorkspaceID,
+				BrandKitID:          attribution.BrandKitID,
+				GenerationJobID:     attribution.JobID,
+				Operation:           OPERATION_GENERATE_LAYOUT,
+				Provider:            "gemini",
+				Model:               "gemini-2.5-flash-001",
+				PromptTokens:        1000,
+				ResponseTokens:      200,
+				LatencyMs:           1500,
+				Succeeded:           true,
+				EstimatedCostMicros: 800,
+			}},
+		},
+		{
+			name: "retries add up and the error is kept",
+			attempts: []llm.Response{
+				{Model: "gemini-2.5-flash-001", Usage: llm.Usage{PromptTokens: 1000, ResponseTokens: 200}},
+				{},
+				{Model: "gemini-2.5-flash-001", Usage: llm.Usage{PromptTokens: 1000, ResponseTokens: 200}},
+			},
+			err: errors.New("all retries failed"),
+			want: []db.CreateModelCallParams{{
+				WorkspaceID:         attribution.WorkspaceID,
+				BrandKitID:          attribution.BrandKitID,
+				GenerationJobID:     attribution.JobID,
+				Operation:           OPERATION_GENERATE_LAYOUT,
+				Provider:            "gemini",
+				Model:               "gemini-2.5-flash-001",
+				PromptTokens:        2000,
+				ResponseTokens:      400,
+				LatencyMs:           4500,
+				Retries:             2,
+				Error:               pgtype.Text{String: "all retries failed", Valid: true},
+				EstimatedCostMicros: 1600,
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDB{}
+			call := Call{Operation: OPERATION_GENERATE_LAYOUT, Provider: "gemini", Model: "gemini-2.5-flash"}
+			for _, response := range tt.attempts {
+				call.Attempt(response, 1500*time.Millisecond)
+			}
+
+			// The request that made the call may be gone by the time it is
+			// recorded.
+			ctx, cancel := context.WithCancel(WithAttribution(context.Background(), attribution))
+			cancel()
+
+			if err := Record(ctx, db.New(fake), call, tt.err); err != nil {
+				t.Fatalf("Record(): %v", err)
+			}
+			if !reflect.DeepEqual(fake.calls, tt.want) {
+				t.Errorf("recorded %+v, want %+v", fake.calls, tt.want)
+			}
+			if fake.ctx_err != nil {
+				t.Errorf("the call was written with a context that is done: %v", fake.ctx_err)
+			}
+		})
+	}
+}
+
+func TestAttributionFrom(t *testing.T) {
+	if got := AttributionFrom(context.Background()); got != (Attribution{}) {
+		t.Errorf("AttributionFrom() without an attribution = %+v, want none", got)
+	}
+
+	want := Attribution{WorkspaceID: pgtype.UUID{Bytes: [16]byte{1}, Valid: true}}
+	if got := AttributionFrom(WithAttribution(context.Background(), want)); got != want {
+		t.Errorf("AttributionFrom() = %+v, want %+v", got, want)
+	}
+}
@@ -1,19 +1,15 @@
 package api
 
 import (
+	"canvas-backend/auth"
 	"canvas-backend/handlers"
-	"canvas-backend/internal/db"
+	"net/http"
 
-	"github.com/cloudinary/cloudinary-go/v2"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/jackc/pgx/v5/pgxpool"
-	"google.golang.org/genai"
 )
 
-func NewRouter(pool *pgxpool.Pool, queries *db.Queries, cld *cloudinary.Cloudinary, gemini_client *genai.Client) *chi.Mux {
-	h := handlers.New(pool, queries, cld, gemini_client)
-
+func NewRouter(h *handlers.APIState) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
@@ -21,13 +17,77 @@ func NewRouter(pool *pgxpool.Pool, queries *db.Queries, cld *cloudinary.Cloudina
 	r.Use(middleware.Recoverer)
 
 	r.Get("/ping", h.PingHandler)
-	r.Get("/brand-kit/{kit_id}", h.HandleGetBrandKit)
-	r.Get("/brand-kits", h.HandleListBrandKits)
-	r.Post("/upload-logo", h.HandleUploadLogo)
-	r.Post("/upload-product", h.HandleUploadProductImage)
-	r.Post("/create-brand-kit", h.HandleCreateBrandKit)
-	r.Post("/brand-kit/{kit_id}/generate", h.HandleGenerateLayout)
-	r.Post("/export-image", h.HandleExport)
+
+	// Everything else needs an API key, or for GET requests a session token,
+	// and only sees the key's workspace.
+	r.Group(func(r chi.Router) {
+		r.Use(auth.Middleware(h.Queries))
+
+		r.Get("/me", h.HandleGetMe)
+		r.Post("/workspaces", h.HandleCreateWorkspace)
+		r.Get("/workspace/members", h.HandleListWorkspaceMembers)
+		r.With(auth.RequireAdmin).Post("/workspace/members", h.HandleAddWorkspaceMember)
+		r.With(auth.RequireAdmin).Delete("/workspace/members/{user_id}", h.HandleRemoveWorkspaceMember)
+		r.With(auth.RequireAdmin).Put("/workspace/members/{user_id}/approval-roles", h.HandleSetApprovalRoles)
+		r.Get("/api-keys", h.HandleListAPIKeys)
+		r.Post("/api-keys", h.HandleCreateAPIKey)
+		r.Delete("/api-keys/{key_id}", h.HandleRevokeAPIKey)
+		r.Post("/session-tokens", h.HandleCreateSessionToken)
+		r.With(auth.RequireAdmin).Put("/api-keys/{key_id}/limits", h.HandleSetAPIKeyLimits)
+		r.Get("/workspace/usage", h.HandleGetUsage)
+		r.With(auth.RequireAdmin).Put("/workspace/limits", h.HandleSetWorkspaceLimits)
+		r.With(auth.RequireAdmin).Get("/workspace/model-usage", h.HandleModelUsageReport)
+		r.With(auth.RequireAdmin).Get("/audit", h.HandleListAuditEvents)
+		r.Get("/prompts", h.HandleListPrompts)
+		r.Get("/prompts/{name}/versions", h.HandleListPromptVersions)
+		r.Get("/prompts/{name}/versions/{version}", h.HandleGetPromptVersion)
+		r.With(auth.RequireAdmin).Post("/prompts/{name}/versions", h.HandlePublishPrompt)
+		r.With(auth.RequireAdmin).Put("/prompts/{name}/active", h.HandleActivatePrompt)
+		r.Get("/static-assets", h.HandleListStaticAssets)
+		r.Get("/formats", h.HandleListFormats)
+		r.With(auth.RequireAdmin).Post("/formats", h.HandleCreateFormat)
+		r.With(auth.RequireAdmin).Delete("/formats/{format_id}", h.HandleDeleteFormat)
+		r.With(auth.RequireAdmin).Put("/static-assets/{key}", h.HandleReplaceStaticAsset)
+
+		r.Get("/brand-kit/{kit_id}", h.HandleGetBrandKit)
+		r.Put("/brand-kit/{kit_id}", h.HandleUpdateBrandKit)
+		r.Patch("/brand-kit/{kit_id}", h.HandlePatchBrandKit)
+		r.Delete("/brand-kit/{kit_id}", h.HandleDeleteBrandKit)
+		r.Get("/brand-kits", h.HandleListBrandKits)
+		r.Post("/upload-logo", h.HandleUploadLogo)
+		r.Post("/upload-product", h.HandleUploadProductImage)
+		r.Post("/create-brand-kit", h.HandleCreateBrandKit)
+		r.Post("/brand-kit/{kit_id}/generate", h.HandleGenerateLayout)
+		r.Get("/brand-kit/{kit_id}/generate/stream", h.HandleGenerateStream)
+		r.Post("/brand-kit/{kit_id}/images", h.HandleAddProductImage)
+		r.Patch("/brand-kit/{kit_id}/images", h.HandlePatchProductImages)
+		r.Delete("/brand-kit/{kit_id}/images/{image_id}", h.HandleDeleteProductImage)
+		r.Post("/brand-kit/{kit_id}/image-descriptions/refresh", h.HandleRefreshImageDescriptions)
+		r.Get("/brand-kit/{kit_id}/prompts", h.HandleListBrandKitPrompts)
+		r.With(auth.RequireAdmin).Put("/brand-kit/{kit_id}/prompts/{name}", h.HandlePinBrandKitPrompt)
+		r.With(auth.RequireAdmin).Delete("/brand-kit/{kit_id}/prompts/{name}", h.HandleUnpinBrandKitPrompt)
+		r.Post("/brand-kit/{kit_id}/designs", h.HandleCreateDesign)
+		r.Get("/brand-kit/{kit_id}/designs", h.HandleListDesigns)
+		r.Get("/designs/{design_id}", h.HandleGetDesign)
+		r.Put("/designs/{design_id}", h.HandleSaveDesign)
+		r.Get("/designs/{design_id}/versions", h.HandleListDesignVersions)
+		r.Get("/designs/{design_id}/versions/{version}", h.HandleGetDesignVersion)
+		r.Post("/designs/{design_id}/versions/{version}/restore", h.HandleRestoreDesignVersion)
+		r.Get("/designs/{design_id}/diff", h.HandleDiffDesignVersions)
+		r.Post("/designs/{design_id}/transitions", h.HandleTransitionDesign)
+		r.Get("/designs/{design_id}/reviews", h.HandleListDesignReviews)
+		r.Post("/export-image", h.HandleExport)
+		r.Post("/validate", h.HandleValidate)
+		r.Post("/render", h.HandleRender)
+		r.Get("/jobs/{job_id}", h.HandleGetJob)
+		r.Post("/jobs/{job_id}/cancel", h.HandleCancelJob)
+	})
+
+	// Backends that keep assets themselves, like the local store, serve them.
+	if server, ok := h.Assets.(http.Handler); ok {
+		r.Method(http.MethodGet, "/assets/*", server)
+		r.Method(http.MethodHead, "/assets/*", server)
+	}
 
 	return r
 }
@@ -0,0 +1,175 @@
+// Package audit records who changed what. An event is written through the
+// same queries, and so in the same transaction, as the change it describes;
+// the table itself rejects updates and deletes.
+package audit
+
+import (
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	ACTION_BRAND_KIT_CREATE       = "brand_kit.create"
+	ACTION_BRAND_KIT_UPDATE       = "brand_kit.update"
+	ACTION_BRAND_KIT_DELETE       = "brand_kit.delete"
+	ACTION_BRAND_KIT_PROMPT_PIN   = "brand_kit.prompt_pin"
+	ACTION_BRAND_KIT_PROMPT_UNPIN = "brand_kit.prompt_unpin"
+
+	ACTION_PRODUCT_IMAGE_CREATE   = "product_image.create"
+	ACTION_PRODUCT_IMAGE_UPDATE   = "product_image.update"
+	ACTION_PRODUCT_IMAGE_DELETE   = "product_image.delete"
+	ACTION_PRODUCT_IMAGE_DESCRIBE = "product_image.describe"
+
+	ACTION_ASSET_UPLOAD = "asset.upload"
+
+	ACTION_GENERATION_ENQUEUE = "generation.enqueue"
+	ACTION_GENERATION_STREAM  = "generation.stream"
+	ACTION_GENERATION_CANCEL  = "generation.cancel"
+
+	ACTION_DESIGN_CREATE     = "design.create"
+	ACTION_DESIGN_SAVE       = "design.save"
+	ACTION_DESIGN_RESTORE    = "design.restore"
+	ACTION_DESIGN_TRANSITION = "design.transition"
+	ACTION_DESIGN_EXPORT     = "design.export"
+
+	ACTION_WORKSPACE_CREATE      = "workspace.create"
+	ACTION_WORKSPACE_LIMITS      = "workspace.limits"
+	ACTION_MEMBER_ADD            = "member.add"
+	ACTION_MEMBER_REMOVE         = "member.remove"
+	ACTION_MEMBER_APPROVAL_ROLES = "member.approval_roles"
+	ACTION_API_KEY_CREATE        = "api_key.create"
+	ACTION_API_KEY_REVOKE        = "api_key.revoke"
+	ACTION_API_KEY_LIMITS        = "api_key.limits"
+
+	ACTION_PROMPT_PUBLISH  = "prompt.publish"
+	ACTION_PROMPT_ACTIVATE = "prompt.activate"
+
+	ACTION_STATIC_ASSET_REPLACE = "static_asset.replace"
+
+	ACTION_FORMAT_CREATE = "format.create"
+	ACTION_FORMAT_DELETE = "format.delete"
+)
+
+const (
+	TARGET_BRAND_KIT      = "brand_kit"
+	TARGET_PRODUCT_IMAGE  = "product_image"
+	TARGET_ASSET          = "asset"
+	TARGET_GENERATION_JOB = "generation_job"
+	TARGET_DESIGN         = "design"
+	TARGET_WORKSPACE      = "workspace"
+	TARGET_USER           = "user"
+	TARGET_API_KEY        = "api_key"
+	TARGET_PROMPT         = "prompt_template"
+	TARGET_STATIC_ASSET   = "static_asset"
+	TARGET_FORMAT         = "layout_format"
+)
+
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   pgtype.UUID
+	// WorkspaceID defaults to the workspace of the actor's API key.
+	WorkspaceID pgtype.UUID
+	// Before and After are the target's state around the change, as it is
+	// returned by the API. Either is nil when there is nothing to show.
+	Before any
+	After  any
+}
+
+// Change is one top-level field that differs between Before and After.
+type Change struct {
+	Field string `json:"field"`
+	From  any    `json:"from,omitempty"`
+	To    any    `json:"to,omitempty"`
+}
+
+// Record writes the event, attributed to the principal and request id in
+// ctx. Pass queries bound to the transaction of the change.
+func Record(ctx context.Context, queries *db.Queries, event Event) error {
+	principal, _ := auth.FromContext(ctx)
+	if !event.WorkspaceID.Valid {
+		event.WorkspaceID = principal.WorkspaceID
+	}
+
+	before_json, err := marshal(event.Before)
+	if err != nil {
+		return err
+	}
+	after_json, err := marshal(event.After)
+	if err != nil {
+		return err
+	}
+	changes_json, err := json.Marshal(Diff(before_json, after_json))
+	if err != nil {
+		return err
+	}
+
+	return queries.CreateAuditEvent(ctx, db.CreateAuditEventParams{
+		WorkspaceID: event.WorkspaceID,
+		ActorUserID: principal.UserID,
+		ActorEmail:  principal.Email,
+		ApiKeyID:    principal.APIKeyID,
+		Action:      event.Action,
+		TargetType:  event.TargetType,
+		TargetID:    event.TargetID,
+		RequestID:   middleware.GetReqID(ctx),
+		BeforeJson:  before_json,
+		AfterJson:   after_json,
+		ChangesJson: changes_json,
+	})
+}
+
+func marshal(value any) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// Diff compares two JSON documents field by field. Objects are compared at
+// the top level only; anything else counts as a single "value" field.
+func Diff(before, after []byte) []Change {
+	before_fields, after_fields := fields(before), fields(after)
+
+	names := map[string]bool{}
+	for name := range before_fields {
+		names[name] = true
+	}
+	for name := range after_fields {
+		names[name] = true
+	}
+	ordered := make([]string, 0, len(names))
+	for name := range names {
+		ordered = append(ordered, name)
+	}
+	sort.Strings(ordered)
+
+	changes := []Change{}
+	for _, name := range ordered {
+		from, to := before_fields[name], after_fields[name]
+		if !reflect.DeepEqual(from, to) {
+			changes = append(changes, Change{Field: name, From: from, To: to})
+		}
+	}
+	return changes
+}
+
+func fields(document []byte) map[string]any {
+	if document == nil {
+		return map[string]any{}
+	}
+	var object map[string]any
+	if err := json.Unmarshal(document, &object); err == nil {
+		return object
+	}
+	var value any
+	json.Unmarshal(document, &value)
+	return map[string]any{"value": value}
+}
@@ -0,0 +1,268 @@
+// Package auth authenticates API requests by API key. Every key belongs to
+// a user and a workspace, and the workspace scopes everything the request
+// can see. Session tokens are short-lived stand-ins for a key, for clients
+// such as EventSource that cannot set headers.
+package auth
+
+import (
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	ROLE_OWNER  = "owner"
+	ROLE_ADMIN  = "admin"
+	ROLE_MEMBER = "member"
+)
+
+const (
+	// KEY_PREFIX marks our keys so they are easy to spot in leaked configs.
+	KEY_PREFIX = "cvk_"
+	// The first characters of a key are kept in clear to tell keys apart.
+	DISPLAY_PREFIX_LENGTH = 12
+	// last_used_at is only written when it is older than this.
+	TOUCH_INTERVAL = time.Minute
+	// SESSION_TOKEN_PREFIX marks session tokens, which may be sent in the
+	// access_token query parameter, unlike keys.
+	SESSION_TOKEN_PREFIX = "cvs_"
+	SESSION_TOKEN_TTL    = 10 * time.Minute
+)
+
+// Principal is who a request acts as.
+type Principal struct {
+	UserID      pgtype.UUID
+	WorkspaceID pgtype.UUID
+	APIKeyID    pgtype.UUID
+	Email       string
+	Role        string
+	// ApprovalRoles are the member's roles in the design approval workflow.
+	ApprovalRoles []string
+}
+
+// CanAdminister reports whether the principal may manage members and keys.
+func (p Principal) CanAdminister() bool {
+	return p.Role == ROLE_OWNER || p.Role == ROLE_ADMIN
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the principal set by Middleware.
+func FromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// GenerateKey returns a new key, which is shown to its owner once, and the
+// hash that is stored in its place.
+func GenerateKey() (key string, hash string, err error) {
+	return generateSecret(KEY_PREFIX)
+}
+
+func generateSecret(prefix string) (secret string, hash string, err error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", "", err
+	}
+	secret = prefix + hex.EncodeToString(random)
+	return secret, HashKey(secret), nil
+}
+
+// HashKey hashes a key for storage and lookup. Keys are long and random, so
+// a fast hash is enough; a slow one would only slow down every request.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix is the part of a key that is safe to show.
+func DisplayPrefix(key string) string {
+	if len(key) < DISPLAY_PREFIX_LENGTH {
+		return key
+	}
+	return key[:DISPLAY_PREFIX_LENGTH]
+}
+
+// keyFromRequest reads the key from "Authorization: Bearer <key>" or from
+// the X-API-Key header. A session token may also come in the access_token
+// query parameter; keys may not, as URLs end up in logs.
+func keyFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+	if token := r.URL.Query().Get("access_token"); strings.HasPrefix(token, SESSION_TOKEN_PREFIX) {
+		return token
+	}
+	return ""
+}
+
+// lookupPrincipal finds who key, an API key or a session token, acts as.
+// Session tokens only authenticate GET requests, so a leaked one cannot be
+// used to issue keys or change anything.
+func lookupPrincipal(r *http.Request, queries *db.Queries, key string) (db.GetAPIKeyPrincipalRow, error) {
+	if !strings.HasPrefix(key, SESSION_TOKEN_PREFIX) {
+		return queries.GetAPIKeyPrincipal(r.Context(), HashKey(key))
+	}
+	if r.Method != http.MethodGet {
+		return db.GetAPIKeyPrincipalRow{}, pgx.ErrNoRows
+	}
+	row, err := queries.GetSessionTokenPrincipal(r.Context(), HashKey(key))
+	return db.GetAPIKeyPrincipalRow(row), err
+}
+
+// Middleware rejects requests without a valid key and puts the principal
+// of the ones it lets through in the request context.
+func Middleware(queries *db.Queries) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyFromRequest(r)
+			if key == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="canvas"`)
+				writeError(w, http.StatusUnauthorized, "ERROR: An API key is required")
+				return
+			}
+
+			row, err := lookupPrincipal(r, queries, key)
+			if err != nil {
+				if errors.Is(err, pgx.ErrNoRows) {
+					w.Header().Set("WWW-Authenticate", `Bearer realm="canvas", error="invalid_token"`)
+					writeError(w, http.StatusUnauthorized, "ERROR: Invalid, expired or revoked API key")
+				} else {
+					log.Printf("ERROR: Something went wrong while checking the API key, error: %v\n", err)
+					writeError(w, http.StatusInternalServerError, "ERROR: Something went wrong")
+				}
+				return
+			}
+
+			if !row.LastUsedAt.Valid || time.Since(row.LastUsedAt.Time) > TOUCH_INTERVAL {
+				if err := queries.TouchAPIKey(r.Context(), row.ID); err != nil {
+					log.Printf("WARN: Unable to record the use of API key %x, error: %v\n", row.ID.Bytes, err)
+				}
+			}
+
+			principal := Principal{
+				UserID:        row.UserID,
+				WorkspaceID:   row.WorkspaceID,
+				APIKeyID:      row.ID,
+				Email:         row.Email,
+				Role:          row.Role,
+				ApprovalRoles: row.ApprovalRoles,
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequireAdmin lets through only workspace owners and admins.
+func RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := FromContext(r.Context())
+		if !ok || !principal.CanAdminister() {
+			writeError(w, http.StatusForbidden, "ERROR: Only workspace owners and admins can do this")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CreateWorkspace creates a workspace owned by the user and a first key
+// for it. queries should be bound to a transaction.
+func CreateWorkspace(ctx context.Context, queries *db.Queries, name string, owner pgtype.UUID) (db.Workspace, string, error) {
+	workspace, err := queries.CreateWorkspace(ctx, name)
+	if err != nil {
+		return db.Workspace{}, "", err
+	}
+
+	key, err := ClaimWorkspace(ctx, queries, workspace.ID, owner)
+	if err != nil {
+		return db.Workspace{}, "", err
+	}
+	return workspace, key, nil
+}
+
+// ClaimWorkspace makes the user an owner of an existing workspace and
+// issues them a first key for it. queries should be bound to a transaction.
+func ClaimWorkspace(ctx context.Context, queries *db.Queries, workspace_id, owner pgtype.UUID) (string, error) {
+	if _, err := queries.AddWorkspaceMember(ctx, db.AddWorkspaceMemberParams{
+		WorkspaceID: workspace_id,
+		UserID:      owner,
+		Role:        ROLE_OWNER,
+	}); err != nil {
+		return "", err
+	}
+
+	key, _, err := CreateKey(ctx, queries, owner, workspace_id, "default")
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// CreateSessionToken issues a session token that acts as the API key until
+// SESSION_TOKEN_TTL has passed, and returns it in clear.
+func CreateSessionToken(ctx context.Context, queries *db.Queries, api_key_id pgtype.UUID) (string, db.SessionToken, error) {
+	token, hash, err := generateSecret(SESSION_TOKEN_PREFIX)
+	if err != nil {
+		return "", db.SessionToken{}, err
+	}
+
+	session, err := queries.CreateSessionToken(ctx, db.CreateSessionTokenParams{
+		ApiKeyID:  api_key_id,
+		TokenHash: hash,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(SESSION_TOKEN_TTL), Valid: true},
+	})
+	if err != nil {
+		return "", db.SessionToken{}, err
+	}
+	return token, session, nil
+}
+
+// CreateKey issues a key for a member of a workspace and returns it in
+// clear, which is the only time it is available.
+func CreateKey(ctx context.Context, queries *db.Queries, user_id, workspace_id pgtype.UUID, name string) (string, db.ApiKey, error) {
+	key, hash, err := GenerateKey()
+	if err != nil {
+		return "", db.ApiKey{}, err
+	}
+
+	api_key, err := queries.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		UserID:      user_id,
+		WorkspaceID: workspace_id,
+		Name:        name,
+		Prefix:      DisplayPrefix(key),
+		KeyHash:     hash,
+	})
+	if err != nil {
+		return "", db.ApiKey{}, err
+	}
+	return key, api_key, nil
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(types.APIResponse{Message: message})
+}
@@ -0,0 +1,260 @@
+package auth
+
+import (
+	"canvas-backend/internal/db"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeDB knows the principals of keys and session tokens by their hashes,
+// and counts the keys whose use was recorded.
+type fakeDB struct {
+	keys    map[string]db.GetAPIKeyPrincipalRow
+	tokens  map[string]db.GetAPIKeyPrincipalRow
+	touched int
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if strings.Contains(sql, "-- name: TouchAPIKey ") {
+		f.touched++
+		return pgconn.CommandTag{}, nil
+	}
+	return pgconn.CommandTag{}, errors.New("unexpected exec")
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	principals := f.keys
+	if strings.Contains(sql, "-- name: GetSessionTokenPrincipal ") {
+		principals = f.tokens
+	}
+	row, ok := principals[args[0].(string)]
+	if !ok {
+		return principalRow{err: pgx.ErrNoRows}
+	}
+	return principalRow{row: row}
+}
+
+type principalRow struct {
+	row db.GetAPIKeyPrincipalRow
+	err error
+}
+
+func (r principalRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*pgtype.UUID) = r.row.ID
+	*dest[1].(*pgtype.UUID) = r.row.UserID
+	*dest[2].(*pgtype.UUID) = r.row.WorkspaceID
+	*dest[3].(*pgtype.Timestamptz) = r.row.LastUsedAt
+	*dest[4].(*string) = r.row.Email
+	*dest[5].(*string) = r.row.Role
+	*dest[6].(*[]string) = r.row.ApprovalRoles
+	return nil
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, hash, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey(): %v", err)
+	}
+	if !strings.HasPrefix(key, KEY_PREFIX) || len(key) != len(KEY_PREFIX)+64 {
+		t.Errorf("key %q is not %s followed by 64 hex digits", key, KEY_PREFIX)
+	}
+	if hash != HashKey(key) {
+		t.Errorf("hash = %q, want HashKey(key) = %q", hash, HashKey(key))
+	}
+	if strings.Contains(hash, key[len(KEY_PREFIX):]) {
+		t.Error("the hash contains the key")
+	}
+	if DisplayPrefix(key) != key[:DISPLAY_PREFIX_LENGTH] {
+		t.Errorf("DisplayPrefix() = %q, want the first %d characters", DisplayPrefix(key), DISPLAY_PREFIX_LENGTH)
+	}
+
+	other, _, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey(): %v", err)
+	}
+	if other == key {
+		t.Error("GenerateKey() returned the same key twice")
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	// The hash is stored, so it must never change for a given key.
+	const want = "fad515238943df4a9702eea54538265af09ce63c949b239c2baeb50339d66896"
+	if got := HashKey("cvk_test"); got != want {
+		t.Errorf("HashKey() = %q, want %q", got, want)
+	}
+	if HashKey("cvk_test") == HashKey("cvk_tesT") {
+		t.Error("different keys have the same hash")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	member := db.GetAPIKeyPrincipalRow{
+		ID:          pgtype.UUID{Bytes: [16]byte{1}, Valid: true},
+		UserID:      pgtype.UUID{Bytes: [16]byte{2}, Valid: true},
+		WorkspaceID: pgtype.UUID{Bytes: [16]byte{3}, Valid: true},
+		LastUsedAt:  pgtype.Timestamptz{Time: time.Now(), Valid: true},
+		Email:       "member@example.com",
+		Role:        ROLE_MEMBER,
+	}
+	stale := member
+	stale.LastUsedAt = pgtype.Timestamptz{Time: time.Now().Add(-time.Hour), Valid: true}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		header  http.Header
+		status  int
+		touched int
+	}{
+		{
+			name:   "bearer key",
+			method: http.MethodPost,
+			target: "/",
+			header: http.Header{"Authorization": {"Bearer cvk_member"}},
+			status: http.StatusOK,
+		},
+		{
+			name:   "X-API-Key header",
+			method: http.MethodGet,
+			target: "/",
+			header: http.Header{"X-Api-Key": {"cvk_member"}},
+			status: http.StatusOK,
+		},
+		{
+			name:    "stale last use is recorded",
+			method:  http.MethodGet,
+			target:  "/",
+			header:  http.Header{"Authorization": {"Bearer cvk_stale"}},
+			status:  http.StatusOK,
+			touched: 1,
+		},
+		{
+			name:   "no key",
+			method: http.MethodGet,
+			target: "/",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "other authorization scheme",
+			method: http.MethodGet,
+			target: "/",
+			header: http.Header{"Authorization": {"Basic cvk_member"}},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "unknown or revoked key",
+			method: http.MethodGet,
+			target: "/",
+			header: http.Header{"Authorization": {"Bearer cvk_revoked"}},
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "key in the query is refused",
+			method: http.MethodGet,
+			target: "/?access_token=cvk_member",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "session token in the query",
+			method: http.MethodGet,
+			target: "/?access_token=cvs_session",
+			status: http.StatusOK,
+		},
+		{
+			name:   "session tokens only authenticate GET",
+			method: http.MethodPost,
+			target: "/?access_token=cvs_session",
+			status: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDB{
+				keys: map[string]db.GetAPIKeyPrincipalRow{
+					HashKey("cvk_member"): member,
+					HashKey("cvk_stale"):  stale,
+				},
+				tokens: map[string]db.GetAPIKeyPrincipalRow{
+					HashKey("cvs_session"): member,
+				},
+			}
+
+			var got Principal
+			handler := Middleware(db.New(fake))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = FromContext(r.Context())
+			}))
+
+			request := httptest.NewRequest(tt.method, tt.target, nil)
+			for name, values := range tt.header {
+				request.Header[name] = values
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if fake.touched != tt.touched {
+				t.Errorf("recorded the key's use %d times, want %d", fake.touched, tt.touched)
+			}
+			if tt.status != http.StatusOK {
+				if recorder.Header().Get("WWW-Authenticate") == "" {
+					t.Error("a refused request has no WWW-Authenticate header")
+				}
+				return
+			}
+			if got.WorkspaceID != member.WorkspaceID || got.UserID != member.UserID || got.Role != member.Role {
+				t.Errorf("principal = %+v, want the member's", got)
+			}
+		})
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		status    int
+	}{
+		{name: "owner", principal: &Principal{Role: ROLE_OWNER}, status: http.StatusOK},
+		{name: "admin", principal: &Principal{Role: ROLE_ADMIN}, status: http.StatusOK},
+		{name: "member", principal: &Principal{Role: ROLE_MEMBER}, status: http.StatusForbidden},
+		{name: "no principal", status: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := RequireAdmin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			request := httptest.NewRequest(http.MethodPost, "/workspace/members", nil)
+			if tt.principal != nil {
+				request = request.WithContext(WithPrincipal(request.Context(), *tt.principal))
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+		})
+	}
+}
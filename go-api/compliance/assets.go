@@ -0,0 +1,138 @@
+package compliance
+
+import (
+	"canvas-backend/types"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	RULE_STATIC_ASSET     = "STATIC_ASSET"
+	RULE_UNKNOWN_ASSET    = "UNKNOWN_ASSET"
+	RULE_ASSET_FORMAT     = "ASSET_FORMAT"
+	RULE_ASSET_DISTORTION = "ASSET_DISTORTION"
+)
+
+const ACTION_RESOLVE_ASSET = "resolve_asset"
+
+// ASSET_KEY_PREFIX starts every static asset key, e.g. ASSET_DRINKAWARE.
+const ASSET_KEY_PREFIX = "ASSET_"
+
+// Static assets drawn more than this far from their own aspect ratio are
+// reported as distorted.
+const MAX_ASSET_DISTORTION = 0.02
+
+// StaticAsset is a fixed compliance image, such as the Drinkaware logo,
+// that prompts and layouts refer to by key instead of by URL.
+type StaticAsset struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+	// Width and Height are the intrinsic size, 0 until it has been measured.
+	Width  int32 `json:"width,omitempty"`
+	Height int32 `json:"height,omitempty"`
+	// Formats the asset may be placed in; empty means any.
+	Formats  []string `json:"formats"`
+	Retailer string   `json:"retailer"`
+}
+
+func (a StaticAsset) AllowedIn(format string) bool {
+	return len(a.Formats) == 0 || slices.Contains(a.Formats, format)
+}
+
+// StaticAssets are the assets available to a layout, by key.
+type StaticAssets map[string]StaticAsset
+
+// ByURL finds the asset served from url.
+func (s StaticAssets) ByURL(url string) (StaticAsset, bool) {
+	for _, asset := range s {
+		if asset.URL == url {
+			return asset, true
+		}
+	}
+	return StaticAsset{}, false
+}
+
+// Sorted lists the assets by key.
+func (s StaticAssets) Sorted() []StaticAsset {
+	assets := make([]StaticAsset, 0, len(s))
+	for _, asset := range s {
+		assets = append(assets, asset)
+	}
+	slices.SortFunc(assets, func(a, b StaticAsset) int { return strings.Compare(a.Key, b.Key) })
+	return assets
+}
+
+// ResolveAssets replaces asset keys used as image URLs with the assets'
+// URLs, and gives images without a height the asset's aspect ratio.
+func ResolveAssets(format string, fl *types.FormatLayout, assets StaticAssets) []Change {
+	changes := []Change{}
+	for i := range fl.Elements {
+		el := &fl.Elements[i]
+		if el.Type != types.ElementImage {
+			continue
+		}
+		asset, ok := assets[el.URL]
+		if !ok {
+			continue
+		}
+
+		el.URL = asset.URL
+		message := fmt.Sprintf("Resolved %s to its URL", asset.Key)
+		if el.Height == 0 && el.Width > 0 && asset.Width > 0 && asset.Height > 0 {
+			el.Height = math.Round(el.Width * float64(asset.Height) / float64(asset.Width))
+			message += fmt.Sprintf(" and its height to %gpx", el.Height)
+		}
+		changes = append(changes, Change{
+			Format:     format,
+			ElementIDs: []string{el.ID},
+			Rule:       RULE_STATIC_ASSET,
+			Action:     ACTION_RESOLVE_ASSET,
+			Message:    message,
+		})
+	}
+	return changes
+}
+
+// ValidateAssets checks the static assets a format places: every key must
+// have been resolved, each asset must be allowed in the format and it must
+// not be stretched.
+func ValidateAssets(format string, fl *types.FormatLayout, assets StaticAssets) []Violation {
+	violations := []Violation{}
+	add := func(el types.Element, rule, severity, message string) {
+		violations = append(violations, Violation{
+			Format:    format,
+			ElementID: el.ID,
+			Rule:      rule,
+			Severity:  severity,
+			Message:   message,
+		})
+	}
+
+	for _, el := range fl.Elements {
+		if el.Type != types.ElementImage {
+			continue
+		}
+		if strings.HasPrefix(el.URL, ASSET_KEY_PREFIX) {
+			add(el, RULE_UNKNOWN_ASSET, SEVERITY_ERROR, fmt.Sprintf("No static asset named %s", el.URL))
+			continue
+		}
+
+		asset, ok := assets.ByURL(el.URL)
+		if !ok {
+			continue
+		}
+		if !asset.AllowedIn(format) {
+			add(el, RULE_ASSET_FORMAT, SEVERITY_ERROR, fmt.Sprintf("%s is not allowed in %s", asset.Key, format))
+		}
+		if asset.Width > 0 && asset.Height > 0 && el.Width > 0 && el.Height > 0 {
+			drawn := el.Width / el.Height
+			intrinsic := float64(asset.Width) / float64(asset.Height)
+			if math.Abs(drawn/intrinsic-1) > MAX_ASSET_DISTORTION {
+				add(el, RULE_ASSET_DISTORTION, SEVERITY_WARNING, fmt.Sprintf("%s is stretched away from its %dx%d aspect ratio", asset.Key, asset.Width, asset.Height))
+			}
+		}
+	}
+	return violations
+}
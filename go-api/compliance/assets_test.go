@@ -0,0 +1,77 @@
+package compliance
+
+import (
+	"canvas-backend/types"
+	"reflect"
+	"testing"
+)
+
+const FORMAT_PORTRAIT_POST = "portrait_post"
+
+func TestValidateAssets(t *testing.T) {
+	assets := StaticAssets{
+		"ASSET_LEP_LOGO":   {Key: "ASSET_LEP_LOGO", URL: "https://cdn.example.com/lep.png", Width: 200, Height: 100},
+		"ASSET_DRINKAWARE": {Key: "ASSET_DRINKAWARE", URL: "https://cdn.example.com/drinkaware.png", Formats: []string{FORMAT_INSTAGRAM_POST}},
+	}
+	image := func(url string, width, height float64) types.Element {
+		return types.Element{Type: types.ElementImage, URL: url, Width: width, Height: height}
+	}
+
+	tests := []struct {
+		name     string
+		format   string
+		elements []types.Element
+		rules    []string
+	}{
+		{
+			name:     "asset allowed anywhere in a built-in format",
+			format:   FORMAT_INSTAGRAM_STORY,
+			elements: []types.Element{image("https://cdn.example.com/lep.png", 200, 100)},
+		},
+		{
+			name:     "asset allowed anywhere in a custom format",
+			format:   FORMAT_PORTRAIT_POST,
+			elements: []types.Element{image("https://cdn.example.com/lep.png", 200, 100)},
+		},
+		{
+			name:     "restricted asset in its format",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{image("https://cdn.example.com/drinkaware.png", 150, 50)},
+		},
+		{
+			name:     "restricted asset in a custom format",
+			format:   FORMAT_PORTRAIT_POST,
+			elements: []types.Element{image("https://cdn.example.com/drinkaware.png", 150, 50)},
+			rules:    []string{RULE_ASSET_FORMAT},
+		},
+		{
+			name:     "unresolved key",
+			format:   FORMAT_PORTRAIT_POST,
+			elements: []types.Element{image("ASSET_MISSING", 100, 100)},
+			rules:    []string{RULE_UNKNOWN_ASSET},
+		},
+		{
+			name:     "stretched asset",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{image("https://cdn.example.com/lep.png", 200, 200)},
+			rules:    []string{RULE_ASSET_DISTORTION},
+		},
+		{
+			name:     "other images are not assets",
+			format:   FORMAT_PORTRAIT_POST,
+			elements: []types.Element{image("https://cdn.example.com/product.png", 500, 500)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules []string
+			for _, violation := range ValidateAssets(tt.format, &types.FormatLayout{Width: 1080, Height: 1350, Elements: tt.elements}, assets) {
+				rules = append(rules, violation.Rule)
+			}
+			if !reflect.DeepEqual(rules, tt.rules) {
+				t.Errorf("ValidateAssets() rules = %v, want %v", rules, tt.rules)
+			}
+		})
+	}
+}
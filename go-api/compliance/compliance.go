@@ -0,0 +1,197 @@
+package compliance
+
+import (
+	"canvas-backend/types"
+	"fmt"
+	"sort"
+)
+
+const (
+	SEVERITY_ERROR   = "error"
+	SEVERITY_WARNING = "warning"
+)
+
+const (
+	RULE_SAFE_ZONE_TOP    = "SAFE_ZONE_TOP"
+	RULE_SAFE_ZONE_BOTTOM = "SAFE_ZONE_BOTTOM"
+	RULE_MIN_FONT_SIZE    = "MIN_FONT_SIZE"
+	RULE_OUT_OF_BOUNDS    = "OUT_OF_BOUNDS"
+	RULE_EDGE_MARGIN      = "EDGE_MARGIN"
+	RULE_ELEMENT_OVERLAP  = "ELEMENT_OVERLAP"
+	RULE_MIN_GAP          = "MIN_GAP"
+)
+
+// Spacing rules shared by the fabric_json prompt and the lep engine.
+const (
+	STORY_SAFE_ZONE = 250
+	MIN_GAP         = 24
+	EDGE_MARGIN     = 24
+)
+
+// Measurements within this distance of a limit are treated as on it.
+const TOLERANCE = 0.01
+
+// Platform holds the per-placement rules from canvas-ui ValidationRules.tsx.
+type Platform struct {
+	Name        string  `json:"name"`
+	MinFontSize float64 `json:"min_font_size"`
+}
+
+var PLATFORMS = map[string]Platform{
+	"social":         {Name: "social", MinFontSize: 20},
+	"checkoutSingle": {Name: "checkoutSingle", MinFontSize: 10},
+	"says":           {Name: "says", MinFontSize: 12},
+}
+
+const DEFAULT_PLATFORM = "social"
+
+type Violation struct {
+	Format    string `json:"format"`
+	ElementID string `json:"element_id,omitempty"`
+	Rule      string `json:"rule"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+// LookupPlatform resolves a platform name, defaulting to social when empty.
+func LookupPlatform(name string) (Platform, error) {
+	if name == "" {
+		name = DEFAULT_PLATFORM
+	}
+	platform, ok := PLATFORMS[name]
+	if !ok {
+		return Platform{}, fmt.Errorf("unknown platform %q", name)
+	}
+	return platform, nil
+}
+
+// Validate checks every format of a layout against the platform rules.
+// Formats not in formats are checked with the rules InferFormat gives them.
+// Elements without an id get one assigned so violations can reference them.
+func Validate(layout types.Layout, formats Formats, platform Platform) []Violation {
+	layout.EnsureElementIDs()
+
+	violations := []Violation{}
+	for _, id := range layout.Formats() {
+		violations = append(violations, ValidateFormat(formats.For(id, layout[id]), layout[id], platform)...)
+	}
+	return violations
+}
+
+func ValidateFormat(format Format, fl *types.FormatLayout, platform Platform) []Violation {
+	violations := []Violation{}
+	add := func(el types.Element, rule, severity, message string) {
+		violations = append(violations, Violation{
+			Format:    format.ID,
+			ElementID: el.ID,
+			Rule:      rule,
+			Severity:  severity,
+			Message:   message,
+		})
+	}
+
+	safe_top, safe_bottom := format.SafeZoneTop, format.SafeZoneBottom
+	min_font := format.MinFont(platform)
+
+	for _, el := range fl.Elements {
+		if el.Type == types.ElementText {
+			font_size := EffectiveFontSize(el)
+			if font_size < min_font {
+				add(el, RULE_MIN_FONT_SIZE, SEVERITY_ERROR, fmt.Sprintf("Font size too small (min %gpx)", min_font))
+			}
+
+			if IsCopy(el) {
+				if rule := ValidateCopy(el.Content); rule != nil {
+					add(el, rule.Code, SEVERITY_WARNING, rule.Message)
+				}
+			}
+		}
+
+		if IsDecorative(el) {
+			continue
+		}
+
+		bounds := ElementBounds(el)
+
+		if safe_top > 0 && bounds.Top < safe_top-TOLERANCE {
+			add(el, RULE_SAFE_ZONE_TOP, SEVERITY_ERROR, fmt.Sprintf("Element violates top safe zone (%gpx)", safe_top))
+		}
+		if safe_bottom > 0 && bounds.Bottom() > fl.Height-safe_bottom+TOLERANCE {
+			add(el, RULE_SAFE_ZONE_BOTTOM, SEVERITY_ERROR, fmt.Sprintf("Element violates bottom safe zone (%gpx)", safe_bottom))
+		}
+
+		if bounds.Left < -TOLERANCE || bounds.Top < -TOLERANCE || bounds.Right() > fl.Width+TOLERANCE || bounds.Bottom() > fl.Height+TOLERANCE {
+			add(el, RULE_OUT_OF_BOUNDS, SEVERITY_ERROR, "Element extends beyond the canvas")
+		} else if bounds.Left < EDGE_MARGIN-TOLERANCE || bounds.Top < EDGE_MARGIN-TOLERANCE || bounds.Right() > fl.Width-EDGE_MARGIN+TOLERANCE || bounds.Bottom() > fl.Height-EDGE_MARGIN+TOLERANCE {
+			add(el, RULE_EDGE_MARGIN, SEVERITY_WARNING, fmt.Sprintf("Element is closer than %dpx to the canvas edge", EDGE_MARGIN))
+		}
+	}
+
+	content := contentElements(fl)
+	for i := 0; i < len(content); i++ {
+		for j := i + 1; j < len(content); j++ {
+			a, b := content[i], content[j]
+			box_a, box_b := ElementBounds(a), ElementBounds(b)
+
+			if box_a.Intersects(box_b) {
+				add(b, RULE_ELEMENT_OVERLAP, SEVERITY_ERROR, fmt.Sprintf("Element overlaps %s", a.ID))
+			} else if box_a.Gap(box_b) < MIN_GAP-TOLERANCE {
+				add(b, RULE_MIN_GAP, SEVERITY_WARNING, fmt.Sprintf("Element is closer than %dpx to %s", MIN_GAP, a.ID))
+			}
+		}
+	}
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		return elementIndex(fl, violations[i].ElementID) < elementIndex(fl, violations[j].ElementID)
+	})
+	return violations
+}
+
+// EffectiveFontSize is the rendered font size after vertical scaling.
+func EffectiveFontSize(el types.Element) float64 {
+	font_size := el.FontSize
+	if font_size == 0 {
+		font_size = 40
+	}
+	if el.ScaleY > 0 {
+		font_size *= el.ScaleY
+	}
+	return font_size
+}
+
+// IsCopy reports whether el is the headline or subhead, the only text the
+// copy rules apply to.
+func IsCopy(el types.Element) bool {
+	return el.Type == types.ElementText && (el.Role == types.RoleHeadline || el.Role == types.RoleSubhead)
+}
+
+// HasErrors reports whether any violation is blocking.
+func HasErrors(violations []Violation) bool {
+	for _, v := range violations {
+		if v.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// contentElements are the texts and images that spacing rules apply to.
+// Rects and circles are tiles and backdrops that text is meant to sit on.
+func contentElements(fl *types.FormatLayout) []types.Element {
+	var content []types.Element
+	for _, el := range fl.Elements {
+		if (el.Type == types.ElementText || el.Type == types.ElementImage) && !IsDecorative(el) {
+			content = append(content, el)
+		}
+	}
+	return content
+}
+
+func elementIndex(fl *types.FormatLayout, id string) int {
+	for i, el := range fl.Elements {
+		if el.ID == id {
+			return i
+		}
+	}
+	return len(fl.Elements)
+}
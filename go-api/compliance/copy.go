@@ -0,0 +1,74 @@
+package compliance
+
+import "regexp"
+
+type CopyRule struct {
+	Code    string
+	Regex   *regexp.Regexp
+	Message string
+}
+
+// copyRules mirrors canvas-ui/src/lib/tescoCopyValidator.ts so that the API
+// and the editor reject the same headline and subhead copy.
+var copyRules = []CopyRule{
+	{
+		Code:    "COPY_PRICE",
+		Regex:   regexp.MustCompile(`(?i)£|\$|\b\d+(\.\d+)?\s?(off|save|saving|discount|deal|offer|only|now|was|from)\b`),
+		Message: "Price, discount, or deal references are not allowed in headline or subhead.",
+	},
+	{
+		Code:    "COPY_CTA",
+		Regex:   regexp.MustCompile(`(?i)\b(shop now|buy now|order now|try now|get now|learn more|find out|discover|explore|click|tap|swipe|sign up|register)\b`),
+		Message: "Call-to-action language is not allowed in headline or subhead.",
+	},
+	{
+		Code:    "COPY_COMPETITION",
+		Regex:   regexp.MustCompile(`(?i)\b(win|competition|enter|chance|prize|giveaway|contest)\b`),
+		Message: "Competition-related copy is not allowed.",
+	},
+	{
+		Code:    "COPY_SUSTAINABILITY",
+		Regex:   regexp.MustCompile(`(?i)\b(eco|green|sustainable|environment|planet|carbon|recyclable|organic|ethical)\b`),
+		Message: "Sustainability or environmental claims are not allowed.",
+	},
+	{
+		Code:    "COPY_CHARITY",
+		Regex:   regexp.MustCompile(`(?i)\b(charity|donate|donation|foundation|non-profit|ngo|support a cause)\b`),
+		Message: "Charity or donation references are not allowed.",
+	},
+	{
+		Code:    "COPY_TERMS",
+		Regex:   regexp.MustCompile(`(?i)\b(terms apply|t&c|conditions apply|see website|see details|small print)\b`),
+		Message: "T&Cs or legal disclaimers are not allowed in copy.",
+	},
+	{
+		Code:    "COPY_GUARANTEE",
+		Regex:   regexp.MustCompile(`(?i)\b(money back|refund|guarantee|risk free|no risk)\b`),
+		Message: "Guarantees or refund claims are not allowed.",
+	},
+	{
+		Code:    "COPY_CLAIMS",
+		Regex:   regexp.MustCompile(`(?i)\*|\b(proven|tested|survey|study|research|clinically|rated|award-winning|best|number one|#1)\b`),
+		Message: "Claims, superlatives, asterisks, or evidence-based copy are not allowed.",
+	},
+	{
+		Code:    "COPY_URGENCY",
+		Regex:   regexp.MustCompile(`(?i)\b(hurry|limited time|don’t miss|last chance|today only|ending soon|while stocks last)\b`),
+		Message: "Urgency or pressure-based language is not allowed.",
+	},
+}
+
+// ValidateCopy returns the first copy rule the text breaks, like the editor
+// does, or nil when the copy is acceptable.
+func ValidateCopy(text string) *CopyRule {
+	if text == "" {
+		return nil
+	}
+
+	for i := range copyRules {
+		if copyRules[i].Regex.MatchString(text) {
+			return &copyRules[i]
+		}
+	}
+	return nil
+}
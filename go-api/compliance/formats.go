@@ -0,0 +1,137 @@
+package compliance
+
+import (
+	"canvas-backend/types"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	RULE_MISSING_FORMAT = "MISSING_FORMAT"
+	RULE_CANVAS_SIZE    = "CANVAS_SIZE"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+const (
+	FORMAT_INSTAGRAM_STORY = "instagram_story"
+	FORMAT_INSTAGRAM_POST  = "instagram_post"
+	FORMAT_FACEBOOK_AD     = "facebook_ad"
+)
+
+// Custom formats are kept within the sizes the renderer handles well.
+const (
+	MIN_FORMAT_SIZE = 50
+	MAX_FORMAT_SIZE = 4096
+)
+
+// Format is a canvas layouts are generated for, with the placement rules
+// that apply to it.
+type Format struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Width          float64 `json:"width"`
+	Height         float64 `json:"height"`
+	SafeZoneTop    float64 `json:"safe_zone_top"`
+	SafeZoneBottom float64 `json:"safe_zone_bottom"`
+	// MinFontSize raises the platform minimum for this format; 0 keeps it.
+	MinFontSize float64 `json:"min_font_size"`
+	Platform    string  `json:"platform"`
+}
+
+// FORMATS are the formats every workspace has, matching canvas-ui
+// canvas-presets.ts.
+var FORMATS = map[string]Format{
+	FORMAT_INSTAGRAM_STORY: {ID: FORMAT_INSTAGRAM_STORY, Name: "Instagram Story", Width: 1080, Height: 1920, SafeZoneTop: STORY_SAFE_ZONE, SafeZoneBottom: STORY_SAFE_ZONE, Platform: DEFAULT_PLATFORM},
+	FORMAT_INSTAGRAM_POST:  {ID: FORMAT_INSTAGRAM_POST, Name: "Instagram Post", Width: 1080, Height: 1080, Platform: DEFAULT_PLATFORM},
+	FORMAT_FACEBOOK_AD:     {ID: FORMAT_FACEBOOK_AD, Name: "Facebook Ad", Width: 1200, Height: 628, Platform: DEFAULT_PLATFORM},
+}
+
+// DEFAULT_FORMATS are generated when a request does not name any.
+var DEFAULT_FORMATS = []string{FORMAT_INSTAGRAM_STORY, FORMAT_INSTAGRAM_POST, FORMAT_FACEBOOK_AD}
+
+// InferFormat describes a layout key that is not registered from its
+// canvas alone. Only story (9:16) canvases reserve safe zones.
+func InferFormat(id string, fl *types.FormatLayout) Format {
+	format := Format{ID: id, Name: id, Width: fl.Width, Height: fl.Height, Platform: DEFAULT_PLATFORM}
+	if fl.Width > 0 && fl.Height/fl.Width >= 1.7 {
+		format.SafeZoneTop, format.SafeZoneBottom = STORY_SAFE_ZONE, STORY_SAFE_ZONE
+	}
+	return format
+}
+
+// MinFont is the smallest font size allowed in the format on platform.
+func (f Format) MinFont(platform Platform) float64 {
+	return math.Max(platform.MinFontSize, f.MinFontSize)
+}
+
+// Check reports what is wrong with a custom format.
+func (f Format) Check() error {
+	switch {
+	case f.ID == "":
+		return fmt.Errorf("id is required")
+	case strings.Trim(f.ID, "abcdefghijklmnopqrstuvwxyz0123456789_") != "":
+		return fmt.Errorf("id may only contain lowercase letters, digits and underscores")
+	case f.Width < MIN_FORMAT_SIZE || f.Width > MAX_FORMAT_SIZE || f.Height < MIN_FORMAT_SIZE || f.Height > MAX_FORMAT_SIZE:
+		return fmt.Errorf("width and height must be between %d and %d", MIN_FORMAT_SIZE, MAX_FORMAT_SIZE)
+	case f.SafeZoneTop < 0 || f.SafeZoneBottom < 0 || f.SafeZoneTop+f.SafeZoneBottom+2*EDGE_MARGIN >= f.Height:
+		return fmt.Errorf("safe zones must be positive and leave room for content")
+	case f.MinFontSize < 0:
+		return fmt.Errorf("min_font_size cannot be negative")
+	}
+	if _, err := LookupPlatform(f.Platform); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Formats are the formats available to a workspace, by id.
+type Formats map[string]Format
+
+// For is the registered format id, or one inferred from fl.
+func (f Formats) For(id string, fl *types.FormatLayout) Format {
+	if format, ok := f[id]; ok {
+		return format
+	}
+	return InferFormat(id, fl)
+}
+
+// Sorted lists the formats by id.
+func (f Formats) Sorted() []Format {
+	formats := make([]Format, 0, len(f))
+	for _, format := range f {
+		formats = append(formats, format)
+	}
+	slices.SortFunc(formats, func(a, b Format) int { return strings.Compare(a.ID, b.ID) })
+	return formats
+}
+
+// CheckFormats reports requested formats a layout is missing and canvases
+// that are not the size of their format.
+func CheckFormats(layout types.Layout, formats []Format) []Violation {
+	violations := []Violation{}
+	for _, format := range formats {
+		fl, ok := layout[format.ID]
+		if !ok || fl == nil {
+			violations = append(violations, Violation{
+				Format:   format.ID,
+				Rule:     RULE_MISSING_FORMAT,
+				Severity: SEVERITY_ERROR,
+				Message:  "No layout was generated for this format",
+			})
+			continue
+		}
+		if math.Abs(fl.Width-format.Width) > TOLERANCE || math.Abs(fl.Height-format.Height) > TOLERANCE {
+			violations = append(violations, Violation{
+				Format:   format.ID,
+				Rule:     RULE_CANVAS_SIZE,
+				Severity: SEVERITY_ERROR,
+				Message:  fmt.Sprintf("Canvas is %gx%g instead of %gx%g", fl.Width, fl.Height, format.Width, format.Height),
+			})
+		}
+	}
+	return violations
+}
@@ -0,0 +1,140 @@
+package compliance
+
+import (
+	"canvas-backend/textmetrics"
+	"canvas-backend/types"
+	"math"
+	"strings"
+)
+
+// Box is an axis-aligned bounding box in canvas pixels.
+type Box struct {
+	Left   float64 `json:"left"`
+	Top    float64 `json:"top"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (b Box) Right() float64  { return b.Left + b.Width }
+func (b Box) Bottom() float64 { return b.Top + b.Height }
+
+func (b Box) Intersects(o Box) bool {
+	return b.Left < o.Right() && o.Left < b.Right() && b.Top < o.Bottom() && o.Top < b.Bottom()
+}
+
+// Gap is the shortest distance between two boxes, 0 when they touch or overlap.
+func (b Box) Gap(o Box) float64 {
+	dx := math.Max(0, math.Max(o.Left-b.Right(), b.Left-o.Right()))
+	dy := math.Max(0, math.Max(o.Top-b.Bottom(), b.Top-o.Bottom()))
+	return math.Hypot(dx, dy)
+}
+
+// ElementSize returns the unscaled, unrotated size of an element the same
+// way fabric derives it: circles use their radius, text is measured in its
+// font and images take the size render.SizeImages gives them.
+func ElementSize(el types.Element) (float64, float64) {
+	switch el.Type {
+	case types.ElementCircle:
+		radius := el.Radius
+		if radius == 0 {
+			radius = 50
+		}
+		return radius * 2, radius * 2
+
+	case types.ElementText:
+		box := textmetrics.Measure(el.Content, textmetrics.ElementStyle(el))
+		return box.Width, box.Height
+
+	case types.ElementImage:
+		// An image that could not be measured is assumed to be a square
+		// packshot.
+		if el.Width > 0 && el.Height > 0 {
+			return el.Width, el.Height
+		}
+		side := math.Max(el.Width, el.Height)
+		return side, side
+
+	default:
+		return el.Width, el.Height
+	}
+}
+
+// ElementBounds returns the axis-aligned bounding box of an element after
+// origin, scale, stroke and rotation are applied.
+func ElementBounds(el types.Element) Box {
+	width, height := ElementSize(el)
+	return boundsForSize(el, width, height)
+}
+
+func boundsForSize(el types.Element, width, height float64) Box {
+	scale_x, scale_y := el.ScaleX, el.ScaleY
+	if scale_x == 0 {
+		scale_x = 1
+	}
+	if scale_y == 0 {
+		scale_y = 1
+	}
+	// Like fabric's scaleToWidth, an image given a size is drawn at it.
+	if el.Type == types.ElementImage && (el.Width > 0 || el.Height > 0) {
+		scale_x, scale_y = 1, 1
+	}
+
+	if el.Type == types.ElementRect || el.Type == types.ElementCircle {
+		width += el.StrokeWidth
+		height += el.StrokeWidth
+	}
+	width *= scale_x
+	height *= scale_y
+
+	// Offset of the origin point from the top-left corner.
+	ox := originOffset(el.OriginX, width)
+	oy := originOffset(el.OriginY, height)
+
+	corners := [4][2]float64{
+		{-ox, -oy},
+		{width - ox, -oy},
+		{width - ox, height - oy},
+		{-ox, height - oy},
+	}
+
+	rad := el.Angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	min_x, min_y := math.Inf(1), math.Inf(1)
+	max_x, max_y := math.Inf(-1), math.Inf(-1)
+	for _, c := range corners {
+		x := el.Left + c[0]*cos - c[1]*sin
+		y := el.Top + c[0]*sin + c[1]*cos
+		min_x, max_x = math.Min(min_x, x), math.Max(max_x, x)
+		min_y, max_y = math.Min(min_y, y), math.Max(max_y, y)
+	}
+
+	return Box{Left: min_x, Top: min_y, Width: max_x - min_x, Height: max_y - min_y}
+}
+
+func originOffset(origin string, size float64) float64 {
+	switch origin {
+	case "center":
+		return size / 2
+	case "right", "bottom":
+		return size
+	default:
+		return 0
+	}
+}
+
+// IsDecorative reports whether an element is background decoration (frames,
+// blobs, faint type) rather than content that placement rules apply to.
+func IsDecorative(el types.Element) bool {
+	if el.Opacity != nil && *el.Opacity <= 0.3 {
+		return true
+	}
+
+	if el.Type == types.ElementRect || el.Type == types.ElementCircle {
+		fill := strings.ToLower(strings.TrimSpace(el.Fill))
+		if el.Gradient == nil && (fill == "" || fill == "transparent" || fill == "none") {
+			return true
+		}
+	}
+	return false
+}
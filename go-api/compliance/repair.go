@@ -0,0 +1,395 @@
+package compliance
+
+import (
+	"canvas-backend/types"
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	ACTION_MOVE        = "move"
+	ACTION_SCALE       = "scale"
+	ACTION_RESIZE_FONT = "resize_font"
+	ACTION_RESTACK     = "restack"
+)
+
+// Images are never shrunk below this fraction of their generated size.
+const MIN_IMAGE_SCALE = 0.4
+
+const RESTACK_PASSES = 5
+
+// Change records a single edit made by the repair pass.
+type Change struct {
+	Format     string   `json:"format"`
+	ElementIDs []string `json:"element_ids"`
+	Rule       string   `json:"rule"`
+	Action     string   `json:"action"`
+	Message    string   `json:"message"`
+}
+
+// Repair deterministically edits a layout in place until it satisfies the
+// placement rules where possible, and returns every change it made. Whatever
+// it cannot fix is left for Validate to report.
+func Repair(layout types.Layout, formats Formats, platform Platform) []Change {
+	layout.EnsureElementIDs()
+
+	changes := []Change{}
+	for _, id := range layout.Formats() {
+		changes = append(changes, RepairFormat(formats.For(id, layout[id]), layout[id], platform)...)
+	}
+	return changes
+}
+
+func RepairFormat(format Format, fl *types.FormatLayout, platform Platform) []Change {
+	r := repairer{format: format, fl: fl, min_font: format.MinFont(platform), changes: []Change{}}
+
+	r.fixFontSizes()
+	r.buildClusters()
+	r.region = contentRegion(fl, format)
+
+	for _, c := range r.clusters {
+		r.fitCluster(c)
+	}
+	r.restack()
+
+	return r.changes
+}
+
+type repairer struct {
+	format   Format
+	fl       *types.FormatLayout
+	min_font float64
+	clusters []*cluster
+	region   Box
+	changes  []Change
+}
+
+// cluster is a group of elements that move together, e.g. a price tile rect
+// and the texts drawn on top of it.
+type cluster struct {
+	members   []int
+	has_text  bool
+	has_image bool
+}
+
+// contentRegion is the area content must stay within: a 24px margin from
+// every edge and 24px clear of the format's safe zones.
+func contentRegion(fl *types.FormatLayout, format Format) Box {
+	top := EDGE_MARGIN + format.SafeZoneTop
+	bottom := fl.Height - EDGE_MARGIN - format.SafeZoneBottom
+	return Box{
+		Left:   EDGE_MARGIN,
+		Top:    top,
+		Width:  fl.Width - 2*EDGE_MARGIN,
+		Height: bottom - top,
+	}
+}
+
+func (r *repairer) record(c *cluster, rule, action, message string) {
+	r.changes = append(r.changes, Change{
+		Format:     r.format.ID,
+		ElementIDs: c.ids(r.fl),
+		Rule:       rule,
+		Action:     action,
+		Message:    message,
+	})
+}
+
+func (r *repairer) fixFontSizes() {
+	for i := range r.fl.Elements {
+		el := &r.fl.Elements[i]
+		if el.Type != types.ElementText {
+			continue
+		}
+
+		before := EffectiveFontSize(*el)
+		if before >= r.min_font {
+			continue
+		}
+
+		el.FontSize = r.min_font
+		if el.ScaleY > 0 {
+			el.FontSize = r.min_font / el.ScaleY
+		}
+		r.changes = append(r.changes, Change{
+			Format:     r.format.ID,
+			ElementIDs: []string{el.ID},
+			Rule:       RULE_MIN_FONT_SIZE,
+			Action:     ACTION_RESIZE_FONT,
+			Message:    fmt.Sprintf("Raised font size from %gpx to %gpx", before, r.min_font),
+		})
+	}
+}
+
+// buildClusters groups every movable element with the tiles it sits on.
+// Decorative elements and backdrops covering half the canvas never move.
+func (r *repairer) buildClusters() {
+	elements := r.fl.Elements
+	parent := make([]int, len(elements))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	movable := make([]bool, len(elements))
+	for i, el := range elements {
+		movable[i] = !IsDecorative(el) && !r.isBackdrop(el)
+	}
+
+	for i, tile := range elements {
+		if !movable[i] || (tile.Type != types.ElementRect && tile.Type != types.ElementCircle) {
+			continue
+		}
+		tile_box := ElementBounds(tile)
+		for j := i + 1; j < len(elements); j++ {
+			if !movable[j] {
+				continue
+			}
+			if contains(tile_box, ElementBounds(elements[j])) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	by_root := map[int]*cluster{}
+	for i, el := range elements {
+		if !movable[i] {
+			continue
+		}
+		root := find(i)
+		c, ok := by_root[root]
+		if !ok {
+			c = &cluster{}
+			by_root[root] = c
+			r.clusters = append(r.clusters, c)
+		}
+		c.members = append(c.members, i)
+		c.has_text = c.has_text || el.Type == types.ElementText
+		c.has_image = c.has_image || el.Type == types.ElementImage
+	}
+}
+
+func (r *repairer) isBackdrop(el types.Element) bool {
+	if el.Type != types.ElementRect && el.Type != types.ElementCircle {
+		return false
+	}
+	b := ElementBounds(el)
+	return b.Width*b.Height >= 0.5*r.fl.Width*r.fl.Height
+}
+
+// fitCluster scales a cluster down when it cannot fit the content region and
+// then nudges it inside.
+func (r *repairer) fitCluster(c *cluster) {
+	b := c.bounds(r.fl)
+
+	if b.Width > r.region.Width || b.Height > r.region.Height {
+		s := math.Min(r.region.Width/b.Width, r.region.Height/b.Height)
+		s = math.Max(s, c.minScale(r.fl, r.min_font))
+		if s < 1 {
+			c.scale(r.fl, s, b.Left, b.Top)
+			r.record(c, RULE_OUT_OF_BOUNDS, ACTION_SCALE, fmt.Sprintf("Scaled by %.2f to fit the content area", s))
+			b = c.bounds(r.fl)
+		}
+	}
+
+	dx, dy := 0.0, 0.0
+	if b.Left < r.region.Left {
+		dx = r.region.Left - b.Left
+	} else if b.Right() > r.region.Right() {
+		dx = r.region.Right() - b.Right()
+	}
+	if b.Top < r.region.Top {
+		dy = r.region.Top - b.Top
+	} else if b.Bottom() > r.region.Bottom() {
+		dy = r.region.Bottom() - b.Bottom()
+	}
+	if dx == 0 && dy == 0 {
+		return
+	}
+
+	c.move(r.fl, dx, dy)
+	r.record(c, r.ruleFor(b), ACTION_MOVE, fmt.Sprintf("Moved by (%.0f, %.0f) into the content area", dx, dy))
+}
+
+func (r *repairer) ruleFor(b Box) string {
+	safe_top, safe_bottom := r.format.SafeZoneTop, r.format.SafeZoneBottom
+	switch {
+	case safe_top > 0 && b.Top < safe_top:
+		return RULE_SAFE_ZONE_TOP
+	case safe_bottom > 0 && b.Bottom() > r.fl.Height-safe_bottom:
+		return RULE_SAFE_ZONE_BOTTOM
+	case b.Left < 0 || b.Top < 0 || b.Right() > r.fl.Width || b.Bottom() > r.fl.Height:
+		return RULE_OUT_OF_BOUNDS
+	default:
+		return RULE_EDGE_MARGIN
+	}
+}
+
+// restack pushes content clusters down until every pair that shares a
+// column is at least MIN_GAP apart. When the stack then overflows the
+// content region, the largest image in the chain of pushes that caused it
+// is shrunk and the stack is recomputed. Anything still overflowing is
+// pulled back inside the region, leaving the overlap for Validate to report.
+func (r *repairer) restack() {
+	var content []*cluster
+	for _, c := range r.clusters {
+		if c.has_text || c.has_image {
+			content = append(content, c)
+		}
+	}
+	if len(content) < 2 {
+		return
+	}
+
+	sort.SliceStable(content, func(i, j int) bool {
+		return content[i].bounds(r.fl).Top < content[j].bounds(r.fl).Top
+	})
+
+	original_top := make(map[*cluster]float64, len(content))
+	scaled := make(map[*cluster]float64, len(content))
+	for _, c := range content {
+		original_top[c] = c.bounds(r.fl).Top
+		scaled[c] = 1
+	}
+
+	for pass := 0; ; pass++ {
+		pushed_by := map[*cluster]*cluster{}
+		var worst *cluster
+		overflow := 0.0
+
+		for i, c := range content {
+			b := c.bounds(r.fl)
+			target := original_top[c]
+			for _, above := range content[:i] {
+				ab := above.bounds(r.fl)
+				if b.Left < ab.Right() && ab.Left < b.Right() && ab.Bottom()+MIN_GAP > target {
+					target = ab.Bottom() + MIN_GAP
+					pushed_by[c] = above
+				}
+			}
+			if target != b.Top {
+				c.move(r.fl, 0, target-b.Top)
+				b = c.bounds(r.fl)
+			}
+			if b.Bottom()-r.region.Bottom() > overflow {
+				overflow = b.Bottom() - r.region.Bottom()
+				worst = c
+			}
+		}
+		if worst == nil || pass == RESTACK_PASSES-1 {
+			break
+		}
+
+		var largest *cluster
+		for c := worst; c != nil; c = pushed_by[c] {
+			if c.has_image && !c.has_text && scaled[c] > MIN_IMAGE_SCALE && (largest == nil || c.bounds(r.fl).Height > largest.bounds(r.fl).Height) {
+				largest = c
+			}
+		}
+		if largest == nil {
+			break
+		}
+
+		b := largest.bounds(r.fl)
+		s := math.Max(MIN_IMAGE_SCALE/scaled[largest], (b.Height-overflow)/b.Height)
+		largest.scale(r.fl, s, b.Left+b.Width/2, b.Top)
+		scaled[largest] *= s
+		r.record(largest, RULE_MIN_GAP, ACTION_SCALE, fmt.Sprintf("Scaled by %.2f to make room for the stack", s))
+	}
+
+	for _, c := range content {
+		if b := c.bounds(r.fl); b.Bottom() > r.region.Bottom() {
+			c.move(r.fl, 0, r.region.Bottom()-b.Bottom())
+		}
+
+		dy := c.bounds(r.fl).Top - original_top[c]
+		if math.Abs(dy) >= 0.5 {
+			r.record(c, RULE_MIN_GAP, ACTION_RESTACK, fmt.Sprintf("Moved %.0fpx vertically to keep a %dpx gap", dy, MIN_GAP))
+		}
+	}
+}
+
+// contains reports whether inner lies within outer, allowing for the
+// anti-aliasing slack generated tiles usually have.
+func contains(outer, inner Box) bool {
+	const slack = 2
+	return inner.Left >= outer.Left-slack && inner.Top >= outer.Top-slack &&
+		inner.Right() <= outer.Right()+slack && inner.Bottom() <= outer.Bottom()+slack
+}
+
+func (c *cluster) bounds(fl *types.FormatLayout) Box {
+	var union Box
+	for n, i := range c.members {
+		b := ElementBounds(fl.Elements[i])
+		if n == 0 {
+			union = b
+			continue
+		}
+		left, top := math.Min(union.Left, b.Left), math.Min(union.Top, b.Top)
+		right, bottom := math.Max(union.Right(), b.Right()), math.Max(union.Bottom(), b.Bottom())
+		union = Box{Left: left, Top: top, Width: right - left, Height: bottom - top}
+	}
+	return union
+}
+
+func (c *cluster) ids(fl *types.FormatLayout) []string {
+	ids := make([]string, 0, len(c.members))
+	for _, i := range c.members {
+		ids = append(ids, fl.Elements[i].ID)
+	}
+	return ids
+}
+
+func (c *cluster) move(fl *types.FormatLayout, dx, dy float64) {
+	for _, i := range c.members {
+		fl.Elements[i].Left = round(fl.Elements[i].Left + dx)
+		fl.Elements[i].Top = round(fl.Elements[i].Top + dy)
+	}
+}
+
+// scale resizes every member about the anchor point, so the cluster keeps
+// its internal arrangement.
+func (c *cluster) scale(fl *types.FormatLayout, s, ax, ay float64) {
+	for _, i := range c.members {
+		el := &fl.Elements[i]
+		el.Left = round(ax + (el.Left-ax)*s)
+		el.Top = round(ay + (el.Top-ay)*s)
+		el.Width = round(el.Width * s)
+		el.Height = round(el.Height * s)
+		el.Radius = round(el.Radius * s)
+		el.Rx = round(el.Rx * s)
+		el.Ry = round(el.Ry * s)
+		if el.Type == types.ElementText {
+			if el.FontSize == 0 {
+				el.FontSize = 40
+			}
+			el.FontSize = round(el.FontSize * s)
+		}
+	}
+}
+
+// minScale is the smallest scale that keeps every text member at or above
+// the minimum font size.
+func (c *cluster) minScale(fl *types.FormatLayout, min_font float64) float64 {
+	min_scale := 0.0
+	for _, i := range c.members {
+		el := fl.Elements[i]
+		if el.Type != types.ElementText {
+			continue
+		}
+		min_scale = math.Max(min_scale, min_font/EffectiveFontSize(el))
+	}
+	return min_scale
+}
+
+// round keeps repaired coordinates to two decimals.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,122 @@
+package compliance
+
+import (
+	"canvas-backend/types"
+	"reflect"
+	"testing"
+)
+
+func tile(left, top, width, height float64) types.Element {
+	return types.Element{Type: types.ElementRect, Fill: "#e00000", Left: left, Top: top, Width: width, Height: height}
+}
+
+func text(content string, left, top, size float64) types.Element {
+	return types.Element{Type: types.ElementText, Content: content, Left: left, Top: top, FontSize: size, FontFamily: "Roboto", Fill: "#000000"}
+}
+
+func TestRepair(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		elements []types.Element
+		// changes lists the rule and action of every change, in order.
+		changes [][2]string
+	}{
+		{
+			name:     "compliant layout is left alone",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{tile(100, 100, 200, 200), text("Hello", 100, 400, 40)},
+		},
+		{
+			name:     "small text is enlarged",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{text("Hello", 100, 100, 10)},
+			changes:  [][2]string{{RULE_MIN_FONT_SIZE, ACTION_RESIZE_FONT}},
+		},
+		{
+			name:     "element off the canvas is moved in",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{tile(-50, 100, 100, 100)},
+			changes:  [][2]string{{RULE_OUT_OF_BOUNDS, ACTION_MOVE}},
+		},
+		{
+			name:     "element in the margin is moved in",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{tile(10, 100, 100, 100)},
+			changes:  [][2]string{{RULE_EDGE_MARGIN, ACTION_MOVE}},
+		},
+		{
+			name:     "element in the story safe zone is moved down",
+			format:   FORMAT_INSTAGRAM_STORY,
+			elements: []types.Element{tile(100, 100, 100, 100)},
+			changes:  [][2]string{{RULE_SAFE_ZONE_TOP, ACTION_MOVE}},
+		},
+		{
+			name:     "element wider than the canvas is scaled and moved in",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{tile(0, 100, 2000, 100)},
+			changes:  [][2]string{{RULE_OUT_OF_BOUNDS, ACTION_SCALE}, {RULE_EDGE_MARGIN, ACTION_MOVE}},
+		},
+		{
+			name:     "overlapping texts are restacked",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{text("Headline", 100, 100, 60), text("Subhead", 100, 110, 30)},
+			changes:  [][2]string{{RULE_MIN_GAP, ACTION_RESTACK}},
+		},
+		{
+			name:     "decorative elements never move",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{{Type: types.ElementRect, Left: -50, Top: -50, Width: 100, Height: 100}},
+		},
+		{
+			name:     "backdrops never move",
+			format:   FORMAT_INSTAGRAM_POST,
+			elements: []types.Element{tile(-10, -10, 1100, 1100)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := FORMATS[tt.format]
+			layout := types.Layout{tt.format: {Width: format.Width, Height: format.Height, Elements: tt.elements}}
+			platform := PLATFORMS[DEFAULT_PLATFORM]
+
+			var changes [][2]string
+			for _, change := range Repair(layout, Formats(FORMATS), platform) {
+				if change.Format != tt.format {
+					t.Errorf("change is for format %q, want %q", change.Format, tt.format)
+				}
+				changes = append(changes, [2]string{change.Rule, change.Action})
+			}
+			if !reflect.DeepEqual(changes, tt.changes) {
+				t.Errorf("Repair() changes = %v, want %v", changes, tt.changes)
+			}
+
+			// Whatever was repaired must now pass.
+			for _, violation := range Validate(layout, Formats(FORMATS), platform) {
+				for _, change := range changes {
+					if violation.Rule == change[0] && violation.Severity == SEVERITY_ERROR {
+						t.Errorf("%s is still violated after the repair: %s", violation.Rule, violation.Message)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRepairIsIdempotent(t *testing.T) {
+	format := FORMATS[FORMAT_INSTAGRAM_STORY]
+	layout := types.Layout{format.ID: {Width: format.Width, Height: format.Height, Elements: []types.Element{
+		tile(-20, 40, 300, 120),
+		text("Headline", 0, 60, 12),
+		text("Subhead", 0, 70, 30),
+	}}}
+	platform := PLATFORMS[DEFAULT_PLATFORM]
+
+	if changes := Repair(layout, Formats(FORMATS), platform); len(changes) == 0 {
+		t.Fatal("Repair() made no changes to a broken layout")
+	}
+	if changes := Repair(layout, Formats(FORMATS), platform); len(changes) > 0 {
+		t.Errorf("Repair() of a repaired layout made changes %v", changes)
+	}
+}
@@ -0,0 +1,207 @@
+package compliance
+
+import (
+	"canvas-backend/render"
+	"canvas-backend/types"
+	"image/color"
+	"math"
+	"slices"
+)
+
+// Weights of each criterion in a score's total.
+const (
+	WEIGHT_COMPLIANCE = 0.4
+	WEIGHT_PALETTE    = 0.2
+	WEIGHT_WHITESPACE = 0.2
+	WEIGHT_PROMINENCE = 0.2
+)
+
+const (
+	// PALETTE_DISTANCE is how far, in RGB, a color may be from the palette
+	// and still count as on brand.
+	PALETTE_DISTANCE = 60
+	// Content should cover between MIN_COVERAGE and MAX_COVERAGE of the
+	// usable canvas.
+	MIN_COVERAGE = 0.3
+	MAX_COVERAGE = 0.7
+	// HERO_COVERAGE is the share of the usable canvas at which the hero
+	// product counts as fully prominent.
+	HERO_COVERAGE = 0.15
+)
+
+// Score rates a layout on each criterion from 0 to 1, higher being better.
+type Score struct {
+	Total      float64 `json:"total"`
+	Compliance float64 `json:"compliance"`
+	Palette    float64 `json:"palette"`
+	Whitespace float64 `json:"whitespace"`
+	Prominence float64 `json:"prominence"`
+}
+
+// ScoreLayout rates a repaired layout of formats. violations are what is
+// left after repair, palette the brand's colors and hero the URL of the
+// product image that should stand out. The per-format criteria are averaged
+// over formats, a missing format scoring 0.
+func ScoreLayout(layout types.Layout, formats []Format, violations []Violation, palette []string, hero string) Score {
+	errors, warnings := 0, 0
+	for _, v := range violations {
+		if v.Severity == SEVERITY_ERROR {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	score := Score{Compliance: 1 / (1 + float64(errors) + float64(warnings)/4)}
+
+	brand_colors := parsePalette(palette)
+	for _, format := range formats {
+		fl, ok := layout[format.ID]
+		if !ok || fl == nil {
+			continue
+		}
+		region := contentRegion(fl, format)
+		score.Palette += paletteScore(fl, brand_colors)
+		score.Whitespace += whitespaceScore(fl, region)
+		score.Prominence += prominenceScore(fl, region, hero)
+	}
+	if n := float64(len(formats)); n > 0 {
+		score.Palette /= n
+		score.Whitespace /= n
+		score.Prominence /= n
+	}
+
+	score.Total = WEIGHT_COMPLIANCE*score.Compliance +
+		WEIGHT_PALETTE*score.Palette +
+		WEIGHT_WHITESPACE*score.Whitespace +
+		WEIGHT_PROMINENCE*score.Prominence
+	return score
+}
+
+// parsePalette reads the brand colors, which always include black and
+// white.
+func parsePalette(palette []string) []color.NRGBA {
+	if len(palette) == 0 {
+		return nil
+	}
+	colors := []color.NRGBA{{0, 0, 0, 255}, {255, 255, 255, 255}}
+	for _, s := range palette {
+		if c, ok := render.ParseColor(s); ok {
+			colors = append(colors, c)
+		}
+	}
+	return colors
+}
+
+// paletteScore is the share of the colors a format uses that are close to
+// the palette. Without a palette every color is on brand.
+func paletteScore(fl *types.FormatLayout, palette []color.NRGBA) float64 {
+	if len(palette) == 0 {
+		return 1
+	}
+
+	used := []string{fl.BackgroundColor}
+	if fl.BackgroundGradient != nil {
+		for _, stop := range fl.BackgroundGradient.Stops {
+			used = append(used, stop.Color)
+		}
+	}
+	for _, el := range fl.Elements {
+		if IsDecorative(el) {
+			continue
+		}
+		used = append(used, el.Fill, el.Color, el.Stroke)
+		if el.Gradient != nil {
+			for _, stop := range el.Gradient.Stops {
+				used = append(used, stop.Color)
+			}
+		}
+	}
+
+	total, on_brand := 0, 0
+	for _, s := range used {
+		c, ok := render.ParseColor(s)
+		if !ok || c.A == 0 {
+			continue
+		}
+		total++
+		if slices.ContainsFunc(palette, func(p color.NRGBA) bool { return colorDistance(c, p) <= PALETTE_DISTANCE }) {
+			on_brand++
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return float64(on_brand) / float64(total)
+}
+
+func colorDistance(a, b color.NRGBA) float64 {
+	return math.Sqrt(math.Pow(float64(a.R)-float64(b.R), 2) + math.Pow(float64(a.G)-float64(b.G), 2) + math.Pow(float64(a.B)-float64(b.B), 2))
+}
+
+// whitespaceScore rewards content that covers a moderate share of region
+// and whose weight sits near its center. Full-bleed images are backdrops
+// and count as neither.
+func whitespaceScore(fl *types.FormatLayout, region Box) float64 {
+	region_area := region.Width * region.Height
+	if region_area <= 0 {
+		return 0
+	}
+
+	covered, center_x, center_y := 0.0, 0.0, 0.0
+	for _, el := range contentElements(fl) {
+		box := clipBox(ElementBounds(el), region)
+		area := box.Width * box.Height
+		if area <= 0 || area >= 0.9*region_area {
+			continue
+		}
+		covered += area
+		center_x += area * (box.Left + box.Width/2)
+		center_y += area * (box.Top + box.Height/2)
+	}
+	if covered == 0 {
+		return 0
+	}
+
+	coverage := math.Min(1, covered/region_area)
+	coverage_score := 1.0
+	if coverage < MIN_COVERAGE {
+		coverage_score = coverage / MIN_COVERAGE
+	} else if coverage > MAX_COVERAGE {
+		coverage_score = (1 - coverage) / (1 - MAX_COVERAGE)
+	}
+
+	offset_x := math.Abs(center_x/covered-(region.Left+region.Width/2)) / (region.Width / 2)
+	offset_y := math.Abs(center_y/covered-(region.Top+region.Height/2)) / (region.Height / 2)
+	balance := math.Max(0, 1-(offset_x+offset_y)/2)
+
+	return (coverage_score + balance) / 2
+}
+
+// prominenceScore rates how much of region the hero image covers. Without
+// a hero there is nothing to rate.
+func prominenceScore(fl *types.FormatLayout, region Box, hero string) float64 {
+	if hero == "" {
+		return 1
+	}
+	region_area := region.Width * region.Height
+	if region_area <= 0 {
+		return 0
+	}
+
+	largest := 0.0
+	for _, el := range fl.Elements {
+		if el.Type != types.ElementImage || el.URL != hero {
+			continue
+		}
+		box := clipBox(ElementBounds(el), region)
+		largest = math.Max(largest, box.Width*box.Height)
+	}
+	return math.Min(1, largest/region_area/HERO_COVERAGE)
+}
+
+// clipBox is the part of b inside region.
+func clipBox(b, region Box) Box {
+	left, top := math.Max(b.Left, region.Left), math.Max(b.Top, region.Top)
+	right, bottom := math.Min(b.Right(), region.Right()), math.Min(b.Bottom(), region.Bottom())
+	return Box{Left: left, Top: top, Width: math.Max(0, right-left), Height: math.Max(0, bottom-top)}
+}
@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE generation_jobs(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    brand_kit_id UUID NOT NULL REFERENCES brand_kits(id) ON DELETE CASCADE, 
+    status TEXT NOT NULL DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')), 
+    progress INTEGER NOT NULL DEFAULT 0, 
+    stage TEXT NOT NULL DEFAULT '', 
+    request_json JSONB NOT NULL DEFAULT '{}', 
+    result_json JSONB, 
+    error TEXT, 
+    attempts INTEGER NOT NULL DEFAULT 0, 
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    started_at TIMESTAMPTZ, 
+    finished_at TIMESTAMPTZ, 
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE INDEX ON generation_jobs (brand_kit_id); 
+CREATE INDEX ON generation_jobs (created_at) WHERE status = 'queued'; 
+
+-- +goose Down
+DROP TABLE IF EXISTS generation_jobs; 
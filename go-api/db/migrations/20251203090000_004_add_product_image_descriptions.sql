@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE product_images
+    ADD COLUMN description TEXT, 
+    ADD COLUMN description_model TEXT, 
+    ADD COLUMN description_prompt_version TEXT, 
+    ADD COLUMN described_at TIMESTAMPTZ; 
+
+-- +goose Down
+ALTER TABLE product_images
+    DROP COLUMN IF EXISTS described_at, 
+    DROP COLUMN IF EXISTS description_prompt_version, 
+    DROP COLUMN IF EXISTS description_model, 
+    DROP COLUMN IF EXISTS description; 
@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE product_images
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'secondary' CHECK (role IN ('hero', 'secondary', 'lifestyle')), 
+    ADD COLUMN position INTEGER NOT NULL DEFAULT 0; 
+
+UPDATE product_images
+SET position = ordered.rank
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY brand_kit_id ORDER BY created_at) - 1 AS rank
+    FROM product_images
+) AS ordered
+WHERE product_images.id = ordered.id; 
+
+UPDATE product_images SET role = 'hero' WHERE position = 0; 
+
+CREATE UNIQUE INDEX product_images_one_hero ON product_images (brand_kit_id) WHERE role = 'hero'; 
+
+-- +goose Down
+DROP INDEX IF EXISTS product_images_one_hero; 
+
+ALTER TABLE product_images
+    DROP COLUMN IF EXISTS position, 
+    DROP COLUMN IF EXISTS role; 
@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE designs(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    brand_kit_id UUID NOT NULL REFERENCES brand_kits(id) ON DELETE CASCADE, 
+    name TEXT NOT NULL, 
+    current_version INTEGER NOT NULL DEFAULT 1, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE INDEX ON designs (brand_kit_id); 
+
+CREATE TABLE design_versions(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    design_id UUID NOT NULL REFERENCES designs(id) ON DELETE CASCADE, 
+    version INTEGER NOT NULL, 
+    layout_json JSONB NOT NULL, 
+    author TEXT NOT NULL, 
+    source TEXT NOT NULL CHECK (source IN ('generated', 'edited', 'restored')), 
+    note TEXT, 
+    generation_job_id UUID REFERENCES generation_jobs(id) ON DELETE SET NULL, 
+    restored_from INTEGER, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    UNIQUE (design_id, version)
+); 
+
+-- +goose Down
+DROP TABLE IF EXISTS design_versions; 
+DROP TABLE IF EXISTS designs; 
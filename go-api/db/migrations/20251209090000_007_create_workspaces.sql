@@ -0,0 +1,57 @@
+-- +goose Up
+CREATE TABLE users(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    email TEXT NOT NULL UNIQUE, 
+    name TEXT NOT NULL DEFAULT '', 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE TABLE workspaces(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    name TEXT NOT NULL, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE TABLE workspace_members(
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE, 
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE, 
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')), 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    PRIMARY KEY (workspace_id, user_id)
+); 
+
+-- Only the sha256 of a key is stored; the prefix lets people tell keys apart.
+CREATE TABLE api_keys(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE, 
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE, 
+    name TEXT NOT NULL DEFAULT '', 
+    prefix TEXT NOT NULL, 
+    key_hash TEXT NOT NULL UNIQUE, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    last_used_at TIMESTAMPTZ, 
+    revoked_at TIMESTAMPTZ
+); 
+
+CREATE INDEX ON api_keys (workspace_id); 
+
+-- Kits created before workspaces existed move into a default workspace.
+-- It has no members until the first `go run . bootstrap -email ...` after
+-- the upgrade, which makes that user its owner and prints a key for it.
+ALTER TABLE brand_kits ADD COLUMN workspace_id UUID REFERENCES workspaces(id) ON DELETE CASCADE; 
+
+INSERT INTO workspaces (name) SELECT 'Default' WHERE EXISTS (SELECT 1 FROM brand_kits); 
+
+UPDATE brand_kits SET workspace_id = (SELECT id FROM workspaces ORDER BY created_at LIMIT 1); 
+
+ALTER TABLE brand_kits ALTER COLUMN workspace_id SET NOT NULL; 
+
+CREATE INDEX ON brand_kits (workspace_id); 
+
+-- +goose Down
+ALTER TABLE brand_kits DROP COLUMN IF EXISTS workspace_id; 
+
+DROP TABLE IF EXISTS api_keys; 
+DROP TABLE IF EXISTS workspace_members; 
+DROP TABLE IF EXISTS workspaces; 
+DROP TABLE IF EXISTS users; 
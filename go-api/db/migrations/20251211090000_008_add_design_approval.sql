@@ -0,0 +1,30 @@
+-- +goose Up
+ALTER TABLE workspace_members
+    ADD COLUMN approval_roles TEXT[] NOT NULL DEFAULT '{}' CHECK (approval_roles <@ ARRAY['designer', 'brand_manager', 'compliance_reviewer']); 
+
+ALTER TABLE designs
+    ADD COLUMN status TEXT NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'in_review', 'approved', 'rejected', 'published')); 
+
+-- Every status change of a design, kept as the record of who signed off.
+CREATE TABLE design_reviews(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    design_id UUID NOT NULL REFERENCES designs(id) ON DELETE CASCADE, 
+    version INTEGER NOT NULL, 
+    action TEXT NOT NULL, 
+    from_status TEXT NOT NULL, 
+    to_status TEXT NOT NULL, 
+    actor_user_id UUID REFERENCES users(id) ON DELETE SET NULL, 
+    actor_email TEXT NOT NULL, 
+    approval_role TEXT, 
+    reason TEXT, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE INDEX ON design_reviews (design_id, created_at); 
+
+-- +goose Down
+DROP TABLE IF EXISTS design_reviews; 
+
+ALTER TABLE designs DROP COLUMN IF EXISTS status; 
+
+ALTER TABLE workspace_members DROP COLUMN IF EXISTS approval_roles; 
@@ -0,0 +1,36 @@
+-- +goose Up
+-- Audit events outlive what they describe, so nothing here is a foreign key.
+CREATE TABLE audit_events(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    workspace_id UUID NOT NULL, 
+    actor_user_id UUID, 
+    actor_email TEXT NOT NULL DEFAULT '', 
+    api_key_id UUID, 
+    action TEXT NOT NULL, 
+    target_type TEXT NOT NULL, 
+    target_id UUID, 
+    request_id TEXT NOT NULL DEFAULT '', 
+    before_json JSONB, 
+    after_json JSONB, 
+    changes_json JSONB NOT NULL DEFAULT '[]', 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE INDEX ON audit_events (workspace_id, created_at DESC); 
+CREATE INDEX ON audit_events (target_id); 
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only(); 
+
+-- +goose Down
+DROP TABLE IF EXISTS audit_events; 
+DROP FUNCTION IF EXISTS audit_events_append_only(); 
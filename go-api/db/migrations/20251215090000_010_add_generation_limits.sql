@@ -0,0 +1,34 @@
+-- +goose Up
+-- Limits are generations per minute and per UTC day. NULL on a workspace
+-- falls back to the server defaults, NULL on a key adds no limit of its own,
+-- and 0 means unlimited.
+ALTER TABLE workspaces
+    ADD COLUMN generation_rate_limit INTEGER CHECK (generation_rate_limit >= 0), 
+    ADD COLUMN generation_daily_quota INTEGER CHECK (generation_daily_quota >= 0); 
+
+ALTER TABLE api_keys
+    ADD COLUMN generation_rate_limit INTEGER CHECK (generation_rate_limit >= 0), 
+    ADD COLUMN generation_daily_quota INTEGER CHECK (generation_daily_quota >= 0); 
+
+-- One row per scope and window, so limits hold across restarts and instances.
+CREATE TABLE usage_counters(
+    scope TEXT NOT NULL CHECK (scope IN ('workspace', 'api_key')), 
+    scope_id UUID NOT NULL, 
+    period TEXT NOT NULL CHECK (period IN ('minute', 'day')), 
+    window_start TIMESTAMPTZ NOT NULL, 
+    count INTEGER NOT NULL DEFAULT 0, 
+    PRIMARY KEY (scope, scope_id, period, window_start)
+); 
+
+CREATE INDEX ON usage_counters (window_start); 
+
+-- +goose Down
+DROP TABLE IF EXISTS usage_counters; 
+
+ALTER TABLE api_keys
+    DROP COLUMN IF EXISTS generation_rate_limit, 
+    DROP COLUMN IF EXISTS generation_daily_quota; 
+
+ALTER TABLE workspaces
+    DROP COLUMN IF EXISTS generation_rate_limit, 
+    DROP COLUMN IF EXISTS generation_daily_quota; 
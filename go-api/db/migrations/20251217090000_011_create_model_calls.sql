@@ -0,0 +1,28 @@
+-- +goose Up
+-- One row per model call, retries included, for charging AI spend back to
+-- brands. Rows outlive the kits and jobs they are attributed to, so nothing
+-- here is a foreign key.
+CREATE TABLE model_calls(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    workspace_id UUID, 
+    brand_kit_id UUID, 
+    generation_job_id UUID, 
+    operation TEXT NOT NULL, 
+    provider TEXT NOT NULL, 
+    model TEXT NOT NULL, 
+    prompt_tokens INTEGER NOT NULL DEFAULT 0, 
+    response_tokens INTEGER NOT NULL DEFAULT 0, 
+    latency_ms INTEGER NOT NULL DEFAULT 0, 
+    retries INTEGER NOT NULL DEFAULT 0, 
+    succeeded BOOLEAN NOT NULL, 
+    error TEXT, 
+    -- Millionths of a US dollar, at the prices known when the call was made.
+    estimated_cost_micros BIGINT NOT NULL DEFAULT 0, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE INDEX ON model_calls (workspace_id, created_at); 
+CREATE INDEX ON model_calls (brand_kit_id, created_at); 
+
+-- +goose Down
+DROP TABLE IF EXISTS model_calls; 
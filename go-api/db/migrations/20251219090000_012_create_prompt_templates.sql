@@ -0,0 +1,46 @@
+-- +goose Up
+-- Published prompt versions never change; a bad one is rolled back by
+-- activating an earlier version. Version 0 is the template built into the
+-- server, which needs no row.
+CREATE TABLE prompt_templates(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE, 
+    name TEXT NOT NULL, 
+    version INTEGER NOT NULL CHECK (version > 0), 
+    body TEXT NOT NULL, 
+    hash TEXT NOT NULL, 
+    note TEXT, 
+    author TEXT NOT NULL, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    UNIQUE (workspace_id, name, version)
+); 
+
+CREATE TABLE active_prompt_templates(
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE, 
+    name TEXT NOT NULL, 
+    version INTEGER NOT NULL CHECK (version >= 0), 
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    PRIMARY KEY (workspace_id, name)
+); 
+
+-- A pin holds a kit on one version whatever is active for the workspace.
+CREATE TABLE brand_kit_prompt_pins(
+    brand_kit_id UUID NOT NULL REFERENCES brand_kits(id) ON DELETE CASCADE, 
+    name TEXT NOT NULL, 
+    version INTEGER NOT NULL CHECK (version >= 0), 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    PRIMARY KEY (brand_kit_id, name)
+); 
+
+ALTER TABLE design_versions
+    ADD COLUMN prompt_name TEXT, 
+    ADD COLUMN prompt_version INTEGER; 
+
+-- +goose Down
+ALTER TABLE design_versions
+    DROP COLUMN IF EXISTS prompt_name, 
+    DROP COLUMN IF EXISTS prompt_version; 
+
+DROP TABLE IF EXISTS brand_kit_prompt_pins; 
+DROP TABLE IF EXISTS active_prompt_templates; 
+DROP TABLE IF EXISTS prompt_templates; 
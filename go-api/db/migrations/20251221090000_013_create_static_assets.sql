@@ -0,0 +1,29 @@
+-- +goose Up
+-- Fixed compliance images that prompts and layouts refer to by key. Rows
+-- without a workspace are the defaults every workspace starts with; a
+-- workspace replaces one by adding a row with the same key. Sizes are NULL
+-- until the image has been fetched and measured.
+CREATE TABLE static_assets(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    workspace_id UUID REFERENCES workspaces(id) ON DELETE CASCADE, 
+    key TEXT NOT NULL CHECK (key ~ '^ASSET_[A-Z0-9_]+$'), 
+    url TEXT NOT NULL, 
+    width INTEGER CHECK (width > 0), 
+    height INTEGER CHECK (height > 0), 
+    formats TEXT[] NOT NULL DEFAULT '{}', 
+    retailer TEXT NOT NULL, 
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    UNIQUE (workspace_id, key)
+); 
+
+CREATE UNIQUE INDEX static_assets_default_key_idx ON static_assets(key) WHERE workspace_id IS NULL; 
+
+INSERT INTO static_assets (key, url, formats, retailer) VALUES
+    ('ASSET_DRINKAWARE', 'https://res.cloudinary.com/video-app-/image/upload/v1764867609/drinkaware_logo_rgb_znlbh0.png', ARRAY['instagram_story', 'instagram_post', 'facebook_ad'], 'tesco'), 
+    ('ASSET_TAG_EXCLUSIVE', 'https://res.cloudinary.com/video-app-/image/upload/v1764857735/exclusive-tag_hri0yi.png', ARRAY['instagram_story', 'instagram_post', 'facebook_ad'], 'tesco'), 
+    ('ASSET_TAG_AVAILABLE', 'https://res.cloudinary.com/video-app-/image/upload/v1764857734/available-tag_ohl3xq.png', ARRAY['instagram_story', 'instagram_post', 'facebook_ad'], 'tesco'), 
+    ('ASSET_LEP_LOGO', 'https://res.cloudinary.com/video-app-/image/upload/v1764930443/low-everyday-prices-logo_zugj7k.png', ARRAY['instagram_story', 'instagram_post', 'facebook_ad'], 'tesco'), 
+    ('ASSET_WHITE_TILE', 'https://res.cloudinary.com/video-app-/image/upload/v1764847074/white_tile_file_tqg0ji.png', ARRAY['instagram_story', 'instagram_post', 'facebook_ad'], 'tesco'); 
+
+-- +goose Down
+DROP TABLE IF EXISTS static_assets; 
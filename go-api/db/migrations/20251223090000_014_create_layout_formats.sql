@@ -0,0 +1,20 @@
+-- +goose Up
+-- Canvas sizes a workspace generates for besides the built-in story, post
+-- and ad formats, which live in the server and cannot be shadowed.
+CREATE TABLE layout_formats(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE, 
+    key TEXT NOT NULL CHECK (key ~ '^[a-z0-9_]+$'), 
+    name TEXT NOT NULL, 
+    width INTEGER NOT NULL CHECK (width > 0), 
+    height INTEGER NOT NULL CHECK (height > 0), 
+    safe_zone_top INTEGER NOT NULL DEFAULT 0 CHECK (safe_zone_top >= 0), 
+    safe_zone_bottom INTEGER NOT NULL DEFAULT 0 CHECK (safe_zone_bottom >= 0), 
+    min_font_size INTEGER NOT NULL DEFAULT 0 CHECK (min_font_size >= 0), 
+    platform TEXT NOT NULL, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(), 
+    UNIQUE (workspace_id, key)
+); 
+
+-- +goose Down
+DROP TABLE IF EXISTS layout_formats; 
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Structured details of a failure, such as the path of every schema problem
+-- in a layout the model returned, alongside the error message.
+ALTER TABLE generation_jobs
+    ADD COLUMN error_details JSONB; 
+
+-- +goose Down
+ALTER TABLE generation_jobs
+    DROP COLUMN IF EXISTS error_details; 
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Short-lived tokens for clients that cannot send headers, such as
+-- EventSource. Each is issued under an API key and dies with it; only the
+-- sha256 of a token is stored.
+CREATE TABLE session_tokens(
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(), 
+    api_key_id UUID NOT NULL REFERENCES api_keys(id) ON DELETE CASCADE, 
+    token_hash TEXT NOT NULL UNIQUE, 
+    expires_at TIMESTAMPTZ NOT NULL, 
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+); 
+
+CREATE INDEX ON session_tokens (expires_at); 
+
+-- +goose Down
+DROP TABLE IF EXISTS session_tokens; 
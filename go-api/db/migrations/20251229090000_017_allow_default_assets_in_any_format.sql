@@ -0,0 +1,11 @@
+-- +goose Up
+-- The default static assets were limited to the built-in formats, so LEP
+-- creatives and alcohol promotions could never pass ASSET_FORMAT in a
+-- registered format. Defaults are allowed anywhere; a workspace can still
+-- restrict its own copy of an asset.
+UPDATE static_assets SET formats = '{}', updated_at = NOW()
+WHERE workspace_id IS NULL AND formats = ARRAY['instagram_story', 'instagram_post', 'facebook_ad'];
+
+-- +goose Down
+UPDATE static_assets SET formats = ARRAY['instagram_story', 'instagram_post', 'facebook_ad'], updated_at = NOW()
+WHERE workspace_id IS NULL AND formats = '{}';
@@ -0,0 +1,65 @@
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (
+  user_id,
+  workspace_id,
+  name,
+  prefix,
+  key_hash
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: GetAPIKeyPrincipal :one
+SELECT api_keys.id, api_keys.user_id, api_keys.workspace_id, api_keys.last_used_at, users.email, workspace_members.role, workspace_members.approval_roles
+FROM api_keys
+JOIN users ON users.id = api_keys.user_id
+JOIN workspace_members ON workspace_members.workspace_id = api_keys.workspace_id AND workspace_members.user_id = api_keys.user_id
+WHERE api_keys.key_hash = $1 AND api_keys.revoked_at IS NULL;
+
+-- name: GetSessionTokenPrincipal :one
+SELECT api_keys.id, api_keys.user_id, api_keys.workspace_id, api_keys.last_used_at, users.email, workspace_members.role, workspace_members.approval_roles
+FROM session_tokens
+JOIN api_keys ON api_keys.id = session_tokens.api_key_id
+JOIN users ON users.id = api_keys.user_id
+JOIN workspace_members ON workspace_members.workspace_id = api_keys.workspace_id AND workspace_members.user_id = api_keys.user_id
+WHERE session_tokens.token_hash = $1 AND session_tokens.expires_at > NOW() AND api_keys.revoked_at IS NULL;
+
+-- name: CreateSessionToken :one
+INSERT INTO session_tokens (
+  api_key_id,
+  token_hash,
+  expires_at
+) VALUES (
+  $1, $2, $3
+)
+RETURNING *;
+
+-- name: DeleteExpiredSessionTokens :execrows
+DELETE FROM session_tokens
+WHERE expires_at <= NOW();
+
+-- name: TouchAPIKey :exec
+UPDATE api_keys
+SET last_used_at = NOW()
+WHERE id = $1;
+
+-- name: GetAPIKey :one
+SELECT * FROM api_keys
+WHERE id = $1 AND workspace_id = $2;
+
+-- name: ListAPIKeysForWorkspace :many
+SELECT * FROM api_keys
+WHERE workspace_id = $1
+ORDER BY created_at DESC;
+
+-- name: RevokeAPIKey :one
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE id = $1 AND workspace_id = $2 AND revoked_at IS NULL
+RETURNING *;
+
+-- name: RevokeAPIKeysForMember :exec
+UPDATE api_keys
+SET revoked_at = NOW()
+WHERE workspace_id = $1 AND user_id = $2 AND revoked_at IS NULL;
@@ -0,0 +1,28 @@
+-- name: CreateAuditEvent :exec
+INSERT INTO audit_events (
+  workspace_id,
+  actor_user_id,
+  actor_email,
+  api_key_id,
+  action,
+  target_type,
+  target_id,
+  request_id,
+  before_json,
+  after_json,
+  changes_json
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+);
+
+-- name: ListAuditEvents :many
+SELECT * FROM audit_events
+WHERE workspace_id = @workspace_id
+  AND (sqlc.narg(action)::text IS NULL OR action = sqlc.narg(action))
+  AND (sqlc.narg(target_type)::text IS NULL OR target_type = sqlc.narg(target_type))
+  AND (sqlc.narg(target_id)::uuid IS NULL OR target_id = sqlc.narg(target_id))
+  AND (sqlc.narg(actor_user_id)::uuid IS NULL OR actor_user_id = sqlc.narg(actor_user_id))
+  AND (sqlc.narg(since)::timestamptz IS NULL OR created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until)::timestamptz IS NULL OR created_at < sqlc.narg(until))
+ORDER BY created_at DESC, id
+LIMIT @page_size OFFSET @page_offset;
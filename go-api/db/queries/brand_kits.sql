@@ -3,16 +3,36 @@ INSERT INTO brand_kits (
   name,
   colors_json,
   rules_text,
-  logo_url
+  logo_url,
+  workspace_id
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5
 )
 RETURNING *;
 
--- name: ListBrandKits :many
+-- name: ListBrandKitsForWorkspace :many
 SELECT * FROM brand_kits
+WHERE workspace_id = $1
 ORDER BY created_at DESC; 
 
 -- name: GetBrandKit :one
 SELECT * FROM brand_kits
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetBrandKitForWorkspace :one
+SELECT * FROM brand_kits
+WHERE id = $1 AND workspace_id = $2;
+
+-- name: UpdateBrandKit :one
+UPDATE brand_kits
+SET name = $2, colors_json = $3, rules_text = $4, logo_url = $5, updated_at = NOW()
+WHERE id = $1 AND updated_at = $6
+RETURNING *;
+
+-- name: DeleteBrandKit :execrows
+DELETE FROM brand_kits
+WHERE id = $1;
+
+-- name: DeleteBrandKitIfUnchanged :execrows
+DELETE FROM brand_kits
+WHERE id = $1 AND updated_at = $2;
@@ -0,0 +1,86 @@
+-- name: CreateDesign :one
+INSERT INTO designs (
+  brand_kit_id,
+  name
+) VALUES (
+  $1, $2
+)
+RETURNING *;
+
+-- name: GetDesign :one
+SELECT * FROM designs
+WHERE id = $1;
+
+-- name: GetDesignForWorkspace :one
+SELECT designs.* FROM designs
+JOIN brand_kits ON brand_kits.id = designs.brand_kit_id
+WHERE designs.id = $1 AND brand_kits.workspace_id = $2;
+
+-- name: ListDesignsForBrandKit :many
+SELECT * FROM designs
+WHERE brand_kit_id = $1
+ORDER BY updated_at DESC;
+
+-- name: LockDesign :one
+SELECT * FROM designs
+WHERE id = $1
+FOR UPDATE;
+
+-- name: BumpDesignVersion :one
+UPDATE designs
+SET current_version = current_version + 1, status = 'draft', updated_at = NOW()
+WHERE id = $1 AND current_version = $2
+RETURNING *;
+
+-- name: TransitionDesign :one
+UPDATE designs
+SET status = @to_status, updated_at = NOW()
+WHERE id = @id AND status = @from_status AND current_version = @version::integer
+RETURNING *;
+
+-- name: CreateDesignVersion :one
+INSERT INTO design_versions (
+  design_id,
+  version,
+  layout_json,
+  author,
+  source,
+  note,
+  generation_job_id,
+  restored_from,
+  prompt_name,
+  prompt_version
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+)
+RETURNING *;
+
+-- name: GetDesignVersion :one
+SELECT * FROM design_versions
+WHERE design_id = $1 AND version = $2;
+
+-- name: ListDesignVersions :many
+SELECT * FROM design_versions
+WHERE design_id = $1
+ORDER BY version;
+
+-- name: CreateDesignReview :one
+INSERT INTO design_reviews (
+  design_id,
+  version,
+  action,
+  from_status,
+  to_status,
+  actor_user_id,
+  actor_email,
+  approval_role,
+  reason
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: ListDesignReviews :many
+SELECT * FROM design_reviews
+WHERE design_id = $1
+ORDER BY created_at;
@@ -0,0 +1,70 @@
+-- name: CreateGenerationJob :one
+INSERT INTO generation_jobs (
+  brand_kit_id,
+  request_json
+) VALUES (
+  $1, $2
+)
+RETURNING *;
+
+-- name: GetGenerationJob :one
+SELECT * FROM generation_jobs
+WHERE id = $1;
+
+-- name: GetGenerationJobForWorkspace :one
+SELECT generation_jobs.* FROM generation_jobs
+JOIN brand_kits ON brand_kits.id = generation_jobs.brand_kit_id
+WHERE generation_jobs.id = $1 AND brand_kits.workspace_id = $2;
+
+-- name: ClaimGenerationJob :one
+UPDATE generation_jobs
+SET status = 'running', attempts = attempts + 1, started_at = NOW(), updated_at = NOW()
+WHERE id = (
+  SELECT id FROM generation_jobs
+  WHERE status = 'queued'
+  ORDER BY created_at
+  LIMIT 1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateGenerationJobProgress :one
+UPDATE generation_jobs
+SET progress = $2, stage = $3, updated_at = NOW()
+WHERE id = $1 AND status = 'running'
+RETURNING cancel_requested;
+
+-- name: CompleteGenerationJob :exec
+UPDATE generation_jobs
+SET status = 'succeeded', progress = 100, stage = 'done', result_json = $2, finished_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'running';
+
+-- name: FailGenerationJob :exec
+UPDATE generation_jobs
+SET status = 'failed', error = $2, error_details = $3, finished_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'running';
+
+-- name: MarkGenerationJobCancelled :exec
+UPDATE generation_jobs
+SET status = 'cancelled', finished_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'running';
+
+-- name: RequeueGenerationJob :exec
+UPDATE generation_jobs
+SET status = 'queued', progress = 0, stage = '', updated_at = NOW()
+WHERE id = $1 AND status = 'running';
+
+-- name: RequeueStaleGenerationJobs :execrows
+UPDATE generation_jobs
+SET status = CASE WHEN cancel_requested THEN 'cancelled' ELSE 'queued' END,
+    progress = 0, stage = '', updated_at = NOW()
+WHERE status = 'running' AND updated_at < $1;
+
+-- name: CancelGenerationJob :one
+UPDATE generation_jobs
+SET cancel_requested = TRUE,
+    status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+    finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END,
+    updated_at = NOW()
+WHERE id = $1 AND status IN ('queued', 'running')
+RETURNING *;
@@ -0,0 +1,28 @@
+-- name: CreateLayoutFormat :one
+INSERT INTO layout_formats (
+  workspace_id,
+  key,
+  name,
+  width,
+  height,
+  safe_zone_top,
+  safe_zone_bottom,
+  min_font_size,
+  platform
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
+)
+RETURNING *;
+
+-- name: ListLayoutFormats :many
+SELECT * FROM layout_formats
+WHERE workspace_id = $1
+ORDER BY key;
+
+-- name: GetLayoutFormat :one
+SELECT * FROM layout_formats
+WHERE workspace_id = $1 AND key = $2;
+
+-- name: DeleteLayoutFormat :execrows
+DELETE FROM layout_formats
+WHERE workspace_id = $1 AND key = $2;
@@ -0,0 +1,29 @@
+-- name: CreateModelCall :exec
+INSERT INTO model_calls (
+  workspace_id,
+  brand_kit_id,
+  generation_job_id,
+  operation,
+  provider,
+  model,
+  prompt_tokens,
+  response_tokens,
+  latency_ms,
+  retries,
+  succeeded,
+  error,
+  estimated_cost_micros
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13
+);
+
+-- name: ReportModelCalls :many
+SELECT (model_calls.created_at AT TIME ZONE 'UTC')::date AS day, model_calls.brand_kit_id, COALESCE(brand_kits.name, '')::text AS brand_kit_name, COUNT(*) AS calls, COUNT(*) FILTER (WHERE NOT model_calls.succeeded)::bigint AS failed_calls, SUM(model_calls.retries)::bigint AS retries, SUM(model_calls.prompt_tokens)::bigint AS prompt_tokens, SUM(model_calls.response_tokens)::bigint AS response_tokens, SUM(model_calls.estimated_cost_micros)::bigint AS estimated_cost_micros
+FROM model_calls
+LEFT JOIN brand_kits ON brand_kits.id = model_calls.brand_kit_id
+WHERE model_calls.workspace_id = @workspace_id
+  AND model_calls.created_at >= @since
+  AND model_calls.created_at < @until
+  AND (sqlc.narg(brand_kit_id)::uuid IS NULL OR model_calls.brand_kit_id = sqlc.narg(brand_kit_id))
+GROUP BY 1, 2, 3
+ORDER BY 1 DESC, 3, 2;
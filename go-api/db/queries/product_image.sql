@@ -2,13 +2,58 @@
 INSERT INTO product_images (
   brand_kit_id,
   image_url,
-  image_name
+  image_name,
+  role,
+  position
 ) VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4, $5
 )
 RETURNING *;
 
 -- name: ListProductImagesForBrandKit :many
 SELECT * FROM product_images
 WHERE brand_kit_id = $1
-ORDER BY created_at;
\ No newline at end of file
+ORDER BY position, created_at;
+
+-- name: GetProductImage :one
+SELECT * FROM product_images
+WHERE id = $1;
+
+-- name: UpdateProductImageDescription :one
+UPDATE product_images
+SET description = $2, description_model = $3, description_prompt_version = $4, described_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: NextProductImagePosition :one
+SELECT COALESCE(MAX(position) + 1, 0)::integer AS next_position
+FROM product_images
+WHERE brand_kit_id = $1;
+
+-- name: UpdateProductImage :one
+UPDATE product_images
+SET image_name = $3, role = $4, position = $5
+WHERE id = $1 AND brand_kit_id = $2
+RETURNING *;
+
+-- name: ClearHeroProductImage :exec
+UPDATE product_images
+SET role = 'secondary'
+WHERE brand_kit_id = $1 AND role = 'hero' AND id <> $2;
+
+-- name: EnsureHeroProductImage :exec
+UPDATE product_images
+SET role = 'hero'
+WHERE id = (
+  SELECT id FROM product_images
+  WHERE brand_kit_id = $1
+  ORDER BY position, created_at
+  LIMIT 1
+) AND NOT EXISTS (
+  SELECT 1 FROM product_images
+  WHERE brand_kit_id = $1 AND role = 'hero'
+);
+
+-- name: DeleteProductImage :execrows
+DELETE FROM product_images
+WHERE id = $1 AND brand_kit_id = $2;
@@ -0,0 +1,73 @@
+-- name: NextPromptTemplateVersion :one
+SELECT COALESCE(MAX(version) + 1, 1)::integer AS next_version
+FROM prompt_templates
+WHERE workspace_id = $1 AND name = $2;
+
+-- name: CreatePromptTemplate :one
+INSERT INTO prompt_templates (
+  workspace_id,
+  name,
+  version,
+  body,
+  hash,
+  note,
+  author
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+RETURNING *;
+
+-- name: GetPromptTemplate :one
+SELECT * FROM prompt_templates
+WHERE workspace_id = $1 AND name = $2 AND version = $3;
+
+-- name: ListPromptTemplateVersions :many
+SELECT * FROM prompt_templates
+WHERE workspace_id = $1 AND name = $2
+ORDER BY version DESC;
+
+-- name: SetActivePromptVersion :one
+INSERT INTO active_prompt_templates (
+  workspace_id,
+  name,
+  version
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (workspace_id, name) DO UPDATE
+SET version = EXCLUDED.version, updated_at = NOW()
+RETURNING *;
+
+-- name: ListActivePromptVersions :many
+SELECT * FROM active_prompt_templates
+WHERE workspace_id = $1
+ORDER BY name;
+
+-- name: GetActivePromptVersion :one
+SELECT version FROM active_prompt_templates
+WHERE workspace_id = $1 AND name = $2;
+
+-- name: SetBrandKitPromptPin :one
+INSERT INTO brand_kit_prompt_pins (
+  brand_kit_id,
+  name,
+  version
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (brand_kit_id, name) DO UPDATE
+SET version = EXCLUDED.version, created_at = NOW()
+RETURNING *;
+
+-- name: DeleteBrandKitPromptPin :execrows
+DELETE FROM brand_kit_prompt_pins
+WHERE brand_kit_id = $1 AND name = $2;
+
+-- name: GetBrandKitPromptPin :one
+SELECT version FROM brand_kit_prompt_pins
+WHERE brand_kit_id = $1 AND name = $2;
+
+-- name: ListBrandKitPromptPins :many
+SELECT * FROM brand_kit_prompt_pins
+WHERE brand_kit_id = $1
+ORDER BY name;
@@ -0,0 +1,25 @@
+-- name: ListStaticAssets :many
+SELECT * FROM static_assets
+WHERE workspace_id IS NULL OR workspace_id = $1
+ORDER BY key, workspace_id NULLS FIRST;
+
+-- name: SetStaticAsset :one
+INSERT INTO static_assets (
+  workspace_id,
+  key,
+  url,
+  width,
+  height,
+  formats,
+  retailer
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7
+)
+ON CONFLICT (workspace_id, key) DO UPDATE
+SET url = EXCLUDED.url,
+    width = EXCLUDED.width,
+    height = EXCLUDED.height,
+    formats = EXCLUDED.formats,
+    retailer = EXCLUDED.retailer,
+    updated_at = NOW()
+RETURNING *;
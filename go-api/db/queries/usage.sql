@@ -0,0 +1,39 @@
+-- name: GetGenerationLimits :one
+SELECT workspaces.generation_rate_limit AS workspace_rate_limit, workspaces.generation_daily_quota AS workspace_daily_quota, api_keys.generation_rate_limit AS key_rate_limit, api_keys.generation_daily_quota AS key_daily_quota
+FROM api_keys
+JOIN workspaces ON workspaces.id = api_keys.workspace_id
+WHERE api_keys.id = $1;
+
+-- name: IncrementUsageCounter :one
+INSERT INTO usage_counters (
+  scope,
+  scope_id,
+  period,
+  window_start,
+  count
+) VALUES (
+  $1, $2, $3, $4, $5
+)
+ON CONFLICT (scope, scope_id, period, window_start) DO UPDATE
+SET count = usage_counters.count + EXCLUDED.count
+RETURNING count;
+
+-- name: GetUsageCount :one
+SELECT count FROM usage_counters
+WHERE scope = $1 AND scope_id = $2 AND period = $3 AND window_start = $4;
+
+-- name: DeleteUsageCountersBefore :execrows
+DELETE FROM usage_counters
+WHERE window_start < $1;
+
+-- name: SetWorkspaceGenerationLimits :one
+UPDATE workspaces
+SET generation_rate_limit = $2, generation_daily_quota = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: SetAPIKeyGenerationLimits :one
+UPDATE api_keys
+SET generation_rate_limit = $3, generation_daily_quota = $4
+WHERE id = $1 AND workspace_id = $2 AND revoked_at IS NULL
+RETURNING *;
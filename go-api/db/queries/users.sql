@@ -0,0 +1,14 @@
+-- name: UpsertUser :one
+INSERT INTO users (
+  email,
+  name
+) VALUES (
+  $1, $2
+)
+ON CONFLICT (email) DO UPDATE
+SET name = CASE WHEN EXCLUDED.name = '' THEN users.name ELSE EXCLUDED.name END
+RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = $1;
@@ -0,0 +1,52 @@
+-- name: CreateWorkspace :one
+INSERT INTO workspaces (
+  name
+) VALUES (
+  $1
+)
+RETURNING *;
+
+-- name: GetWorkspace :one
+SELECT * FROM workspaces
+WHERE id = $1;
+
+-- name: ListUnownedWorkspaces :many
+SELECT * FROM workspaces
+WHERE NOT EXISTS (
+  SELECT 1 FROM workspace_members
+  WHERE workspace_members.workspace_id = workspaces.id AND workspace_members.role = 'owner'
+)
+ORDER BY created_at;
+
+-- name: AddWorkspaceMember :one
+INSERT INTO workspace_members (
+  workspace_id,
+  user_id,
+  role
+) VALUES (
+  $1, $2, $3
+)
+ON CONFLICT (workspace_id, user_id) DO UPDATE
+SET role = EXCLUDED.role
+RETURNING *;
+
+-- name: ListWorkspaceMembers :many
+SELECT users.id, users.email, users.name, workspace_members.role, workspace_members.approval_roles, workspace_members.created_at
+FROM workspace_members
+JOIN users ON users.id = workspace_members.user_id
+WHERE workspace_members.workspace_id = $1
+ORDER BY workspace_members.created_at;
+
+-- name: RemoveWorkspaceMember :execrows
+DELETE FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: GetWorkspaceMember :one
+SELECT * FROM workspace_members
+WHERE workspace_id = $1 AND user_id = $2;
+
+-- name: SetWorkspaceMemberApprovalRoles :one
+UPDATE workspace_members
+SET approval_roles = $3
+WHERE workspace_id = $1 AND user_id = $2
+RETURNING *;
@@ -1,11 +1,18 @@
 package handlers
 
 import (
+	"bytes"
+	"canvas-backend/accounting"
+	"canvas-backend/audit"
+	"canvas-backend/auth"
 	"canvas-backend/internal/db"
+	"canvas-backend/jobs"
+	"canvas-backend/llm"
+	"canvas-backend/prompts"
+	"canvas-backend/quota"
+	"canvas-backend/storage"
 	"canvas-backend/types"
-	"canvas-backend/util"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,31 +20,50 @@ import (
 	"log"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"google.golang.org/genai"
+	"golang.org/x/sync/singleflight"
 )
 
 type APIState struct {
-	Pool         *pgxpool.Pool
-	Queries      *db.Queries
-	Cld          *cloudinary.Cloudinary
-	GeminiClient *genai.Client
+	Pool      *pgxpool.Pool
+	Queries   *db.Queries
+	Assets    storage.AssetStore
+	Layouts   llm.LayoutGenerator
+	Describer llm.ImageDescriber
+	Jobs      *jobs.Pool
+	Limits    *quota.Limiter
+	Prompts   *prompts.Registry
+
+	// ProviderName and ModelName are what model calls are accounted
+	// against until the model reports a more specific name.
+	ProviderName string
+	ModelName    string
+	// DescriptionModel is recorded with stored image descriptions.
+	DescriptionModel string
+	describing       singleflight.Group
 }
 
-func New(pool *pgxpool.Pool, queries *db.Queries, cld *cloudinary.Cloudinary, gemini_client *genai.Client) *APIState {
-	return &APIState{
-		Pool:         pool,
-		Queries:      queries,
-		Cld:          cld,
-		GeminiClient: gemini_client,
-	}
+func New(pool *pgxpool.Pool, queries *db.Queries, assets storage.AssetStore, provider llm.Provider) *APIState {
+	h := &APIState{
+		Pool:      pool,
+		Queries:   queries,
+		Assets:    assets,
+		Layouts:   provider,
+		Describer: provider,
+
+		ProviderName:     provider.Name(),
+		ModelName:        provider.ModelName(),
+		DescriptionModel: provider.Name() + "/" + provider.ModelName(),
+	}
+	h.Jobs = jobs.NewPool(queries, jobs.DEFAULT_WORKERS, h.runGenerationJob)
+	h.Limits = quota.NewLimiter(pool, queries)
+	h.Prompts = prompts.NewRegistry(queries)
+	return h
 }
 
 func (h *APIState) PingHandler(w http.ResponseWriter, r *http.Request) {
@@ -45,9 +71,7 @@ func (h *APIState) PingHandler(w http.ResponseWriter, r *http.Request) {
 		Message: "Pong",
 		Data:    nil,
 	}
-	w.Header().Add("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (h *APIState) HandleGetBrandKit(w http.ResponseWriter, r *http.Request) {
@@ -57,31 +81,28 @@ func (h *APIState) HandleGetBrandKit(w http.ResponseWriter, r *http.Request) {
 	err := kit_uuid.Scan(kit_id)
 
 	response := types.APIResponse{}
-	w.Header().Add("Content-Type", "application/json")
 
 	if err != nil {
 		response.Message = "ERROR: Cannot parse the uuid from the URL"
-		w.WriteHeader(http.StatusBadRequest)
 		response.Data = nil
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		log.Printf("ERROR: Cannot parse the uuid from the URL, error: %v\n", err)
 		return
 	}
 
-	kit, err := h.Queries.GetBrandKit(r.Context(), kit_uuid)
+	kit, err := h.Queries.GetBrandKitForWorkspace(r.Context(), db.GetBrandKitForWorkspaceParams{ID: kit_uuid, WorkspaceID: workspaceID(r)})
 	if err != nil {
 		response.Data = nil
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			response.Message = "ERROR: No kits found"
-			w.WriteHeader(http.StatusBadRequest)
 			log.Printf("ERROR: No kits found, error: %v\n", err)
+			writeJSON(w, http.StatusBadRequest, response)
 		} else {
 			response.Message = "ERROR: Something went wrong"
-			w.WriteHeader(http.StatusInternalServerError)
 			log.Printf("ERROR: Something went wrong while fetching brandkits for id %v, error: %v\n", kit_id, err)
+			writeJSON(w, http.StatusInternalServerError, response)
 
 		}
-		json.NewEncoder(w).Encode(response)
 		return
 	}
 
@@ -89,9 +110,8 @@ func (h *APIState) HandleGetBrandKit(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		response.Data = nil
 		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("ERROR: Something went wrong while fetching brandkits for id %v, error: %v\n", kit_id, err)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
 
@@ -103,22 +123,20 @@ func (h *APIState) HandleGetBrandKit(w http.ResponseWriter, r *http.Request) {
 	log.Println("SUCCESS: successfully fetched the brandkit")
 	response.Message = "SUCCESS: successfully fetched the brandkit"
 	response.Data = brand_kit_response
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	w.Header().Set("ETag", brandKitETag(kit))
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (h *APIState) HandleListBrandKits(w http.ResponseWriter, r *http.Request) {
-	kits, err := h.Queries.ListBrandKits(r.Context())
+	kits, err := h.Queries.ListBrandKitsForWorkspace(r.Context(), workspaceID(r))
 
 	response := types.APIResponse{}
-	w.Header().Add("Content-Type", "application/json")
 
 	if err != nil {
 		response.Data = nil
 		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
 		log.Printf("ERROR: Something went wrong while fetching brandkits, error: %v\n", err)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
 
@@ -129,20 +147,17 @@ func (h *APIState) HandleListBrandKits(w http.ResponseWriter, r *http.Request) {
 	log.Println("SUCCESS: Successfully fetched the brandkits")
 	response.Message = "SUCCESS: Successfully fetched the brandkits"
 	response.Data = brand_kit_response
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (h *APIState) HandleUploadLogo(w http.ResponseWriter, r *http.Request) {
 	response := types.APIResponse{}
 	response.Data = nil
-	w.Header().Add("Content-Type", "application/json")
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		log.Printf("ERROR: Unable to parse the multipart form, error: %v\n", err)
 		response.Message = "ERROR: File too large (max 10MB allowed)"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
 
@@ -150,47 +165,43 @@ func (h *APIState) HandleUploadLogo(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("ERROR: Failed to get the logo_file, error: %v\n", err)
 		response.Message = "ERROR: Failed to get the logo_file"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
 	defer file.Close()
 
-	resp, err := h.Cld.Upload.Upload(r.Context(), file, uploader.UploadParams{
-		PublicID:       header.Filename,
-		Transformation: "e_background_removal/e_trim",
-		Format:         "png",
+	asset, err := h.Assets.Put(r.Context(), file, storage.PutOptions{
+		Name:             header.Filename,
+		Format:           "png",
+		RemoveBackground: true,
 	})
 
 	if err != nil {
-		log.Printf("ERROR: Unable to upload the logo_file to cloudinary server, error: %v\n", err)
+		log.Printf("ERROR: Unable to upload the logo_file to the %s asset store, error: %v\n", h.Assets.Name(), err)
 		response.Message = "ERROR: Unable to upload the file"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
 
 	logo_upload_response := types.ImageUploadResponse{
-		URL: resp.SecureURL,
+		URL: asset.URL,
 	}
+	h.recordAudit(r, audit.Event{Action: audit.ACTION_ASSET_UPLOAD, TargetType: audit.TARGET_ASSET, After: asset})
 
-	log.Println("SUCCESS: Successfully uploaded the logo_file to cloudinary")
-	response.Message = "SUCCESS: Successfully uploaded the file to cloudinary"
+	log.Println("SUCCESS: Successfully uploaded the logo_file")
+	response.Message = "SUCCESS: Successfully uploaded the file"
 	response.Data = logo_upload_response
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusCreated, response)
 }
 
 func (h *APIState) HandleUploadProductImage(w http.ResponseWriter, r *http.Request) {
 	response := types.APIResponse{}
 	response.Data = nil
-	w.Header().Add("Content-Type", "application/json")
 
 	if err := r.ParseMultipartForm(10 << 20); err != nil {
 		log.Printf("ERROR: Unable to parse the multipart form, error: %v\n", err)
 		response.Message = "ERROR: File too large (max 10MB allowed)"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
 
@@ -198,40 +209,37 @@ func (h *APIState) HandleUploadProductImage(w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		log.Printf("ERROR: Failed to get the product_file, error: %v\n", err)
 		response.Message = "ERROR: Failed to get the product_file"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
 	defer file.Close()
 
-	resp, err := h.Cld.Upload.Upload(r.Context(), file, uploader.UploadParams{
-		PublicID:       header.Filename,
-		Transformation: "e_background_removal/e_trim",
-		Format:         "png",
+	asset, err := h.Assets.Put(r.Context(), file, storage.PutOptions{
+		Name:             header.Filename,
+		Format:           "png",
+		RemoveBackground: true,
 	})
 
 	if err != nil {
-		log.Printf("ERROR: Unable to upload the product_file to cloudinary server, error: %v\n", err)
+		log.Printf("ERROR: Unable to upload the product_file to the %s asset store, error: %v\n", h.Assets.Name(), err)
 		response.Message = "ERROR: Unable to upload the file"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
 
 	product_image_upload_response := types.ImageUploadResponse{
-		URL: resp.SecureURL,
+		URL: asset.URL,
 	}
-	log.Println("SUCCESS: Successfully uploaded the product image to cloudinary")
-	response.Message = "SUCCESS: Successfully uploaded the file to cloudinary"
+	h.recordAudit(r, audit.Event{Action: audit.ACTION_ASSET_UPLOAD, TargetType: audit.TARGET_ASSET, After: asset})
+	log.Println("SUCCESS: Successfully uploaded the product image")
+	response.Message = "SUCCESS: Successfully uploaded the file"
 	response.Data = product_image_upload_response
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusCreated, response)
 }
 
 func (h *APIState) HandleCreateBrandKit(w http.ResponseWriter, r *http.Request) {
 	response := types.APIResponse{}
 	response.Data = nil
-	w.Header().Add("Content-Type", "application/json")
 
 	request_body := types.BrandKitRequest{}
 
@@ -239,8 +247,7 @@ func (h *APIState) HandleCreateBrandKit(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
 		response.Message = "ERROR: Unable to parse the request body"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
 
@@ -260,8 +267,7 @@ func (h *APIState) HandleCreateBrandKit(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
 		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
 	defer tx.Rollback(r.Context())
@@ -269,45 +275,66 @@ func (h *APIState) HandleCreateBrandKit(w http.ResponseWriter, r *http.Request)
 	qtx := h.Queries.WithTx(tx)
 
 	brand_kit, err := qtx.CreateBrandKit(r.Context(), db.CreateBrandKitParams{
-		Name:       request_body.Name,
-		ColorsJson: request_body.ColorsJson,
-		RulesText:  rules_text,
-		LogoUrl:    logo_url,
+		Name:        request_body.Name,
+		ColorsJson:  request_body.ColorsJson,
+		RulesText:   rules_text,
+		LogoUrl:     logo_url,
+		WorkspaceID: workspaceID(r),
 	})
 
 	if err != nil {
 		log.Printf("ERROR: Something went wrong while creating brandkit, error: %v\n", err)
 		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
 
 	log.Println("SUCCESS: Successfully created the brandkit")
-	for _, image_url := range request_body.Images {
-		var image_name pgtype.Text
-		_, err := qtx.CreateProductImage(r.Context(), db.CreateProductImageParams{
+	product_images := []db.ProductImage{}
+	for i, image_url := range request_body.Images {
+		role := types.IMAGE_ROLE_SECONDARY
+		if i == 0 {
+			role = types.IMAGE_ROLE_HERO
+		}
+
+		product_image, err := qtx.CreateProductImage(r.Context(), db.CreateProductImageParams{
 			BrandKitID: brand_kit.ID,
 			ImageUrl:   image_url,
-			ImageName:  image_name,
+			ImageName:  optionalText(imageNameFromURL(image_url)),
+			Role:       role,
+			Position:   int32(i),
 		})
 
 		if err != nil {
 			log.Printf("ERROR: Something went wrong while creating new product image, error: %v\n", err)
 			response.Message = "ERROR: Something went wrong"
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(response)
+			writeJSON(w, http.StatusInternalServerError, response)
 			return
 		}
+		product_images = append(product_images, product_image)
+	}
+
+	if err := audit.Record(r.Context(), qtx, audit.Event{
+		Action:     audit.ACTION_BRAND_KIT_CREATE,
+		TargetType: audit.TARGET_BRAND_KIT,
+		TargetID:   brand_kit.ID,
+		After:      types.BrandKitAndImagesResponse{BrandKit: brand_kit, Images: product_images},
+	}); err != nil {
+		log.Printf("ERROR: Unable to record the audit event, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
 	}
 
 	if err := tx.Commit(r.Context()); err != nil {
 		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
 		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
+
+	principal, _ := auth.FromContext(r.Context())
+	go h.describeInBackground(principal, brand_kit, product_images)
 	brand_kits := []db.BrandKit{brand_kit}
 
 	log.Println("SUCCESS: Successfully created the product images")
@@ -315,53 +342,75 @@ func (h *APIState) HandleCreateBrandKit(w http.ResponseWriter, r *http.Request)
 	response.Data = types.BrandKitResponse{
 		Brandkits: brand_kits,
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	writeJSON(w, http.StatusCreated, response)
 }
 
 func (h *APIState) HandleExport(w http.ResponseWriter, r *http.Request) {
 	response := types.APIResponse{}
 	response.Data = nil
-	w.Header().Add("Content-Type", "application/json")
 
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_RENDER_BODY_BYTES)
 	var request_body types.ExportRequest
-	err := json.NewDecoder(r.Body).Decode(&request_body)
-
-	if err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
 		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
 		response.Message = "ERROR: Unable to parse the request body"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	if !request_body.DesignID.Valid {
+		response.Message = "ERROR: design_id is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if !validOutput(request_body.Output) {
+		log.Printf("ERROR: Unsupported output format %q\n", request_body.Output)
+		response.Message = "ERROR: Unsupported output format (use png or jpeg)"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	// The image is rendered here from the approved version, never taken
+	// from the client, so what is exported is what was signed off.
+	design, version, ok := h.loadExportableDesign(w, r, request_body.DesignID)
+	if !ok {
+		return
+	}
+	data, format, ok := renderLayout(w, r, version.LayoutJson, request_body.Format, request_body.Output, request_body.Quality, "")
+	if !ok {
 		return
 	}
 
-	resp, err := h.Cld.Upload.Upload(r.Context(), request_body.URL, uploader.UploadParams{})
+	asset, err := h.Assets.Put(r.Context(), bytes.NewReader(data), storage.PutOptions{})
 	if err != nil {
-		log.Printf("ERROR: Unable to upload the exported image to cloudinary server, error: %v\n", err)
+		log.Printf("ERROR: Unable to upload the exported image to the %s asset store, error: %v\n", h.Assets.Name(), err)
 		response.Message = "ERROR: Unable to upload the exported image"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
 
-	log.Println("SUCCESS: Successfully uploaded the exported image to cloudinary")
-	response.Message = "SUCCESS: Successfully uploaded the exported image to cloudinary"
-	response.Data = types.ExportResponse{URL: resp.SecureURL}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	h.recordAudit(r, audit.Event{
+		Action:     audit.ACTION_DESIGN_EXPORT,
+		TargetType: audit.TARGET_DESIGN,
+		TargetID:   design.ID,
+		After:      types.DesignExportEvent{Version: version.Version, Status: design.Status, Format: format, URL: asset.URL},
+	})
+
+	log.Println("SUCCESS: Successfully uploaded the exported image")
+	response.Message = "SUCCESS: Successfully uploaded the exported image"
+	response.Data = types.ExportResponse{URL: asset.URL}
+	writeJSON(w, http.StatusCreated, response)
 }
 
 func (h *APIState) HandleGenerateLayout(w http.ResponseWriter, r *http.Request) {
 	response := types.APIResponse{}
 	response.Data = nil
-	w.Header().Add("Content-Type", "application/json")
 
 	kit_id := chi.URLParam(r, "kit_id")
 	if kit_id == "" {
 		log.Printf("ERROR: Invalid kit id (empty), error: nil\n")
 		response.Message = "ERROR: Invalid kit id (empty)"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
 
@@ -371,190 +420,119 @@ func (h *APIState) HandleGenerateLayout(w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		log.Printf("ERROR: Unable to kit id to uuid, error: %v\n", err)
 		response.Message = "ERROR: Invalid kit id"
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
 
-	kit, err := h.Queries.GetBrandKit(r.Context(), kit_uuid)
+	kit, err := h.Queries.GetBrandKitForWorkspace(r.Context(), db.GetBrandKitForWorkspaceParams{ID: kit_uuid, WorkspaceID: workspaceID(r)})
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("ERROR: No kits found, error: %v\n", err)
 			response.Message = "ERROR: No kits found with this id"
-			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, http.StatusBadRequest, response)
 		} else {
 			response.Message = "ERROR: Something went wrong"
 			log.Printf("ERROR: Something went wrong while fetching brandkits for id %v, error: %v\n", kit_id, err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeJSON(w, http.StatusInternalServerError, response)
 		}
-		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	images, err := h.Queries.ListProductImagesForBrandKit(r.Context(), kit_uuid)
-	if err != nil {
-		log.Printf("ERROR: Something went wrong while fetching images for id %v, error: %v\n", kit_id, err)
-		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+	var request_body types.GenerateLayoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
 		return
 	}
-	if images == nil {
-		images = []db.ProductImage{}
-	}
-
-	// === CONCURRENCY FIX START ===
-	image_descriptions := make(map[string]string)
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-
-	for _, image := range images {
-		wg.Add(1)
-		go func(imgURL string) {
-			defer wg.Done()
-			description, err := h.getImageDescription(r.Context(), imgURL)
-			if err != nil {
-				log.Printf("WARN: Unable to describe image %s: %v\n", imgURL, err)
-				description = "A product image"
-			}
-			mu.Lock()
-			image_descriptions[imgURL] = description
-			mu.Unlock()
-		}(image.ImageUrl)
-	}
-	wg.Wait()
-	// === CONCURRENCY FIX END ===
-
-	var ImageUrlArray []string
-	for _, image := range images {
-		ImageUrlArray = append(ImageUrlArray, image.ImageUrl)
-	}
-
-	// === TAGLINE FIX START ===
-	// Extract the tagline from the raw JSON rules string
-	var rules types.RulesData
 
-	// Attempt to unmarshal. If it fails, we fall back to raw string.
-	err = json.Unmarshal([]byte(kit.RulesText.String), &rules)
+	request, err := h.checkGenerationRequest(r.Context(), kit, request_body)
 	if err != nil {
-		log.Printf("WARN: Failed to parse detailed rules JSON, falling back to raw string. Error: %v", err)
-		rules.Prompt = kit.RulesText.String
-	}
-
-	systemPrompt := util.LEP_JSON_PROMPT
-	var mandates strings.Builder
-
-	mandates.WriteString(fmt.Sprintf("DESIGN TONE: %s. STYLE: %s.\n", rules.Tone, rules.Style))
-	mandates.WriteString(fmt.Sprintf("BRAND NAME: %s.", kit.Name))
-
-	if rules.Compliance.Headline != "" {
-		mandates.WriteString(fmt.Sprintf("MANDATORY HEADLINE: \"%s\"\n", rules.Compliance.Headline))
-	}
-	if rules.Compliance.Subhead != "" {
-		mandates.WriteString(fmt.Sprintf("MANDATORY SUBHEAD: \"%s\"\n", rules.Compliance.Subhead))
-	}
-	if rules.Compliance.IsAlcoholPromotion {
-		mandates.WriteString("MANDATORY: Include 'Drinkaware.co.uk' logo.\n")
-	}
-
-	if rules.Compliance.CreativeMode != "lep" {
-		if rules.Compliance.TescoFinalTag != "" && rules.Compliance.TescoFinalTag != "Selected stores. While stocks last." {
-			mandates.WriteString(fmt.Sprintf("MANDATORY FOOTER TAG: \"%s\" (Place at bottom use the logo from assets).\n", rules.Compliance.TescoFinalTag))
-		}
-
-		if rules.Compliance.ValueTile != nil {
-			vt := rules.Compliance.ValueTile
-			if vt.Type == "clubcard" {
-				mandates.WriteString(fmt.Sprintf("USE THE CLUBCARD PRICE TILE. Large Price: %s. Small Regular Price: %s. Date: %s.\n", vt.OfferPrice, vt.RegularPrice, vt.EndDate))
-			} else if vt.Type == "white" {
-				mandates.WriteString(fmt.Sprintf("USE THE WHITE VALUE TILE. Price: %s.\n", vt.WhitePrice))
-			} else if vt.Type == "new" {
-				mandates.WriteString("USE THE 'NEW' BADGE .\n")
-			}
+		var invalid *invalidRequestError
+		if errors.As(err, &invalid) {
+			response.Message = "ERROR: " + invalid.message
+			writeJSON(w, http.StatusBadRequest, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the formats, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
 		}
-
-		systemPrompt = util.FABRIC_JSON_PROMPT
+		return
 	}
 
-	finalUserPrompt := fmt.Sprintf(`
-	MANDATORY TAGLINE TO INCLUDE (Do not ignore this): "%s"
-	`, mandates.String())
-
-	json_request := types.JsonRequest{
-		UserPrompt:        finalUserPrompt,
-		Colors:            kit.ColorsJson,
-		Logo:              kit.LogoUrl.String,
-		ImageDescriptions: image_descriptions,
-		ImageURLs:         ImageUrlArray,
+	if !h.Limits.Allow(w, r, int32(request.Variants)) {
+		return
 	}
 
-	result, err := h.getFabricJSON(r.Context(), json_request, systemPrompt)
+	tx, err := h.Pool.Begin(r.Context())
 	if err != nil {
-		log.Printf("ERROR: Unable to generate the fabric json")
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
 		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
 
-	var resultObj map[string]interface{}
-	if err := json.Unmarshal([]byte(result), &resultObj); err != nil {
-		log.Printf("ERROR: Unable to parse the fabric json string, error: %v\n", err)
+	job, err := h.Jobs.EnqueueWith(r.Context(), qtx, kit.ID, request.GenerateLayoutRequest)
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_GENERATION_ENQUEUE,
+			TargetType: audit.TARGET_GENERATION_JOB,
+			TargetID:   job.ID,
+			After:      types.NewGenerationJobResponse(job),
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Unable to queue the generation job for kit %v, error: %v\n", kit_id, err)
 		response.Message = "ERROR: Something went wrong"
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(response)
+		writeJSON(w, http.StatusInternalServerError, response)
 		return
 	}
+	h.Jobs.Wake()
 
-	log.Println("SUCCESS: Successfully fetched all data for the layout generation")
-	response.Message = "SUCCESS: Successfully generated the data"
-	response.Data = resultObj
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	log.Println("SUCCESS: Successfully queued the layout generation")
+	response.Message = "SUCCESS: Successfully queued the layout generation"
+	response.Data = types.NewGenerationJobResponse(job)
+	w.Header().Set("Location", "/jobs/"+uuidString(job.ID))
+	writeJSON(w, http.StatusAccepted, response)
 }
 
-func (h *APIState) getImageDescription(ctx context.Context, image_url string) (string, error) {
+func (h *APIState) getImageDescription(ctx context.Context, image_url string, prompt string) (description string, err error) {
 	const MAX_RETRIES = 3
 	var final_error error
 
+	call := h.newModelCall(accounting.OPERATION_DESCRIBE_IMAGE)
+	defer func() { h.recordModelCall(ctx, call, err) }()
+
 	for i := 0; i < MAX_RETRIES; i++ {
-		resp, err := http.Get(image_url)
+		image_bytes, err := storage.OpenSource(ctx, image_url)
 		if err != nil {
 			final_error = fmt.Errorf("ERROR: Failed to download the image, error: %v", err)
 			continue
 		}
 
-		image_bytes, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		if err != nil {
-			final_error = fmt.Errorf("ERROR: Failed to read the image, error: %v", err)
-			continue
-		}
-
 		mime_type := http.DetectContentType(image_bytes)
-		prompt := util.IMAGE_DESCRIPTION_PROMPT
-
-		parts := []*genai.Part{
-			{Text: prompt},
-			{InlineData: &genai.Blob{Data: image_bytes, MIMEType: mime_type}},
-		}
-
-		result, err := h.GeminiClient.Models.GenerateContent(ctx, "gemini-2.5-flash", []*genai.Content{{Parts: parts}}, nil)
 
+		started := time.Now()
+		model_response, err := h.Describer.DescribeImage(ctx, llm.ImageRequest{
+			Prompt:   prompt,
+			Data:     image_bytes,
+			MIMEType: mime_type,
+		})
+		call.Attempt(model_response, time.Since(started))
 		if err == nil {
-			if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
-				final_error = fmt.Errorf("ERROR: No content generated")
-				continue
-			}
-			text := result.Candidates[0].Content.Parts[0].Text
-			return text, nil
+			return model_response.Text, nil
 		}
 
 		final_error = err
-		log.Printf("WARN: Gemini call attempt %d/%d failed: %v", i+1, MAX_RETRIES, err)
+		log.Printf("WARN: Model call attempt %d/%d failed: %v", i+1, MAX_RETRIES, err)
 
-		if strings.Contains(err.Error(), "UNAVAILABLE") {
+		if errors.Is(err, llm.ErrUnavailable) {
 			time.Sleep(500 * time.Millisecond)
 			continue
 		} else {
@@ -562,56 +540,57 @@ func (h *APIState) getImageDescription(ctx context.Context, image_url string) (s
 		}
 	}
 
-	return "", fmt.Errorf("ERROR: All retries failed. Last error: %v", final_error)
+	return "", fmt.Errorf("ERROR: All retries failed. Last error: %w", final_error)
 }
 
-func (h *APIState) getFabricJSON(ctx context.Context, json_request types.JsonRequest, systemPrompt string) (string, error) {
+func (h *APIState) getFabricJSON(ctx context.Context, layout_request llm.LayoutRequest, emit func(types.GenerationEvent)) (fabric_json string, err error) {
 	const MAX_RETRIES = 3
 	var final_error error
 
-	var sb strings.Builder
-	encoder := json.NewEncoder(&sb)
-	encoder.SetEscapeHTML(false)
-	encoder.SetIndent("", "  ")
-
-	if err := encoder.Encode(json_request); err != nil {
-		return "", fmt.Errorf("failed to encode request: %v", err)
-	}
-
-	jsonString := sb.String()
+	call := h.newModelCall(accounting.OPERATION_GENERATE_LAYOUT)
+	defer func() { h.recordModelCall(ctx, call, err) }()
 
 	for i := 0; i < MAX_RETRIES; i++ {
-		prompt := systemPrompt
-
-		parts := []*genai.Part{
-			{Text: prompt + "\n\nContext Data:\n" + jsonString},
-		}
-
-		result, err := h.GeminiClient.Models.GenerateContent(ctx, "gemini-2.5-flash", []*genai.Content{{Parts: parts}}, nil)
+		emit(types.GenerationEvent{
+			Event:    EVENT_PROMPT_SENT,
+			Progress: 55,
+			Stage:    "generating layout",
+			Data:     types.AttemptEvent{Attempt: i + 1, MaxAttempts: MAX_RETRIES},
+		})
+		started := time.Now()
+		model_response, err := h.Layouts.GenerateLayout(ctx, layout_request)
+		call.Attempt(model_response, time.Since(started))
 
 		if err == nil {
-			if len(result.Candidates) == 0 || len(result.Candidates[0].Content.Parts) == 0 {
-				final_error = fmt.Errorf("ERROR: No content generated")
-				continue
-			}
-			text := result.Candidates[0].Content.Parts[0].Text
-
-			cleanedText := cleanLLMResponse(text)
+			// Providers without structured output may still fence the JSON.
+			cleanedText := cleanLLMResponse(model_response.Text)
 
 			if !json.Valid([]byte(cleanedText)) {
 				log.Printf("WARN: Invalid JSON on attempt %d/%d, retrying...", i+1, MAX_RETRIES)
 				final_error = fmt.Errorf("invalid JSON received from LLM")
+				emitRetry(emit, i+1, MAX_RETRIES, final_error)
 				time.Sleep(500 * time.Millisecond)
 				continue
 			}
 
+			if layout_request.Schema != nil {
+				if problems := layout_request.Schema.Validate([]byte(cleanedText)); len(problems) > 0 {
+					final_error = &types.LayoutDecodeError{Problems: problems}
+					log.Printf("WARN: Layout does not match the schema on attempt %d/%d, retrying: %v", i+1, MAX_RETRIES, final_error)
+					emitRetry(emit, i+1, MAX_RETRIES, final_error)
+					time.Sleep(500 * time.Millisecond)
+					continue
+				}
+			}
+
 			return cleanedText, nil
 		}
 
 		final_error = err
-		log.Printf("WARN: Gemini call attempt %d/%d failed: %v", i+1, MAX_RETRIES, err)
+		log.Printf("WARN: Model call attempt %d/%d failed: %v", i+1, MAX_RETRIES, err)
 
-		if strings.Contains(err.Error(), "UNAVAILABLE") {
+		if errors.Is(err, llm.ErrUnavailable) {
+			emitRetry(emit, i+1, MAX_RETRIES, err)
 			time.Sleep(500 * time.Millisecond)
 			continue
 		} else {
@@ -619,7 +598,31 @@ func (h *APIState) getFabricJSON(ctx context.Context, json_request types.JsonReq
 		}
 	}
 
-	return "", fmt.Errorf("ERROR: All retries failed. Last error: %v", final_error)
+	return "", fmt.Errorf("ERROR: All retries failed. Last error: %w", final_error)
+}
+
+func (h *APIState) newModelCall(operation string) *accounting.Call {
+	return &accounting.Call{Operation: operation, Provider: h.ProviderName, Model: h.ModelName}
+}
+
+// recordModelCall accounts for a model call. A failure is logged rather
+// than failing a call that has already been paid for.
+func (h *APIState) recordModelCall(ctx context.Context, call *accounting.Call, err error) {
+	if record_err := accounting.Record(ctx, h.Queries, *call, err); record_err != nil {
+		log.Printf("ERROR: Unable to record the %s model call, error: %v\n", call.Operation, record_err)
+	}
+}
+
+func emitRetry(emit func(types.GenerationEvent), attempt, max_attempts int, err error) {
+	if attempt >= max_attempts {
+		return
+	}
+	emit(types.GenerationEvent{
+		Event:    EVENT_RETRY,
+		Progress: 55,
+		Stage:    "generating layout",
+		Data:     types.AttemptEvent{Attempt: attempt, MaxAttempts: max_attempts, Error: err.Error()},
+	})
 }
 
 func cleanLLMResponse(response string) string {
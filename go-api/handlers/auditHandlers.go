@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DEFAULT_AUDIT_PAGE_SIZE = 50
+	MAX_AUDIT_PAGE_SIZE     = 500
+)
+
+// recordAudit records an operation that has no transaction of its own, such
+// as an upload. A failure is logged rather than failing an operation that
+// has already happened.
+func (h *APIState) recordAudit(r *http.Request, event audit.Event) {
+	if err := audit.Record(r.Context(), h.Queries, event); err != nil {
+		log.Printf("ERROR: Unable to record the audit event %s, error: %v\n", event.Action, err)
+	}
+}
+
+// HandleListAuditEvents lists the workspace's audit events, newest first.
+// They can be filtered by action, target_type, target_id, actor (a user id)
+// and an RFC 3339 since/until range, and paged with limit and offset.
+func (h *APIState) HandleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	query := r.URL.Query()
+	params := db.ListAuditEventsParams{
+		WorkspaceID: workspaceID(r),
+		Action:      optionalText(query.Get("action")),
+		TargetType:  optionalText(query.Get("target_type")),
+		PageSize:    DEFAULT_AUDIT_PAGE_SIZE,
+	}
+
+	for name, target := range map[string]*pgtype.UUID{"target_id": &params.TargetID, "actor": &params.ActorUserID} {
+		if value := query.Get(name); value != "" {
+			if err := target.Scan(value); err != nil {
+				response.Message = "ERROR: " + name + " must be a uuid"
+				writeJSON(w, http.StatusBadRequest, response)
+				return
+			}
+		}
+	}
+
+	for name, target := range map[string]*pgtype.Timestamptz{"since": &params.Since, "until": &params.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				response.Message = "ERROR: " + name + " must be an RFC 3339 time"
+				writeJSON(w, http.StatusBadRequest, response)
+				return
+			}
+			*target = pgtype.Timestamptz{Time: parsed, Valid: true}
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > MAX_AUDIT_PAGE_SIZE {
+			response.Message = "ERROR: limit must be between 1 and " + strconv.Itoa(MAX_AUDIT_PAGE_SIZE)
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		params.PageSize = int32(limit)
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			response.Message = "ERROR: offset must be a positive number"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		params.PageOffset = int32(offset)
+	}
+
+	events, err := h.Queries.ListAuditEvents(r.Context(), params)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the audit events, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	event_responses := make([]types.AuditEventResponse, 0, len(events))
+	for _, event := range events {
+		event_responses = append(event_responses, types.NewAuditEventResponse(event))
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the audit events"
+	response.Data = event_responses
+	writeJSON(w, http.StatusOK, response)
+}
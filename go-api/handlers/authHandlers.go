@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// workspaceID is the workspace of the request's API key. Every route that
+// reaches a handler has been through auth.Middleware.
+func workspaceID(r *http.Request) pgtype.UUID {
+	principal, _ := auth.FromContext(r.Context())
+	return principal.WorkspaceID
+}
+
+func (h *APIState) HandleGetMe(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	principal, _ := auth.FromContext(r.Context())
+
+	user, err := h.Queries.GetUser(r.Context(), principal.UserID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the user, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	workspace, err := h.Queries.GetWorkspace(r.Context(), principal.WorkspaceID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the workspace, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the current user"
+	response.Data = types.MeResponse{User: user, Workspace: workspace, Role: principal.Role}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleCreateWorkspace creates a workspace owned by the caller. The
+// response holds the workspace's first API key.
+func (h *APIState) HandleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var request_body types.WorkspaceCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	request_body.Name = strings.TrimSpace(request_body.Name)
+	if request_body.Name == "" {
+		response.Message = "ERROR: name is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	workspace, key, err := auth.CreateWorkspace(r.Context(), qtx, request_body.Name, principal.UserID)
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:      audit.ACTION_WORKSPACE_CREATE,
+			TargetType:  audit.TARGET_WORKSPACE,
+			TargetID:    workspace.ID,
+			WorkspaceID: workspace.ID,
+			After:       workspace,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the workspace, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully created the workspace")
+	response.Message = "SUCCESS: Successfully created the workspace"
+	response.Data = types.WorkspaceCreateResponse{Workspace: workspace, APIKey: key}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (h *APIState) HandleListWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	members, err := h.Queries.ListWorkspaceMembers(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the workspace members, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if members == nil {
+		members = []db.ListWorkspaceMembersRow{}
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the workspace members"
+	response.Data = members
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleAddWorkspaceMember adds a user to the workspace by email, creating
+// the user if needed, or changes the role of an existing member.
+func (h *APIState) HandleAddWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var request_body types.WorkspaceMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	request_body.Email = strings.ToLower(strings.TrimSpace(request_body.Email))
+	if !strings.Contains(request_body.Email, "@") {
+		response.Message = "ERROR: A valid email is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if request_body.Role == "" {
+		request_body.Role = auth.ROLE_MEMBER
+	}
+	if request_body.Role != auth.ROLE_OWNER && request_body.Role != auth.ROLE_ADMIN && request_body.Role != auth.ROLE_MEMBER {
+		response.Message = "ERROR: role must be owner, admin or member"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	if request_body.Role == auth.ROLE_OWNER && principal.Role != auth.ROLE_OWNER {
+		response.Message = "ERROR: Only owners can make other owners"
+		writeJSON(w, http.StatusForbidden, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	user, err := qtx.UpsertUser(r.Context(), db.UpsertUserParams{Email: request_body.Email, Name: strings.TrimSpace(request_body.Name)})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the user, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	var before any
+	existing, err := qtx.GetWorkspaceMember(r.Context(), db.GetWorkspaceMemberParams{WorkspaceID: principal.WorkspaceID, UserID: user.ID})
+	if err == nil {
+		if existing.Role == auth.ROLE_OWNER && principal.Role != auth.ROLE_OWNER {
+			response.Message = "ERROR: Only owners can change the role of an owner"
+			writeJSON(w, http.StatusForbidden, response)
+			return
+		}
+		before = existing
+	}
+
+	member, err := qtx.AddWorkspaceMember(r.Context(), db.AddWorkspaceMemberParams{
+		WorkspaceID: principal.WorkspaceID,
+		UserID:      user.ID,
+		Role:        request_body.Role,
+	})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_MEMBER_ADD,
+			TargetType: audit.TARGET_USER,
+			TargetID:   user.ID,
+			Before:     before,
+			After:      member,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while adding the workspace member, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully added the workspace member")
+	response.Message = "SUCCESS: Successfully added the workspace member"
+	response.Data = db.ListWorkspaceMembersRow{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		Role:          member.Role,
+		ApprovalRoles: member.ApprovalRoles,
+		CreatedAt:     member.CreatedAt,
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleRemoveWorkspaceMember removes a member and revokes their keys for
+// the workspace.
+func (h *APIState) HandleRemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var user_uuid pgtype.UUID
+	if err := user_uuid.Scan(chi.URLParam(r, "user_id")); err != nil {
+		response.Message = "ERROR: Invalid user id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	if user_uuid == principal.UserID {
+		response.Message = "ERROR: You cannot remove yourself from the workspace"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	member, err := h.Queries.GetWorkspaceMember(r.Context(), db.GetWorkspaceMemberParams{WorkspaceID: principal.WorkspaceID, UserID: user_uuid})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No member found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the workspace member, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+	if member.Role == auth.ROLE_OWNER && principal.Role != auth.ROLE_OWNER {
+		response.Message = "ERROR: Only owners can remove an owner"
+		writeJSON(w, http.StatusForbidden, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	params := db.RemoveWorkspaceMemberParams{WorkspaceID: principal.WorkspaceID, UserID: user_uuid}
+	if _, err := qtx.RemoveWorkspaceMember(r.Context(), params); err != nil {
+		log.Printf("ERROR: Something went wrong while removing the workspace member, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if err := qtx.RevokeAPIKeysForMember(r.Context(), db.RevokeAPIKeysForMemberParams(params)); err != nil {
+		log.Printf("ERROR: Something went wrong while revoking the member's keys, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	err = audit.Record(r.Context(), qtx, audit.Event{
+		Action:     audit.ACTION_MEMBER_REMOVE,
+		TargetType: audit.TARGET_USER,
+		TargetID:   member.UserID,
+		Before:     member,
+	})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while removing the workspace member, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully removed the workspace member")
+	response.Message = "SUCCESS: Successfully removed the workspace member"
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleListAPIKeys lists the caller's keys, or every key of the workspace
+// for owners and admins.
+func (h *APIState) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	principal, _ := auth.FromContext(r.Context())
+
+	keys, err := h.Queries.ListAPIKeysForWorkspace(r.Context(), principal.WorkspaceID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the API keys, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	key_responses := []types.APIKeyResponse{}
+	for _, key := range keys {
+		if key.UserID != principal.UserID && !principal.CanAdminister() {
+			continue
+		}
+		key_responses = append(key_responses, types.NewAPIKeyResponse(key))
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the API keys"
+	response.Data = key_responses
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleCreateAPIKey issues a key for the caller, or for another member when
+// the caller is an owner or admin. The key is only ever returned here.
+func (h *APIState) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var request_body types.APIKeyCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+
+	user_id := principal.UserID
+	if request_body.UserID.Valid && request_body.UserID != principal.UserID {
+		if !principal.CanAdminister() {
+			response.Message = "ERROR: Only workspace owners and admins can issue keys for others"
+			writeJSON(w, http.StatusForbidden, response)
+			return
+		}
+		if _, err := h.Queries.GetWorkspaceMember(r.Context(), db.GetWorkspaceMemberParams{WorkspaceID: principal.WorkspaceID, UserID: request_body.UserID}); err != nil {
+			response.Message = "ERROR: No member found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+			return
+		}
+		user_id = request_body.UserID
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	key, api_key, err := auth.CreateKey(r.Context(), qtx, user_id, principal.WorkspaceID, strings.TrimSpace(request_body.Name))
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_API_KEY_CREATE,
+			TargetType: audit.TARGET_API_KEY,
+			TargetID:   api_key.ID,
+			After:      types.NewAPIKeyResponse(api_key),
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the API key, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully created the API key")
+	key_response := types.NewAPIKeyResponse(api_key)
+	key_response.Key = key
+	response.Message = "SUCCESS: Successfully created the API key"
+	response.Data = key_response
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// HandleCreateSessionToken issues a short-lived token for the caller's key,
+// for clients that cannot set headers. EventSource passes it as
+// ?access_token=; it only authenticates GET requests and is checked when the
+// request starts, so a stream outlives it.
+func (h *APIState) HandleCreateSessionToken(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	principal, _ := auth.FromContext(r.Context())
+
+	if n, err := h.Queries.DeleteExpiredSessionTokens(r.Context()); err != nil {
+		log.Printf("WARN: Unable to delete expired session tokens, error: %v\n", err)
+	} else if n > 0 {
+		log.Printf("INFO: Deleted %d expired session tokens\n", n)
+	}
+
+	token, session, err := auth.CreateSessionToken(r.Context(), h.Queries, principal.APIKeyID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the session token, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully created the session token")
+	response.Message = "SUCCESS: Successfully created the session token"
+	response.Data = types.SessionTokenResponse{Token: token, ExpiresAt: session.ExpiresAt}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (h *APIState) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var key_uuid pgtype.UUID
+	if err := key_uuid.Scan(chi.URLParam(r, "key_id")); err != nil {
+		response.Message = "ERROR: Invalid key id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+
+	api_key, err := h.Queries.GetAPIKey(r.Context(), db.GetAPIKeyParams{ID: key_uuid, WorkspaceID: principal.WorkspaceID})
+	if err != nil || (api_key.UserID != principal.UserID && !principal.CanAdminister()) {
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("ERROR: Something went wrong while fetching the API key, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+		response.Message = "ERROR: No key found with this id"
+		writeJSON(w, http.StatusNotFound, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	revoked, err := qtx.RevokeAPIKey(r.Context(), db.RevokeAPIKeyParams{ID: api_key.ID, WorkspaceID: principal.WorkspaceID})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_API_KEY_REVOKE,
+			TargetType: audit.TARGET_API_KEY,
+			TargetID:   revoked.ID,
+			Before:     types.NewAPIKeyResponse(api_key),
+			After:      types.NewAPIKeyResponse(revoked),
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: The key has already been revoked"
+			writeJSON(w, http.StatusConflict, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while revoking the API key, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	log.Println("SUCCESS: Successfully revoked the API key")
+	response.Message = "SUCCESS: Successfully revoked the API key"
+	response.Data = types.NewAPIKeyResponse(revoked)
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bytes"
+	"canvas-backend/audit"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var errPreconditionMissing = errors.New("missing precondition")
+
+// brandKitETag identifies a version of a kit by its updated_at.
+func brandKitETag(kit db.BrandKit) string {
+	return fmt.Sprintf(`"%d"`, kit.UpdatedAt.Time.UnixMicro())
+}
+
+// expectedUpdatedAt reads the version the client last saw, from If-Match
+// or else from the request body. If-Match: * accepts whatever is current.
+func expectedUpdatedAt(r *http.Request, body_updated_at pgtype.Timestamptz, current db.BrandKit) (pgtype.Timestamptz, error) {
+	if_match := strings.TrimSpace(r.Header.Get("If-Match"))
+	if if_match == "*" {
+		return current.UpdatedAt, nil
+	}
+	if if_match != "" {
+		tag := strings.Trim(strings.TrimPrefix(if_match, "W/"), `"`)
+		micros, err := strconv.ParseInt(tag, 10, 64)
+		if err != nil {
+			return pgtype.Timestamptz{}, fmt.Errorf("malformed If-Match header")
+		}
+		return pgtype.Timestamptz{Time: time.UnixMicro(micros), Valid: true}, nil
+	}
+	if body_updated_at.Valid {
+		return body_updated_at, nil
+	}
+	return pgtype.Timestamptz{}, errPreconditionMissing
+}
+
+// loadBrandKit parses the kit id from the URL and loads the kit, writing the
+// error response itself when that fails.
+func (h *APIState) loadBrandKit(w http.ResponseWriter, r *http.Request) (db.BrandKit, bool) {
+	response := types.APIResponse{}
+
+	var kit_uuid pgtype.UUID
+	if err := kit_uuid.Scan(chi.URLParam(r, "kit_id")); err != nil {
+		log.Printf("ERROR: Cannot parse the uuid from the URL, error: %v\n", err)
+		response.Message = "ERROR: Invalid kit id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return db.BrandKit{}, false
+	}
+
+	kit, err := h.Queries.GetBrandKitForWorkspace(r.Context(), db.GetBrandKitForWorkspaceParams{ID: kit_uuid, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No kits found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching brandkits for id %v, error: %v\n", uuidString(kit_uuid), err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return db.BrandKit{}, false
+	}
+	return kit, true
+}
+
+func (h *APIState) HandleUpdateBrandKit(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	current, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.BrandKitUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	expected, err := expectedUpdatedAt(r, request_body.UpdatedAt, current)
+	if err != nil {
+		writePreconditionError(w, err)
+		return
+	}
+
+	h.saveBrandKit(w, r, current, db.UpdateBrandKitParams{
+		ID:         current.ID,
+		Name:       request_body.Name,
+		ColorsJson: colorsJSON(request_body.ColorsJson),
+		RulesText:  optionalText(request_body.RulesText),
+		LogoUrl:    optionalText(request_body.LogoURL),
+		UpdatedAt:  expected,
+	})
+}
+
+func (h *APIState) HandlePatchBrandKit(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	current, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.BrandKitPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	expected, err := expectedUpdatedAt(r, request_body.UpdatedAt, current)
+	if err != nil {
+		writePreconditionError(w, err)
+		return
+	}
+
+	// The merge is based on the version just read. If it is not the version
+	// the client expects, the update below matches no rows and reports a
+	// conflict.
+	params := db.UpdateBrandKitParams{
+		ID:         current.ID,
+		Name:       current.Name,
+		ColorsJson: current.ColorsJson,
+		RulesText:  current.RulesText,
+		LogoUrl:    current.LogoUrl,
+		UpdatedAt:  expected,
+	}
+	if request_body.Name != nil {
+		params.Name = *request_body.Name
+	}
+	if request_body.ColorsJson != nil {
+		params.ColorsJson = colorsJSON(request_body.ColorsJson)
+	}
+	if request_body.RulesText != nil {
+		params.RulesText = optionalText(*request_body.RulesText)
+	}
+	if request_body.LogoURL != nil {
+		params.LogoUrl = optionalText(*request_body.LogoURL)
+	}
+
+	h.saveBrandKit(w, r, current, params)
+}
+
+func (h *APIState) saveBrandKit(w http.ResponseWriter, r *http.Request, current db.BrandKit, params db.UpdateBrandKitParams) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	if strings.TrimSpace(params.Name) == "" {
+		response.Message = "ERROR: The kit name cannot be empty"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if params.ColorsJson != nil && !json.Valid(params.ColorsJson) {
+		response.Message = "ERROR: colors_json must be valid JSON"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	kit, err := qtx.UpdateBrandKit(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			h.writeBrandKitConflict(r.Context(), w, params.ID)
+			return
+		}
+		log.Printf("ERROR: Something went wrong while updating the brandkit, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	err = audit.Record(r.Context(), qtx, audit.Event{
+		Action:     audit.ACTION_BRAND_KIT_UPDATE,
+		TargetType: audit.TARGET_BRAND_KIT,
+		TargetID:   kit.ID,
+		Before:     current,
+		After:      kit,
+	})
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while updating the brandkit, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully updated the brandkit")
+	response.Message = "SUCCESS: Successfully updated the brandkit"
+	response.Data = types.BrandKitResponse{Brandkits: []db.BrandKit{kit}}
+	w.Header().Set("ETag", brandKitETag(kit))
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) HandleDeleteBrandKit(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	current, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	expected, precondition_err := expectedUpdatedAt(r, pgtype.Timestamptz{}, current)
+	if precondition_err != nil && !errors.Is(precondition_err, errPreconditionMissing) {
+		writePreconditionError(w, precondition_err)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	// Deletes are only guarded when the client sends a version.
+	var deleted int64
+	if precondition_err != nil {
+		deleted, err = qtx.DeleteBrandKit(r.Context(), current.ID)
+	} else {
+		deleted, err = qtx.DeleteBrandKitIfUnchanged(r.Context(), db.DeleteBrandKitIfUnchangedParams{
+			ID:        current.ID,
+			UpdatedAt: expected,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while deleting the brandkit, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if deleted == 0 {
+		h.writeBrandKitConflict(r.Context(), w, current.ID)
+		return
+	}
+
+	err = audit.Record(r.Context(), qtx, audit.Event{
+		Action:     audit.ACTION_BRAND_KIT_DELETE,
+		TargetType: audit.TARGET_BRAND_KIT,
+		TargetID:   current.ID,
+		Before:     current,
+	})
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while deleting the brandkit, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully deleted the brandkit")
+	response.Message = "SUCCESS: Successfully deleted the brandkit"
+	writeJSON(w, http.StatusOK, response)
+}
+
+// writeBrandKitConflict answers an update that matched no rows: either the
+// kit is gone or someone else changed it first, in which case the current
+// version is returned so the client can merge.
+func (h *APIState) writeBrandKitConflict(ctx context.Context, w http.ResponseWriter, id pgtype.UUID) {
+	response := types.APIResponse{}
+
+	kit, err := h.Queries.GetBrandKit(ctx, id)
+	if err != nil {
+		response.Message = "ERROR: No kits found with this id"
+		writeJSON(w, http.StatusNotFound, response)
+		return
+	}
+
+	log.Printf("WARN: Rejected a stale write to brandkit %s\n", uuidString(id))
+	response.Message = "ERROR: The brandkit was changed by someone else, reload and try again"
+	response.Data = types.BrandKitResponse{Brandkits: []db.BrandKit{kit}}
+	w.Header().Set("ETag", brandKitETag(kit))
+	writeJSON(w, http.StatusPreconditionFailed, response)
+}
+
+func writePreconditionError(w http.ResponseWriter, err error) {
+	response := types.APIResponse{}
+	if errors.Is(err, errPreconditionMissing) {
+		response.Message = "ERROR: Send If-Match or updated_at with the version being edited"
+		writeJSON(w, http.StatusPreconditionRequired, response)
+		return
+	}
+	response.Message = "ERROR: " + err.Error()
+	writeJSON(w, http.StatusBadRequest, response)
+}
+
+func optionalText(s string) pgtype.Text {
+	return pgtype.Text{String: s, Valid: s != ""}
+}
+
+// colorsJSON stores a JSON null as SQL NULL.
+func colorsJSON(raw json.RawMessage) []byte {
+	if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		return nil
+	}
+	return raw
+}
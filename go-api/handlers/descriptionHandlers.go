@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"canvas-backend/accounting"
+	"canvas-backend/audit"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// HandleRefreshImageDescriptions describes the kit's product images again,
+// ignoring stored descriptions. An image_id query parameter limits it to
+// one image. Each image counts as a generation.
+func (h *APIState) HandleRefreshImageDescriptions(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var kit_uuid pgtype.UUID
+	if err := kit_uuid.Scan(chi.URLParam(r, "kit_id")); err != nil {
+		log.Printf("ERROR: Cannot parse the uuid from the URL, error: %v\n", err)
+		response.Message = "ERROR: Invalid kit id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	kit, err := h.Queries.GetBrandKitForWorkspace(r.Context(), db.GetBrandKitForWorkspaceParams{ID: kit_uuid, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No kits found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching brandkits for id %v, error: %v\n", uuidString(kit_uuid), err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	images, err := h.Queries.ListProductImagesForBrandKit(r.Context(), kit_uuid)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching images for id %v, error: %v\n", uuidString(kit_uuid), err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if image_id := r.URL.Query().Get("image_id"); image_id != "" {
+		var image_uuid pgtype.UUID
+		if err := image_uuid.Scan(image_id); err != nil {
+			response.Message = "ERROR: Invalid image id"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+
+		var selected []db.ProductImage
+		for _, image := range images {
+			if image.ID == image_uuid {
+				selected = append(selected, image)
+			}
+		}
+		if len(selected) == 0 {
+			response.Message = "ERROR: No image found with this id in the kit"
+			writeJSON(w, http.StatusNotFound, response)
+			return
+		}
+		images = selected
+	}
+
+	if !h.Limits.Allow(w, r, int32(len(images))) {
+		return
+	}
+
+	ctx := accounting.WithAttribution(r.Context(), accounting.Attribution{WorkspaceID: kit.WorkspaceID, BrandKitID: kit.ID})
+	described, errs := h.describeProductImages(ctx, kit, images, true)
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			log.Printf("ERROR: Unable to describe image %s, error: %v\n", images[i].ImageUrl, err)
+			continue
+		}
+		h.recordAudit(r, audit.Event{
+			Action:     audit.ACTION_PRODUCT_IMAGE_DESCRIBE,
+			TargetType: audit.TARGET_PRODUCT_IMAGE,
+			TargetID:   images[i].ID,
+			Before:     images[i],
+			After:      described[i],
+		})
+	}
+	if described == nil {
+		described = []db.ProductImage{}
+	}
+
+	response.Data = types.BrandKitAndImagesResponse{BrandKit: kit, Images: described}
+	if failed > 0 {
+		response.Message = "ERROR: Unable to describe some of the images"
+		writeJSON(w, http.StatusBadGateway, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully refreshed the image descriptions")
+	response.Message = "SUCCESS: Successfully refreshed the image descriptions"
+	writeJSON(w, http.StatusOK, response)
+}
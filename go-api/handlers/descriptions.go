@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"canvas-backend/accounting"
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/prompts"
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Background descriptions started at kit creation give up after this long.
+const DESCRIBE_TIMEOUT = 5 * time.Minute
+
+// hasCurrentDescription reports whether the stored description came from
+// the current model and prompt.
+func (h *APIState) hasCurrentDescription(image db.ProductImage, prompt prompts.Template) bool {
+	return image.Description.Valid &&
+		image.DescriptionModel.String == h.DescriptionModel &&
+		image.DescriptionPromptVersion.String == prompt.Hash
+}
+
+// productImageDescription returns the image with a current description,
+// reusing the stored one unless refresh is set. Concurrent calls for the
+// same image share a single model call. The bool reports whether the stored
+// description was reused.
+func (h *APIState) productImageDescription(ctx context.Context, kit db.BrandKit, image db.ProductImage, refresh bool) (db.ProductImage, bool, error) {
+	prompt, err := h.Prompts.Resolve(ctx, kit, prompts.NAME_IMAGE_DESCRIPTION)
+	if err != nil {
+		return image, false, err
+	}
+	if !refresh && h.hasCurrentDescription(image, prompt) {
+		return image, true, nil
+	}
+
+	result, err, _ := h.describing.Do(uuidString(image.ID), func() (any, error) {
+		prompt_text, err := prompt.Render(prompts.ImageData{ImageName: image.ImageName.String, Role: image.Role})
+		if err != nil {
+			return nil, err
+		}
+		description, err := h.getImageDescription(ctx, image.ImageUrl, prompt_text)
+		if err != nil {
+			return nil, err
+		}
+
+		return h.Queries.UpdateProductImageDescription(ctx, db.UpdateProductImageDescriptionParams{
+			ID:                       image.ID,
+			Description:              pgtype.Text{String: description, Valid: true},
+			DescriptionModel:         pgtype.Text{String: h.DescriptionModel, Valid: true},
+			DescriptionPromptVersion: pgtype.Text{String: prompt.Hash, Valid: true},
+		})
+	})
+	if err != nil {
+		return image, false, err
+	}
+	return result.(db.ProductImage), false, nil
+}
+
+// describeProductImages describes the images concurrently. Images that
+// fail keep their previous description and are reported in errs by index.
+func (h *APIState) describeProductImages(ctx context.Context, kit db.BrandKit, images []db.ProductImage, refresh bool) ([]db.ProductImage, []error) {
+	described := make([]db.ProductImage, len(images))
+	errs := make([]error, len(images))
+
+	var wg sync.WaitGroup
+	for i, image := range images {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			described[i], _, errs[i] = h.productImageDescription(ctx, kit, image, refresh)
+		}()
+	}
+	wg.Wait()
+
+	return described, errs
+}
+
+// describeInBackground fills in descriptions for newly created images so
+// the first generation does not have to wait for them. Each image counts
+// against principal's generation limits; once they are reached the images
+// are left for the first generation to describe.
+func (h *APIState) describeInBackground(principal auth.Principal, kit db.BrandKit, images []db.ProductImage) {
+	if len(images) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DESCRIBE_TIMEOUT)
+	defer cancel()
+	ctx = accounting.WithAttribution(ctx, accounting.Attribution{WorkspaceID: kit.WorkspaceID, BrandKitID: kit.ID})
+
+	if err := h.Limits.Take(ctx, principal, int32(len(images))); err != nil {
+		log.Printf("WARN: Not describing the new images of kit %s, error: %v\n", uuidString(kit.ID), err)
+		return
+	}
+
+	_, errs := h.describeProductImages(ctx, kit, images, false)
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("WARN: Unable to describe image %s: %v\n", images[i].ImageUrl, err)
+		}
+	}
+}
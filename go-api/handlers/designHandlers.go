@@ -0,0 +1,577 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/jobs"
+	"canvas-backend/types"
+	"canvas-backend/workflow"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var errVersionConflict = errors.New("design was saved by someone else")
+
+func (h *APIState) HandleCreateDesign(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.DesignCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	request_body.Name = strings.TrimSpace(request_body.Name)
+	if request_body.Name == "" {
+		response.Message = "ERROR: name is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	source := types.DESIGN_SOURCE_EDITED
+	raw_layout := request_body.Layout
+	var prompt_name pgtype.Text
+	var prompt_version pgtype.Int4
+	if request_body.Variant != 0 && !request_body.JobID.Valid {
+		response.Message = "ERROR: variant can only be used with a job_id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if request_body.JobID.Valid {
+		if len(raw_layout) > 0 {
+			response.Message = "ERROR: Send either a layout or a job_id, not both"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		job, err := h.Queries.GetGenerationJob(r.Context(), request_body.JobID)
+		if err != nil || job.BrandKitID != kit.ID {
+			response.Message = "ERROR: No job found with this id for the kit"
+			writeJSON(w, http.StatusNotFound, response)
+			return
+		}
+		if job.Status != jobs.STATUS_SUCCEEDED {
+			response.Message = "ERROR: The job has not produced a layout"
+			writeJSON(w, http.StatusConflict, response)
+			return
+		}
+		var result struct {
+			Layout   json.RawMessage  `json:"layout"`
+			Prompt   *types.PromptRef `json:"prompt"`
+			Variants []struct {
+				Variant int             `json:"variant"`
+				Layout  json.RawMessage `json:"layout"`
+			} `json:"variants"`
+		}
+		if err := json.Unmarshal(job.ResultJson, &result); err != nil {
+			log.Printf("ERROR: Unable to read the result of job %v, error: %v\n", uuidString(job.ID), err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+		raw_layout = result.Layout
+		if request_body.Variant != 0 {
+			raw_layout = nil
+			for _, variant := range result.Variants {
+				if variant.Variant == request_body.Variant {
+					raw_layout = variant.Layout
+				}
+			}
+			if raw_layout == nil {
+				response.Message = "ERROR: The job has no variant " + strconv.Itoa(request_body.Variant)
+				writeJSON(w, http.StatusNotFound, response)
+				return
+			}
+		}
+		source = types.DESIGN_SOURCE_GENERATED
+		// Jobs that ran before prompts were versioned did not record one.
+		if result.Prompt != nil {
+			prompt_name = pgtype.Text{String: result.Prompt.Name, Valid: true}
+			prompt_version = pgtype.Int4{Int32: result.Prompt.Version, Valid: true}
+		}
+	}
+
+	layout_json, ok := decodeDesignLayout(w, raw_layout)
+	if !ok {
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	design, err := qtx.CreateDesign(r.Context(), db.CreateDesignParams{BrandKitID: kit.ID, Name: request_body.Name})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the design, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	version, err := qtx.CreateDesignVersion(r.Context(), db.CreateDesignVersionParams{
+		DesignID:        design.ID,
+		Version:         design.CurrentVersion,
+		LayoutJson:      layout_json,
+		Author:          designAuthor(r),
+		Source:          source,
+		Note:            optionalText(request_body.Note),
+		GenerationJobID: request_body.JobID,
+		PromptName:      prompt_name,
+		PromptVersion:   prompt_version,
+	})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the design, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	err = audit.Record(r.Context(), qtx, audit.Event{
+		Action:     audit.ACTION_DESIGN_CREATE,
+		TargetType: audit.TARGET_DESIGN,
+		TargetID:   design.ID,
+		After:      design,
+	})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the design, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully created the design")
+	w.Header().Set("Location", "/designs/"+uuidString(design.ID))
+	response.Message = "SUCCESS: Successfully created the design"
+	response.Data = types.DesignResponse{Design: design, Version: types.NewDesignVersionResponse(version, true)}
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (h *APIState) HandleListDesigns(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	designs, err := h.Queries.ListDesignsForBrandKit(r.Context(), kit.ID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching designs for id %v, error: %v\n", uuidString(kit.ID), err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if designs == nil {
+		designs = []db.Design{}
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the designs"
+	response.Data = designs
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) HandleGetDesign(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := h.Queries.GetDesignVersion(r.Context(), db.GetDesignVersionParams{DesignID: design.ID, Version: design.CurrentVersion})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the design version, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the design"
+	response.Data = types.DesignResponse{Design: design, Version: types.NewDesignVersionResponse(version, true)}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) HandleSaveDesign(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.DesignSaveRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	layout_json, ok := decodeDesignLayout(w, request_body.Layout)
+	if !ok {
+		return
+	}
+
+	base := request_body.BaseVersion
+	if base == 0 {
+		base = design.CurrentVersion
+	}
+
+	h.writeNewDesignVersion(w, r, design, base, audit.ACTION_DESIGN_SAVE, db.CreateDesignVersionParams{
+		LayoutJson: layout_json,
+		Author:     designAuthor(r),
+		Source:     types.DESIGN_SOURCE_EDITED,
+		Note:       optionalText(request_body.Note),
+	}, "SUCCESS: Successfully saved the design")
+}
+
+func (h *APIState) HandleListDesignVersions(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := h.Queries.ListDesignVersions(r.Context(), design.ID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the design versions, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	version_responses := make([]types.DesignVersionResponse, 0, len(versions))
+	for _, version := range versions {
+		version_responses = append(version_responses, types.NewDesignVersionResponse(version, false))
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the design versions"
+	response.Data = version_responses
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) HandleGetDesignVersion(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := h.loadDesignVersion(w, r, design, chi.URLParam(r, "version"))
+	if !ok {
+		return
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the design version"
+	response.Data = types.NewDesignVersionResponse(version, true)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleDiffDesignVersions compares ?from= with ?to=. They default to the
+// first version and the current one, i.e. the draft and the latest edit.
+func (h *APIState) HandleDiffDesignVersions(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	from_param := r.URL.Query().Get("from")
+	if from_param == "" {
+		from_param = "1"
+	}
+	to_param := r.URL.Query().Get("to")
+	if to_param == "" {
+		to_param = strconv.Itoa(int(design.CurrentVersion))
+	}
+
+	from, ok := h.loadDesignVersion(w, r, design, from_param)
+	if !ok {
+		return
+	}
+	to, ok := h.loadDesignVersion(w, r, design, to_param)
+	if !ok {
+		return
+	}
+
+	var from_layout, to_layout types.Layout
+	if err := json.Unmarshal(from.LayoutJson, &from_layout); err != nil {
+		log.Printf("ERROR: Unable to read design version %d, error: %v\n", from.Version, err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if err := json.Unmarshal(to.LayoutJson, &to_layout); err != nil {
+		log.Printf("ERROR: Unable to read design version %d, error: %v\n", to.Version, err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	response.Message = "SUCCESS: Successfully compared the design versions"
+	response.Data = types.DesignDiffResponse{
+		From:    from.Version,
+		To:      to.Version,
+		Changes: types.DiffLayouts(from_layout, to_layout),
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleRestoreDesignVersion makes an old version current again by copying
+// it into a new version, so the history itself is never rewritten.
+func (h *APIState) HandleRestoreDesignVersion(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	old, ok := h.loadDesignVersion(w, r, design, chi.URLParam(r, "version"))
+	if !ok {
+		return
+	}
+
+	var request_body types.DesignRestoreRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+			log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+			response.Message = "ERROR: Unable to parse the request body"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	h.writeNewDesignVersion(w, r, design, design.CurrentVersion, audit.ACTION_DESIGN_RESTORE, db.CreateDesignVersionParams{
+		LayoutJson:      old.LayoutJson,
+		Author:          designAuthor(r),
+		Source:          types.DESIGN_SOURCE_RESTORED,
+		Note:            optionalText(request_body.Note),
+		GenerationJobID: old.GenerationJobID,
+		RestoredFrom:    pgtype.Int4{Int32: old.Version, Valid: true},
+		PromptName:      old.PromptName,
+		PromptVersion:   old.PromptVersion,
+	}, "SUCCESS: Successfully restored the design version")
+}
+
+// writeNewDesignVersion appends a version on top of base and writes the
+// response, answering 409 when base is no longer the current version.
+func (h *APIState) writeNewDesignVersion(w http.ResponseWriter, r *http.Request, design db.Design, base int32, action string, params db.CreateDesignVersionParams, message string) {
+	response := types.APIResponse{}
+
+	principal, _ := auth.FromContext(r.Context())
+
+	design, version, err := h.appendDesignVersion(r.Context(), principal, design.ID, base, action, params)
+	if err != nil {
+		if errors.Is(err, errVersionConflict) {
+			response.Message = "ERROR: The design was saved by someone else, reload it and try again"
+			if current, err := h.Queries.GetDesign(r.Context(), design.ID); err == nil {
+				response.Data = current
+			}
+			writeJSON(w, http.StatusConflict, response)
+			return
+		}
+		log.Printf("ERROR: Something went wrong while saving the design, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println(message)
+	response.Message = message
+	response.Data = types.DesignResponse{Design: design, Version: types.NewDesignVersionResponse(version, true)}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// appendDesignVersion adds a version on top of base and audits it as
+// action. A new version has not been reviewed, so the design goes back to
+// draft, and that is recorded with the rest of its review history.
+func (h *APIState) appendDesignVersion(ctx context.Context, principal auth.Principal, design_id pgtype.UUID, base int32, action string, params db.CreateDesignVersionParams) (db.Design, db.DesignVersion, error) {
+	tx, err := h.Pool.Begin(ctx)
+	if err != nil {
+		return db.Design{ID: design_id}, db.DesignVersion{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := h.Queries.WithTx(tx)
+
+	previous, err := qtx.LockDesign(ctx, design_id)
+	if err != nil {
+		return db.Design{ID: design_id}, db.DesignVersion{}, err
+	}
+
+	design, err := qtx.BumpDesignVersion(ctx, db.BumpDesignVersionParams{ID: design_id, CurrentVersion: base})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			err = errVersionConflict
+		}
+		return db.Design{ID: design_id}, db.DesignVersion{}, err
+	}
+
+	params.DesignID = design.ID
+	params.Version = design.CurrentVersion
+	version, err := qtx.CreateDesignVersion(ctx, params)
+	if err != nil {
+		return design, db.DesignVersion{}, err
+	}
+
+	if previous.Status != design.Status {
+		if _, err := qtx.CreateDesignReview(ctx, db.CreateDesignReviewParams{
+			DesignID:    design.ID,
+			Version:     design.CurrentVersion,
+			Action:      workflow.ACTION_EDIT,
+			FromStatus:  previous.Status,
+			ToStatus:    design.Status,
+			ActorUserID: principal.UserID,
+			ActorEmail:  principal.Email,
+		}); err != nil {
+			return design, db.DesignVersion{}, err
+		}
+	}
+
+	err = audit.Record(ctx, qtx, audit.Event{
+		Action:     action,
+		TargetType: audit.TARGET_DESIGN,
+		TargetID:   design.ID,
+		Before:     previous,
+		After:      design,
+	})
+	if err != nil {
+		return design, db.DesignVersion{}, err
+	}
+
+	return design, version, tx.Commit(ctx)
+}
+
+// loadDesign parses the design id from the URL and loads the design,
+// writing the error response itself when that fails.
+func (h *APIState) loadDesign(w http.ResponseWriter, r *http.Request) (db.Design, bool) {
+	response := types.APIResponse{}
+
+	var design_uuid pgtype.UUID
+	if err := design_uuid.Scan(chi.URLParam(r, "design_id")); err != nil {
+		log.Printf("ERROR: Cannot parse the uuid from the URL, error: %v\n", err)
+		response.Message = "ERROR: Invalid design id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return db.Design{}, false
+	}
+
+	design, err := h.Queries.GetDesignForWorkspace(r.Context(), db.GetDesignForWorkspaceParams{ID: design_uuid, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No design found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the design, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return db.Design{}, false
+	}
+	return design, true
+}
+
+func (h *APIState) loadDesignVersion(w http.ResponseWriter, r *http.Request, design db.Design, param string) (db.DesignVersion, bool) {
+	response := types.APIResponse{}
+
+	number, err := strconv.ParseInt(param, 10, 32)
+	if err != nil || number < 1 {
+		response.Message = "ERROR: Invalid version " + strconv.Quote(param)
+		writeJSON(w, http.StatusBadRequest, response)
+		return db.DesignVersion{}, false
+	}
+
+	version, err := h.Queries.GetDesignVersion(r.Context(), db.GetDesignVersionParams{DesignID: design.ID, Version: int32(number)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No version " + param + " of this design"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the design version, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return db.DesignVersion{}, false
+	}
+	return version, true
+}
+
+// decodeDesignLayout validates a layout before it is stored and gives its
+// new elements ids, so versions can be diffed element by element. The
+// client's document is stored rather than the decoded model, which would
+// drop fabric properties the model does not cover.
+func decodeDesignLayout(w http.ResponseWriter, raw json.RawMessage) ([]byte, bool) {
+	response := types.APIResponse{}
+
+	if len(raw) == 0 {
+		response.Message = "ERROR: layout is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return nil, false
+	}
+
+	if _, _, err := types.DecodeLayout(raw); err != nil {
+		var decode_err *types.LayoutDecodeError
+		if errors.As(err, &decode_err) {
+			response.Data = decode_err.Problems
+		}
+		response.Message = "ERROR: Invalid layout"
+		writeJSON(w, http.StatusBadRequest, response)
+		return nil, false
+	}
+
+	layout_json, err := types.AssignElementIDs(raw)
+	if err != nil {
+		log.Printf("ERROR: Unable to assign the element ids, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return nil, false
+	}
+	return layout_json, true
+}
+
+// designAuthor is who a version is recorded against: the user behind the
+// request's API key.
+func designAuthor(r *http.Request) string {
+	principal, _ := auth.FromContext(r.Context())
+	return principal.Email
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/compliance"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func formatFromRow(row db.LayoutFormat) compliance.Format {
+	return compliance.Format{
+		ID:             row.Key,
+		Name:           row.Name,
+		Width:          float64(row.Width),
+		Height:         float64(row.Height),
+		SafeZoneTop:    float64(row.SafeZoneTop),
+		SafeZoneBottom: float64(row.SafeZoneBottom),
+		MinFontSize:    float64(row.MinFontSize),
+		Platform:       row.Platform,
+	}
+}
+
+func newLayoutFormatResponse(format compliance.Format) types.LayoutFormatResponse {
+	return types.LayoutFormatResponse{
+		ID:             format.ID,
+		Name:           format.Name,
+		Width:          format.Width,
+		Height:         format.Height,
+		SafeZoneTop:    format.SafeZoneTop,
+		SafeZoneBottom: format.SafeZoneBottom,
+		MinFontSize:    format.MinFontSize,
+		Platform:       format.Platform,
+	}
+}
+
+func newCustomFormatResponse(row db.LayoutFormat) types.LayoutFormatResponse {
+	response := newLayoutFormatResponse(formatFromRow(row))
+	response.Custom = true
+	response.CreatedAt = &row.CreatedAt
+	return response
+}
+
+// layoutFormats are the built-in formats and the workspace's own.
+func (h *APIState) layoutFormats(ctx context.Context, workspace_id pgtype.UUID) (compliance.Formats, error) {
+	rows, err := h.Queries.ListLayoutFormats(ctx, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := compliance.Formats{}
+	for id, format := range compliance.FORMATS {
+		formats[id] = format
+	}
+	for _, row := range rows {
+		formats[row.Key] = formatFromRow(row)
+	}
+	return formats, nil
+}
+
+func (h *APIState) HandleListFormats(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	rows, err := h.Queries.ListLayoutFormats(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the formats, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	formats := []types.LayoutFormatResponse{}
+	for _, format := range compliance.Formats(compliance.FORMATS).Sorted() {
+		formats = append(formats, newLayoutFormatResponse(format))
+	}
+	for _, row := range rows {
+		formats = append(formats, newCustomFormatResponse(row))
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the formats"
+	response.Data = formats
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleCreateFormat registers a custom canvas size for the workspace. Only
+// admins can add formats.
+func (h *APIState) HandleCreateFormat(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var request_body types.LayoutFormatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if request_body.Platform == "" {
+		request_body.Platform = compliance.DEFAULT_PLATFORM
+	}
+	if request_body.Name == "" {
+		request_body.Name = request_body.ID
+	}
+
+	format := compliance.Format{
+		ID:             request_body.ID,
+		Name:           request_body.Name,
+		Width:          float64(request_body.Width),
+		Height:         float64(request_body.Height),
+		SafeZoneTop:    float64(request_body.SafeZoneTop),
+		SafeZoneBottom: float64(request_body.SafeZoneBottom),
+		MinFontSize:    float64(request_body.MinFontSize),
+		Platform:       request_body.Platform,
+	}
+	if err := format.Check(); err != nil {
+		response.Message = "ERROR: Invalid format: " + err.Error()
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if _, ok := compliance.FORMATS[format.ID]; ok {
+		response.Message = "ERROR: " + strconv.Quote(format.ID) + " is a built-in format"
+		writeJSON(w, http.StatusConflict, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	row, err := qtx.CreateLayoutFormat(r.Context(), db.CreateLayoutFormatParams{
+		WorkspaceID:    workspaceID(r),
+		Key:            request_body.ID,
+		Name:           request_body.Name,
+		Width:          request_body.Width,
+		Height:         request_body.Height,
+		SafeZoneTop:    request_body.SafeZoneTop,
+		SafeZoneBottom: request_body.SafeZoneBottom,
+		MinFontSize:    request_body.MinFontSize,
+		Platform:       request_body.Platform,
+	})
+	var pg_err *pgconn.PgError
+	if errors.As(err, &pg_err) && pg_err.Code == "23505" {
+		response.Message = "ERROR: The workspace already has a format with this id"
+		writeJSON(w, http.StatusConflict, response)
+		return
+	}
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_FORMAT_CREATE,
+			TargetType: audit.TARGET_FORMAT,
+			TargetID:   row.ID,
+			After:      newCustomFormatResponse(row),
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while creating the format, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Printf("SUCCESS: Registered the %s format (%dx%d)\n", row.Key, row.Width, row.Height)
+	response.Message = "SUCCESS: Successfully created the format"
+	response.Data = newCustomFormatResponse(row)
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// HandleDeleteFormat removes a custom format. Designs already generated
+// for it keep their layouts.
+func (h *APIState) HandleDeleteFormat(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	format_id := chi.URLParam(r, "format_id")
+	if _, ok := compliance.FORMATS[format_id]; ok {
+		response.Message = "ERROR: Built-in formats cannot be deleted"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	row, err := qtx.GetLayoutFormat(r.Context(), db.GetLayoutFormatParams{WorkspaceID: workspaceID(r), Key: format_id})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No format found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the format, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	_, err = qtx.DeleteLayoutFormat(r.Context(), db.DeleteLayoutFormatParams{WorkspaceID: workspaceID(r), Key: format_id})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_FORMAT_DELETE,
+			TargetType: audit.TARGET_FORMAT,
+			TargetID:   row.ID,
+			Before:     newCustomFormatResponse(row),
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while deleting the format, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Printf("SUCCESS: Deleted the %s format\n", format_id)
+	response.Message = "SUCCESS: Successfully deleted the format"
+	writeJSON(w, http.StatusOK, response)
+}
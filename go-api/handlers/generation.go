@@ -0,0 +1,674 @@
+package handlers
+
+import (
+	"canvas-backend/accounting"
+	"canvas-backend/compliance"
+	"canvas-backend/internal/db"
+	"canvas-backend/jobs"
+	"canvas-backend/lep"
+	"canvas-backend/llm"
+	"canvas-backend/prompts"
+	"canvas-backend/render"
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Limits on what a generation request may ask for.
+const (
+	MAX_DIRECTION_LENGTH = 2000
+	MAX_COPY_LENGTH      = 150
+	MAX_VARIANTS         = 5
+)
+
+// Variants are sampled at temperatures spread evenly over this range.
+const (
+	MIN_VARIANT_TEMPERATURE = 0.4
+	MAX_VARIANT_TEMPERATURE = 1.2
+)
+
+const (
+	EVENT_STARTED         = "started"
+	EVENT_IMAGE_DESCRIBED = "image_described"
+	EVENT_PROMPT_SENT     = "prompt_sent"
+	EVENT_RETRY           = "retry"
+	EVENT_FORMAT_READY    = "format_ready"
+	EVENT_DONE            = "done"
+	EVENT_ERROR           = "error"
+)
+
+// runGenerationJob is the jobs.Handler for layout generation.
+func (h *APIState) runGenerationJob(ctx context.Context, job db.GenerationJob, progress jobs.Progress) (any, error) {
+	progress(5, "loading brand kit")
+	kit, err := h.Queries.GetBrandKit(ctx, job.BrandKitID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the brand kit: %v", err)
+	}
+	ctx = accounting.WithAttribution(ctx, accounting.Attribution{WorkspaceID: kit.WorkspaceID, BrandKitID: kit.ID, JobID: job.ID})
+
+	var request_body types.GenerateLayoutRequest
+	if err := json.Unmarshal(job.RequestJson, &request_body); err != nil {
+		return nil, fmt.Errorf("unable to parse the job request: %v", err)
+	}
+	// Checked again in case a format was deleted while the job was queued.
+	request, err := h.checkGenerationRequest(ctx, kit, request_body)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := h.Queries.ListProductImagesForBrandKit(ctx, job.BrandKitID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the product images: %v", err)
+	}
+	if images == nil {
+		images = []db.ProductImage{}
+	}
+
+	return h.generateLayout(ctx, kit, images, request, func(event types.GenerationEvent) {
+		progress(event.Progress, event.Stage)
+	})
+}
+
+// invalidRequestError is a generation request the client has to fix. Its
+// message is safe to show them.
+type invalidRequestError struct {
+	message string
+}
+
+func (e *invalidRequestError) Error() string {
+	return e.message
+}
+
+func invalidRequest(format string, args ...any) error {
+	return &invalidRequestError{message: fmt.Sprintf(format, args...)}
+}
+
+// generationRequest is a types.GenerateLayoutRequest that has been checked
+// against its kit, with its formats resolved.
+type generationRequest struct {
+	types.GenerateLayoutRequest
+	formats []compliance.Format
+}
+
+// kitRules parses the kit's rules, falling back to treating them as a raw
+// prompt.
+func kitRules(kit db.BrandKit) types.RulesData {
+	var rules types.RulesData
+	if err := json.Unmarshal([]byte(kit.RulesText.String), &rules); err != nil {
+		log.Printf("WARN: Failed to parse detailed rules JSON, falling back to raw string. Error: %v", err)
+		rules.Prompt = kit.RulesText.String
+	}
+	return rules
+}
+
+// checkGenerationRequest validates a request for kit, returning an
+// *invalidRequestError for anything the client got wrong. Format is folded
+// into Formats, which lists every format that will be generated.
+func (h *APIState) checkGenerationRequest(ctx context.Context, kit db.BrandKit, request types.GenerateLayoutRequest) (generationRequest, error) {
+	request.Prompt = strings.TrimSpace(request.Prompt)
+	if len([]rune(request.Prompt)) > MAX_DIRECTION_LENGTH {
+		return generationRequest{}, invalidRequest("prompt must be at most %d characters", MAX_DIRECTION_LENGTH)
+	}
+
+	for _, copy := range []struct {
+		field string
+		text  *string
+	}{{"headline", request.Headline}, {"subhead", request.Subhead}} {
+		if copy.text == nil {
+			continue
+		}
+		*copy.text = strings.TrimSpace(*copy.text)
+		if len([]rune(*copy.text)) > MAX_COPY_LENGTH {
+			return generationRequest{}, invalidRequest("%s must be at most %d characters", copy.field, MAX_COPY_LENGTH)
+		}
+		if rule := compliance.ValidateCopy(*copy.text); rule != nil {
+			return generationRequest{}, invalidRequest("%s: %s", copy.field, rule.Message)
+		}
+	}
+
+	// LEP creatives are laid out by the lep engine, which has no use for
+	// direction, value tiles or alternatives.
+	if kitRules(kit).Compliance.CreativeMode == "lep" {
+		switch {
+		case request.Prompt != "":
+			return generationRequest{}, invalidRequest("prompt cannot be used in the lep creative mode")
+		case request.ValueTile != nil:
+			return generationRequest{}, invalidRequest("value_tile cannot be used in the lep creative mode")
+		case request.Variants > 1:
+			return generationRequest{}, invalidRequest("variants cannot be used in the lep creative mode")
+		}
+	}
+
+	if vt := request.ValueTile; vt != nil {
+		switch {
+		case vt.Type == types.VALUE_TILE_CLUBCARD && (vt.OfferPrice == "" || vt.RegularPrice == "" || vt.EndDate == ""):
+			return generationRequest{}, invalidRequest("a clubcard value_tile needs offer_price, regular_price and end_date")
+		case vt.Type == types.VALUE_TILE_WHITE && vt.WhitePrice == "":
+			return generationRequest{}, invalidRequest("a white value_tile needs white_price")
+		case vt.Type != types.VALUE_TILE_CLUBCARD && vt.Type != types.VALUE_TILE_WHITE && vt.Type != types.VALUE_TILE_NEW:
+			return generationRequest{}, invalidRequest("value_tile type must be clubcard, white or new")
+		}
+	}
+
+	if request.Variants == 0 {
+		request.Variants = 1
+	}
+	if request.Variants < 1 || request.Variants > MAX_VARIANTS {
+		return generationRequest{}, invalidRequest("variants must be between 1 and %d", MAX_VARIANTS)
+	}
+
+	if request.Format != "" {
+		if len(request.Formats) > 0 {
+			return generationRequest{}, invalidRequest("use either format or formats, not both")
+		}
+		request.Formats, request.Format = []string{request.Format}, ""
+	}
+	if len(request.Formats) == 0 {
+		request.Formats = compliance.DEFAULT_FORMATS
+	}
+
+	available, err := h.layoutFormats(ctx, kit.WorkspaceID)
+	if err != nil {
+		return generationRequest{}, err
+	}
+	checked := generationRequest{GenerateLayoutRequest: request}
+	seen := map[string]bool{}
+	for _, id := range request.Formats {
+		format, ok := available[id]
+		if !ok {
+			return generationRequest{}, invalidRequest("%v %q", compliance.ErrUnknownFormat, id)
+		}
+		if seen[id] {
+			return generationRequest{}, invalidRequest("format %q is listed twice", id)
+		}
+		seen[id] = true
+		checked.formats = append(checked.formats, format)
+	}
+	return checked, nil
+}
+
+// generateLayout describes the product images, asks the model for a layout
+// of each requested format and repairs it against the compliance rules,
+// reporting each step to emit. LEP creatives are laid out without the
+// model. emit may be called from several goroutines at once.
+func (h *APIState) generateLayout(ctx context.Context, kit db.BrandKit, images []db.ProductImage, request generationRequest, emit func(types.GenerationEvent)) (*types.GenerateLayoutResponse, error) {
+	formats := request.formats
+
+	// The request overrides the kit's copy and value tile for this run.
+	rules := kitRules(kit)
+	if request.Headline != nil {
+		rules.Compliance.Headline = *request.Headline
+	}
+	if request.Subhead != nil {
+		rules.Compliance.Subhead = *request.Subhead
+	}
+	if request.ValueTile != nil {
+		rules.Compliance.ValueTile = request.ValueTile
+	}
+
+	hero_image := heroImage(images)
+	if rules.Compliance.CreativeMode == "lep" {
+		return h.generateLEPLayout(ctx, kit, request, rules, hero_image, emit)
+	}
+
+	emit(types.GenerationEvent{Event: EVENT_STARTED, Progress: 10, Stage: "describing images"})
+
+	image_descriptions := make(map[string]string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	described := 0
+	for _, image := range images {
+		wg.Add(1)
+		go func(image db.ProductImage) {
+			defer wg.Done()
+			imgURL := image.ImageUrl
+			described_image, cached, err := h.productImageDescription(ctx, kit, image, false)
+			description := described_image.Description.String
+			if err != nil {
+				log.Printf("WARN: Unable to describe image %s: %v\n", imgURL, err)
+				// An outdated description still beats a generic one.
+				if !image.Description.Valid {
+					description = "A product image"
+				}
+			}
+			mu.Lock()
+			image_descriptions[imgURL] = description
+			described++
+			percent := 10 + 40*described/len(images)
+			mu.Unlock()
+
+			emit(types.GenerationEvent{
+				Event:    EVENT_IMAGE_DESCRIBED,
+				Progress: percent,
+				Stage:    "describing images",
+				Data:     types.ImageDescribedEvent{ImageURL: imgURL, Description: description, Cached: cached, Fallback: err != nil},
+			})
+		}(image)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var ImageUrlArray []string
+	image_roles := make(map[string]string)
+	for _, image := range images {
+		ImageUrlArray = append(ImageUrlArray, image.ImageUrl)
+		image_roles[image.ImageUrl] = image.Role
+	}
+
+	var mandates strings.Builder
+
+	mandates.WriteString(fmt.Sprintf("DESIGN TONE: %s. STYLE: %s.\n", rules.Tone, rules.Style))
+	mandates.WriteString(fmt.Sprintf("BRAND NAME: %s.", kit.Name))
+	if hero_image != "" {
+		mandates.WriteString(fmt.Sprintf("HERO PRODUCT: Use %s as the main, most prominent product image in every format. Other images are supporting; lifestyle images suit backgrounds.\n", hero_image))
+	}
+	if request.Prompt != "" {
+		mandates.WriteString(fmt.Sprintf("CREATIVE DIRECTION: %s\n", request.Prompt))
+	}
+
+	if rules.Compliance.Headline != "" {
+		mandates.WriteString(fmt.Sprintf("MANDATORY HEADLINE: \"%s\"\n", rules.Compliance.Headline))
+	}
+	if rules.Compliance.Subhead != "" {
+		mandates.WriteString(fmt.Sprintf("MANDATORY SUBHEAD: \"%s\"\n", rules.Compliance.Subhead))
+	}
+	if rules.Compliance.IsAlcoholPromotion {
+		mandates.WriteString("MANDATORY: Include the ASSET_DRINKAWARE logo.\n")
+	}
+
+	if rules.Compliance.TescoFinalTag != "" && rules.Compliance.TescoFinalTag != "Selected stores. While stocks last." {
+		mandates.WriteString(fmt.Sprintf("MANDATORY FOOTER TAG: \"%s\" (Place at bottom use the logo from assets).\n", rules.Compliance.TescoFinalTag))
+	}
+
+	if rules.Compliance.ValueTile != nil {
+		vt := rules.Compliance.ValueTile
+		if vt.Type == types.VALUE_TILE_CLUBCARD {
+			mandates.WriteString(fmt.Sprintf("USE THE CLUBCARD PRICE TILE. Large Price: %s. Small Regular Price: %s. Date: %s.\n", vt.OfferPrice, vt.RegularPrice, vt.EndDate))
+		} else if vt.Type == types.VALUE_TILE_WHITE {
+			mandates.WriteString(fmt.Sprintf("USE THE WHITE VALUE TILE. Price: %s.\n", vt.WhitePrice))
+		} else if vt.Type == types.VALUE_TILE_NEW {
+			mandates.WriteString("USE THE 'NEW' BADGE .\n")
+		}
+	}
+
+	prompt, err := h.Prompts.Resolve(ctx, kit, prompts.NAME_FABRIC_JSON)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the %s prompt: %w", prompts.NAME_FABRIC_JSON, err)
+	}
+	systemPrompt, err := prompt.Render(prompts.LayoutData{
+		BrandName:          kit.Name,
+		Tone:               rules.Tone,
+		Style:              rules.Style,
+		CreativeMode:       rules.Compliance.CreativeMode,
+		Headline:           rules.Compliance.Headline,
+		Subhead:            rules.Compliance.Subhead,
+		HeroImage:          hero_image,
+		IsAlcoholPromotion: rules.Compliance.IsAlcoholPromotion,
+		Formats:            formats,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	finalUserPrompt := fmt.Sprintf(`
+	MANDATORY TAGLINE TO INCLUDE (Do not ignore this): "%s"
+	`, mandates.String())
+
+	json_request := types.JsonRequest{
+		UserPrompt:        finalUserPrompt,
+		Colors:            kit.ColorsJson,
+		Logo:              kit.LogoUrl.String,
+		ImageDescriptions: image_descriptions,
+		ImageURLs:         ImageUrlArray,
+		HeroImage:         hero_image,
+		ImageRoles:        image_roles,
+		Formats:           map[string]types.CanvasSize{},
+	}
+	format_ids := make([]string, 0, len(formats))
+	for _, format := range formats {
+		format_ids = append(format_ids, format.ID)
+		json_request.Formats[format.ID] = types.CanvasSize{
+			Width:          format.Width,
+			Height:         format.Height,
+			SafeZoneTop:    format.SafeZoneTop,
+			SafeZoneBottom: format.SafeZoneBottom,
+		}
+	}
+
+	assets, err := h.staticAssets(ctx, kit.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the static assets: %w", err)
+	}
+
+	// Candidates are generated side by side, each sampled differently, and
+	// the best scoring one is returned first.
+	variants := max(request.Variants, 1)
+	candidates := make([]*layoutCandidate, variants)
+	errs := make([]error, variants)
+	palette := kitPalette(kit)
+	seed := rand.Int32()
+	schema := types.LayoutSchema(format_ids)
+
+	ready, total_ready := 0, variants*len(formats)
+	var ready_mu sync.Mutex
+	next_progress := func() int {
+		ready_mu.Lock()
+		defer ready_mu.Unlock()
+		ready++
+		return 90 + 9*ready/total_ready
+	}
+
+	var candidates_wg sync.WaitGroup
+	for i := range variants {
+		candidates_wg.Add(1)
+		go func(i int) {
+			defer candidates_wg.Done()
+			candidate := &layoutCandidate{
+				request: llm.LayoutRequest{SystemPrompt: systemPrompt, Context: json_request, Schema: schema},
+			}
+			if variants > 1 {
+				candidate.variant = i + 1
+				temperature := MIN_VARIANT_TEMPERATURE + (MAX_VARIANT_TEMPERATURE-MIN_VARIANT_TEMPERATURE)*float32(i)/float32(variants-1)
+				variant_seed := seed + int32(i)
+				candidate.request.Temperature, candidate.request.Seed = &temperature, &variant_seed
+			}
+			errs[i] = h.generateCandidate(ctx, candidate, formats, assets, emit, next_progress)
+			if errs[i] == nil {
+				candidate.score = compliance.ScoreLayout(candidate.layout, formats, candidate.violations, palette, hero_image)
+				candidates[i] = candidate
+			}
+		}(i)
+	}
+	candidates_wg.Wait()
+
+	// A failed candidate only fails the generation when none succeeded.
+	ranked := []*layoutCandidate{}
+	for i, candidate := range candidates {
+		if candidate != nil {
+			ranked = append(ranked, candidate)
+		} else {
+			log.Printf("WARN: Variant %d of %d failed: %v\n", i+1, variants, errs[i])
+		}
+	}
+	if len(ranked) == 0 {
+		return nil, errs[0]
+	}
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].score.Total > ranked[b].score.Total })
+
+	return newGenerationResponse(ranked, prompt.Ref(), request), nil
+}
+
+// newGenerationResponse answers with the best of ranked, listing every
+// candidate when there was more than one to choose from.
+func newGenerationResponse(ranked []*layoutCandidate, prompt types.PromptRef, request generationRequest) *types.GenerateLayoutResponse {
+	best := ranked[0]
+	log.Printf("INFO: Repair pass made %d changes, %d violations remain\n", len(best.repairs), len(best.violations))
+
+	response := &types.GenerateLayoutResponse{
+		Layout:     best.layout,
+		Repairs:    best.repairs,
+		Violations: best.violations,
+		Score:      best.score,
+		Prompt:     prompt,
+		Request:    request.GenerateLayoutRequest,
+	}
+	if request.Variants > 1 {
+		for rank, candidate := range ranked {
+			response.Variants = append(response.Variants, types.LayoutVariant{
+				Variant:     candidate.variant,
+				Rank:        rank + 1,
+				Temperature: candidate.request.Temperature,
+				Seed:        candidate.request.Seed,
+				Score:       candidate.score,
+				Layout:      candidate.layout,
+				Repairs:     candidate.repairs,
+				Violations:  candidate.violations,
+			})
+		}
+	}
+	return response
+}
+
+// layoutCandidate is one layout generated for a request, after repair.
+// variant is 0 when only one was asked for.
+type layoutCandidate struct {
+	variant    int
+	request    llm.LayoutRequest
+	layout     types.Layout
+	repairs    []compliance.Change
+	violations []compliance.Violation
+	score      compliance.Score
+}
+
+// generateCandidate asks the model for candidate's layout and repairs it,
+// emitting each format as soon as it has been checked.
+func (h *APIState) generateCandidate(ctx context.Context, candidate *layoutCandidate, formats []compliance.Format, assets compliance.StaticAssets, emit func(types.GenerationEvent), next_progress func() int) error {
+	result, err := h.getFabricJSON(ctx, candidate.request, emit)
+	if err != nil {
+		return fmt.Errorf("unable to generate the fabric json: %w", err)
+	}
+
+	layout, unknown_fields, err := types.DecodeLayout([]byte(result))
+	if err != nil {
+		return fmt.Errorf("unable to parse the fabric json string: %w", err)
+	}
+	for _, field := range unknown_fields {
+		log.Printf("WARN: Ignoring unknown layout field %s\n", field.Path)
+	}
+	requested := map[string]bool{}
+	for _, format := range formats {
+		requested[format.ID] = true
+	}
+	for _, format := range layout.Formats() {
+		if !requested[format] {
+			log.Printf("WARN: Dropping the %s layout, which was not requested\n", format)
+			delete(layout, format)
+		}
+	}
+
+	repairCandidate(candidate, layout, formats, assets, imageSizes(ctx, layout, assets), emit, next_progress)
+	return nil
+}
+
+// repairCandidate resolves the static assets in layout, sizes its images
+// from sizes and repairs it against the compliance rules, emitting each
+// format as soon as it has been checked.
+func repairCandidate(candidate *layoutCandidate, layout types.Layout, formats []compliance.Format, assets compliance.StaticAssets, sizes map[string]image.Point, emit func(types.GenerationEvent), next_progress func() int) {
+	layout.EnsureElementIDs()
+
+	repairs := []compliance.Change{}
+	violations := compliance.CheckFormats(layout, formats)
+	for _, format := range formats {
+		fl, ok := layout[format.ID]
+		if !ok {
+			continue
+		}
+		platform, _ := compliance.LookupPlatform(format.Platform)
+		format_repairs := compliance.ResolveAssets(format.ID, fl, assets)
+		render.SizeImages(fl, sizes)
+		format_repairs = append(format_repairs, compliance.RepairFormat(format, fl, platform)...)
+		format_violations := compliance.ValidateFormat(format, fl, platform)
+		format_violations = append(format_violations, compliance.ValidateAssets(format.ID, fl, assets)...)
+		repairs = append(repairs, format_repairs...)
+		violations = append(violations, format_violations...)
+
+		emit(types.GenerationEvent{
+			Event:    EVENT_FORMAT_READY,
+			Progress: next_progress(),
+			Stage:    "repairing layout",
+			Data: types.FormatReadyEvent{
+				Variant:    candidate.variant,
+				Format:     format.ID,
+				Layout:     fl,
+				Repairs:    format_repairs,
+				Violations: format_violations,
+			},
+		})
+	}
+
+	candidate.layout, candidate.repairs, candidate.violations = layout, repairs, violations
+}
+
+// generateLEPLayout lays out a LEP creative with the lep engine, from the
+// copy in rules and the measured sizes of its images.
+func (h *APIState) generateLEPLayout(ctx context.Context, kit db.BrandKit, request generationRequest, rules types.RulesData, hero_image string, emit func(types.GenerationEvent)) (*types.GenerateLayoutResponse, error) {
+	emit(types.GenerationEvent{Event: EVENT_STARTED, Progress: 10, Stage: "measuring images"})
+
+	assets, err := h.staticAssets(ctx, kit.WorkspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load the static assets: %w", err)
+	}
+
+	input := lep.Input{
+		Headline:           rules.Compliance.Headline,
+		Subhead:            rules.Compliance.Subhead,
+		Logo:               kit.LogoUrl.String,
+		Product:            hero_image,
+		IsAlcoholPromotion: rules.Compliance.IsAlcoholPromotion,
+		Sizes:              map[string]lep.Size{},
+	}
+	to_measure := map[string]string{}
+	for _, key := range []string{lep.LEP_LOGO_KEY, lep.DRINKAWARE_KEY} {
+		if asset, ok := assets[key]; ok {
+			if asset.Width > 0 && asset.Height > 0 {
+				input.Sizes[key] = lep.Size{Width: float64(asset.Width), Height: float64(asset.Height)}
+			} else {
+				to_measure[key] = asset.URL
+			}
+		}
+	}
+	for _, image_url := range []string{input.Logo, input.Product} {
+		if image_url != "" {
+			to_measure[image_url] = image_url
+		}
+	}
+	for key, size := range measureImages(ctx, to_measure) {
+		input.Sizes[key] = size
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	emit(types.GenerationEvent{Event: EVENT_PROMPT_SENT, Progress: 55, Stage: "laying out"})
+
+	ready := 0
+	next_progress := func() int {
+		ready++
+		return 90 + 9*ready/len(request.formats)
+	}
+	sizes := map[string]image.Point{}
+	for key, size := range input.Sizes {
+		if asset, ok := assets[key]; ok {
+			key = asset.URL
+		}
+		sizes[key] = image.Pt(int(size.Width), int(size.Height))
+	}
+	candidate := &layoutCandidate{}
+	repairCandidate(candidate, lep.Generate(request.formats, input), request.formats, assets, sizes, emit, next_progress)
+	candidate.score = compliance.ScoreLayout(candidate.layout, request.formats, candidate.violations, kitPalette(kit), hero_image)
+
+	return newGenerationResponse([]*layoutCandidate{candidate}, types.PromptRef{Name: lep.ENGINE_NAME}, request), nil
+}
+
+// measureImages fetches images side by side and returns their sizes under
+// the same keys. Images that cannot be loaded are left out, to be laid out
+// as squares.
+func measureImages(ctx context.Context, urls map[string]string) map[string]lep.Size {
+	to_measure := make([]string, 0, len(urls))
+	for _, image_url := range urls {
+		to_measure = append(to_measure, image_url)
+	}
+	measured := render.MeasureImages(ctx, render.NewHTTPFetcher(), to_measure)
+
+	sizes := map[string]lep.Size{}
+	for key, image_url := range urls {
+		if size, ok := measured[image_url]; ok {
+			sizes[key] = lep.Size{Width: float64(size.X), Height: float64(size.Y)}
+		}
+	}
+	return sizes
+}
+
+// imageSizes returns the intrinsic size of every image layout places, by
+// URL, with static assets under the URL they resolve to. Assets whose size
+// is already known are not fetched.
+func imageSizes(ctx context.Context, layout types.Layout, assets compliance.StaticAssets) map[string]image.Point {
+	sizes := map[string]image.Point{}
+	var to_measure []string
+	for _, fl := range layout {
+		for _, el := range fl.Elements {
+			if el.Type != types.ElementImage {
+				continue
+			}
+			asset, ok := assets[el.URL]
+			if !ok {
+				asset, ok = assets.ByURL(el.URL)
+			}
+			switch {
+			case ok && asset.Width > 0 && asset.Height > 0:
+				sizes[asset.URL] = image.Pt(int(asset.Width), int(asset.Height))
+			case ok:
+				to_measure = append(to_measure, asset.URL)
+			default:
+				to_measure = append(to_measure, el.URL)
+			}
+		}
+	}
+	for image_url, size := range render.MeasureImages(ctx, render.NewHTTPFetcher(), to_measure) {
+		sizes[image_url] = size
+	}
+	return sizes
+}
+
+// heroImage is the image marked as the hero. Images are ordered by
+// position, so the first one stands in for a missing hero.
+func heroImage(images []db.ProductImage) string {
+	for _, image := range images {
+		if image.Role == types.IMAGE_ROLE_HERO {
+			return image.ImageUrl
+		}
+	}
+	if len(images) > 0 {
+		return images[0].ImageUrl
+	}
+	return ""
+}
+
+// kitPalette collects the colors in the kit's colors_json, whatever its
+// shape. Strings that are not colors are ignored when scoring.
+func kitPalette(kit db.BrandKit) []string {
+	var colors any
+	if err := json.Unmarshal(kit.ColorsJson, &colors); err != nil {
+		return nil
+	}
+
+	palette := []string{}
+	var collect func(value any)
+	collect = func(value any) {
+		switch value := value.(type) {
+		case string:
+			palette = append(palette, value)
+		case []any:
+			for _, item := range value {
+				collect(item)
+			}
+		case map[string]any:
+			for _, item := range value {
+				collect(item)
+			}
+		}
+	}
+	collect(colors)
+	return palette
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func (h *APIState) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var job_uuid pgtype.UUID
+	if err := job_uuid.Scan(chi.URLParam(r, "job_id")); err != nil {
+		log.Printf("ERROR: Cannot parse the uuid from the URL, error: %v\n", err)
+		response.Message = "ERROR: Invalid job id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	job, err := h.Queries.GetGenerationJobForWorkspace(r.Context(), db.GetGenerationJobForWorkspaceParams{ID: job_uuid, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No job found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the job, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the job"
+	response.Data = types.NewGenerationJobResponse(job)
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var job_uuid pgtype.UUID
+	if err := job_uuid.Scan(chi.URLParam(r, "job_id")); err != nil {
+		log.Printf("ERROR: Cannot parse the uuid from the URL, error: %v\n", err)
+		response.Message = "ERROR: Invalid job id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	existing, err := h.Queries.GetGenerationJobForWorkspace(r.Context(), db.GetGenerationJobForWorkspaceParams{ID: job_uuid, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No job found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the job, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Unable to start a transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := h.Queries.WithTx(tx)
+
+	job, err := h.Jobs.CancelWith(r.Context(), qtx, existing.ID)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("ERROR: Something went wrong while cancelling the job, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+
+		// The job exists, so it has already finished.
+		if finished, err := h.Queries.GetGenerationJob(r.Context(), existing.ID); err == nil {
+			existing = finished
+		}
+		response.Message = "ERROR: The job has already finished"
+		response.Data = types.NewGenerationJobResponse(existing)
+		writeJSON(w, http.StatusConflict, response)
+		return
+	}
+
+	err = audit.Record(r.Context(), qtx, audit.Event{
+		Action:     audit.ACTION_GENERATION_CANCEL,
+		TargetType: audit.TARGET_GENERATION_JOB,
+		TargetID:   job.ID,
+		Before:     types.NewGenerationJobResponse(existing),
+		After:      types.NewGenerationJobResponse(job),
+	})
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while cancelling the job, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	h.Jobs.Interrupt(job.ID)
+
+	log.Println("SUCCESS: Successfully cancelled the job")
+	response.Message = "SUCCESS: Successfully cancelled the job"
+	response.Data = types.NewGenerationJobResponse(job)
+	writeJSON(w, http.StatusAccepted, response)
+}
+
+func uuidString(id pgtype.UUID) string {
+	value, _ := id.Value()
+	s, _ := value.(string)
+	return s
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	DATE_FORMAT = "2006-01-02"
+	// Reports cover this many days up to today unless asked otherwise.
+	DEFAULT_REPORT_DAYS = 30
+)
+
+// HandleModelUsageReport adds up the workspace's model calls by UTC day and
+// brand kit. since and until are dates, both included, and brand_kit_id
+// limits the report to one kit.
+func (h *APIState) HandleModelUsageReport(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	query := r.URL.Query()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	until, since := today, today.AddDate(0, 0, -(DEFAULT_REPORT_DAYS-1))
+
+	for name, target := range map[string]*time.Time{"since": &since, "until": &until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(DATE_FORMAT, value)
+			if err != nil {
+				response.Message = "ERROR: " + name + " must be a date like " + DATE_FORMAT
+				writeJSON(w, http.StatusBadRequest, response)
+				return
+			}
+			*target = parsed
+		}
+	}
+	if until.Before(since) {
+		response.Message = "ERROR: until cannot be before since"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	params := db.ReportModelCallsParams{
+		WorkspaceID: workspaceID(r),
+		Since:       pgtype.Timestamptz{Time: since, Valid: true},
+		Until:       pgtype.Timestamptz{Time: until.AddDate(0, 0, 1), Valid: true},
+	}
+	if value := query.Get("brand_kit_id"); value != "" {
+		if err := params.BrandKitID.Scan(value); err != nil {
+			response.Message = "ERROR: brand_kit_id must be a uuid"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	rows, err := h.Queries.ReportModelCalls(r.Context(), params)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the model usage, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	report := types.ModelUsageReport{
+		Since: since.Format(DATE_FORMAT),
+		Until: until.Format(DATE_FORMAT),
+		Days:  []types.ModelUsage{},
+		Kits:  []types.ModelUsage{},
+	}
+	kit_index := map[pgtype.UUID]int{}
+	for _, row := range rows {
+		usage := types.ModelUsage{
+			Day:            row.Day.Time.Format(DATE_FORMAT),
+			BrandKitID:     row.BrandKitID,
+			BrandKitName:   row.BrandKitName,
+			Calls:          row.Calls,
+			FailedCalls:    row.FailedCalls,
+			Retries:        row.Retries,
+			PromptTokens:   row.PromptTokens,
+			ResponseTokens: row.ResponseTokens,
+		}
+		addModelCost(&usage, row.EstimatedCostMicros)
+		report.Days = append(report.Days, usage)
+
+		i, ok := kit_index[row.BrandKitID]
+		if !ok {
+			i = len(report.Kits)
+			kit_index[row.BrandKitID] = i
+			report.Kits = append(report.Kits, types.ModelUsage{BrandKitID: row.BrandKitID, BrandKitName: row.BrandKitName})
+		}
+		addModelUsage(&report.Kits[i], usage)
+		addModelUsage(&report.Totals, usage)
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the model usage"
+	response.Data = report
+	writeJSON(w, http.StatusOK, response)
+}
+
+func addModelUsage(total *types.ModelUsage, usage types.ModelUsage) {
+	total.Calls += usage.Calls
+	total.FailedCalls += usage.FailedCalls
+	total.Retries += usage.Retries
+	total.PromptTokens += usage.PromptTokens
+	total.ResponseTokens += usage.ResponseTokens
+	addModelCost(total, usage.EstimatedCostMicros)
+}
+
+func addModelCost(usage *types.ModelUsage, micros int64) {
+	usage.EstimatedCostMicros += micros
+	usage.EstimatedCostUSD = float64(usage.EstimatedCostMicros) / 1e6
+}
@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func (h *APIState) HandleAddProductImage(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.ProductImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if request_body.ImageURL == "" {
+		response.Message = "ERROR: image_url is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if request_body.Role == "" {
+		request_body.Role = types.IMAGE_ROLE_SECONDARY
+	}
+	if !types.ValidImageRole(request_body.Role) {
+		response.Message = "ERROR: role must be hero, secondary or lifestyle"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if request_body.ImageName == "" {
+		request_body.ImageName = imageNameFromURL(request_body.ImageURL)
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	position, err := qtx.NextProductImagePosition(r.Context(), kit.ID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while adding the product image, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// The image starts as secondary so the previous hero can be demoted
+	// without two heroes ever existing.
+	image, err := qtx.CreateProductImage(r.Context(), db.CreateProductImageParams{
+		BrandKitID: kit.ID,
+		ImageUrl:   request_body.ImageURL,
+		ImageName:  optionalText(request_body.ImageName),
+		Role:       types.IMAGE_ROLE_SECONDARY,
+		Position:   position,
+	})
+	if err == nil && request_body.Role != types.IMAGE_ROLE_SECONDARY {
+		image, err = setImageRole(r.Context(), qtx, image, request_body.Role)
+	}
+	if err == nil {
+		err = qtx.EnsureHeroProductImage(r.Context(), kit.ID)
+	}
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_PRODUCT_IMAGE_CREATE,
+			TargetType: audit.TARGET_PRODUCT_IMAGE,
+			TargetID:   image.ID,
+			After:      image,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while adding the product image, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+	go h.describeInBackground(principal, kit, []db.ProductImage{image})
+
+	log.Println("SUCCESS: Successfully added the product image")
+	h.writeProductImages(w, r, kit, http.StatusCreated, "SUCCESS: Successfully added the product image")
+}
+
+func (h *APIState) HandlePatchProductImages(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.ProductImagesPatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	images, err := qtx.ListProductImagesForBrandKit(r.Context(), kit.ID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching images for id %v, error: %v\n", uuidString(kit.ID), err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	index := map[[16]byte]int{}
+	for i, image := range images {
+		index[image.ID.Bytes] = i
+	}
+
+	// Work out the final state of every image before writing anything.
+	updated := make([]db.ProductImage, len(images))
+	copy(updated, images)
+
+	hero := pgtype.UUID{}
+	for _, patch := range request_body.Images {
+		i, found := index[patch.ID.Bytes]
+		if !patch.ID.Valid || !found {
+			response.Message = "ERROR: Image " + uuidString(patch.ID) + " does not belong to this kit"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		if patch.ImageName != nil {
+			updated[i].ImageName = optionalText(strings.TrimSpace(*patch.ImageName))
+		}
+		if patch.Role != nil {
+			if !types.ValidImageRole(*patch.Role) {
+				response.Message = "ERROR: role must be hero, secondary or lifestyle"
+				writeJSON(w, http.StatusBadRequest, response)
+				return
+			}
+			if *patch.Role == types.IMAGE_ROLE_HERO {
+				if hero.Valid && hero != patch.ID {
+					response.Message = "ERROR: Only one image can be the hero"
+					writeJSON(w, http.StatusBadRequest, response)
+					return
+				}
+				hero = patch.ID
+			}
+			updated[i].Role = *patch.Role
+		}
+	}
+
+	if len(request_body.Order) > 0 {
+		if len(request_body.Order) != len(images) {
+			response.Message = "ERROR: order must list every image of the kit exactly once"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		seen := map[[16]byte]bool{}
+		for position, id := range request_body.Order {
+			i, found := index[id.Bytes]
+			if !id.Valid || !found || seen[id.Bytes] {
+				response.Message = "ERROR: order must list every image of the kit exactly once"
+				writeJSON(w, http.StatusBadRequest, response)
+				return
+			}
+			seen[id.Bytes] = true
+			updated[i].Position = int32(position)
+		}
+	}
+
+	if hero.Valid {
+		if err := qtx.ClearHeroProductImage(r.Context(), db.ClearHeroProductImageParams{BrandKitID: kit.ID, ID: hero}); err != nil {
+			log.Printf("ERROR: Something went wrong while updating the product images, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+		for i := range updated {
+			if updated[i].ID != hero && updated[i].Role == types.IMAGE_ROLE_HERO {
+				updated[i].Role = types.IMAGE_ROLE_SECONDARY
+			}
+		}
+	}
+
+	for i, image := range updated {
+		if image.ImageName == images[i].ImageName && image.Role == images[i].Role && image.Position == images[i].Position {
+			continue
+		}
+		if _, err := qtx.UpdateProductImage(r.Context(), db.UpdateProductImageParams{
+			ID:         image.ID,
+			BrandKitID: kit.ID,
+			ImageName:  image.ImageName,
+			Role:       image.Role,
+			Position:   image.Position,
+		}); err != nil {
+			log.Printf("ERROR: Something went wrong while updating the product images, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+	}
+
+	if err := qtx.EnsureHeroProductImage(r.Context(), kit.ID); err != nil {
+		log.Printf("ERROR: Something went wrong while updating the product images, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	after, err := qtx.ListProductImagesForBrandKit(r.Context(), kit.ID)
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_PRODUCT_IMAGE_UPDATE,
+			TargetType: audit.TARGET_BRAND_KIT,
+			TargetID:   kit.ID,
+			Before:     imagesByID(images),
+			After:      imagesByID(after),
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while updating the product images, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully updated the product images")
+	h.writeProductImages(w, r, kit, http.StatusOK, "SUCCESS: Successfully updated the product images")
+}
+
+func (h *APIState) HandleDeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	var image_uuid pgtype.UUID
+	if err := image_uuid.Scan(chi.URLParam(r, "image_id")); err != nil {
+		response.Message = "ERROR: Invalid image id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	image, err := qtx.GetProductImage(r.Context(), image_uuid)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("ERROR: Something went wrong while deleting the product image, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	deleted, err := qtx.DeleteProductImage(r.Context(), db.DeleteProductImageParams{ID: image_uuid, BrandKitID: kit.ID})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while deleting the product image, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if deleted == 0 {
+		response.Message = "ERROR: No image found with this id in the kit"
+		writeJSON(w, http.StatusNotFound, response)
+		return
+	}
+
+	err = compactImagePositions(r.Context(), qtx, kit.ID)
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_PRODUCT_IMAGE_DELETE,
+			TargetType: audit.TARGET_PRODUCT_IMAGE,
+			TargetID:   image_uuid,
+			Before:     image,
+		})
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while deleting the product image, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully deleted the product image")
+	h.writeProductImages(w, r, kit, http.StatusOK, "SUCCESS: Successfully deleted the product image")
+}
+
+// setImageRole gives the image a new role, demoting the current hero first
+// when the image becomes the hero.
+func setImageRole(ctx context.Context, qtx *db.Queries, image db.ProductImage, role string) (db.ProductImage, error) {
+	if role == types.IMAGE_ROLE_HERO {
+		if err := qtx.ClearHeroProductImage(ctx, db.ClearHeroProductImageParams{BrandKitID: image.BrandKitID, ID: image.ID}); err != nil {
+			return image, err
+		}
+	}
+	return qtx.UpdateProductImage(ctx, db.UpdateProductImageParams{
+		ID:         image.ID,
+		BrandKitID: image.BrandKitID,
+		ImageName:  image.ImageName,
+		Role:       role,
+		Position:   image.Position,
+	})
+}
+
+// compactImagePositions renumbers the kit's images 0..n-1 in their current
+// order and makes sure one of them is the hero.
+func compactImagePositions(ctx context.Context, qtx *db.Queries, kit_id pgtype.UUID) error {
+	images, err := qtx.ListProductImagesForBrandKit(ctx, kit_id)
+	if err != nil {
+		return err
+	}
+	for i, image := range images {
+		if image.Position == int32(i) {
+			continue
+		}
+		if _, err := qtx.UpdateProductImage(ctx, db.UpdateProductImageParams{
+			ID:         image.ID,
+			BrandKitID: kit_id,
+			ImageName:  image.ImageName,
+			Role:       image.Role,
+			Position:   int32(i),
+		}); err != nil {
+			return err
+		}
+	}
+	return qtx.EnsureHeroProductImage(ctx, kit_id)
+}
+
+func (h *APIState) writeProductImages(w http.ResponseWriter, r *http.Request, kit db.BrandKit, status int, message string) {
+	response := types.APIResponse{}
+
+	images, err := h.Queries.ListProductImagesForBrandKit(r.Context(), kit.ID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching images for id %v, error: %v\n", uuidString(kit.ID), err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if images == nil {
+		images = []db.ProductImage{}
+	}
+
+	response.Message = message
+	response.Data = types.BrandKitAndImagesResponse{BrandKit: kit, Images: images}
+	writeJSON(w, status, response)
+}
+
+// imagesByID keys images by id, so the audit log shows which image changed.
+func imagesByID(images []db.ProductImage) map[string]db.ProductImage {
+	by_id := make(map[string]db.ProductImage, len(images))
+	for _, image := range images {
+		by_id[uuidString(image.ID)] = image
+	}
+	return by_id
+}
+
+// imageNameFromURL names an image after its file, without the extension.
+func imageNameFromURL(image_url string) string {
+	parsed, err := url.Parse(image_url)
+	if err != nil || parsed.Scheme == "data" {
+		return ""
+	}
+	name := path.Base(parsed.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return strings.TrimSuffix(name, path.Ext(name))
+}
@@ -0,0 +1,477 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/internal/db"
+	"canvas-backend/prompts"
+	"canvas-backend/types"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// promptName reads the prompt name from the URL, writing a 404 itself when
+// there is no such prompt.
+func promptName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := chi.URLParam(r, "name")
+	if _, err := prompts.Builtin(name); err != nil {
+		writeJSON(w, http.StatusNotFound, types.APIResponse{Message: "ERROR: No prompt named " + strconv.Quote(name)})
+		return "", false
+	}
+	return name, true
+}
+
+func (h *APIState) HandleListPrompts(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	active, err := h.Queries.ListActivePromptVersions(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the active prompts, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	active_versions := map[string]int32{}
+	for _, row := range active {
+		active_versions[row.Name] = row.Version
+	}
+
+	summaries := []types.PromptSummary{}
+	for _, name := range prompts.Names() {
+		summaries = append(summaries, types.PromptSummary{
+			Name:          name,
+			Variables:     prompts.Variables(name),
+			ActiveVersion: active_versions[name],
+		})
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the prompts"
+	response.Data = summaries
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleListPromptVersions lists the published versions of a prompt,
+// newest first, without their bodies.
+func (h *APIState) HandleListPromptVersions(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := h.Queries.ListPromptTemplateVersions(r.Context(), db.ListPromptTemplateVersionsParams{WorkspaceID: workspaceID(r), Name: name})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the prompt versions, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	builtin, _ := prompts.Builtin(name)
+	version_responses := make([]types.PromptTemplateResponse, 0, len(versions)+1)
+	for _, version := range versions {
+		version_responses = append(version_responses, types.NewPromptTemplateResponse(version, false))
+	}
+	version_responses = append(version_responses, types.PromptTemplateResponse{Name: name, Version: prompts.BUILTIN_VERSION, Hash: builtin.Hash})
+
+	response.Message = "SUCCESS: Successfully fetched the prompt versions"
+	response.Data = version_responses
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) HandleGetPromptVersion(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+
+	version, err := strconv.ParseInt(chi.URLParam(r, "version"), 10, 32)
+	if err != nil || version < 0 {
+		response.Message = "ERROR: Invalid version " + strconv.Quote(chi.URLParam(r, "version"))
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	if version == prompts.BUILTIN_VERSION {
+		builtin, _ := prompts.Builtin(name)
+		response.Message = "SUCCESS: Successfully fetched the prompt version"
+		response.Data = types.PromptTemplateResponse{Name: name, Version: builtin.Version, Hash: builtin.Hash, Body: builtin.Body}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	template, err := h.Queries.GetPromptTemplate(r.Context(), db.GetPromptTemplateParams{WorkspaceID: workspaceID(r), Name: name, Version: int32(version)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No version " + strconv.FormatInt(version, 10) + " of this prompt"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the prompt version, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the prompt version"
+	response.Data = types.NewPromptTemplateResponse(template, true)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandlePublishPrompt stores a new version of a prompt after checking that
+// it parses and only uses the prompt's variables.
+func (h *APIState) HandlePublishPrompt(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.PromptPublishRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if request_body.Body == "" {
+		response.Message = "ERROR: body is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	parsed, err := prompts.Parse(name, 0, request_body.Body)
+	if err != nil {
+		response.Message = "ERROR: Invalid template: " + err.Error()
+		response.Data = types.PromptSummary{Name: name, Variables: prompts.Variables(name)}
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	version, err := qtx.NextPromptTemplateVersion(r.Context(), db.NextPromptTemplateVersionParams{WorkspaceID: workspaceID(r), Name: name})
+	var template db.PromptTemplate
+	if err == nil {
+		template, err = qtx.CreatePromptTemplate(r.Context(), db.CreatePromptTemplateParams{
+			WorkspaceID: workspaceID(r),
+			Name:        name,
+			Version:     version,
+			Body:        parsed.Body,
+			Hash:        parsed.Hash,
+			Note:        optionalText(request_body.Note),
+			Author:      designAuthor(r),
+		})
+	}
+	var pg_err *pgconn.PgError
+	if errors.As(err, &pg_err) && pg_err.Code == "23505" {
+		response.Message = "ERROR: Another version was published at the same time, try again"
+		writeJSON(w, http.StatusConflict, response)
+		return
+	}
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_PROMPT_PUBLISH,
+			TargetType: audit.TARGET_PROMPT,
+			TargetID:   template.ID,
+			After:      types.NewPromptTemplateResponse(template, true),
+		})
+	}
+	if err == nil && (request_body.Activate == nil || *request_body.Activate) {
+		err = h.activatePrompt(r, qtx, name, template.Version)
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while publishing the prompt, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Printf("SUCCESS: Published version %d of the %s prompt\n", template.Version, name)
+	response.Message = "SUCCESS: Successfully published the prompt"
+	response.Data = types.NewPromptTemplateResponse(template, true)
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// HandleActivatePrompt makes a version the one the workspace's kits use,
+// which is also how a bad version is rolled back.
+func (h *APIState) HandleActivatePrompt(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := h.decodePromptVersion(w, r, name)
+	if !ok {
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	err = h.activatePrompt(r, h.Queries.WithTx(tx), name, version)
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while activating the prompt, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Printf("SUCCESS: Activated version %d of the %s prompt\n", version, name)
+	response.Message = "SUCCESS: Successfully activated the prompt version"
+	response.Data = types.PromptSummary{Name: name, Variables: prompts.Variables(name), ActiveVersion: version}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) activatePrompt(r *http.Request, queries *db.Queries, name string, version int32) error {
+	previous, err := h.Prompts.Active(r.Context(), workspaceID(r), name)
+	if err != nil {
+		return err
+	}
+
+	active, err := queries.SetActivePromptVersion(r.Context(), db.SetActivePromptVersionParams{
+		WorkspaceID: workspaceID(r),
+		Name:        name,
+		Version:     version,
+	})
+	if err != nil {
+		return err
+	}
+
+	return audit.Record(r.Context(), queries, audit.Event{
+		Action:     audit.ACTION_PROMPT_ACTIVATE,
+		TargetType: audit.TARGET_PROMPT,
+		Before:     types.BrandKitPrompt{Name: name, Version: previous},
+		After:      types.BrandKitPrompt{Name: active.Name, Version: active.Version},
+	})
+}
+
+// HandleListBrandKitPrompts shows the version of each prompt the kit
+// generates with.
+func (h *APIState) HandleListBrandKitPrompts(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+
+	pins, err := h.Queries.ListBrandKitPromptPins(r.Context(), kit.ID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the prompt pins, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	pinned := map[string]int32{}
+	for _, pin := range pins {
+		pinned[pin.Name] = pin.Version
+	}
+
+	kit_prompts := []types.BrandKitPrompt{}
+	for _, name := range prompts.Names() {
+		version, is_pinned := pinned[name]
+		if !is_pinned {
+			if version, err = h.Prompts.Active(r.Context(), kit.WorkspaceID, name); err != nil {
+				log.Printf("ERROR: Something went wrong while fetching the active prompt, error: %v\n", err)
+				response.Message = "ERROR: Something went wrong"
+				writeJSON(w, http.StatusInternalServerError, response)
+				return
+			}
+		}
+		kit_prompts = append(kit_prompts, types.BrandKitPrompt{Name: name, Version: version, Pinned: is_pinned})
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the kit's prompts"
+	response.Data = kit_prompts
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandlePinBrandKitPrompt holds the kit on a version of a prompt whatever
+// the workspace has active.
+func (h *APIState) HandlePinBrandKitPrompt(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+	version, ok := h.decodePromptVersion(w, r, name)
+	if !ok {
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	pin, err := qtx.SetBrandKitPromptPin(r.Context(), db.SetBrandKitPromptPinParams{BrandKitID: kit.ID, Name: name, Version: version})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_BRAND_KIT_PROMPT_PIN,
+			TargetType: audit.TARGET_BRAND_KIT,
+			TargetID:   kit.ID,
+			After:      types.BrandKitPrompt{Name: pin.Name, Version: pin.Version, Pinned: true},
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while pinning the prompt, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Printf("SUCCESS: Pinned kit %s to version %d of the %s prompt\n", uuidString(kit.ID), version, name)
+	response.Message = "SUCCESS: Successfully pinned the prompt version"
+	response.Data = types.BrandKitPrompt{Name: pin.Name, Version: pin.Version, Pinned: true}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleUnpinBrandKitPrompt puts the kit back on the workspace's active
+// version.
+func (h *APIState) HandleUnpinBrandKitPrompt(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	kit, ok := h.loadBrandKit(w, r)
+	if !ok {
+		return
+	}
+	name, ok := promptName(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	previous, err := qtx.GetBrandKitPromptPin(r.Context(), db.GetBrandKitPromptPinParams{BrandKitID: kit.ID, Name: name})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: The kit is not pinned to a version of this prompt"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the prompt pin, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	_, err = qtx.DeleteBrandKitPromptPin(r.Context(), db.DeleteBrandKitPromptPinParams{BrandKitID: kit.ID, Name: name})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_BRAND_KIT_PROMPT_UNPIN,
+			TargetType: audit.TARGET_BRAND_KIT,
+			TargetID:   kit.ID,
+			Before:     types.BrandKitPrompt{Name: name, Version: previous, Pinned: true},
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while unpinning the prompt, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully unpinned the prompt version")
+	response.Message = "SUCCESS: Successfully unpinned the prompt version"
+	writeJSON(w, http.StatusOK, response)
+}
+
+// decodePromptVersion reads a types.PromptVersionRequest and checks that
+// the workspace has that version, writing the error response itself.
+func (h *APIState) decodePromptVersion(w http.ResponseWriter, r *http.Request, name string) (int32, bool) {
+	response := types.APIResponse{}
+
+	var request_body types.PromptVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return 0, false
+	}
+	if request_body.Version == nil {
+		response.Message = "ERROR: version is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return 0, false
+	}
+
+	if _, err := h.Prompts.Load(r.Context(), workspaceID(r), name, *request_body.Version); err != nil {
+		if errors.Is(err, prompts.ErrUnknownVersion) {
+			response.Message = "ERROR: No version " + strconv.Itoa(int(*request_body.Version)) + " of this prompt"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while loading the prompt version, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return 0, false
+	}
+	return *request_body.Version, true
+}
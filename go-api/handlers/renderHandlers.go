@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"canvas-backend/internal/db"
+	"canvas-backend/render"
+	"canvas-backend/types"
+	"canvas-backend/workflow"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// MAX_RENDER_BODY_BYTES bounds render and export requests, leaving room for
+// a layout with an inline image.
+const MAX_RENDER_BODY_BYTES = 10 << 20
+
+// HandleRender renders an approved design, or any layout as a watermarked
+// preview. Clean renders of unapproved work would bypass the sign-off.
+func (h *APIState) HandleRender(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_RENDER_BODY_BYTES)
+	var request_body types.RenderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	if !validOutput(request_body.Output) {
+		log.Printf("ERROR: Unsupported output format %q\n", request_body.Output)
+		response.Message = "ERROR: Unsupported output format (use png or jpeg)"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	layout_json := []byte(request_body.Layout)
+	watermark := render.PREVIEW_WATERMARK
+	switch {
+	case request_body.DesignID.Valid && len(request_body.Layout) > 0:
+		response.Message = "ERROR: Send either a layout or a design_id, not both"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	case request_body.DesignID.Valid:
+		_, version, ok := h.loadExportableDesign(w, r, request_body.DesignID)
+		if !ok {
+			return
+		}
+		layout_json, watermark = version.LayoutJson, ""
+	case len(request_body.Layout) == 0:
+		response.Message = "ERROR: layout or design_id is required"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	data, format, ok := renderLayout(w, r, layout_json, request_body.Format, request_body.Output, request_body.Quality, watermark)
+	if !ok {
+		return
+	}
+
+	log.Printf("SUCCESS: Rendered the %s layout\n", format)
+	w.Header().Add("Content-Type", render.ContentType(request_body.Output))
+	w.Header().Add("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+func validOutput(output string) bool {
+	return output == "" || output == render.OUTPUT_PNG || output == render.OUTPUT_JPEG
+}
+
+// loadExportableDesign loads a design of the caller's workspace that has
+// been signed off, with its current version. Saving a new version sends a
+// design back to draft, so the current version is the one that was approved.
+func (h *APIState) loadExportableDesign(w http.ResponseWriter, r *http.Request, design_id pgtype.UUID) (db.Design, db.DesignVersion, bool) {
+	response := types.APIResponse{}
+
+	design, err := h.Queries.GetDesignForWorkspace(r.Context(), db.GetDesignForWorkspaceParams{ID: design_id, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No design found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the design, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return db.Design{}, db.DesignVersion{}, false
+	}
+
+	if !workflow.Exportable(design.Status) {
+		log.Printf("ERROR: Refused to export design %s in status %s\n", uuidString(design.ID), design.Status)
+		response.Message = "ERROR: Only approved designs can be exported, this one is " + design.Status
+		response.Data = design
+		writeJSON(w, http.StatusConflict, response)
+		return db.Design{}, db.DesignVersion{}, false
+	}
+
+	version, err := h.Queries.GetDesignVersion(r.Context(), db.GetDesignVersionParams{DesignID: design.ID, Version: design.CurrentVersion})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the design version, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return db.Design{}, db.DesignVersion{}, false
+	}
+	return design, version, true
+}
+
+// renderLayout renders one format of a layout document and encodes it,
+// defaulting to the layout's only format. It returns the format rendered.
+func renderLayout(w http.ResponseWriter, r *http.Request, layout_json []byte, format, output string, quality int, watermark string) ([]byte, string, bool) {
+	response := types.APIResponse{}
+
+	layout, _, err := types.DecodeLayout(layout_json)
+	if err != nil {
+		log.Printf("ERROR: Unable to decode the layout, error: %v\n", err)
+		response.Message = "ERROR: Invalid layout"
+		var decode_err *types.LayoutDecodeError
+		if errors.As(err, &decode_err) {
+			response.Data = decode_err.Problems
+		}
+		writeJSON(w, http.StatusBadRequest, response)
+		return nil, "", false
+	}
+
+	if format == "" && len(layout) == 1 {
+		format = layout.Formats()[0]
+	}
+	format_layout, ok := layout[format]
+	if !ok || format_layout == nil {
+		log.Printf("ERROR: Format %q not found in the layout\n", format)
+		response.Message = fmt.Sprintf("ERROR: Format not found in the layout (available: %v)", layout.Formats())
+		writeJSON(w, http.StatusBadRequest, response)
+		return nil, "", false
+	}
+
+	img, err := render.Render(r.Context(), format_layout, render.Options{Watermark: watermark})
+	if err != nil {
+		log.Printf("ERROR: Unable to render the layout, error: %v\n", err)
+		response.Message = "ERROR: Unable to render the layout"
+		writeJSON(w, http.StatusUnprocessableEntity, response)
+		return nil, "", false
+	}
+
+	var buf bytes.Buffer
+	if err := render.Encode(&buf, img, output, quality); err != nil {
+		log.Printf("ERROR: Unable to encode the rendered image, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return nil, "", false
+	}
+	return buf.Bytes(), format, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, response types.APIResponse) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
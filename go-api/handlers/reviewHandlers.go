@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"canvas-backend/workflow"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// HandleTransitionDesign takes a workflow action (submit, withdraw, approve,
+// reject, publish) on the current version of a design and records who took
+// it, in which role and why.
+func (h *APIState) HandleTransitionDesign(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	var request_body types.DesignTransitionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	request_body.Reason = strings.TrimSpace(request_body.Reason)
+	if request_body.Version == 0 {
+		request_body.Version = design.CurrentVersion
+	}
+
+	principal, _ := auth.FromContext(r.Context())
+
+	transition, role, err := workflow.Check(request_body.Action, design.Status, principal.ApprovalRoles, request_body.Reason)
+	if err != nil {
+		response.Data = design
+		switch {
+		case errors.Is(err, workflow.ErrUnknownAction):
+			response.Message = "ERROR: action must be submit, withdraw, approve, reject or publish"
+			writeJSON(w, http.StatusBadRequest, response)
+		case errors.Is(err, workflow.ErrInvalidTransition):
+			response.Message = "ERROR: Cannot " + request_body.Action + " a design that is " + design.Status
+			writeJSON(w, http.StatusConflict, response)
+		case errors.Is(err, workflow.ErrRoleRequired):
+			response.Message = "ERROR: Only a " + strings.Join(transition.Roles, " or ") + " can " + request_body.Action + " a design"
+			writeJSON(w, http.StatusForbidden, response)
+		default:
+			response.Message = "ERROR: A reason is required to " + request_body.Action + " a design"
+			writeJSON(w, http.StatusBadRequest, response)
+		}
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	updated, err := qtx.TransitionDesign(r.Context(), db.TransitionDesignParams{
+		ToStatus:   transition.To,
+		ID:         design.ID,
+		FromStatus: design.Status,
+		Version:    request_body.Version,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: The design has changed since it was loaded, reload it and try again"
+			if current, err := h.Queries.GetDesign(r.Context(), design.ID); err == nil {
+				response.Data = current
+			}
+			writeJSON(w, http.StatusConflict, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while updating the design status, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	review, err := qtx.CreateDesignReview(r.Context(), db.CreateDesignReviewParams{
+		DesignID:     updated.ID,
+		Version:      updated.CurrentVersion,
+		Action:       transition.Action,
+		FromStatus:   design.Status,
+		ToStatus:     updated.Status,
+		ActorUserID:  principal.UserID,
+		ActorEmail:   principal.Email,
+		ApprovalRole: optionalText(role),
+		Reason:       optionalText(request_body.Reason),
+	})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while recording the design review, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	err = audit.Record(r.Context(), qtx, audit.Event{
+		Action:     audit.ACTION_DESIGN_TRANSITION,
+		TargetType: audit.TARGET_DESIGN,
+		TargetID:   updated.ID,
+		Before:     design,
+		After:      updated,
+	})
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while recording the design review, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		log.Printf("ERROR: Failed to commit the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Printf("SUCCESS: Design %s moved from %s to %s by %s\n", uuidString(updated.ID), design.Status, updated.Status, principal.Email)
+	response.Message = "SUCCESS: Successfully updated the design status"
+	response.Data = types.DesignTransitionResponse{Design: updated, Review: review}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (h *APIState) HandleListDesignReviews(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	design, ok := h.loadDesign(w, r)
+	if !ok {
+		return
+	}
+
+	reviews, err := h.Queries.ListDesignReviews(r.Context(), design.ID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the design reviews, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if reviews == nil {
+		reviews = []db.DesignReview{}
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the design reviews"
+	response.Data = reviews
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleSetApprovalRoles replaces a member's approval roles.
+func (h *APIState) HandleSetApprovalRoles(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var user_uuid pgtype.UUID
+	if err := user_uuid.Scan(chi.URLParam(r, "user_id")); err != nil {
+		response.Message = "ERROR: Invalid user id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	var request_body types.ApprovalRolesRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	roles := []string{}
+	for _, role := range request_body.ApprovalRoles {
+		if !workflow.ValidRole(role) {
+			response.Message = "ERROR: approval roles must be designer, brand_manager or compliance_reviewer"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	previous, err := qtx.GetWorkspaceMember(r.Context(), db.GetWorkspaceMemberParams{WorkspaceID: workspaceID(r), UserID: user_uuid})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No member found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the member, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	member, err := qtx.SetWorkspaceMemberApprovalRoles(r.Context(), db.SetWorkspaceMemberApprovalRolesParams{
+		WorkspaceID:   workspaceID(r),
+		UserID:        user_uuid,
+		ApprovalRoles: roles,
+	})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_MEMBER_APPROVAL_ROLES,
+			TargetType: audit.TARGET_USER,
+			TargetID:   member.UserID,
+			Before:     previous,
+			After:      member,
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while updating the approval roles, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully updated the approval roles")
+	response.Message = "SUCCESS: Successfully updated the approval roles"
+	response.Data = member
+	writeJSON(w, http.StatusOK, response)
+}
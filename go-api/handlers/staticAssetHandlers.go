@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/compliance"
+	"canvas-backend/internal/db"
+	"canvas-backend/render"
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// currentStaticAssets loads the workspace's static assets, its own
+// replacements taking the place of the defaults.
+func (h *APIState) currentStaticAssets(ctx context.Context, workspace_id pgtype.UUID) ([]db.StaticAsset, error) {
+	rows, err := h.Queries.ListStaticAssets(ctx, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows come sorted by key with the workspace's row last.
+	assets := []db.StaticAsset{}
+	for _, row := range rows {
+		if n := len(assets); n > 0 && assets[n-1].Key == row.Key {
+			assets[n-1] = row
+		} else {
+			assets = append(assets, row)
+		}
+	}
+	return assets, nil
+}
+
+// staticAssets is currentStaticAssets keyed for the compliance checks.
+func (h *APIState) staticAssets(ctx context.Context, workspace_id pgtype.UUID) (compliance.StaticAssets, error) {
+	rows, err := h.currentStaticAssets(ctx, workspace_id)
+	if err != nil {
+		return nil, err
+	}
+
+	assets := compliance.StaticAssets{}
+	for _, row := range rows {
+		assets[row.Key] = compliance.StaticAsset{
+			Key:      row.Key,
+			URL:      row.Url,
+			Width:    row.Width.Int32,
+			Height:   row.Height.Int32,
+			Formats:  row.Formats,
+			Retailer: row.Retailer,
+		}
+	}
+	return assets, nil
+}
+
+func (h *APIState) HandleListStaticAssets(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	rows, err := h.currentStaticAssets(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the static assets, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	assets := make([]types.StaticAssetResponse, 0, len(rows))
+	for _, row := range rows {
+		assets = append(assets, types.NewStaticAssetResponse(row))
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the static assets"
+	response.Data = assets
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleReplaceStaticAsset points one of the workspace's static assets at a
+// new image. The image is fetched first, so a broken URL is refused and the
+// asset's intrinsic size is measured from what is actually served.
+func (h *APIState) HandleReplaceStaticAsset(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	key := chi.URLParam(r, "key")
+
+	var request_body types.StaticAssetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if parsed, err := url.Parse(request_body.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		response.Message = "ERROR: url must be an http or https URL"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	rows, err := h.currentStaticAssets(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the static assets, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	var previous *db.StaticAsset
+	for i := range rows {
+		if rows[i].Key == key {
+			previous = &rows[i]
+		}
+	}
+	if previous == nil {
+		response.Message = "ERROR: No static asset named " + strconv.Quote(key)
+		writeJSON(w, http.StatusNotFound, response)
+		return
+	}
+
+	formats, retailer := previous.Formats, previous.Retailer
+	if request_body.Formats != nil {
+		formats = *request_body.Formats
+	}
+	if request_body.Retailer != nil {
+		retailer = *request_body.Retailer
+	}
+	if formats == nil {
+		formats = []string{}
+	}
+
+	img, err := render.NewHTTPFetcher().Fetch(r.Context(), request_body.URL)
+	if err != nil {
+		log.Printf("ERROR: Unable to load the static asset %s, error: %v\n", request_body.URL, err)
+		response.Message = "ERROR: Unable to load an image from url"
+		writeJSON(w, http.StatusUnprocessableEntity, response)
+		return
+	}
+	size := img.Bounds().Size()
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	asset, err := qtx.SetStaticAsset(r.Context(), db.SetStaticAssetParams{
+		WorkspaceID: workspaceID(r),
+		Key:         key,
+		Url:         request_body.URL,
+		Width:       pgtype.Int4{Int32: int32(size.X), Valid: true},
+		Height:      pgtype.Int4{Int32: int32(size.Y), Valid: true},
+		Formats:     formats,
+		Retailer:    retailer,
+	})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_STATIC_ASSET_REPLACE,
+			TargetType: audit.TARGET_STATIC_ASSET,
+			TargetID:   asset.ID,
+			Before:     types.NewStaticAssetResponse(*previous),
+			After:      types.NewStaticAssetResponse(asset),
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while replacing the static asset, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Printf("SUCCESS: Replaced the static asset %s\n", key)
+	response.Message = "SUCCESS: Successfully replaced the static asset"
+	response.Data = types.NewStaticAssetResponse(asset)
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"canvas-backend/accounting"
+	"canvas-backend/audit"
+	"canvas-backend/internal/db"
+	"canvas-backend/jobs"
+	"canvas-backend/types"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Comments are sent this often so proxies keep idle streams open.
+const SSE_KEEPALIVE_INTERVAL = 15 * time.Second
+
+// HandleGenerateStream runs a generation inside the request and streams its
+// progress as server-sent events. The generation stops if the client goes
+// away. EventSource cannot send the API key, so browsers first get a token
+// from POST /session-tokens and open the stream with ?access_token=<token>.
+func (h *APIState) HandleGenerateStream(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var kit_uuid pgtype.UUID
+	if err := kit_uuid.Scan(chi.URLParam(r, "kit_id")); err != nil {
+		log.Printf("ERROR: Unable to kit id to uuid, error: %v\n", err)
+		response.Message = "ERROR: Invalid kit id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	kit, err := h.Queries.GetBrandKitForWorkspace(r.Context(), db.GetBrandKitForWorkspaceParams{ID: kit_uuid, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No kits found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching brandkits for id %v, error: %v\n", uuidString(kit_uuid), err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	// EventSource can only send a GET, so the request comes as query
+	// parameters; format may be repeated and value_tile is JSON.
+	query := r.URL.Query()
+	request_body := types.GenerateLayoutRequest{Prompt: query.Get("prompt"), Formats: query["format"]}
+	if query.Has("headline") {
+		headline := query.Get("headline")
+		request_body.Headline = &headline
+	}
+	if query.Has("subhead") {
+		subhead := query.Get("subhead")
+		request_body.Subhead = &subhead
+	}
+	if query.Has("variants") {
+		variants, err := strconv.Atoi(query.Get("variants"))
+		if err != nil {
+			response.Message = "ERROR: variants must be a number"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+		request_body.Variants = variants
+	}
+	if query.Has("value_tile") {
+		if err := json.Unmarshal([]byte(query.Get("value_tile")), &request_body.ValueTile); err != nil {
+			response.Message = "ERROR: value_tile must be a JSON object"
+			writeJSON(w, http.StatusBadRequest, response)
+			return
+		}
+	}
+
+	request, err := h.checkGenerationRequest(r.Context(), kit, request_body)
+	if err != nil {
+		var invalid *invalidRequestError
+		if errors.As(err, &invalid) {
+			response.Message = "ERROR: " + invalid.message
+			writeJSON(w, http.StatusBadRequest, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the formats, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	if !h.Limits.Allow(w, r, int32(request.Variants)) {
+		return
+	}
+
+	images, err := h.Queries.ListProductImagesForBrandKit(r.Context(), kit_uuid)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching images for id %v, error: %v\n", uuidString(kit_uuid), err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	if images == nil {
+		images = []db.ProductImage{}
+	}
+
+	h.recordAudit(r, audit.Event{
+		Action:     audit.ACTION_GENERATION_STREAM,
+		TargetType: audit.TARGET_BRAND_KIT,
+		TargetID:   kit.ID,
+	})
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	ctx := accounting.WithAttribution(r.Context(), accounting.Attribution{WorkspaceID: kit.WorkspaceID, BrandKitID: kit.ID})
+	events := make(chan types.GenerationEvent, 16)
+	var result *types.GenerateLayoutResponse
+	var generate_err error
+
+	go func() {
+		defer close(events)
+		result, generate_err = h.generateLayout(ctx, kit, images, request, func(event types.GenerationEvent) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	keepalive := time.NewTicker(SSE_KEEPALIVE_INTERVAL)
+	defer keepalive.Stop()
+
+	for open := true; open; {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				open = false
+				break
+			}
+			if err := writeEvent(w, rc, event); err != nil {
+				log.Printf("WARN: Unable to write the generation event, error: %v\n", err)
+			}
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			rc.Flush()
+		}
+	}
+
+	if ctx.Err() != nil {
+		log.Println("INFO: Client went away, generation stream stopped")
+		return
+	}
+
+	if generate_err != nil {
+		log.Printf("ERROR: Unable to generate the layout, error: %v\n", generate_err)
+		error_event := types.ErrorEvent{Message: "ERROR: Something went wrong"}
+		var detailed jobs.DetailedError
+		if errors.As(generate_err, &detailed) {
+			error_event.Message = "ERROR: The model did not return a valid layout"
+			error_event.Details = detailed.Details()
+		}
+		writeEvent(w, rc, types.GenerationEvent{Event: EVENT_ERROR, Stage: "failed", Data: error_event})
+		return
+	}
+
+	log.Println("SUCCESS: Successfully streamed the layout generation")
+	writeEvent(w, rc, types.GenerationEvent{Event: EVENT_DONE, Progress: 100, Stage: "done", Data: result})
+}
+
+func writeEvent(w http.ResponseWriter, rc *http.ResponseController, event types.GenerationEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data); err != nil {
+		return err
+	}
+	return rc.Flush()
+}
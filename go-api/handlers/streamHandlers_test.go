@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"bufio"
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/llm"
+	"canvas-backend/prompts"
+	"canvas-backend/quota"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	TEST_KIT_ID       = "6f1c2a5e-3b4d-4c8e-9f10-112233445566"
+	TEST_WORKSPACE_ID = "0a0b0c0d-1e2f-4a3b-8c4d-5e6f70819203"
+)
+
+// fakeDB answers the brand kit lookup with kit, the generation limits
+// with limits and every other query with no rows, which the generation path
+// treats as "use the defaults". generations counts what the workspace was
+// charged this minute.
+type fakeDB struct {
+	kit         *db.BrandKit
+	limits      db.GetGenerationLimitsRow
+	generations int32
+}
+
+// Begin hands out a transaction that writes straight through to f.
+func (f *fakeDB) Begin(ctx context.Context) (pgx.Tx, error) {
+	return fakeTx{db: f}, nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return emptyRows{}, nil
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "-- name: GetBrandKitForWorkspace ") && f.kit != nil:
+		return kitRow{kit: *f.kit}
+	case strings.Contains(sql, "-- name: GetGenerationLimits "):
+		return limitsRow(f.limits)
+	case strings.Contains(sql, "-- name: IncrementUsageCounter "):
+		if args[0] == quota.SCOPE_WORKSPACE && args[2] == quota.PERIOD_MINUTE {
+			f.generations += args[4].(int32)
+			return countRow(f.generations)
+		}
+		return countRow(0)
+	}
+	return errRow{err: pgx.ErrNoRows}
+}
+
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDB
+}
+
+func (t fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return t.db.QueryRow(ctx, sql, args...)
+}
+
+func (t fakeTx) Commit(ctx context.Context) error   { return nil }
+func (t fakeTx) Rollback(ctx context.Context) error { return nil }
+
+type kitRow struct {
+	kit db.BrandKit
+}
+
+func (r kitRow) Scan(dest ...any) error {
+	*dest[0].(*pgtype.UUID) = r.kit.ID
+	*dest[1].(*string) = r.kit.Name
+	*dest[2].(*[]byte) = r.kit.ColorsJson
+	*dest[3].(*pgtype.Text) = r.kit.RulesText
+	*dest[4].(*pgtype.Text) = r.kit.LogoUrl
+	*dest[5].(*pgtype.Timestamptz) = r.kit.CreatedAt
+	*dest[6].(*pgtype.Timestamptz) = r.kit.UpdatedAt
+	*dest[7].(*pgtype.UUID) = r.kit.WorkspaceID
+	return nil
+}
+
+type limitsRow db.GetGenerationLimitsRow
+
+func (r limitsRow) Scan(dest ...any) error {
+	*dest[0].(*pgtype.Int4) = r.WorkspaceRateLimit
+	*dest[1].(*pgtype.Int4) = r.WorkspaceDailyQuota
+	*dest[2].(*pgtype.Int4) = r.KeyRateLimit
+	*dest[3].(*pgtype.Int4) = r.KeyDailyQuota
+	return nil
+}
+
+type countRow int32
+
+func (r countRow) Scan(dest ...any) error {
+	*dest[0].(*int32) = int32(r)
+	return nil
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...any) error {
+	return r.err
+}
+
+type emptyRows struct{}
+
+func (emptyRows) Close()                                       {}
+func (emptyRows) Err() error                                   { return nil }
+func (emptyRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (emptyRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (emptyRows) Next() bool                                   { return false }
+func (emptyRows) Scan(dest ...any) error                       { return pgx.ErrNoRows }
+func (emptyRows) Values() ([]any, error)                       { return nil, nil }
+func (emptyRows) RawValues() [][]byte                          { return nil }
+func (emptyRows) Conn() *pgx.Conn                              { return nil }
+
+func testUUID(t *testing.T, value string) pgtype.UUID {
+	t.Helper()
+	var id pgtype.UUID
+	if err := id.Scan(value); err != nil {
+		t.Fatalf("invalid test uuid %q: %v", value, err)
+	}
+	return id
+}
+
+// sseEvent is one server-sent event of a stream.
+type sseEvent struct {
+	name string
+	data map[string]any
+}
+
+func readEvents(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.data); err != nil {
+				t.Fatalf("event %s has invalid data: %v", current.name, err)
+			}
+		case line == "" && current.name != "":
+			events = append(events, current)
+			current = sseEvent{}
+		}
+	}
+	return events
+}
+
+func TestHandleGenerateStream(t *testing.T) {
+	workspace_id := testUUID(t, TEST_WORKSPACE_ID)
+	kit := &db.BrandKit{
+		ID:          testUUID(t, TEST_KIT_ID),
+		Name:        "Test brand",
+		ColorsJson:  []byte(`["#00539F","#ffffff"]`),
+		WorkspaceID: workspace_id,
+	}
+
+	tests := []struct {
+		name    string
+		kit     *db.BrandKit
+		kit_id  string
+		query   url.Values
+		layouts []string
+		limits  db.GetGenerationLimitsRow
+		status  int
+		// generations is what the workspace is charged.
+		generations int32
+		// last is the stream's last event, and formats how many
+		// format_ready events come before it.
+		last    string
+		formats int
+		// problems are the paths reported for an invalid layout.
+		problems []string
+	}{
+		{
+			name:    "generates every default format",
+			kit:     kit,
+			kit_id:  TEST_KIT_ID,
+			query:   url.Values{"headline": {"Fresh every day"}},
+			status:  http.StatusOK,
+			last:    EVENT_DONE,
+			formats: 3,
+
+			generations: 1,
+		},
+		{
+			name:    "generates the requested format",
+			kit:     kit,
+			kit_id:  TEST_KIT_ID,
+			query:   url.Values{"format": {"instagram_post"}},
+			status:  http.StatusOK,
+			last:    EVENT_DONE,
+			formats: 1,
+
+			generations: 1,
+		},
+		{
+			name:    "charges every variant",
+			kit:     kit,
+			kit_id:  TEST_KIT_ID,
+			query:   url.Values{"format": {"instagram_post"}, "variants": {"3"}},
+			status:  http.StatusOK,
+			last:    EVENT_DONE,
+			formats: 3,
+
+			generations: 3,
+		},
+		{
+			name:   "refuses variants past the limit",
+			kit:    kit,
+			kit_id: TEST_KIT_ID,
+			query:  url.Values{"format": {"instagram_post"}, "variants": {"3"}},
+			limits: db.GetGenerationLimitsRow{WorkspaceRateLimit: pgtype.Int4{Int32: 2, Valid: true}},
+			status: http.StatusTooManyRequests,
+
+			generations: 3,
+		},
+		{
+			name:     "reports the problems of an invalid layout",
+			kit:      kit,
+			kit_id:   TEST_KIT_ID,
+			query:    url.Values{"format": {"instagram_post"}},
+			layouts:  []string{`{"instagram_post":{"width":"wide","height":1080,"elements":[]}}`},
+			status:   http.StatusOK,
+			last:     EVENT_ERROR,
+			problems: []string{"instagram_post.width"},
+
+			generations: 1,
+		},
+		{
+			name:   "unknown format",
+			kit:    kit,
+			kit_id: TEST_KIT_ID,
+			query:  url.Values{"format": {"billboard"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "variants must be a number",
+			kit:    kit,
+			kit_id: TEST_KIT_ID,
+			query:  url.Values{"variants": {"many"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid kit id",
+			kit:    kit,
+			kit_id: "not-a-uuid",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown kit",
+			kit_id: TEST_KIT_ID,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := llm.NewFakeProvider()
+			provider.Layouts = tt.layouts
+			fake := &fakeDB{kit: tt.kit, limits: tt.limits}
+			queries := db.New(fake)
+			h := &APIState{
+				Queries:      queries,
+				Limits:       quota.NewLimiter(fake, queries),
+				Layouts:      provider,
+				Describer:    provider,
+				Prompts:      prompts.NewRegistry(queries),
+				ProviderName: provider.Name(),
+				ModelName:    provider.ModelName(),
+			}
+
+			router := chi.NewRouter()
+			router.Get("/brand-kit/{kit_id}/generate/stream", h.HandleGenerateStream)
+
+			request := httptest.NewRequest(http.MethodGet, "/brand-kit/"+tt.kit_id+"/generate/stream?"+tt.query.Encode(), nil)
+			request = request.WithContext(auth.WithPrincipal(request.Context(), auth.Principal{WorkspaceID: workspace_id}))
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", recorder.Code, tt.status, recorder.Body)
+			}
+			if fake.generations != tt.generations {
+				t.Errorf("charged %d generations, want %d", fake.generations, tt.generations)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			events := readEvents(t, recorder.Body.String())
+			if len(events) == 0 {
+				t.Fatal("the stream sent no events")
+			}
+			last := events[len(events)-1]
+			if last.name != tt.last {
+				t.Fatalf("last event = %s, want %s: %v", last.name, tt.last, last.data)
+			}
+
+			formats := 0
+			for _, event := range events {
+				if event.name == EVENT_FORMAT_READY {
+					formats++
+				}
+			}
+			if formats != tt.formats {
+				t.Errorf("%d format_ready events, want %d", formats, tt.formats)
+			}
+
+			if tt.last == EVENT_ERROR {
+				data, _ := last.data["data"].(map[string]any)
+				details, _ := data["details"].(map[string]any)
+				problems, _ := details["problems"].([]any)
+				var paths []string
+				for _, problem := range problems {
+					problem, _ := problem.(map[string]any)
+					path, _ := problem["path"].(string)
+					paths = append(paths, path)
+				}
+				if strings.Join(paths, ",") != strings.Join(tt.problems, ",") {
+					t.Errorf("problem paths = %v, want %v", paths, tt.problems)
+				}
+			}
+		})
+	}
+}
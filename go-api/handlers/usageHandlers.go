@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"canvas-backend/audit"
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/quota"
+	"canvas-backend/types"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// HandleGetUsage shows the generation limits in effect for the caller's
+// workspace and key, and how much of them has been used.
+func (h *APIState) HandleGetUsage(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	principal, _ := auth.FromContext(r.Context())
+
+	limits, err := h.Queries.GetGenerationLimits(r.Context(), principal.APIKeyID)
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the generation limits, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	workspace_limits := h.Limits.WorkspaceLimits(limits.WorkspaceRateLimit, limits.WorkspaceDailyQuota)
+
+	usage := types.GenerationUsageResponse{
+		Workspace: types.GenerationUsage{
+			GenerationRateLimit:  workspace_limits.RateLimit,
+			GenerationDailyQuota: workspace_limits.DailyQuota,
+		},
+		APIKey: types.GenerationUsage{
+			GenerationRateLimit:  limits.KeyRateLimit.Int32,
+			GenerationDailyQuota: limits.KeyDailyQuota.Int32,
+		},
+		DayResetsAt: quota.WindowStart(quota.PERIOD_DAY, time.Now()).Add(24 * time.Hour),
+	}
+
+	for _, used := range []struct {
+		scope    string
+		scope_id pgtype.UUID
+		period   string
+		count    *int32
+	}{
+		{quota.SCOPE_WORKSPACE, principal.WorkspaceID, quota.PERIOD_MINUTE, &usage.Workspace.UsedThisMinute},
+		{quota.SCOPE_WORKSPACE, principal.WorkspaceID, quota.PERIOD_DAY, &usage.Workspace.UsedToday},
+		{quota.SCOPE_API_KEY, principal.APIKeyID, quota.PERIOD_MINUTE, &usage.APIKey.UsedThisMinute},
+		{quota.SCOPE_API_KEY, principal.APIKeyID, quota.PERIOD_DAY, &usage.APIKey.UsedToday},
+	} {
+		*used.count, err = h.Limits.Used(r.Context(), used.scope, used.scope_id, used.period)
+		if err != nil {
+			log.Printf("ERROR: Something went wrong while fetching the generation usage, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+			return
+		}
+	}
+
+	response.Message = "SUCCESS: Successfully fetched the generation usage"
+	response.Data = usage
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleSetWorkspaceLimits replaces the workspace's generation limits.
+func (h *APIState) HandleSetWorkspaceLimits(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	rate_limit, daily_quota, ok := decodeGenerationLimits(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	previous, err := qtx.GetWorkspace(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the workspace, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	workspace, err := qtx.SetWorkspaceGenerationLimits(r.Context(), db.SetWorkspaceGenerationLimitsParams{
+		ID:                   previous.ID,
+		GenerationRateLimit:  rate_limit,
+		GenerationDailyQuota: daily_quota,
+	})
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_WORKSPACE_LIMITS,
+			TargetType: audit.TARGET_WORKSPACE,
+			TargetID:   workspace.ID,
+			Before:     previous,
+			After:      workspace,
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while updating the generation limits, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully updated the workspace generation limits")
+	response.Message = "SUCCESS: Successfully updated the generation limits"
+	response.Data = workspace
+	writeJSON(w, http.StatusOK, response)
+}
+
+// HandleSetAPIKeyLimits replaces a key's own generation limits, which
+// apply on top of the workspace's.
+func (h *APIState) HandleSetAPIKeyLimits(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var key_uuid pgtype.UUID
+	if err := key_uuid.Scan(chi.URLParam(r, "key_id")); err != nil {
+		response.Message = "ERROR: Invalid key id"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	rate_limit, daily_quota, ok := decodeGenerationLimits(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := h.Pool.Begin(r.Context())
+	if err != nil {
+		log.Printf("ERROR: Failed to start the sql transaction, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	qtx := h.Queries.WithTx(tx)
+
+	previous, err := qtx.GetAPIKey(r.Context(), db.GetAPIKeyParams{ID: key_uuid, WorkspaceID: workspaceID(r)})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			response.Message = "ERROR: No key found with this id"
+			writeJSON(w, http.StatusNotFound, response)
+		} else {
+			log.Printf("ERROR: Something went wrong while fetching the API key, error: %v\n", err)
+			response.Message = "ERROR: Something went wrong"
+			writeJSON(w, http.StatusInternalServerError, response)
+		}
+		return
+	}
+
+	api_key, err := qtx.SetAPIKeyGenerationLimits(r.Context(), db.SetAPIKeyGenerationLimitsParams{
+		ID:                   previous.ID,
+		WorkspaceID:          previous.WorkspaceID,
+		GenerationRateLimit:  rate_limit,
+		GenerationDailyQuota: daily_quota,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		response.Message = "ERROR: The key has been revoked"
+		writeJSON(w, http.StatusConflict, response)
+		return
+	}
+	if err == nil {
+		err = audit.Record(r.Context(), qtx, audit.Event{
+			Action:     audit.ACTION_API_KEY_LIMITS,
+			TargetType: audit.TARGET_API_KEY,
+			TargetID:   api_key.ID,
+			Before:     types.NewAPIKeyResponse(previous),
+			After:      types.NewAPIKeyResponse(api_key),
+		})
+	}
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while updating the generation limits, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	log.Println("SUCCESS: Successfully updated the API key generation limits")
+	response.Message = "SUCCESS: Successfully updated the generation limits"
+	response.Data = types.NewAPIKeyResponse(api_key)
+	writeJSON(w, http.StatusOK, response)
+}
+
+// decodeGenerationLimits reads a types.GenerationLimitsRequest, writing the
+// error response itself when it is invalid.
+func decodeGenerationLimits(w http.ResponseWriter, r *http.Request) (pgtype.Int4, pgtype.Int4, bool) {
+	response := types.APIResponse{}
+
+	var request_body types.GenerationLimitsRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return pgtype.Int4{}, pgtype.Int4{}, false
+	}
+
+	var limits [2]pgtype.Int4
+	for i, limit := range []*int32{request_body.GenerationRateLimit, request_body.GenerationDailyQuota} {
+		if limit == nil {
+			continue
+		}
+		if *limit < 0 {
+			response.Message = "ERROR: Generation limits cannot be negative"
+			writeJSON(w, http.StatusBadRequest, response)
+			return pgtype.Int4{}, pgtype.Int4{}, false
+		}
+		limits[i] = pgtype.Int4{Int32: *limit, Valid: true}
+	}
+	return limits[0], limits[1], true
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"canvas-backend/compliance"
+	"canvas-backend/render"
+	"canvas-backend/types"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+func (h *APIState) HandleValidate(w http.ResponseWriter, r *http.Request) {
+	response := types.APIResponse{}
+	response.Data = nil
+
+	var request_body types.ValidateRequest
+	if err := json.NewDecoder(r.Body).Decode(&request_body); err != nil {
+		log.Printf("ERROR: Unable to parse the request body, error: %v\n", err)
+		response.Message = "ERROR: Unable to parse the request body"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	platform, err := compliance.LookupPlatform(request_body.Platform)
+	if err != nil {
+		log.Printf("ERROR: Invalid platform, error: %v\n", err)
+		response.Message = "ERROR: Invalid platform (use social, checkoutSingle or says)"
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+
+	layout, unknown_fields, err := types.DecodeLayout(request_body.Layout)
+	if err != nil {
+		log.Printf("ERROR: Unable to decode the layout, error: %v\n", err)
+		response.Message = "ERROR: Invalid layout"
+		var decode_err *types.LayoutDecodeError
+		if errors.As(err, &decode_err) {
+			response.Data = decode_err.Problems
+		}
+		writeJSON(w, http.StatusBadRequest, response)
+		return
+	}
+	if unknown_fields == nil {
+		unknown_fields = []types.UnknownField{}
+	}
+
+	assets, err := h.staticAssets(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the static assets, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	formats, err := h.layoutFormats(r.Context(), workspaceID(r))
+	if err != nil {
+		log.Printf("ERROR: Something went wrong while fetching the formats, error: %v\n", err)
+		response.Message = "ERROR: Something went wrong"
+		writeJSON(w, http.StatusInternalServerError, response)
+		return
+	}
+
+	// Images are measured so that they are checked at the size they are drawn.
+	sizes := imageSizes(r.Context(), layout, assets)
+	for _, format := range layout.Formats() {
+		render.SizeImages(layout[format], sizes)
+	}
+
+	violations := compliance.Validate(layout, formats, platform)
+	for _, format := range layout.Formats() {
+		violations = append(violations, compliance.ValidateAssets(format, layout[format], assets)...)
+	}
+
+	log.Printf("SUCCESS: Validated the layout, %d violations found\n", len(violations))
+	response.Message = "SUCCESS: Successfully validated the layout"
+	response.Data = types.ValidateResponse{
+		Valid:         !compliance.HasErrors(violations),
+		Platform:      platform.Name,
+		Violations:    violations,
+		UnknownFields: unknown_fields,
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -16,18 +16,20 @@ INSERT INTO brand_kits (
   name,
   colors_json,
   rules_text,
-  logo_url
+  logo_url,
+  workspace_id
 ) VALUES (
-  $1, $2, $3, $4
+  $1, $2, $3, $4, $5
 )
-RETURNING id, name, colors_json, rules_text, logo_url, created_at, updated_at
+RETURNING id, name, colors_json, rules_text, logo_url, created_at, updated_at, workspace_id
 `
 
 type CreateBrandKitParams struct {
-	Name       string      `json:"name"`
-	ColorsJson []byte      `json:"colors_json"`
-	RulesText  pgtype.Text `json:"rules_text"`
-	LogoUrl    pgtype.Text `json:"logo_url"`
+	Name        string      `json:"name"`
+	ColorsJson  []byte      `json:"colors_json"`
+	RulesText   pgtype.Text `json:"rules_text"`
+	LogoUrl     pgtype.Text `json:"logo_url"`
+	WorkspaceID pgtype.UUID `json:"workspace_id"`
 }
 
 func (q *Queries) CreateBrandKit(ctx context.Context, arg CreateBrandKitParams) (BrandKit, error) {
@@ -36,6 +38,7 @@ func (q *Queries) CreateBrandKit(ctx context.Context, arg CreateBrandKitParams)
 		arg.ColorsJson,
 		arg.RulesText,
 		arg.LogoUrl,
+		arg.WorkspaceID,
 	)
 	var i BrandKit
 	err := row.Scan(
@@ -46,12 +49,44 @@ func (q *Queries) CreateBrandKit(ctx context.Context, arg CreateBrandKitParams)
 		&i.LogoUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
 
+const deleteBrandKit = `-- name: DeleteBrandKit :execrows
+DELETE FROM brand_kits
+WHERE id = $1
+`
+
+func (q *Queries) DeleteBrandKit(ctx context.Context, id pgtype.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteBrandKit, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteBrandKitIfUnchanged = `-- name: DeleteBrandKitIfUnchanged :execrows
+DELETE FROM brand_kits
+WHERE id = $1 AND updated_at = $2
+`
+
+type DeleteBrandKitIfUnchangedParams struct {
+	ID        pgtype.UUID        `json:"id"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+func (q *Queries) DeleteBrandKitIfUnchanged(ctx context.Context, arg DeleteBrandKitIfUnchangedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteBrandKitIfUnchanged, arg.ID, arg.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getBrandKit = `-- name: GetBrandKit :one
-SELECT id, name, colors_json, rules_text, logo_url, created_at, updated_at FROM brand_kits
+SELECT id, name, colors_json, rules_text, logo_url, created_at, updated_at, workspace_id FROM brand_kits
 WHERE id = $1
 `
 
@@ -66,17 +101,45 @@ func (q *Queries) GetBrandKit(ctx context.Context, id pgtype.UUID) (BrandKit, er
 		&i.LogoUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
+
+const getBrandKitForWorkspace = `-- name: GetBrandKitForWorkspace :one
+SELECT id, name, colors_json, rules_text, logo_url, created_at, updated_at, workspace_id FROM brand_kits
+WHERE id = $1 AND workspace_id = $2
+`
+
+type GetBrandKitForWorkspaceParams struct {
+	ID          pgtype.UUID `json:"id"`
+	WorkspaceID pgtype.UUID `json:"workspace_id"`
+}
+
+func (q *Queries) GetBrandKitForWorkspace(ctx context.Context, arg GetBrandKitForWorkspaceParams) (BrandKit, error) {
+	row := q.db.QueryRow(ctx, getBrandKitForWorkspace, arg.ID, arg.WorkspaceID)
+	var i BrandKit
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ColorsJson,
+		&i.RulesText,
+		&i.LogoUrl,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WorkspaceID,
 	)
 	return i, err
 }
 
-const listBrandKits = `-- name: ListBrandKits :many
-SELECT id, name, colors_json, rules_text, logo_url, created_at, updated_at FROM brand_kits
+const listBrandKitsForWorkspace = `-- name: ListBrandKitsForWorkspace :many
+SELECT id, name, colors_json, rules_text, logo_url, created_at, updated_at, workspace_id FROM brand_kits
+WHERE workspace_id = $1
 ORDER BY created_at DESC
 `
 
-func (q *Queries) ListBrandKits(ctx context.Context) ([]BrandKit, error) {
-	rows, err := q.db.Query(ctx, listBrandKits)
+func (q *Queries) ListBrandKitsForWorkspace(ctx context.Context, workspaceID pgtype.UUID) ([]BrandKit, error) {
+	rows, err := q.db.Query(ctx, listBrandKitsForWorkspace, workspaceID)
 	if err != nil {
 		return nil, err
 	}
@@ -92,6 +155,7 @@ func (q *Queries) ListBrandKits(ctx context.Context) ([]BrandKit, error) {
 			&i.LogoUrl,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.WorkspaceID,
 		); err != nil {
 			return nil, err
 		}
@@ -102,3 +166,42 @@ func (q *Queries) ListBrandKits(ctx context.Context) ([]BrandKit, error) {
 	}
 	return items, nil
 }
+
+const updateBrandKit = `-- name: UpdateBrandKit :one
+UPDATE brand_kits
+SET name = $2, colors_json = $3, rules_text = $4, logo_url = $5, updated_at = NOW()
+WHERE id = $1 AND updated_at = $6
+RETURNING id, name, colors_json, rules_text, logo_url, created_at, updated_at, workspace_id
+`
+
+type UpdateBrandKitParams struct {
+	ID         pgtype.UUID        `json:"id"`
+	Name       string             `json:"name"`
+	ColorsJson []byte             `json:"colors_json"`
+	RulesText  pgtype.Text        `json:"rules_text"`
+	LogoUrl    pgtype.Text        `json:"logo_url"`
+	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
+}
+
+func (q *Queries) UpdateBrandKit(ctx context.Context, arg UpdateBrandKitParams) (BrandKit, error) {
+	row := q.db.QueryRow(ctx, updateBrandKit,
+		arg.ID,
+		arg.Name,
+		arg.ColorsJson,
+		arg.RulesText,
+		arg.LogoUrl,
+		arg.UpdatedAt,
+	)
+	var i BrandKit
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.ColorsJson,
+		&i.RulesText,
+		&i.LogoUrl,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.WorkspaceID,
+	)
+	return i, err
+}
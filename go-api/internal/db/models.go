@@ -8,20 +8,223 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ActivePromptTemplate struct {
+	WorkspaceID pgtype.UUID        `json:"workspace_id"`
+	Name        string             `json:"name"`
+	Version     int32              `json:"version"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+}
+
+type ApiKey struct {
+	ID                   pgtype.UUID        `json:"id"`
+	UserID               pgtype.UUID        `json:"user_id"`
+	WorkspaceID          pgtype.UUID        `json:"workspace_id"`
+	Name                 string             `json:"name"`
+	Prefix               string             `json:"prefix"`
+	KeyHash              string             `json:"key_hash"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt           pgtype.Timestamptz `json:"last_used_at"`
+	RevokedAt            pgtype.Timestamptz `json:"revoked_at"`
+	GenerationRateLimit  pgtype.Int4        `json:"generation_rate_limit"`
+	GenerationDailyQuota pgtype.Int4        `json:"generation_daily_quota"`
+}
+
+type AuditEvent struct {
+	ID          pgtype.UUID        `json:"id"`
+	WorkspaceID pgtype.UUID        `json:"workspace_id"`
+	ActorUserID pgtype.UUID        `json:"actor_user_id"`
+	ActorEmail  string             `json:"actor_email"`
+	ApiKeyID    pgtype.UUID        `json:"api_key_id"`
+	Action      string             `json:"action"`
+	TargetType  string             `json:"target_type"`
+	TargetID    pgtype.UUID        `json:"target_id"`
+	RequestID   string             `json:"request_id"`
+	BeforeJson  []byte             `json:"before_json"`
+	AfterJson   []byte             `json:"after_json"`
+	ChangesJson []byte             `json:"changes_json"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
 type BrandKit struct {
-	ID         pgtype.UUID        `json:"id"`
+	ID          pgtype.UUID        `json:"id"`
+	Name        string             `json:"name"`
+	ColorsJson  []byte             `json:"colors_json"`
+	RulesText   pgtype.Text        `json:"rules_text"`
+	LogoUrl     pgtype.Text        `json:"logo_url"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+	WorkspaceID pgtype.UUID        `json:"workspace_id"`
+}
+
+type BrandKitPromptPin struct {
+	BrandKitID pgtype.UUID        `json:"brand_kit_id"`
 	Name       string             `json:"name"`
-	ColorsJson []byte             `json:"colors_json"`
-	RulesText  pgtype.Text        `json:"rules_text"`
-	LogoUrl    pgtype.Text        `json:"logo_url"`
+	Version    int32              `json:"version"`
 	CreatedAt  pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
+}
+
+type Design struct {
+	ID             pgtype.UUID        `json:"id"`
+	BrandKitID     pgtype.UUID        `json:"brand_kit_id"`
+	Name           string             `json:"name"`
+	CurrentVersion int32              `json:"current_version"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt      pgtype.Timestamptz `json:"updated_at"`
+	Status         string             `json:"status"`
+}
+
+type DesignReview struct {
+	ID           pgtype.UUID        `json:"id"`
+	DesignID     pgtype.UUID        `json:"design_id"`
+	Version      int32              `json:"version"`
+	Action       string             `json:"action"`
+	FromStatus   string             `json:"from_status"`
+	ToStatus     string             `json:"to_status"`
+	ActorUserID  pgtype.UUID        `json:"actor_user_id"`
+	ActorEmail   string             `json:"actor_email"`
+	ApprovalRole pgtype.Text        `json:"approval_role"`
+	Reason       pgtype.Text        `json:"reason"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+}
+
+type DesignVersion struct {
+	ID              pgtype.UUID        `json:"id"`
+	DesignID        pgtype.UUID        `json:"design_id"`
+	Version         int32              `json:"version"`
+	LayoutJson      []byte             `json:"layout_json"`
+	Author          string             `json:"author"`
+	Source          string             `json:"source"`
+	Note            pgtype.Text        `json:"note"`
+	GenerationJobID pgtype.UUID        `json:"generation_job_id"`
+	RestoredFrom    pgtype.Int4        `json:"restored_from"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	PromptName      pgtype.Text        `json:"prompt_name"`
+	PromptVersion   pgtype.Int4        `json:"prompt_version"`
+}
+
+type GenerationJob struct {
+	ID              pgtype.UUID        `json:"id"`
+	BrandKitID      pgtype.UUID        `json:"brand_kit_id"`
+	Status          string             `json:"status"`
+	Progress        int32              `json:"progress"`
+	Stage           string             `json:"stage"`
+	RequestJson     []byte             `json:"request_json"`
+	ResultJson      []byte             `json:"result_json"`
+	Error           pgtype.Text        `json:"error"`
+	Attempts        int32              `json:"attempts"`
+	CancelRequested bool               `json:"cancel_requested"`
+	CreatedAt       pgtype.Timestamptz `json:"created_at"`
+	StartedAt       pgtype.Timestamptz `json:"started_at"`
+	FinishedAt      pgtype.Timestamptz `json:"finished_at"`
+	UpdatedAt       pgtype.Timestamptz `json:"updated_at"`
+	ErrorDetails    []byte             `json:"error_details"`
+}
+
+type LayoutFormat struct {
+	ID             pgtype.UUID        `json:"id"`
+	WorkspaceID    pgtype.UUID        `json:"workspace_id"`
+	Key            string             `json:"key"`
+	Name           string             `json:"name"`
+	Width          int32              `json:"width"`
+	Height         int32              `json:"height"`
+	SafeZoneTop    int32              `json:"safe_zone_top"`
+	SafeZoneBottom int32              `json:"safe_zone_bottom"`
+	MinFontSize    int32              `json:"min_font_size"`
+	Platform       string             `json:"platform"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+}
+
+type ModelCall struct {
+	ID                  pgtype.UUID        `json:"id"`
+	WorkspaceID         pgtype.UUID        `json:"workspace_id"`
+	BrandKitID          pgtype.UUID        `json:"brand_kit_id"`
+	GenerationJobID     pgtype.UUID        `json:"generation_job_id"`
+	Operation           string             `json:"operation"`
+	Provider            string             `json:"provider"`
+	Model               string             `json:"model"`
+	PromptTokens        int32              `json:"prompt_tokens"`
+	ResponseTokens      int32              `json:"response_tokens"`
+	LatencyMs           int32              `json:"latency_ms"`
+	Retries             int32              `json:"retries"`
+	Succeeded           bool               `json:"succeeded"`
+	Error               pgtype.Text        `json:"error"`
+	EstimatedCostMicros int64              `json:"estimated_cost_micros"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
 }
 
 type ProductImage struct {
-	ID         pgtype.UUID        `json:"id"`
-	BrandKitID pgtype.UUID        `json:"brand_kit_id"`
-	ImageUrl   string             `json:"image_url"`
-	ImageName  pgtype.Text        `json:"image_name"`
-	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	ID                       pgtype.UUID        `json:"id"`
+	BrandKitID               pgtype.UUID        `json:"brand_kit_id"`
+	ImageUrl                 string             `json:"image_url"`
+	ImageName                pgtype.Text        `json:"image_name"`
+	CreatedAt                pgtype.Timestamptz `json:"created_at"`
+	Description              pgtype.Text        `json:"description"`
+	DescriptionModel         pgtype.Text        `json:"description_model"`
+	DescriptionPromptVersion pgtype.Text        `json:"description_prompt_version"`
+	DescribedAt              pgtype.Timestamptz `json:"described_at"`
+	Role                     string             `json:"role"`
+	Position                 int32              `json:"position"`
+}
+
+type PromptTemplate struct {
+	ID          pgtype.UUID        `json:"id"`
+	WorkspaceID pgtype.UUID        `json:"workspace_id"`
+	Name        string             `json:"name"`
+	Version     int32              `json:"version"`
+	Body        string             `json:"body"`
+	Hash        string             `json:"hash"`
+	Note        pgtype.Text        `json:"note"`
+	Author      string             `json:"author"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+type SessionToken struct {
+	ID        pgtype.UUID        `json:"id"`
+	ApiKeyID  pgtype.UUID        `json:"api_key_id"`
+	TokenHash string             `json:"token_hash"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type StaticAsset struct {
+	ID          pgtype.UUID        `json:"id"`
+	WorkspaceID pgtype.UUID        `json:"workspace_id"`
+	Key         string             `json:"key"`
+	Url         string             `json:"url"`
+	Width       pgtype.Int4        `json:"width"`
+	Height      pgtype.Int4        `json:"height"`
+	Formats     []string           `json:"formats"`
+	Retailer    string             `json:"retailer"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+}
+
+type UsageCounter struct {
+	Scope       string             `json:"scope"`
+	ScopeID     pgtype.UUID        `json:"scope_id"`
+	Period      string             `json:"period"`
+	WindowStart pgtype.Timestamptz `json:"window_start"`
+	Count       int32              `json:"count"`
+}
+
+type User struct {
+	ID        pgtype.UUID        `json:"id"`
+	Email     string             `json:"email"`
+	Name      string             `json:"name"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+type Workspace struct {
+	ID                   pgtype.UUID        `json:"id"`
+	Name                 string             `json:"name"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	GenerationRateLimit  pgtype.Int4        `json:"generation_rate_limit"`
+	GenerationDailyQuota pgtype.Int4        `json:"generation_daily_quota"`
+}
+
+type WorkspaceMember struct {
+	WorkspaceID   pgtype.UUID        `json:"workspace_id"`
+	UserID        pgtype.UUID        `json:"user_id"`
+	Role          string             `json:"role"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	ApprovalRoles []string           `json:"approval_roles"`
 }
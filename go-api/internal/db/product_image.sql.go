@@ -11,25 +11,51 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const clearHeroProductImage = `-- name: ClearHeroProductImage :exec
+UPDATE product_images
+SET role = 'secondary'
+WHERE brand_kit_id = $1 AND role = 'hero' AND id <> $2
+`
+
+type ClearHeroProductImageParams struct {
+	BrandKitID pgtype.UUID `json:"brand_kit_id"`
+	ID         pgtype.UUID `json:"id"`
+}
+
+func (q *Queries) ClearHeroProductImage(ctx context.Context, arg ClearHeroProductImageParams) error {
+	_, err := q.db.Exec(ctx, clearHeroProductImage, arg.BrandKitID, arg.ID)
+	return err
+}
+
 const createProductImage = `-- name: CreateProductImage :one
 INSERT INTO product_images (
   brand_kit_id,
   image_url,
-  image_name
+  image_name,
+  role,
+  position
 ) VALUES (
-  $1, $2, $3
+  $1, $2, $3, $4, $5
 )
-RETURNING id, brand_kit_id, image_url, image_name, created_at
+RETURNING id, brand_kit_id, image_url, image_name, created_at, description, description_model, description_prompt_version, described_at, role, position
 `
 
 type CreateProductImageParams struct {
 	BrandKitID pgtype.UUID `json:"brand_kit_id"`
 	ImageUrl   string      `json:"image_url"`
 	ImageName  pgtype.Text `json:"image_name"`
+	Role       string      `json:"role"`
+	Position   int32       `json:"position"`
 }
 
 func (q *Queries) CreateProductImage(ctx context.Context, arg CreateProductImageParams) (ProductImage, error) {
-	row := q.db.QueryRow(ctx, createProductImage, arg.BrandKitID, arg.ImageUrl, arg.ImageName)
+	row := q.db.QueryRow(ctx, createProductImage,
+		arg.BrandKitID,
+		arg.ImageUrl,
+		arg.ImageName,
+		arg.Role,
+		arg.Position,
+	)
 	var i ProductImage
 	err := row.Scan(
 		&i.ID,
@@ -37,14 +63,81 @@ func (q *Queries) CreateProductImage(ctx context.Context, arg CreateProductImage
 		&i.ImageUrl,
 		&i.ImageName,
 		&i.CreatedAt,
+		&i.Description,
+		&i.DescriptionModel,
+		&i.DescriptionPromptVersion,
+		&i.DescribedAt,
+		&i.Role,
+		&i.Position,
+	)
+	return i, err
+}
+
+const deleteProductImage = `-- name: DeleteProductImage :execrows
+DELETE FROM product_images
+WHERE id = $1 AND brand_kit_id = $2
+`
+
+type DeleteProductImageParams struct {
+	ID         pgtype.UUID `json:"id"`
+	BrandKitID pgtype.UUID `json:"brand_kit_id"`
+}
+
+func (q *Queries) DeleteProductImage(ctx context.Context, arg DeleteProductImageParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteProductImage, arg.ID, arg.BrandKitID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const ensureHeroProductImage = `-- name: EnsureHeroProductImage :exec
+UPDATE product_images
+SET role = 'hero'
+WHERE id = (
+  SELECT id FROM product_images
+  WHERE brand_kit_id = $1
+  ORDER BY position, created_at
+  LIMIT 1
+) AND NOT EXISTS (
+  SELECT 1 FROM product_images
+  WHERE brand_kit_id = $1 AND role = 'hero'
+)
+`
+
+func (q *Queries) EnsureHeroProductImage(ctx context.Context, brandKitID pgtype.UUID) error {
+	_, err := q.db.Exec(ctx, ensureHeroProductImage, brandKitID)
+	return err
+}
+
+const getProductImage = `-- name: GetProductImage :one
+SELECT id, brand_kit_id, image_url, image_name, created_at, description, description_model, description_prompt_version, described_at, role, position FROM product_images
+WHERE id = $1
+`
+
+func (q *Queries) GetProductImage(ctx context.Context, id pgtype.UUID) (ProductImage, error) {
+	row := q.db.QueryRow(ctx, getProductImage, id)
+	var i ProductImage
+	err := row.Scan(
+		&i.ID,
+		&i.BrandKitID,
+		&i.ImageUrl,
+		&i.ImageName,
+		&i.CreatedAt,
+		&i.Description,
+		&i.DescriptionModel,
+		&i.DescriptionPromptVersion,
+		&i.DescribedAt,
+		&i.Role,
+		&i.Position,
 	)
 	return i, err
 }
 
 const listProductImagesForBrandKit = `-- name: ListProductImagesForBrandKit :many
-SELECT id, brand_kit_id, image_url, image_name, created_at FROM product_images
+SELECT id, brand_kit_id, image_url, image_name, created_at, description, description_model, description_prompt_version, described_at, role, position FROM product_images
 WHERE brand_kit_id = $1
-ORDER BY created_at
+ORDER BY position, created_at
 `
 
 func (q *Queries) ListProductImagesForBrandKit(ctx context.Context, brandKitID pgtype.UUID) ([]ProductImage, error) {
@@ -62,6 +155,12 @@ func (q *Queries) ListProductImagesForBrandKit(ctx context.Context, brandKitID p
 			&i.ImageUrl,
 			&i.ImageName,
 			&i.CreatedAt,
+			&i.Description,
+			&i.DescriptionModel,
+			&i.DescriptionPromptVersion,
+			&i.DescribedAt,
+			&i.Role,
+			&i.Position,
 		); err != nil {
 			return nil, err
 		}
@@ -72,3 +171,94 @@ func (q *Queries) ListProductImagesForBrandKit(ctx context.Context, brandKitID p
 	}
 	return items, nil
 }
+
+const nextProductImagePosition = `-- name: NextProductImagePosition :one
+SELECT COALESCE(MAX(position) + 1, 0)::integer AS next_position
+FROM product_images
+WHERE brand_kit_id = $1
+`
+
+func (q *Queries) NextProductImagePosition(ctx context.Context, brandKitID pgtype.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, nextProductImagePosition, brandKitID)
+	var next_position int32
+	err := row.Scan(&next_position)
+	return next_position, err
+}
+
+const updateProductImage = `-- name: UpdateProductImage :one
+UPDATE product_images
+SET image_name = $3, role = $4, position = $5
+WHERE id = $1 AND brand_kit_id = $2
+RETURNING id, brand_kit_id, image_url, image_name, created_at, description, description_model, description_prompt_version, described_at, role, position
+`
+
+type UpdateProductImageParams struct {
+	ID         pgtype.UUID `json:"id"`
+	BrandKitID pgtype.UUID `json:"brand_kit_id"`
+	ImageName  pgtype.Text `json:"image_name"`
+	Role       string      `json:"role"`
+	Position   int32       `json:"position"`
+}
+
+func (q *Queries) UpdateProductImage(ctx context.Context, arg UpdateProductImageParams) (ProductImage, error) {
+	row := q.db.QueryRow(ctx, updateProductImage,
+		arg.ID,
+		arg.BrandKitID,
+		arg.ImageName,
+		arg.Role,
+		arg.Position,
+	)
+	var i ProductImage
+	err := row.Scan(
+		&i.ID,
+		&i.BrandKitID,
+		&i.ImageUrl,
+		&i.ImageName,
+		&i.CreatedAt,
+		&i.Description,
+		&i.DescriptionModel,
+		&i.DescriptionPromptVersion,
+		&i.DescribedAt,
+		&i.Role,
+		&i.Position,
+	)
+	return i, err
+}
+
+const updateProductImageDescription = `-- name: UpdateProductImageDescription :one
+UPDATE product_images
+SET description = $2, description_model = $3, description_prompt_version = $4, described_at = NOW()
+WHERE id = $1
+RETURNING id, brand_kit_id, image_url, image_name, created_at, description, description_model, description_prompt_version, described_at, role, position
+`
+
+type UpdateProductImageDescriptionParams struct {
+	ID                       pgtype.UUID `json:"id"`
+	Description              pgtype.Text `json:"description"`
+	DescriptionModel         pgtype.Text `json:"description_model"`
+	DescriptionPromptVersion pgtype.Text `json:"description_prompt_version"`
+}
+
+func (q *Queries) UpdateProductImageDescription(ctx context.Context, arg UpdateProductImageDescriptionParams) (ProductImage, error) {
+	row := q.db.QueryRow(ctx, updateProductImageDescription,
+		arg.ID,
+		arg.Description,
+		arg.DescriptionModel,
+		arg.DescriptionPromptVersion,
+	)
+	var i ProductImage
+	err := row.Scan(
+		&i.ID,
+		&i.BrandKitID,
+		&i.ImageUrl,
+		&i.ImageName,
+		&i.CreatedAt,
+		&i.Description,
+		&i.DescriptionModel,
+		&i.DescriptionPromptVersion,
+		&i.DescribedAt,
+		&i.Role,
+		&i.Position,
+	)
+	return i, err
+}
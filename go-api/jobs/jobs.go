@@ -0,0 +1,374 @@
+// Package jobs runs layout generations in the background. Jobs are rows in
+// generation_jobs; any number of API instances can share the table because
+// workers claim rows with SKIP LOCKED.
+package jobs
+
+import (
+	"canvas-backend/internal/db"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	STATUS_QUEUED    = "queued"
+	STATUS_RUNNING   = "running"
+	STATUS_SUCCEEDED = "succeeded"
+	STATUS_FAILED    = "failed"
+	STATUS_CANCELLED = "cancelled"
+)
+
+const (
+	DEFAULT_WORKERS = 4
+	POLL_INTERVAL   = 2 * time.Second
+	JOB_TIMEOUT     = 10 * time.Minute
+	// Running jobs touch updated_at at least this often.
+	HEARTBEAT_INTERVAL = 30 * time.Second
+	// Running jobs without a heartbeat for this long belonged to an instance
+	// that died and are put back in the queue.
+	STALE_AFTER  = 5 * time.Minute
+	MAX_ATTEMPTS = 3
+)
+
+// Progress reports how far a job has got, in percent, and what it is doing.
+type Progress func(percent int, stage string)
+
+// Handler does the work for one job and returns its JSON-encodable result.
+type Handler func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error)
+
+// DetailedError is a handler error that carries structured details, such as
+// the schema problems of a layout, which are stored with the failed job.
+type DetailedError interface {
+	error
+	Details() any
+}
+
+type Pool struct {
+	Queries *db.Queries
+	Workers int
+	handler Handler
+
+	wake    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[[16]byte]*runningJob
+}
+
+type runningJob struct {
+	cancel    context.CancelFunc
+	mu        sync.Mutex
+	cancelled bool
+	progress  int
+	stage     string
+}
+
+func NewPool(queries *db.Queries, workers int, handler Handler) *Pool {
+	if workers <= 0 {
+		workers = DEFAULT_WORKERS
+	}
+	return &Pool{
+		Queries: queries,
+		Workers: workers,
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		running: map[[16]byte]*runningJob{},
+	}
+}
+
+// Start launches the workers. They stop once ctx is cancelled, putting
+// interrupted jobs back in the queue; Wait blocks until they have.
+func (p *Pool) Start(ctx context.Context) {
+	p.requeueStale(ctx)
+
+	for i := 0; i < p.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(ctx)
+		}()
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		ticker := time.NewTicker(STALE_AFTER / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.requeueStale(ctx)
+			}
+		}
+	}()
+}
+
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Enqueue stores a new job for the brand kit and wakes a worker.
+func (p *Pool) Enqueue(ctx context.Context, brand_kit_id pgtype.UUID, request any) (db.GenerationJob, error) {
+	job, err := p.EnqueueWith(ctx, p.Queries, brand_kit_id, request)
+	if err != nil {
+		return db.GenerationJob{}, err
+	}
+	p.Wake()
+	return job, nil
+}
+
+// EnqueueWith stores a new job through queries, which may be bound to a
+// transaction. Call Wake once the transaction has committed.
+func (p *Pool) EnqueueWith(ctx context.Context, queries *db.Queries, brand_kit_id pgtype.UUID, request any) (db.GenerationJob, error) {
+	request_json, err := json.Marshal(request)
+	if err != nil {
+		return db.GenerationJob{}, err
+	}
+
+	return queries.CreateGenerationJob(ctx, db.CreateGenerationJobParams{
+		BrandKitID:  brand_kit_id,
+		RequestJson: request_json,
+	})
+}
+
+// Wake tells an idle worker to look for queued jobs now.
+func (p *Pool) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Cancel stops a queued or running job. Queued jobs are cancelled at once;
+// running jobs stop at their next checkpoint, or immediately when this
+// instance is the one running them. pgx.ErrNoRows means the job does not
+// exist or has already finished.
+func (p *Pool) Cancel(ctx context.Context, id pgtype.UUID) (db.GenerationJob, error) {
+	job, err := p.CancelWith(ctx, p.Queries, id)
+	if err != nil {
+		return db.GenerationJob{}, err
+	}
+	p.Interrupt(id)
+	return job, nil
+}
+
+// CancelWith marks a job cancelled through queries, which may be bound to a
+// transaction. Call Interrupt once the transaction has committed.
+func (p *Pool) CancelWith(ctx context.Context, queries *db.Queries, id pgtype.UUID) (db.GenerationJob, error) {
+	return queries.CancelGenerationJob(ctx, id)
+}
+
+// Interrupt stops the job if this instance is running it.
+func (p *Pool) Interrupt(id pgtype.UUID) {
+	p.mu.Lock()
+	rj := p.running[id.Bytes]
+	p.mu.Unlock()
+	if rj != nil {
+		rj.stop()
+	}
+}
+
+func (p *Pool) work(ctx context.Context) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		job, err := p.Queries.ClaimGenerationJob(ctx)
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) && ctx.Err() == nil {
+				log.Printf("ERROR: Unable to claim a generation job, error: %v\n", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.wake:
+			case <-time.After(POLL_INTERVAL):
+			}
+			continue
+		}
+
+		p.run(ctx, job)
+	}
+}
+
+func (p *Pool) run(ctx context.Context, job db.GenerationJob) {
+	// Final status writes must land even while shutting down.
+	finish_ctx := context.WithoutCancel(ctx)
+
+	if job.Attempts > MAX_ATTEMPTS {
+		p.fail(finish_ctx, job, fmt.Sprintf("gave up after %d attempts", MAX_ATTEMPTS))
+		return
+	}
+
+	job_ctx, cancel := context.WithTimeout(ctx, JOB_TIMEOUT)
+	defer cancel()
+
+	rj := &runningJob{cancel: cancel}
+	p.mu.Lock()
+	p.running[job.ID.Bytes] = rj
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, job.ID.Bytes)
+		p.mu.Unlock()
+	}()
+
+	if job.CancelRequested {
+		rj.stop()
+	}
+
+	heartbeat_done := make(chan struct{})
+	defer close(heartbeat_done)
+	go func() {
+		ticker := time.NewTicker(HEARTBEAT_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeat_done:
+				return
+			case <-ticker.C:
+				percent, stage := rj.current()
+				p.report(job_ctx, job, rj, percent, stage)
+			}
+		}
+	}()
+
+	progress := func(percent int, stage string) {
+		rj.set(percent, stage)
+		p.report(job_ctx, job, rj, percent, stage)
+	}
+
+	log.Printf("INFO: Running generation job %s (attempt %d)\n", uuidString(job.ID), job.Attempts)
+	result, err := p.handler(job_ctx, job, progress)
+
+	switch {
+	case rj.wasCancelled():
+		if err := p.Queries.MarkGenerationJobCancelled(finish_ctx, job.ID); err != nil {
+			log.Printf("ERROR: Unable to mark generation job %s cancelled, error: %v\n", uuidString(job.ID), err)
+		}
+		log.Printf("INFO: Generation job %s was cancelled\n", uuidString(job.ID))
+	case err == nil:
+		result_json, err := json.Marshal(result)
+		if err != nil {
+			p.fail(finish_ctx, job, fmt.Sprintf("unable to encode the result: %v", err))
+			return
+		}
+		if err := p.Queries.CompleteGenerationJob(finish_ctx, db.CompleteGenerationJobParams{ID: job.ID, ResultJson: result_json}); err != nil {
+			log.Printf("ERROR: Unable to store the result of generation job %s, error: %v\n", uuidString(job.ID), err)
+			return
+		}
+		log.Printf("SUCCESS: Generation job %s succeeded\n", uuidString(job.ID))
+	case ctx.Err() != nil:
+		// The pool is shutting down; another worker picks the job up later.
+		if err := p.Queries.RequeueGenerationJob(finish_ctx, job.ID); err != nil {
+			log.Printf("ERROR: Unable to requeue generation job %s, error: %v\n", uuidString(job.ID), err)
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		p.fail(finish_ctx, job, fmt.Sprintf("timed out after %s", JOB_TIMEOUT))
+	default:
+		var detailed DetailedError
+		if errors.As(err, &detailed) {
+			p.failWithDetails(finish_ctx, job, err.Error(), detailed.Details())
+			return
+		}
+		p.fail(finish_ctx, job, err.Error())
+	}
+}
+
+// report writes progress, which doubles as the heartbeat, and picks up
+// cancellations requested through other instances.
+func (p *Pool) report(ctx context.Context, job db.GenerationJob, rj *runningJob, percent int, stage string) {
+	cancel_requested, err := p.Queries.UpdateGenerationJobProgress(ctx, db.UpdateGenerationJobProgressParams{
+		ID:       job.ID,
+		Progress: int32(percent),
+		Stage:    stage,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("WARN: Unable to update progress of generation job %s, error: %v\n", uuidString(job.ID), err)
+		}
+		return
+	}
+	if cancel_requested {
+		rj.stop()
+	}
+}
+
+func (p *Pool) fail(ctx context.Context, job db.GenerationJob, message string) {
+	p.failWithDetails(ctx, job, message, nil)
+}
+
+// failWithDetails stores details, when there are any, as JSON next to the
+// message.
+func (p *Pool) failWithDetails(ctx context.Context, job db.GenerationJob, message string, details any) {
+	log.Printf("ERROR: Generation job %s failed, error: %s\n", uuidString(job.ID), message)
+	var details_json []byte
+	if details != nil {
+		var err error
+		if details_json, err = json.Marshal(details); err != nil {
+			log.Printf("WARN: Unable to encode the error details of generation job %s, error: %v\n", uuidString(job.ID), err)
+		}
+	}
+	err := p.Queries.FailGenerationJob(ctx, db.FailGenerationJobParams{
+		ID:           job.ID,
+		Error:        pgtype.Text{String: message, Valid: true},
+		ErrorDetails: details_json,
+	})
+	if err != nil {
+		log.Printf("ERROR: Unable to mark generation job %s failed, error: %v\n", uuidString(job.ID), err)
+	}
+}
+
+func (p *Pool) requeueStale(ctx context.Context) {
+	cutoff := pgtype.Timestamptz{Time: time.Now().Add(-STALE_AFTER), Valid: true}
+	n, err := p.Queries.RequeueStaleGenerationJobs(ctx, cutoff)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("ERROR: Unable to requeue stale generation jobs, error: %v\n", err)
+		}
+		return
+	}
+	if n > 0 {
+		log.Printf("WARN: Requeued %d stale generation jobs\n", n)
+	}
+}
+
+func (rj *runningJob) stop() {
+	rj.mu.Lock()
+	rj.cancelled = true
+	rj.mu.Unlock()
+	rj.cancel()
+}
+
+func (rj *runningJob) wasCancelled() bool {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	return rj.cancelled
+}
+
+func (rj *runningJob) set(percent int, stage string) {
+	rj.mu.Lock()
+	rj.progress, rj.stage = percent, stage
+	rj.mu.Unlock()
+}
+
+func (rj *runningJob) current() (int, string) {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	return rj.progress, rj.stage
+}
+
+func uuidString(id pgtype.UUID) string {
+	value, _ := id.Value()
+	s, _ := value.(string)
+	return s
+}
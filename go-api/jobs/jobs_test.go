@@ -0,0 +1,375 @@
+package jobs
+
+import (
+	"canvas-backend/internal/db"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeDB is an in-memory generation_jobs table that answers the queries
+// the pool makes the way their SQL does.
+type fakeDB struct {
+	mu   sync.Mutex
+	jobs []*db.GenerationJob
+	// cancel_after sets cancel_requested once a job has reported progress
+	// this many times, as if another instance had cancelled it.
+	cancel_after int
+	reports      int
+}
+
+func (f *fakeDB) add(job db.GenerationJob) *db.GenerationJob {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	job.ID = pgtype.UUID{Bytes: [16]byte{byte(len(f.jobs) + 1)}, Valid: true}
+	if job.Status == "" {
+		job.Status = STATUS_QUEUED
+	}
+	if !job.UpdatedAt.Valid {
+		job.UpdatedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+	}
+	f.jobs = append(f.jobs, &job)
+	return &job
+}
+
+func (f *fakeDB) get(id pgtype.UUID) db.GenerationJob {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, job := range f.jobs {
+		if job.ID == id {
+			return *job
+		}
+	}
+	return db.GenerationJob{}
+}
+
+// running finds the running job with id, as the WHERE clauses do.
+func (f *fakeDB) running(id any) *db.GenerationJob {
+	for _, job := range f.jobs {
+		if job.ID == id.(pgtype.UUID) && job.Status == STATUS_RUNNING {
+			return job
+		}
+	}
+	return nil
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if strings.Contains(sql, "-- name: RequeueStaleGenerationJobs ") {
+		n := 0
+		for _, job := range f.jobs {
+			if job.Status == STATUS_RUNNING && job.UpdatedAt.Time.Before(args[0].(pgtype.Timestamptz).Time) {
+				job.Status = STATUS_QUEUED
+				if job.CancelRequested {
+					job.Status = STATUS_CANCELLED
+				}
+				job.Progress, job.Stage = 0, ""
+				n++
+			}
+		}
+		return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", n)), nil
+	}
+
+	job := f.running(args[0])
+	if job == nil {
+		return pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+	switch {
+	case strings.Contains(sql, "-- name: CompleteGenerationJob "):
+		job.Status, job.Progress, job.Stage, job.ResultJson = STATUS_SUCCEEDED, 100, "done", args[1].([]byte)
+	case strings.Contains(sql, "-- name: FailGenerationJob "):
+		job.Status, job.Error, job.ErrorDetails = STATUS_FAILED, args[1].(pgtype.Text), args[2].([]byte)
+	case strings.Contains(sql, "-- name: MarkGenerationJobCancelled "):
+		job.Status = STATUS_CANCELLED
+	case strings.Contains(sql, "-- name: RequeueGenerationJob "):
+		job.Status, job.Progress, job.Stage = STATUS_QUEUED, 0, ""
+	default:
+		return pgconn.CommandTag{}, errors.New("unexpected exec")
+	}
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case strings.Contains(sql, "-- name: ClaimGenerationJob "):
+		for _, job := range f.jobs {
+			if job.Status == STATUS_QUEUED {
+				job.Status = STATUS_RUNNING
+				job.Attempts++
+				job.UpdatedAt = pgtype.Timestamptz{Time: time.Now(), Valid: true}
+				return jobRow{job: *job}
+			}
+		}
+	case strings.Contains(sql, "-- name: UpdateGenerationJobProgress "):
+		if job := f.running(args[0]); job != nil {
+			job.Progress, job.Stage = args[1].(int32), args[2].(string)
+			f.reports++
+			if f.cancel_after > 0 && f.reports >= f.cancel_after {
+				job.CancelRequested = true
+			}
+			return boolRow(job.CancelRequested)
+		}
+	}
+	return jobRow{err: pgx.ErrNoRows}
+}
+
+type jobRow struct {
+	job db.GenerationJob
+	err error
+}
+
+func (r jobRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	j := r.job
+	for i, value := range []any{j.ID, j.BrandKitID, j.Status, j.Progress, j.Stage, j.RequestJson, j.ResultJson, j.Error, j.Attempts, j.CancelRequested, j.CreatedAt, j.StartedAt, j.FinishedAt, j.UpdatedAt, j.ErrorDetails} {
+		switch d := dest[i].(type) {
+		case *pgtype.UUID:
+			*d = value.(pgtype.UUID)
+		case *string:
+			*d = value.(string)
+		case *int32:
+			*d = value.(int32)
+		case *[]byte:
+			*d = value.([]byte)
+		case *pgtype.Text:
+			*d = value.(pgtype.Text)
+		case *bool:
+			*d = value.(bool)
+		case *pgtype.Timestamptz:
+			*d = value.(pgtype.Timestamptz)
+		}
+	}
+	return nil
+}
+
+type boolRow bool
+
+func (r boolRow) Scan(dest ...any) error {
+	*dest[0].(*bool) = bool(r)
+	return nil
+}
+
+type detailedError struct{}
+
+func (detailedError) Error() string { return "invalid layout" }
+func (detailedError) Details() any  { return []string{"instagram_post.width"} }
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name             string
+		attempts         int32
+		cancel_requested bool
+		cancel_after     int
+		handler          Handler
+		status           string
+		error            string
+		details          string
+		result           string
+	}{
+		{
+			name: "success stores the result",
+			handler: func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+				progress(50, "generating")
+				return map[string]string{"layout": "ok"}, nil
+			},
+			status: STATUS_SUCCEEDED,
+			result: `{"layout":"ok"}`,
+		},
+		{
+			name: "errors fail the job",
+			handler: func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+				return nil, errors.New("model unavailable")
+			},
+			status: STATUS_FAILED,
+			error:  "model unavailable",
+		},
+		{
+			name: "detailed errors keep their details",
+			handler: func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+				return nil, detailedError{}
+			},
+			status:  STATUS_FAILED,
+			error:   "invalid layout",
+			details: `["instagram_post.width"]`,
+		},
+		{
+			name:     "gives up after too many attempts",
+			attempts: MAX_ATTEMPTS + 1,
+			status:   STATUS_FAILED,
+			error:    fmt.Sprintf("gave up after %d attempts", MAX_ATTEMPTS),
+		},
+		{
+			name:             "a cancellation requested while queued stops the job",
+			cancel_requested: true,
+			handler: func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			status: STATUS_CANCELLED,
+		},
+		{
+			name:         "a cancellation seen in a progress report stops the job",
+			cancel_after: 1,
+			handler: func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+				progress(10, "loading brand kit")
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			status: STATUS_CANCELLED,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeDB{cancel_after: tt.cancel_after}
+			handler := tt.handler
+			if handler == nil {
+				handler = func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+					t.Error("the handler ran")
+					return nil, nil
+				}
+			}
+			pool := NewPool(db.New(fake), 1, handler)
+			fake.add(db.GenerationJob{Attempts: tt.attempts - 1, CancelRequested: tt.cancel_requested})
+
+			job, err := pool.Queries.ClaimGenerationJob(context.Background())
+			if err != nil {
+				t.Fatalf("ClaimGenerationJob(): %v", err)
+			}
+			pool.run(context.Background(), job)
+
+			got := fake.get(job.ID)
+			if got.Status != tt.status {
+				t.Errorf("status = %s, want %s", got.Status, tt.status)
+			}
+			if got.Error.String != tt.error {
+				t.Errorf("error = %q, want %q", got.Error.String, tt.error)
+			}
+			if string(got.ErrorDetails) != tt.details {
+				t.Errorf("error details = %s, want %s", got.ErrorDetails, tt.details)
+			}
+			if string(got.ResultJson) != tt.result {
+				t.Errorf("result = %s, want %s", got.ResultJson, tt.result)
+			}
+			if len(pool.running) != 0 {
+				t.Errorf("%d jobs are still registered as running", len(pool.running))
+			}
+		})
+	}
+}
+
+func TestPoolClaimsJobsInOrder(t *testing.T) {
+	fake := &fakeDB{}
+	var mu sync.Mutex
+	var order []byte
+	done := make(chan struct{})
+	pool := NewPool(db.New(fake), 1, func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, job.ID.Bytes[0])
+		if len(order) == 3 {
+			close(done)
+		}
+		return nil, nil
+	})
+	for range 3 {
+		fake.add(db.GenerationJob{})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.Start(ctx)
+	pool.Wake()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pool did not run every job")
+	}
+	cancel()
+	pool.Wait()
+
+	if string(order) != "\x01\x02\x03" {
+		t.Errorf("jobs ran in order %v, want [1 2 3]", order)
+	}
+	for _, job := range fake.jobs {
+		if job.Status != STATUS_SUCCEEDED || job.Attempts != 1 {
+			t.Errorf("job %d is %s after %d attempts, want succeeded after 1", job.ID.Bytes[0], job.Status, job.Attempts)
+		}
+	}
+}
+
+func TestPoolRequeuesJobsOnShutdown(t *testing.T) {
+	fake := &fakeDB{}
+	started := make(chan struct{})
+	pool := NewPool(db.New(fake), 1, func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+		progress(20, "describing images")
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	job := fake.add(db.GenerationJob{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.Start(ctx)
+	pool.Wake()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pool did not start the job")
+	}
+	cancel()
+	pool.Wait()
+
+	got := fake.get(job.ID)
+	if got.Status != STATUS_QUEUED || got.Progress != 0 || got.Stage != "" {
+		t.Errorf("job is %s at %d%% %q, want queued from the start", got.Status, got.Progress, got.Stage)
+	}
+	if got.Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", got.Attempts)
+	}
+}
+
+func TestStartRequeuesStaleJobs(t *testing.T) {
+	fake := &fakeDB{}
+	old := pgtype.Timestamptz{Time: time.Now().Add(-2 * STALE_AFTER), Valid: true}
+	stale := fake.add(db.GenerationJob{Status: STATUS_RUNNING, Attempts: 1, Progress: 40, UpdatedAt: old})
+	cancelled := fake.add(db.GenerationJob{Status: STATUS_RUNNING, Attempts: 1, CancelRequested: true, UpdatedAt: old})
+	alive := fake.add(db.GenerationJob{Status: STATUS_RUNNING, Attempts: 1, Progress: 40})
+
+	// The workers stop at once; only the requeue at start runs.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pool := NewPool(db.New(fake), 1, func(ctx context.Context, job db.GenerationJob, progress Progress) (any, error) {
+		t.Error("the handler ran")
+		return nil, nil
+	})
+	pool.Start(ctx)
+	pool.Wait()
+
+	for _, want := range []struct {
+		job    *db.GenerationJob
+		status string
+	}{{stale, STATUS_QUEUED}, {cancelled, STATUS_CANCELLED}, {alive, STATUS_RUNNING}} {
+		if got := fake.get(want.job.ID); got.Status != want.status {
+			t.Errorf("job %d is %s, want %s", want.job.ID.Bytes[0], got.Status, want.status)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package lep lays out Low Everyday Prices creatives. The LEP design is a
+// fixed grid, so positions are computed from the copy's measured size and
+// the images' aspect ratios rather than asked of a model.
+package lep
+
+import (
+	"canvas-backend/compliance"
+	"canvas-backend/textmetrics"
+	"canvas-backend/types"
+	"math"
+	"strings"
+)
+
+// ENGINE_NAME is recorded as the prompt of LEP results, at version 0 like
+// the other templates built into the server.
+const ENGINE_NAME = "lep_engine"
+
+const (
+	LEP_LOGO_KEY   = "ASSET_LEP_LOGO"
+	DRINKAWARE_KEY = "ASSET_DRINKAWARE"
+)
+
+const (
+	BACKGROUND_COLOR = "#ffffff"
+	HEADLINE_COLOR   = "#00539F"
+	SUBHEAD_COLOR    = "#000000"
+	HEADLINE_FONT    = "Oswald"
+	SUBHEAD_FONT     = "Roboto"
+)
+
+// Sizes on a 1080x1080 canvas. Other canvases scale them by the square root
+// of their area relative to it.
+const (
+	REFERENCE_SIZE   = 1080
+	LOGO_WIDTH       = 120
+	LEP_LOGO_WIDTH   = 160
+	DRINKAWARE_WIDTH = 150
+	HEADLINE_SIZE    = 72
+	SUBHEAD_SIZE     = 36
+)
+
+const (
+	MAX_HEADLINE_LINES = 2
+	MAX_SUBHEAD_LINES  = 3
+	// PRODUCT_FILL is how much of the space left for it the product takes.
+	PRODUCT_FILL = 0.9
+	// Canvases this much wider than tall put the product beside the copy
+	// instead of under it; this much taller keep the LEP logo for the
+	// bottom of the stack.
+	WIDE_RATIO = 1.4
+	TALL_RATIO = 1.4
+)
+
+// Size is an image's intrinsic size. Images of unknown size are treated as
+// square, as the compliance checks do.
+type Size struct {
+	Width  float64
+	Height float64
+}
+
+func (s Size) aspect() float64 {
+	if s.Width <= 0 || s.Height <= 0 {
+		return 1
+	}
+	return s.Width / s.Height
+}
+
+// Input is what a LEP creative is built from. Sizes are keyed by image URL,
+// or by asset key for the static assets.
+type Input struct {
+	Headline           string
+	Subhead            string
+	Logo               string
+	Product            string
+	IsAlcoholPromotion bool
+	Sizes              map[string]Size
+}
+
+// Generate lays out every format. Static assets are placed by key, to be
+// resolved like any generated layout.
+func Generate(formats []compliance.Format, in Input) types.Layout {
+	layout := types.Layout{}
+	for _, format := range formats {
+		platform, _ := compliance.LookupPlatform(format.Platform)
+		layout[format.ID] = LayoutFormat(format, platform, in)
+	}
+	return layout
+}
+
+// LayoutFormat lays out one format. The brand logo and LEP logo head the
+// canvas with the copy stacked beneath them, and the product fills what is
+// left above the footer: beside the copy on wide canvases, under it
+// otherwise. Tall canvases move the LEP logo into the footer, next to the
+// Drinkaware logo of alcohol promotions. Canvases too small for the grid
+// are laid out all the same, for the checks to report.
+func LayoutFormat(format compliance.Format, platform compliance.Platform, in Input) *types.FormatLayout {
+	e := engine{
+		in:       in,
+		scale:    math.Sqrt(format.Width*format.Height) / REFERENCE_SIZE,
+		min_font: math.Max(format.MinFont(platform), 1),
+		region: compliance.Box{
+			Left:   compliance.EDGE_MARGIN,
+			Top:    compliance.EDGE_MARGIN + format.SafeZoneTop,
+			Width:  format.Width - 2*compliance.EDGE_MARGIN,
+			Height: format.Height - 2*compliance.EDGE_MARGIN - format.SafeZoneTop - format.SafeZoneBottom,
+		},
+	}
+	wide := format.Width >= WIDE_RATIO*format.Height
+	tall := format.Height >= TALL_RATIO*format.Width
+	region := e.region
+
+	// Header row.
+	header_bottom := region.Top
+	if in.Logo != "" {
+		logo := e.image(in.Logo, LOGO_WIDTH)
+		e.place(&logo, region.Left, region.Top)
+		header_bottom = math.Max(header_bottom, region.Top+logo.Height)
+	}
+	lep_logo := e.image(LEP_LOGO_KEY, LEP_LOGO_WIDTH)
+	if !tall {
+		e.place(&lep_logo, region.Right()-lep_logo.Width, region.Top)
+		header_bottom = math.Max(header_bottom, region.Top+lep_logo.Height)
+	}
+
+	// Footer row, bottom aligned: the LEP logo right and Drinkaware left on
+	// tall canvases, Drinkaware right otherwise.
+	footer_top := region.Bottom() + compliance.MIN_GAP
+	if tall {
+		e.place(&lep_logo, region.Right()-lep_logo.Width, region.Bottom()-lep_logo.Height)
+		footer_top = math.Min(footer_top, lep_logo.Top)
+	}
+	if in.IsAlcoholPromotion {
+		drinkaware := e.image(DRINKAWARE_KEY, DRINKAWARE_WIDTH)
+		left := region.Right() - drinkaware.Width
+		if tall {
+			left = region.Left
+		}
+		e.place(&drinkaware, left, region.Bottom()-drinkaware.Height)
+		footer_top = math.Min(footer_top, drinkaware.Top)
+	}
+
+	// Copy.
+	text_width := region.Width
+	if wide {
+		text_width = (region.Width - compliance.MIN_GAP) / 2
+	}
+	text_bottom := header_bottom
+	if in.Headline != "" {
+		headline := e.text(types.RoleHeadline, in.Headline, HEADLINE_FONT, "bold", HEADLINE_COLOR, HEADLINE_SIZE, text_width, MAX_HEADLINE_LINES)
+		text_bottom = e.stack(&headline, region.Left, text_bottom)
+	}
+	if in.Subhead != "" {
+		subhead := e.text(types.RoleSubhead, in.Subhead, SUBHEAD_FONT, "", SUBHEAD_COLOR, SUBHEAD_SIZE, text_width, MAX_SUBHEAD_LINES)
+		text_bottom = e.stack(&subhead, region.Left, text_bottom)
+	}
+
+	// Product.
+	if in.Product != "" {
+		area := compliance.Box{Left: region.Left, Top: text_bottom + compliance.MIN_GAP, Width: region.Width}
+		if wide {
+			area.Left = region.Left + text_width + compliance.MIN_GAP
+			area.Top = header_bottom + compliance.MIN_GAP
+			area.Width = region.Right() - area.Left
+		}
+		area.Height = footer_top - compliance.MIN_GAP - area.Top
+
+		if area.Width > 0 && area.Height > 0 {
+			aspect := in.Sizes[in.Product].aspect()
+			width := math.Min(area.Width, area.Height*aspect) * PRODUCT_FILL
+			product := types.Element{Type: types.ElementImage, URL: in.Product, Width: round(width), Height: round(width / aspect)}
+			e.place(&product, area.Left+(area.Width-product.Width)/2, area.Top+(area.Height-product.Height)/2)
+		}
+	}
+
+	return &types.FormatLayout{
+		Width:           format.Width,
+		Height:          format.Height,
+		BackgroundColor: BACKGROUND_COLOR,
+		Elements:        e.elements,
+	}
+}
+
+type engine struct {
+	in       Input
+	scale    float64
+	min_font float64
+	region   compliance.Box
+	elements []types.Element
+}
+
+// image is url at its reference width, scaled to the canvas.
+func (e *engine) image(url string, width float64) types.Element {
+	width = round(width * e.scale)
+	return types.Element{Type: types.ElementImage, URL: url, Width: width, Height: round(width / e.in.Sizes[url].aspect())}
+}
+
+func (e *engine) place(el *types.Element, left, top float64) {
+	el.Left, el.Top = round(left), round(top)
+	e.elements = append(e.elements, *el)
+}
+
+// stack places el a gap below bottom, returning its own bottom. The gap
+// is rounded up so it is never short of MIN_GAP.
+func (e *engine) stack(el *types.Element, left, bottom float64) float64 {
+	e.place(el, left, math.Ceil(bottom+compliance.MIN_GAP))
+	_, height := compliance.ElementSize(*el)
+	return el.Top + height
+}
+
+// text wraps content to width at the largest size from its reference size
+// down to the minimum that fits in max_lines. Copy that never fits is set
+// at the minimum and left for the checks to report.
+func (e *engine) text(role, content, font, weight, fill string, size, width float64, max_lines int) types.Element {
+	el := types.Element{
+		Type:       types.ElementText,
+		Role:       role,
+		FontFamily: font,
+		FontWeight: types.FontWeight(weight),
+		Fill:       fill,
+		TextAlign:  "left",
+		FontSize:   math.Max(math.Floor(size*e.scale), e.min_font),
+	}
+	box, font_size, _ := textmetrics.Fit(content, textmetrics.ElementStyle(el), width, max_lines, e.min_font)
+	el.FontSize = font_size
+	el.Content = strings.Join(box.Lines, "\n")
+	return el
+}
+
+func round(v float64) float64 {
+	return math.Round(v)
+}
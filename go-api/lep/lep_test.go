@@ -0,0 +1,99 @@
+package lep
+
+import (
+	"canvas-backend/compliance"
+	"canvas-backend/types"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name string
+		in   Input
+	}{
+		{
+			name: "full creative",
+			in:   Input{Headline: "Fresh strawberries", Subhead: "Sweet and juicy, every day", Logo: "logo.png", Product: "berries.png"},
+		},
+		{
+			name: "alcohol promotion",
+			in:   Input{Headline: "Summer wine", Subhead: "Chilled rosé", Logo: "logo.png", Product: "wine.png", IsAlcoholPromotion: true},
+		},
+		{
+			name: "wide product",
+			in: Input{Headline: "Garden furniture", Product: "bench.png", Sizes: map[string]Size{
+				"bench.png": {Width: 1600, Height: 400},
+			}},
+		},
+		{
+			name: "tall logos",
+			in: Input{Headline: "Bread", Logo: "logo.png", Product: "loaf.png", Sizes: map[string]Size{
+				"logo.png":   {Width: 100, Height: 200},
+				LEP_LOGO_KEY: {Width: 100, Height: 100},
+			}},
+		},
+		{
+			name: "long copy",
+			in: Input{
+				Headline: strings.Repeat("Low everyday prices ", 6),
+				Subhead:  strings.Repeat("On the things you buy every week ", 5),
+				Product:  "basket.png",
+			},
+		},
+		{
+			name: "copy only",
+			in:   Input{Headline: "Low prices", Subhead: "Always"},
+		},
+	}
+
+	formats := make([]compliance.Format, 0, len(compliance.FORMATS))
+	for _, format := range compliance.FORMATS {
+		formats = append(formats, format)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout := Generate(formats, tt.in)
+
+			for _, format := range formats {
+				fl := layout[format.ID]
+				if fl == nil {
+					t.Fatalf("no layout for %s", format.ID)
+				}
+				if fl.Width != format.Width || fl.Height != format.Height {
+					t.Errorf("%s: canvas is %vx%v, want %vx%v", format.ID, fl.Width, fl.Height, format.Width, format.Height)
+				}
+
+				found := map[string]bool{}
+				for _, el := range fl.Elements {
+					found[el.Role] = true
+					found[el.URL] = true
+				}
+				want := map[string]bool{
+					types.RoleHeadline: tt.in.Headline != "",
+					types.RoleSubhead:  tt.in.Subhead != "",
+					LEP_LOGO_KEY:       true,
+					DRINKAWARE_KEY:     tt.in.IsAlcoholPromotion,
+				}
+				if tt.in.Logo != "" {
+					want[tt.in.Logo] = true
+				}
+				if tt.in.Product != "" {
+					want[tt.in.Product] = true
+				}
+				for key, wanted := range want {
+					if found[key] != wanted {
+						t.Errorf("%s: has %s = %v, want %v", format.ID, key, found[key], wanted)
+					}
+				}
+			}
+
+			for _, violation := range compliance.Validate(layout, compliance.Formats(compliance.FORMATS), compliance.PLATFORMS[compliance.DEFAULT_PLATFORM]) {
+				if violation.Severity == compliance.SEVERITY_ERROR {
+					t.Errorf("%s: %s: %s", violation.Format, violation.Rule, violation.Message)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package llm
+
+import (
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sync"
+)
+
+var (
+	fakeHeadlinePattern = regexp.MustCompile(`MANDATORY HEADLINE: "([^"]*)"`)
+	fakeSubheadPattern  = regexp.MustCompile(`MANDATORY SUBHEAD: "([^"]*)"`)
+)
+
+// FakeProvider is a deterministic offline provider. It returns the canned
+// Layouts in turn, or a compliant layout built from the request when none
+// are set, and never calls the network.
+type FakeProvider struct {
+	Layouts     []string
+	Description string
+
+	mu    sync.Mutex
+	calls int
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (f *FakeProvider) ModelName() string {
+	return "fake"
+}
+
+func (f *FakeProvider) GenerateLayout(ctx context.Context, request LayoutRequest) (Response, error) {
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+
+	f.mu.Lock()
+	call := f.calls
+	f.calls++
+	f.mu.Unlock()
+
+	prompt, err := request.PromptText()
+	if err != nil {
+		return Response{}, err
+	}
+
+	if len(f.Layouts) > 0 {
+		return fakeResponse(prompt, f.Layouts[call%len(f.Layouts)]), nil
+	}
+
+	layout := fakeLayout(request.Context, request.Seed)
+	data, err := json.Marshal(layout)
+	if err != nil {
+		return Response{}, err
+	}
+	return fakeResponse(prompt, string(data)), nil
+}
+
+func (f *FakeProvider) DescribeImage(ctx context.Context, request ImageRequest) (Response, error) {
+	if err := ctx.Err(); err != nil {
+		return Response{}, err
+	}
+	if f.Description != "" {
+		return fakeResponse(request.Prompt, f.Description), nil
+	}
+	return fakeResponse(request.Prompt, fmt.Sprintf("A product image (%s, %d bytes) photographed against a plain background.", request.MIMEType, len(request.Data))), nil
+}
+
+// fakeResponse counts roughly four characters to a token, so usage
+// accounting has something to show offline.
+func fakeResponse(prompt, text string) Response {
+	return Response{
+		Text:  text,
+		Model: "fake",
+		Usage: Usage{PromptTokens: int32(len(prompt) / 4), ResponseTokens: int32(len(text) / 4)},
+	}
+}
+
+// fakeLayout builds a compliant layout from the request. A seed shrinks the
+// product a little, so candidates generated offline still differ.
+func fakeLayout(request types.JsonRequest, seed *int32) types.Layout {
+	headline, subhead := "FRESH EVERY DAY", "Made for sharing"
+	if m := fakeHeadlinePattern.FindStringSubmatch(request.UserPrompt); m != nil {
+		headline = m[1]
+	}
+	if m := fakeSubheadPattern.FindStringSubmatch(request.UserPrompt); m != nil {
+		subhead = m[1]
+	}
+
+	product := request.HeroImage
+	if product == "" && len(request.ImageURLs) > 0 {
+		product = request.ImageURLs[0]
+	}
+
+	product_scale := 1.0
+	if seed != nil {
+		product_scale = 1 - 0.15*float64(uint32(*seed)%3)
+	}
+
+	format := func(width, height, top, product_width float64) *types.FormatLayout {
+		center := width / 2
+		product_width *= product_scale
+		var elements []types.Element
+		if request.Logo != "" {
+			elements = append(elements, types.Element{Type: types.ElementImage, URL: request.Logo, Top: top, Left: 24, Width: 120})
+			top += 144
+		}
+		elements = append(elements,
+			types.Element{Type: types.ElementText, Role: types.RoleHeadline, Content: headline, Top: top, Left: center, OriginX: "center", FontSize: 60, FontFamily: "Oswald", FontWeight: "bold", Fill: "#00539F"},
+			types.Element{Type: types.ElementText, Role: types.RoleSubhead, Content: subhead, Top: top + 96, Left: center, OriginX: "center", FontSize: 32, FontFamily: "Roboto", Fill: "#000000"},
+		)
+		if product != "" {
+			elements = append(elements, types.Element{Type: types.ElementImage, URL: product, Top: top + 164, Left: center, OriginX: "center", Width: product_width})
+		}
+		return &types.FormatLayout{Width: width, Height: height, BackgroundColor: "#ffffff", Elements: elements}
+	}
+
+	sizes := request.Formats
+	if len(sizes) == 0 {
+		sizes = map[string]types.CanvasSize{
+			"instagram_story": {Width: 1080, Height: 1920, SafeZoneTop: 250, SafeZoneBottom: 250},
+			"instagram_post":  {Width: 1080, Height: 1080},
+			"facebook_ad":     {Width: 1200, Height: 628},
+		}
+	}
+
+	// The built-in formats keep their hand-placed top and product width;
+	// other canvases get the product at whatever size fits under the copy.
+	presets := map[string][2]float64{
+		"instagram_story": {274, 700},
+		"instagram_post":  {24, 520},
+		"facebook_ad":     {24, 260},
+	}
+	layout := types.Layout{}
+	for id, size := range sizes {
+		if preset, ok := presets[id]; ok {
+			layout[id] = format(size.Width, size.Height, preset[0], preset[1])
+			continue
+		}
+		top := size.SafeZoneTop + 24
+		product_width := math.Max(40, math.Min(size.Width/2, size.Height-size.SafeZoneBottom-24-top-164))
+		layout[id] = format(size.Width, size.Height, top, product_width)
+	}
+	return layout
+}
@@ -0,0 +1,113 @@
+package llm
+
+import (
+	"canvas-backend/types"
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+const DEFAULT_GEMINI_MODEL = "gemini-2.5-flash"
+
+type GeminiProvider struct {
+	Client *genai.Client
+	Model  string
+}
+
+func NewGeminiProvider(client *genai.Client, model string) *GeminiProvider {
+	if model == "" {
+		model = DEFAULT_GEMINI_MODEL
+	}
+	return &GeminiProvider{
+		Client: client,
+		Model:  model,
+	}
+}
+
+func (g *GeminiProvider) Name() string {
+	return "gemini"
+}
+
+func (g *GeminiProvider) ModelName() string {
+	return g.Model
+}
+
+func (g *GeminiProvider) GenerateLayout(ctx context.Context, request LayoutRequest) (Response, error) {
+	prompt, err := request.PromptText()
+	if err != nil {
+		return Response{}, err
+	}
+
+	parts := []*genai.Part{
+		{Text: prompt},
+	}
+	config := &genai.GenerateContentConfig{
+		Temperature: request.Temperature,
+		Seed:        request.Seed,
+	}
+	if request.Schema != nil {
+		config.ResponseMIMEType = "application/json"
+		config.ResponseSchema = geminiSchema(request.Schema)
+	}
+	return g.generate(ctx, parts, config)
+}
+
+// geminiSchema converts a schema to genai's, whose types are upper case.
+// Properties keep the model's order so the model writes an element's type
+// before its other fields.
+func geminiSchema(s *types.Schema) *genai.Schema {
+	schema := &genai.Schema{
+		Type:             genai.Type(strings.ToUpper(s.Type)),
+		Required:         s.Required,
+		Enum:             s.Enum,
+		PropertyOrdering: s.Order,
+	}
+	if s.Items != nil {
+		schema.Items = geminiSchema(s.Items)
+	}
+	if len(s.Properties) > 0 {
+		schema.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, property := range s.Properties {
+			schema.Properties[name] = geminiSchema(property)
+		}
+	}
+	return schema
+}
+
+func (g *GeminiProvider) DescribeImage(ctx context.Context, request ImageRequest) (Response, error) {
+	parts := []*genai.Part{
+		{Text: request.Prompt},
+		{InlineData: &genai.Blob{Data: request.Data, MIMEType: request.MIMEType}},
+	}
+	return g.generate(ctx, parts, nil)
+}
+
+func (g *GeminiProvider) generate(ctx context.Context, parts []*genai.Part, config *genai.GenerateContentConfig) (Response, error) {
+	result, err := g.Client.Models.GenerateContent(ctx, g.Model, []*genai.Content{{Parts: parts}}, config)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNAVAILABLE") || strings.Contains(err.Error(), "RESOURCE_EXHAUSTED") {
+			return Response{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return Response{}, err
+	}
+
+	// An empty answer is still billed, so it keeps its usage.
+	response := Response{Model: g.Model}
+	if result.ModelVersion != "" {
+		response.Model = result.ModelVersion
+	}
+	if usage := result.UsageMetadata; usage != nil {
+		response.Usage = Usage{
+			PromptTokens:   usage.PromptTokenCount,
+			ResponseTokens: usage.CandidatesTokenCount + usage.ThoughtsTokenCount,
+		}
+	}
+
+	if len(result.Candidates) == 0 || result.Candidates[0].Content == nil || len(result.Candidates[0].Content.Parts) == 0 {
+		return response, fmt.Errorf("%w: no content generated", ErrUnavailable)
+	}
+	response.Text = result.Candidates[0].Content.Parts[0].Text
+	return response, nil
+}
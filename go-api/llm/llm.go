@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnavailable marks transient provider failures (overload, rate limits)
+// that callers may retry.
+var ErrUnavailable = errors.New("model unavailable")
+
+// LayoutRequest is everything a provider needs to produce a layout document.
+type LayoutRequest struct {
+	SystemPrompt string
+	Context      types.JsonRequest
+	// Temperature and Seed vary the sampling between candidates; nil keeps
+	// the provider's default.
+	Temperature *float32
+	Seed        *int32
+	// Schema, when set, is what the layout must conform to. Providers that
+	// support structured output constrain their answer to it.
+	Schema *types.Schema
+}
+
+// ImageRequest asks a provider to describe a single image.
+type ImageRequest struct {
+	Prompt   string
+	Data     []byte
+	MIMEType string
+}
+
+// Usage is the tokens a model call was billed for. ResponseTokens include
+// any thinking tokens, which are billed as output.
+type Usage struct {
+	PromptTokens   int32
+	ResponseTokens int32
+}
+
+// Response is a model's answer. Model is the model that produced it, which
+// may be more specific than the configured one.
+type Response struct {
+	Text  string
+	Model string
+	Usage Usage
+}
+
+type LayoutGenerator interface {
+	GenerateLayout(ctx context.Context, request LayoutRequest) (Response, error)
+}
+
+type ImageDescriber interface {
+	DescribeImage(ctx context.Context, request ImageRequest) (Response, error)
+}
+
+// Provider is a model backend that can both describe images and generate
+// layouts.
+type Provider interface {
+	LayoutGenerator
+	ImageDescriber
+	Name() string
+	ModelName() string
+}
+
+// ContextJSON encodes the layout context the same way for every provider.
+func (r LayoutRequest) ContextJSON() (string, error) {
+	var sb strings.Builder
+	encoder := json.NewEncoder(&sb)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	if err := encoder.Encode(r.Context); err != nil {
+		return "", fmt.Errorf("failed to encode request: %v", err)
+	}
+	return sb.String(), nil
+}
+
+// PromptText is the single-message prompt: system prompt followed by the
+// context data.
+func (r LayoutRequest) PromptText() (string, error) {
+	context_json, err := r.ContextJSON()
+	if err != nil {
+		return "", err
+	}
+	return r.SystemPrompt + "\n\nContext Data:\n" + context_json, nil
+}
@@ -0,0 +1,153 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider talks to any OpenAI-compatible chat completions server,
+// such as a local llama.cpp, vLLM or Ollama instance.
+type OpenAIProvider struct {
+	BaseURL string
+	APIKey  string
+	Model   string
+	Client  *http.Client
+}
+
+func NewOpenAIProvider(base_url, api_key, model string) *OpenAIProvider {
+	return &OpenAIProvider{
+		BaseURL: strings.TrimSuffix(base_url, "/"),
+		APIKey:  api_key,
+		Model:   model,
+		Client:  &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (o *OpenAIProvider) Name() string {
+	return "openai"
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+type openAIChatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []openAIMessage `json:"messages"`
+	Temperature *float32        `json:"temperature,omitempty"`
+	Seed        *int32          `json:"seed,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int32 `json:"prompt_tokens"`
+		CompletionTokens int32 `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (o *OpenAIProvider) ModelName() string {
+	return o.Model
+}
+
+func (o *OpenAIProvider) GenerateLayout(ctx context.Context, request LayoutRequest) (Response, error) {
+	context_json, err := request.ContextJSON()
+	if err != nil {
+		return Response{}, err
+	}
+
+	return o.chat(ctx, openAIChatRequest{
+		Messages: []openAIMessage{
+			{Role: "system", Content: request.SystemPrompt},
+			{Role: "user", Content: "Context Data:\n" + context_json},
+		},
+		Temperature: request.Temperature,
+		Seed:        request.Seed,
+	})
+}
+
+func (o *OpenAIProvider) DescribeImage(ctx context.Context, request ImageRequest) (Response, error) {
+	data_url := fmt.Sprintf("data:%s;base64,%s", request.MIMEType, base64.StdEncoding.EncodeToString(request.Data))
+
+	return o.chat(ctx, openAIChatRequest{Messages: []openAIMessage{
+		{Role: "user", Content: []openAIContentPart{
+			{Type: "text", Text: request.Prompt},
+			{Type: "image_url", ImageURL: &openAIImageURL{URL: data_url}},
+		}},
+	}})
+}
+
+func (o *OpenAIProvider) chat(ctx context.Context, chat_request openAIChatRequest) (Response, error) {
+	chat_request.Model = o.Model
+	body, err := json.Marshal(chat_request)
+	if err != nil {
+		return Response{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	resp, err := o.Client.Do(req)
+	if err != nil {
+		return Response{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	resp_body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Response{}, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return Response{}, fmt.Errorf("%w: status %s", ErrUnavailable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("chat completion failed with status %s: %s", resp.Status, strings.TrimSpace(string(resp_body)))
+	}
+
+	var chat openAIChatResponse
+	if err := json.Unmarshal(resp_body, &chat); err != nil {
+		return Response{}, fmt.Errorf("failed to parse the chat completion, error: %v", err)
+	}
+	response := Response{
+		Model: o.Model,
+		Usage: Usage{PromptTokens: chat.Usage.PromptTokens, ResponseTokens: chat.Usage.CompletionTokens},
+	}
+	if chat.Model != "" {
+		response.Model = chat.Model
+	}
+	if len(chat.Choices) == 0 || chat.Choices[0].Message.Content == "" {
+		return response, fmt.Errorf("%w: no content generated", ErrUnavailable)
+	}
+	response.Text = chat.Choices[0].Message.Content
+	return response, nil
+}
@@ -2,12 +2,21 @@ package main
 
 import (
 	"canvas-backend/api"
+	"canvas-backend/auth"
+	"canvas-backend/handlers"
 	"canvas-backend/internal/db"
+	"canvas-backend/llm"
+	"canvas-backend/storage"
+	"canvas-backend/textmetrics"
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,12 +27,132 @@ import (
 	"google.golang.org/genai"
 )
 
-func credentials() (*cloudinary.Cloudinary, context.Context) {
-	cld, _ := cloudinary.New()
-	// cld.Config.URL.Secure = true
+// newAssetStore picks where uploads and exports are kept from ASSET_STORE:
+// cloudinary (default, configured by CLOUDINARY_URL) or local, which writes
+// to ASSET_DIR and serves the files under PUBLIC_BASE_URL/assets/.
+func newAssetStore() (storage.AssetStore, error) {
+	switch os.Getenv("ASSET_STORE") {
+	case "", "cloudinary":
+		cld, err := cloudinary.New()
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewCloudinaryStore(cld), nil
+	case "local":
+		ASSET_DIR := os.Getenv("ASSET_DIR")
+		if ASSET_DIR == "" {
+			ASSET_DIR = "data/assets"
+		}
+		PUBLIC_BASE_URL := os.Getenv("PUBLIC_BASE_URL")
+		if PUBLIC_BASE_URL == "" {
+			PUBLIC_BASE_URL = "http://localhost:8080"
+		}
+		return storage.NewLocalStore(ASSET_DIR, PUBLIC_BASE_URL)
+	default:
+		return nil, fmt.Errorf("unknown ASSET_STORE %q", os.Getenv("ASSET_STORE"))
+	}
+}
+
+// newProvider picks the model backend from LLM_PROVIDER: gemini (default),
+// openai for any OpenAI-compatible server, or fake for offline runs.
+func newProvider() (llm.Provider, error) {
+	switch os.Getenv("LLM_PROVIDER") {
+	case "", "gemini":
+		GOOGLE_API_KEY := os.Getenv("GOOGLE_API_KEY")
+		if GOOGLE_API_KEY == "" {
+			return nil, fmt.Errorf("unable to get the GOOGLE_API_KEY")
+		}
+
+		gemini_client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+			APIKey:  GOOGLE_API_KEY,
+			Backend: genai.BackendGeminiAPI,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return llm.NewGeminiProvider(gemini_client, os.Getenv("GEMINI_MODEL")), nil
+	case "openai":
+		OPENAI_BASE_URL := os.Getenv("OPENAI_BASE_URL")
+		if OPENAI_BASE_URL == "" {
+			return nil, fmt.Errorf("unable to get the OPENAI_BASE_URL")
+		}
+		OPENAI_MODEL := os.Getenv("OPENAI_MODEL")
+		if OPENAI_MODEL == "" {
+			return nil, fmt.Errorf("unable to get the OPENAI_MODEL")
+		}
+		return llm.NewOpenAIProvider(OPENAI_BASE_URL, os.Getenv("OPENAI_API_KEY"), OPENAI_MODEL), nil
+	case "fake":
+		return llm.NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_PROVIDER %q", os.Getenv("LLM_PROVIDER"))
+	}
+}
+
+// bootstrap creates a user and a workspace they own, and prints the
+// workspace's first API key. It is how a fresh deployment gets its first
+// key: go run . bootstrap -email admin@example.com -workspace Acme
+//
+// It also makes the user the owner of every workspace that has none and
+// prints a key for each. Deployments that predate workspaces have their
+// kits in such a "Default" workspace, which is unreachable until someone
+// runs bootstrap once after upgrading; -workspace may then be left out.
+func bootstrap(dbpool *pgxpool.Pool, args []string) error {
+	flags := flag.NewFlagSet("bootstrap", flag.ExitOnError)
+	email := flags.String("email", "", "email of the workspace owner")
+	name := flags.String("name", "", "name of the workspace owner")
+	workspace_name := flags.String("workspace", "", "name of the workspace to create")
+	flags.Parse(args)
+
+	if !strings.Contains(*email, "@") {
+		return fmt.Errorf("-email is required")
+	}
+
 	ctx := context.Background()
+	tx, err := dbpool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	queries := db.New(tx)
+	unowned, err := queries.ListUnownedWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+	if len(unowned) == 0 && *workspace_name == "" {
+		return fmt.Errorf("-workspace is required, there is no workspace without an owner to claim")
+	}
+
+	user, err := queries.UpsertUser(ctx, db.UpsertUserParams{Email: strings.ToLower(*email), Name: *name})
+	if err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(unowned)+1)
+	for _, workspace := range unowned {
+		key, err := auth.ClaimWorkspace(ctx, queries, workspace.ID, user.ID)
+		if err != nil {
+			return err
+		}
+		log.Printf("SUCCESS: %s now owns the existing workspace %q\n", user.Email, workspace.Name)
+		keys = append(keys, key)
+	}
+	if *workspace_name != "" {
+		workspace, key, err := auth.CreateWorkspace(ctx, queries, *workspace_name, user.ID)
+		if err != nil {
+			return err
+		}
+		log.Printf("SUCCESS: Created workspace %q owned by %s\n", workspace.Name, user.Email)
+		keys = append(keys, key)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
 
-	return cld, ctx
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+	return nil
 }
 
 func main() {
@@ -37,21 +166,17 @@ func main() {
 		log.Fatalln("ERROR: Unable to get the DATABASE_URL")
 	}
 
-	GOOGLE_API_KEY := os.Getenv("GOOGLE_API_KEY")
-	if GOOGLE_API_KEY == "" {
-		log.Fatalln("ERROR: Unable to get the GOOGLE_API_KEY")
-	}
-
 	dbpool, err := pgxpool.New(context.Background(), DATABASE_URL)
 	if err != nil {
 		log.Fatalf("ERROR: Unable to connect to the database, error: %v\n", err)
 	}
 	defer dbpool.Close()
 
-	cld, _ := credentials()
-	if cld == nil {
-		log.Fatalln("ERROR: Unable to get the cloudinary client")
+	assets, err := newAssetStore()
+	if err != nil {
+		log.Fatalf("ERROR: Unable to instantiate the asset store, error: %v\n", err)
 	}
+	log.Printf("INFO: Using the %s asset store\n", assets.Name())
 
 	if err := dbpool.Ping(context.Background()); err != nil {
 		log.Fatalf("ERROR: Unable to ping the database, error: %v\n", err)
@@ -59,21 +184,55 @@ func main() {
 
 	log.Println("SUCCESS: Successfully connected to the database")
 
-	gemini_client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
-		APIKey:  GOOGLE_API_KEY,
-		Backend: genai.BackendGeminiAPI,
-	})
+	if len(os.Args) > 1 && os.Args[1] == "bootstrap" {
+		if err := bootstrap(dbpool, os.Args[2:]); err != nil {
+			log.Fatalf("ERROR: Unable to bootstrap, error: %v\n", err)
+		}
+		return
+	}
+
+	if err := textmetrics.Check(); err != nil {
+		log.Fatalf("ERROR: Unable to load the fonts, error: %v\n", err)
+	}
+
+	provider, err := newProvider()
 	if err != nil {
-		log.Fatalf("ERROR: Unable to instantiate the gemini client, error: %v\n", err)
+		log.Fatalf("ERROR: Unable to instantiate the model provider, error: %v\n", err)
 	}
+	log.Printf("INFO: Using the %s model provider\n", provider.Name())
 
 	queries := db.New(dbpool)
-	r := api.NewRouter(dbpool, queries, cld, gemini_client)
+	h := handlers.New(dbpool, queries, assets, provider)
+
+	if GENERATION_WORKERS := os.Getenv("GENERATION_WORKERS"); GENERATION_WORKERS != "" {
+		workers, err := strconv.Atoi(GENERATION_WORKERS)
+		if err != nil || workers <= 0 {
+			log.Fatalf("ERROR: Invalid GENERATION_WORKERS %q\n", GENERATION_WORKERS)
+		}
+		h.Jobs.Workers = workers
+	}
+
+	for name, limit := range map[string]*int32{"GENERATION_RATE_LIMIT": &h.Limits.Defaults.RateLimit, "GENERATION_DAILY_QUOTA": &h.Limits.Defaults.DailyQuota} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || parsed < 0 {
+				log.Fatalf("ERROR: Invalid %s %q\n", name, value)
+			}
+			*limit = int32(parsed)
+		}
+	}
+
+	worker_ctx, stop_workers := context.WithCancel(context.Background())
+	h.Jobs.Start(worker_ctx)
+	go h.Limits.Sweep(worker_ctx)
+
+	r := api.NewRouter(h)
 
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173"}, // frontend origin
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "X-API-Key"},
+		ExposedHeaders:   []string{"ETag", "Location", "Retry-After"},
 		AllowCredentials: true,
 	}).Handler(r)
 
@@ -100,5 +259,9 @@ func main() {
 		log.Fatalf("ERROR: Something went wrong while shutting down, error: %v\n", err)
 	}
 
+	log.Println("INFO: Stopping the generation workers")
+	stop_workers()
+	h.Jobs.Wait()
+
 	log.Println("SUCCESS: Server shutdown complete")
 }
@@ -0,0 +1,211 @@
+// Package prompts keeps the model prompts as versioned text/template
+// templates. Version 0 of each prompt is built into the server; workspaces
+// publish later versions to the database, activate one, and can pin a brand
+// kit to a version of its own.
+package prompts
+
+import (
+	"canvas-backend/compliance"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	NAME_FABRIC_JSON       = "fabric_json"
+	NAME_IMAGE_DESCRIPTION = "image_description"
+
+	// BUILTIN_VERSION is the template that ships with the server.
+	BUILTIN_VERSION = 0
+)
+
+var (
+	ErrUnknownPrompt  = errors.New("unknown prompt")
+	ErrUnknownVersion = errors.New("unknown prompt version")
+)
+
+// LayoutData is what the layout prompts can refer to, as {{.BrandName}}
+// and so on.
+type LayoutData struct {
+	BrandName          string
+	Tone               string
+	Style              string
+	CreativeMode       string
+	Headline           string
+	Subhead            string
+	HeroImage          string
+	IsAlcoholPromotion bool
+	// Formats are the canvases to lay out, in the order they were asked for.
+	Formats []compliance.Format
+}
+
+// ImageData is what the image description prompt can refer to.
+type ImageData struct {
+	ImageName string
+	Role      string
+}
+
+// data holds the type each prompt is rendered with. A template is checked
+// against its zero value, so a misspelt variable fails when it is
+// published rather than when it is used.
+var data = map[string]any{
+	NAME_FABRIC_JSON:       LayoutData{},
+	NAME_IMAGE_DESCRIPTION: ImageData{},
+}
+
+//go:embed builtin/*.tmpl
+var builtin_files embed.FS
+
+var builtin = map[string]Template{}
+
+func init() {
+	for name := range data {
+		body, err := builtin_files.ReadFile("builtin/" + name + ".tmpl")
+		if err != nil {
+			panic(err)
+		}
+		t, err := Parse(name, BUILTIN_VERSION, string(body))
+		if err != nil {
+			panic(err)
+		}
+		builtin[name] = t
+	}
+}
+
+// Names lists the known prompts.
+func Names() []string {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Variables lists the variables a prompt can use.
+func Variables(name string) []string {
+	value, ok := data[name]
+	if !ok {
+		return nil
+	}
+	value_type := reflect.TypeOf(value)
+	variables := make([]string, 0, value_type.NumField())
+	for i := 0; i < value_type.NumField(); i++ {
+		variables = append(variables, value_type.Field(i).Name)
+	}
+	return variables
+}
+
+// Hash identifies a template body, so stored results can tell whether they
+// came from the current wording.
+func Hash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+type Template struct {
+	Name    string
+	Version int32
+	Hash    string
+	Body    string
+
+	parsed *template.Template
+}
+
+// Parse checks body as a version of the named prompt.
+func Parse(name string, version int32, body string) (Template, error) {
+	sample, ok := data[name]
+	if !ok {
+		return Template{}, fmt.Errorf("%w %q", ErrUnknownPrompt, name)
+	}
+
+	parsed, err := template.New(name).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return Template{}, err
+	}
+	if err := parsed.Execute(io.Discard, sample); err != nil {
+		return Template{}, err
+	}
+
+	return Template{Name: name, Version: version, Hash: Hash(body), Body: body, parsed: parsed}, nil
+}
+
+// Builtin is version 0 of the named prompt.
+func Builtin(name string) (Template, error) {
+	t, ok := builtin[name]
+	if !ok {
+		return Template{}, fmt.Errorf("%w %q", ErrUnknownPrompt, name)
+	}
+	return t, nil
+}
+
+func (t Template) Render(value any) (string, error) {
+	var sb strings.Builder
+	if err := t.parsed.Execute(&sb, value); err != nil {
+		return "", fmt.Errorf("unable to render prompt %s version %d: %w", t.Name, t.Version, err)
+	}
+	return sb.String(), nil
+}
+
+func (t Template) Ref() types.PromptRef {
+	return types.PromptRef{Name: t.Name, Version: t.Version, Hash: t.Hash}
+}
+
+type Registry struct {
+	Queries *db.Queries
+}
+
+func NewRegistry(queries *db.Queries) *Registry {
+	return &Registry{Queries: queries}
+}
+
+// Load returns a version of a workspace's prompt.
+func (r *Registry) Load(ctx context.Context, workspace_id pgtype.UUID, name string, version int32) (Template, error) {
+	if version == BUILTIN_VERSION {
+		return Builtin(name)
+	}
+
+	row, err := r.Queries.GetPromptTemplate(ctx, db.GetPromptTemplateParams{WorkspaceID: workspace_id, Name: name, Version: version})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Template{}, fmt.Errorf("%w %s/%d", ErrUnknownVersion, name, version)
+		}
+		return Template{}, err
+	}
+	return Parse(row.Name, row.Version, row.Body)
+}
+
+// Active is the version of name a workspace uses for kits without a pin.
+func (r *Registry) Active(ctx context.Context, workspace_id pgtype.UUID, name string) (int32, error) {
+	version, err := r.Queries.GetActivePromptVersion(ctx, db.GetActivePromptVersionParams{WorkspaceID: workspace_id, Name: name})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return BUILTIN_VERSION, nil
+	}
+	return version, err
+}
+
+// Resolve picks the version of name for the kit: its pin if it has one,
+// otherwise the workspace's active version.
+func (r *Registry) Resolve(ctx context.Context, kit db.BrandKit, name string) (Template, error) {
+	version, err := r.Queries.GetBrandKitPromptPin(ctx, db.GetBrandKitPromptPinParams{BrandKitID: kit.ID, Name: name})
+	if errors.Is(err, pgx.ErrNoRows) {
+		version, err = r.Active(ctx, kit.WorkspaceID, name)
+	}
+	if err != nil {
+		return Template{}, err
+	}
+	return r.Load(ctx, kit.WorkspaceID, name, version)
+}
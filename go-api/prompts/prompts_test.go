@@ -0,0 +1,218 @@
+package prompts
+
+import (
+	"canvas-backend/internal/db"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+var (
+	TEST_WORKSPACE = pgtype.UUID{Bytes: [16]byte{1}, Valid: true}
+	TEST_KIT       = pgtype.UUID{Bytes: [16]byte{2}, Valid: true}
+)
+
+// fakeDB holds one workspace's published versions, active versions and
+// kit pins, keyed by prompt name. err, when set, fails every query.
+type fakeDB struct {
+	published map[string]map[int32]string
+	active    map[string]int32
+	pins      map[string]int32
+	err       error
+}
+
+func (f *fakeDB) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("unexpected exec")
+}
+
+func (f *fakeDB) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (f *fakeDB) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	if f.err != nil {
+		return row{err: f.err}
+	}
+
+	switch {
+	case strings.Contains(sql, "-- name: GetBrandKitPromptPin "):
+		if version, ok := f.pins[args[1].(string)]; ok && args[0] == TEST_KIT {
+			return row{values: []any{version}}
+		}
+	case strings.Contains(sql, "-- name: GetActivePromptVersion "):
+		if version, ok := f.active[args[1].(string)]; ok && args[0] == TEST_WORKSPACE {
+			return row{values: []any{version}}
+		}
+	case strings.Contains(sql, "-- name: GetPromptTemplate "):
+		name, version := args[1].(string), args[2].(int32)
+		if body, ok := f.published[name][version]; ok && args[0] == TEST_WORKSPACE {
+			return row{values: []any{pgtype.UUID{}, TEST_WORKSPACE, name, version, body, Hash(body), pgtype.Text{}, "", pgtype.Timestamptz{}}}
+		}
+	}
+	return row{err: pgx.ErrNoRows}
+}
+
+type row struct {
+	values []any
+	err    error
+}
+
+func (r row) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, value := range r.values {
+		switch d := dest[i].(type) {
+		case *pgtype.UUID:
+			*d = value.(pgtype.UUID)
+		case *string:
+			*d = value.(string)
+		case *int32:
+			*d = value.(int32)
+		case *pgtype.Text:
+			*d = value.(pgtype.Text)
+		case *pgtype.Timestamptz:
+			*d = value.(pgtype.Timestamptz)
+		default:
+			return fmt.Errorf("cannot scan into %T", dest[i])
+		}
+	}
+	return nil
+}
+
+func TestResolve(t *testing.T) {
+	published := map[string]map[int32]string{
+		NAME_IMAGE_DESCRIPTION: {
+			1: "Describe {{.ImageName}}.",
+			2: "Describe the {{.Role}} image {{.ImageName}}.",
+		},
+	}
+	builtin, err := Builtin(NAME_IMAGE_DESCRIPTION)
+	if err != nil {
+		t.Fatalf("Builtin(): %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		db      *fakeDB
+		version int32
+		body    string
+		err     error
+	}{
+		{
+			name:    "the built-in version without an active one or a pin",
+			db:      &fakeDB{published: published},
+			version: BUILTIN_VERSION,
+			body:    builtin.Body,
+		},
+		{
+			name:    "the workspace's active version",
+			db:      &fakeDB{published: published, active: map[string]int32{NAME_IMAGE_DESCRIPTION: 2}},
+			version: 2,
+			body:    published[NAME_IMAGE_DESCRIPTION][2],
+		},
+		{
+			name:    "the kit's pin wins over the active version",
+			db:      &fakeDB{published: published, active: map[string]int32{NAME_IMAGE_DESCRIPTION: 2}, pins: map[string]int32{NAME_IMAGE_DESCRIPTION: 1}},
+			version: 1,
+			body:    published[NAME_IMAGE_DESCRIPTION][1],
+		},
+		{
+			name:    "a pin to the built-in version",
+			db:      &fakeDB{published: published, active: map[string]int32{NAME_IMAGE_DESCRIPTION: 2}, pins: map[string]int32{NAME_IMAGE_DESCRIPTION: BUILTIN_VERSION}},
+			version: BUILTIN_VERSION,
+			body:    builtin.Body,
+		},
+		{
+			name: "an active version that was never published",
+			db:   &fakeDB{published: published, active: map[string]int32{NAME_IMAGE_DESCRIPTION: 7}},
+			err:  ErrUnknownVersion,
+		},
+		{
+			name: "database errors are not mistaken for defaults",
+			db:   &fakeDB{err: pgx.ErrTxClosed},
+			err:  pgx.ErrTxClosed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry(db.New(tt.db))
+			got, err := registry.Resolve(context.Background(), db.BrandKit{ID: TEST_KIT, WorkspaceID: TEST_WORKSPACE}, NAME_IMAGE_DESCRIPTION)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Resolve() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve(): %v", err)
+			}
+			if got.Version != tt.version || got.Body != tt.body || got.Hash != Hash(tt.body) {
+				t.Errorf("Resolve() = version %d %q (%s), want version %d %q", got.Version, got.Body, got.Hash, tt.version, tt.body)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		// prompt defaults to the image description.
+		prompt string
+		ok     bool
+	}{
+		{name: "known variables", body: "Describe the {{.Role}} image {{.ImageName}}.", ok: true},
+		{name: "plain text", body: "Describe the image.", ok: true},
+		{name: "misspelt variable", body: "Describe {{.ImageNmae}}."},
+		{name: "another prompt's variable", body: "Describe {{.BrandName}}."},
+		{name: "syntax error", body: "Describe {{.ImageName}."},
+		{name: "unknown prompt", prompt: "tagline", body: "Write a tagline."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompt := tt.prompt
+			if prompt == "" {
+				prompt = NAME_IMAGE_DESCRIPTION
+			}
+			template, err := Parse(prompt, 3, tt.body)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Parse() error = %v, want ok %v", err, tt.ok)
+			}
+			if tt.prompt != "" && !errors.Is(err, ErrUnknownPrompt) {
+				t.Errorf("Parse() error = %v, want ErrUnknownPrompt", err)
+			}
+			if tt.ok && (template.Version != 3 || template.Hash != Hash(tt.body)) {
+				t.Errorf("Parse() = version %d hash %s, want version 3 hash %s", template.Version, template.Hash, Hash(tt.body))
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	template, err := Parse(NAME_IMAGE_DESCRIPTION, 1, "Describe the {{.Role}} image {{.ImageName}}.")
+	if err != nil {
+		t.Fatalf("Parse(): %v", err)
+	}
+	got, err := template.Render(ImageData{ImageName: "bottle.png", Role: "hero"})
+	if err != nil {
+		t.Fatalf("Render(): %v", err)
+	}
+	if want := "Describe the hero image bottle.png."; got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	for _, name := range Names() {
+		if _, err := Builtin(name); err != nil {
+			t.Errorf("Builtin(%q): %v", name, err)
+		}
+	}
+}
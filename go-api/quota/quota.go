@@ -0,0 +1,237 @@
+// Package quota limits how many generations a workspace and each of its
+// API keys can run, per minute and per UTC day. Every variant of a layout
+// and every image description counts as one generation. Counters live in
+// the database, so the limits hold across restarts and between instances.
+package quota
+
+import (
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"canvas-backend/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	SCOPE_WORKSPACE = "workspace"
+	SCOPE_API_KEY   = "api_key"
+
+	PERIOD_MINUTE = "minute"
+	PERIOD_DAY    = "day"
+)
+
+const (
+	DEFAULT_RATE_LIMIT  = 10
+	DEFAULT_DAILY_QUOTA = 200
+
+	// Counters are swept once they are this old; a day window ends well
+	// before then.
+	COUNTER_RETENTION = 48 * time.Hour
+	SWEEP_INTERVAL    = time.Hour
+)
+
+// Limits are generations per minute and per day. 0 means unlimited.
+type Limits struct {
+	RateLimit  int32 `json:"generation_rate_limit"`
+	DailyQuota int32 `json:"generation_daily_quota"`
+}
+
+// LimitError is returned by Take when a limit has been reached.
+type LimitError struct {
+	Scope      string
+	Period     string
+	Limit      int32
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit of %d generations per %s reached", e.Scope, e.Limit, e.Period)
+}
+
+// Beginner starts the transaction Take counts in. *pgxpool.Pool is one.
+type Beginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+type Limiter struct {
+	Pool    Beginner
+	Queries *db.Queries
+	// Defaults apply to workspaces without limits of their own.
+	Defaults Limits
+
+	now func() time.Time
+}
+
+func NewLimiter(pool Beginner, queries *db.Queries) *Limiter {
+	return &Limiter{
+		Pool:     pool,
+		Queries:  queries,
+		Defaults: Limits{RateLimit: DEFAULT_RATE_LIMIT, DailyQuota: DEFAULT_DAILY_QUOTA},
+		now:      time.Now,
+	}
+}
+
+// WindowStart is the start of the window of period that t falls in.
+func WindowStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	if period == PERIOD_DAY {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return t.Truncate(time.Minute)
+}
+
+func windowLength(period string) time.Duration {
+	if period == PERIOD_DAY {
+		return 24 * time.Hour
+	}
+	return time.Minute
+}
+
+// WorkspaceLimits resolves the limits stored on a workspace against the
+// defaults.
+func (l *Limiter) WorkspaceLimits(rate_limit, daily_quota pgtype.Int4) Limits {
+	limits := l.Defaults
+	if rate_limit.Valid {
+		limits.RateLimit = rate_limit.Int32
+	}
+	if daily_quota.Valid {
+		limits.DailyQuota = daily_quota.Int32
+	}
+	return limits
+}
+
+type counter struct {
+	scope    string
+	scope_id pgtype.UUID
+	period   string
+	limit    int32
+}
+
+// Take counts generations against the principal's workspace and key. When
+// that would go over any of their limits it returns a *LimitError for the
+// one that frees up last, and nothing is counted.
+func (l *Limiter) Take(ctx context.Context, principal auth.Principal, generations int32) error {
+	row, err := l.Queries.GetGenerationLimits(ctx, principal.APIKeyID)
+	if err != nil {
+		return err
+	}
+	workspace := l.WorkspaceLimits(row.WorkspaceRateLimit, row.WorkspaceDailyQuota)
+
+	counters := []counter{
+		{SCOPE_WORKSPACE, principal.WorkspaceID, PERIOD_MINUTE, workspace.RateLimit},
+		{SCOPE_WORKSPACE, principal.WorkspaceID, PERIOD_DAY, workspace.DailyQuota},
+		{SCOPE_API_KEY, principal.APIKeyID, PERIOD_MINUTE, row.KeyRateLimit.Int32},
+		{SCOPE_API_KEY, principal.APIKeyID, PERIOD_DAY, row.KeyDailyQuota.Int32},
+	}
+
+	tx, err := l.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := l.Queries.WithTx(tx)
+	now := l.now()
+
+	var limited *LimitError
+	for _, c := range counters {
+		if c.limit <= 0 {
+			continue
+		}
+		start := WindowStart(c.period, now)
+		count, err := qtx.IncrementUsageCounter(ctx, db.IncrementUsageCounterParams{
+			Scope:       c.scope,
+			ScopeID:     c.scope_id,
+			Period:      c.period,
+			WindowStart: pgtype.Timestamptz{Time: start, Valid: true},
+			Count:       generations,
+		})
+		if err != nil {
+			return err
+		}
+		if count > c.limit {
+			retry_after := start.Add(windowLength(c.period)).Sub(now)
+			if limited == nil || retry_after > limited.RetryAfter {
+				limited = &LimitError{Scope: c.scope, Period: c.period, Limit: c.limit, RetryAfter: retry_after}
+			}
+		}
+	}
+	if limited != nil {
+		return limited
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Used is how many generations scope_id has used in the current window of
+// period.
+func (l *Limiter) Used(ctx context.Context, scope string, scope_id pgtype.UUID, period string) (int32, error) {
+	count, err := l.Queries.GetUsageCount(ctx, db.GetUsageCountParams{
+		Scope:       scope,
+		ScopeID:     scope_id,
+		Period:      period,
+		WindowStart: pgtype.Timestamptz{Time: WindowStart(period, l.now()), Valid: true},
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return count, err
+}
+
+// Allow takes generations for the request's principal. Once a limit has
+// been reached it answers 429 with a Retry-After header and returns false.
+// Handlers call it after checking the request, so a request the client has
+// to fix costs nothing. It must run after auth.Middleware.
+func (l *Limiter) Allow(w http.ResponseWriter, r *http.Request, generations int32) bool {
+	principal, _ := auth.FromContext(r.Context())
+
+	err := l.Take(r.Context(), principal, generations)
+	if err != nil {
+		var limited *LimitError
+		if errors.As(err, &limited) {
+			seconds := int(math.Ceil(limited.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+			writeError(w, http.StatusTooManyRequests, "ERROR: The "+limited.Error()+", try again later")
+			return false
+		}
+		log.Printf("ERROR: Something went wrong while checking the generation limits, error: %v\n", err)
+		writeError(w, http.StatusInternalServerError, "ERROR: Something went wrong")
+		return false
+	}
+	return true
+}
+
+// Sweep deletes expired counters every SWEEP_INTERVAL until ctx is done.
+func (l *Limiter) Sweep(ctx context.Context) {
+	ticker := time.NewTicker(SWEEP_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		cutoff := pgtype.Timestamptz{Time: l.now().Add(-COUNTER_RETENTION), Valid: true}
+		if _, err := l.Queries.DeleteUsageCountersBefore(ctx, cutoff); err != nil && ctx.Err() == nil {
+			log.Printf("WARN: Unable to sweep the usage counters, error: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(types.APIResponse{Message: message})
+}
@@ -0,0 +1,286 @@
+package quota
+
+import (
+	"canvas-backend/auth"
+	"canvas-backend/internal/db"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// fakeStore keeps the limits and counters in memory, answering the
+// queries the limiter makes.
+type fakeStore struct {
+	limits   db.GetGenerationLimitsRow
+	counters map[string]int32
+}
+
+func counterKey(args []any) string {
+	return fmt.Sprint(args[0], args[1].(pgtype.UUID).Bytes, args[2], args[3].(pgtype.Timestamptz).Time.Unix())
+}
+
+func (s *fakeStore) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errors.New("unexpected exec")
+}
+
+func (s *fakeStore) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func (s *fakeStore) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	switch {
+	case strings.Contains(sql, "-- name: GetGenerationLimits "):
+		return limitsRow(s.limits)
+	case strings.Contains(sql, "-- name: GetUsageCount "):
+		count, ok := s.counters[counterKey(args)]
+		if !ok {
+			return countRow{err: pgx.ErrNoRows}
+		}
+		return countRow{count: count}
+	case strings.Contains(sql, "-- name: IncrementUsageCounter "):
+		key := counterKey(args)
+		s.counters[key] += args[4].(int32)
+		return countRow{count: s.counters[key]}
+	}
+	return countRow{err: errors.New("unexpected query")}
+}
+
+// Begin works on a copy of the counters that Commit keeps.
+func (s *fakeStore) Begin(ctx context.Context) (pgx.Tx, error) {
+	return &fakeTx{store: &fakeStore{limits: s.limits, counters: maps.Clone(s.counters)}, parent: s}, nil
+}
+
+type fakeTx struct {
+	pgx.Tx
+	store  *fakeStore
+	parent *fakeStore
+}
+
+func (t *fakeTx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return t.store.QueryRow(ctx, sql, args...)
+}
+
+func (t *fakeTx) Commit(ctx context.Context) error {
+	t.parent.counters = t.store.counters
+	return nil
+}
+
+func (t *fakeTx) Rollback(ctx context.Context) error {
+	return nil
+}
+
+type limitsRow db.GetGenerationLimitsRow
+
+func (r limitsRow) Scan(dest ...any) error {
+	*dest[0].(*pgtype.Int4) = r.WorkspaceRateLimit
+	*dest[1].(*pgtype.Int4) = r.WorkspaceDailyQuota
+	*dest[2].(*pgtype.Int4) = r.KeyRateLimit
+	*dest[3].(*pgtype.Int4) = r.KeyDailyQuota
+	return nil
+}
+
+type countRow struct {
+	count int32
+	err   error
+}
+
+func (r countRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[0].(*int32) = r.count
+	return nil
+}
+
+// seed counts generations already taken in every window of principal.
+func (s *fakeStore) seed(principal auth.Principal, now time.Time, generations int32) {
+	for _, scope_id := range []pgtype.UUID{principal.WorkspaceID, principal.APIKeyID} {
+		for _, period := range []string{PERIOD_MINUTE, PERIOD_DAY} {
+			scope := SCOPE_WORKSPACE
+			if scope_id == principal.APIKeyID {
+				scope = SCOPE_API_KEY
+			}
+			s.counters[counterKey([]any{scope, scope_id, period, pgtype.Timestamptz{Time: WindowStart(period, now), Valid: true}})] = generations
+		}
+	}
+}
+
+func limit(n int32) pgtype.Int4 {
+	return pgtype.Int4{Int32: n, Valid: true}
+}
+
+func testPrincipal() auth.Principal {
+	return auth.Principal{
+		WorkspaceID: pgtype.UUID{Bytes: [16]byte{1}, Valid: true},
+		APIKeyID:    pgtype.UUID{Bytes: [16]byte{2}, Valid: true},
+	}
+}
+
+func newTestLimiter(limits db.GetGenerationLimitsRow, now time.Time) (*Limiter, *fakeStore) {
+	store := &fakeStore{limits: limits, counters: map[string]int32{}}
+	limiter := NewLimiter(store, db.New(store))
+	limiter.now = func() time.Time { return now }
+	return limiter, store
+}
+
+func TestWindowStart(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	at := time.Date(2025, 12, 20, 2, 15, 42, 0, ist)
+
+	if got, want := WindowStart(PERIOD_MINUTE, at), time.Date(2025, 12, 19, 20, 45, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("minute window = %v, want %v", got, want)
+	}
+	if got, want := WindowStart(PERIOD_DAY, at), time.Date(2025, 12, 19, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("day window = %v, want %v", got, want)
+	}
+}
+
+func TestTake(t *testing.T) {
+	now := time.Date(2025, 12, 20, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		limits db.GetGenerationLimitsRow
+		// earlier generations were taken before this one.
+		earlier     int32
+		generations int32
+		// scope and period name the limit that is reported, if any.
+		scope  string
+		period string
+		retry  time.Duration
+	}{
+		{
+			name:        "defaults allow a generation",
+			generations: 1,
+		},
+		{
+			name:        "variants count up to the limit",
+			earlier:     7,
+			generations: 3,
+		},
+		{
+			name:        "variants count past the limit",
+			earlier:     8,
+			generations: 3,
+			scope:       SCOPE_WORKSPACE,
+			period:      PERIOD_MINUTE,
+			retry:       45 * time.Second,
+		},
+		{
+			name:        "a key's own limit",
+			limits:      db.GetGenerationLimitsRow{KeyRateLimit: limit(2)},
+			generations: 3,
+			scope:       SCOPE_API_KEY,
+			period:      PERIOD_MINUTE,
+			retry:       45 * time.Second,
+		},
+		{
+			name:        "the limit that frees up last is reported",
+			limits:      db.GetGenerationLimitsRow{WorkspaceRateLimit: limit(5), WorkspaceDailyQuota: limit(5)},
+			earlier:     5,
+			generations: 1,
+			scope:       SCOPE_WORKSPACE,
+			period:      PERIOD_DAY,
+			retry:       13*time.Hour + 29*time.Minute + 45*time.Second,
+		},
+		{
+			name:        "a rate limit of 0 is unlimited",
+			limits:      db.GetGenerationLimitsRow{WorkspaceRateLimit: limit(0), WorkspaceDailyQuota: limit(1000)},
+			earlier:     500,
+			generations: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, store := newTestLimiter(tt.limits, now)
+			principal := testPrincipal()
+			ctx := context.Background()
+
+			store.seed(principal, now, tt.earlier)
+			before, err := limiter.Used(ctx, SCOPE_WORKSPACE, principal.WorkspaceID, PERIOD_DAY)
+			if err != nil {
+				t.Fatalf("Used(): %v", err)
+			}
+
+			err = limiter.Take(ctx, principal, tt.generations)
+
+			used, used_err := limiter.Used(ctx, SCOPE_WORKSPACE, principal.WorkspaceID, PERIOD_DAY)
+			if used_err != nil {
+				t.Fatalf("Used(): %v", used_err)
+			}
+
+			if tt.scope == "" {
+				if err != nil {
+					t.Fatalf("Take() = %v, want nil", err)
+				}
+				if used != before+tt.generations {
+					t.Errorf("used %d generations, want %d", used, before+tt.generations)
+				}
+				return
+			}
+
+			var limited *LimitError
+			if !errors.As(err, &limited) {
+				t.Fatalf("Take() = %v, want a *LimitError", err)
+			}
+			if limited.Scope != tt.scope || limited.Period != tt.period || limited.RetryAfter != tt.retry {
+				t.Errorf("Take() limited by %s %s, retry after %v; want %s %s, retry after %v", limited.Scope, limited.Period, limited.RetryAfter, tt.scope, tt.period, tt.retry)
+			}
+			if used != before {
+				t.Errorf("a refused Take() counted %d generations", used-before)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	now := time.Date(2025, 12, 20, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		generations int32
+		allowed     bool
+		status      int
+		retry_after string
+	}{
+		{name: "under the limit", generations: 2, allowed: true},
+		{name: "over the limit", generations: 3, status: http.StatusTooManyRequests, retry_after: "45"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, _ := newTestLimiter(db.GetGenerationLimitsRow{WorkspaceRateLimit: limit(2)}, now)
+
+			request := httptest.NewRequest(http.MethodPost, "/brand-kit/kit/generate", nil)
+			request = request.WithContext(auth.WithPrincipal(request.Context(), testPrincipal()))
+			recorder := httptest.NewRecorder()
+
+			if allowed := limiter.Allow(recorder, request, tt.generations); allowed != tt.allowed {
+				t.Fatalf("Allow() = %v, want %v", allowed, tt.allowed)
+			}
+			if tt.allowed {
+				if recorder.Body.Len() > 0 {
+					t.Errorf("Allow() wrote a response: %s", recorder.Body)
+				}
+				return
+			}
+			if recorder.Code != tt.status {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.status)
+			}
+			if got := recorder.Header().Get("Retry-After"); got != tt.retry_after {
+				t.Errorf("Retry-After = %q, want %q", got, tt.retry_after)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package render
+
+import (
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+var namedColors = map[string]color.NRGBA{
+	"transparent": {0, 0, 0, 0},
+	"black":       {0, 0, 0, 255},
+	"white":       {255, 255, 255, 255},
+	"red":         {255, 0, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"lime":        {0, 255, 0, 255},
+	"blue":        {0, 0, 255, 255},
+	"navy":        {0, 0, 128, 255},
+	"yellow":      {255, 255, 0, 255},
+	"gold":        {255, 215, 0, 255},
+	"orange":      {255, 165, 0, 255},
+	"purple":      {128, 0, 128, 255},
+	"pink":        {255, 192, 203, 255},
+	"brown":       {165, 42, 42, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"lightgray":   {211, 211, 211, 255},
+	"lightgrey":   {211, 211, 211, 255},
+	"darkgray":    {169, 169, 169, 255},
+	"darkgrey":    {169, 169, 169, 255},
+	"silver":      {192, 192, 192, 255},
+	"teal":        {0, 128, 128, 255},
+	"cyan":        {0, 255, 255, 255},
+	"magenta":     {255, 0, 255, 255},
+	"maroon":      {128, 0, 0, 255},
+	"olive":       {128, 128, 0, 255},
+	"beige":       {245, 245, 220, 255},
+	"ivory":       {255, 255, 240, 255},
+	"cream":       {255, 253, 208, 255},
+}
+
+// ParseColor understands the CSS color forms fabric accepts in generated
+// layouts: #rgb, #rgba, #rrggbb, #rrggbbaa, rgb(), rgba() and common names.
+func ParseColor(s string) (color.NRGBA, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" {
+		return color.NRGBA{}, false
+	}
+
+	if c, ok := namedColors[s]; ok {
+		return c, true
+	}
+
+	if strings.HasPrefix(s, "#") {
+		return parseHex(s[1:])
+	}
+
+	if strings.HasPrefix(s, "rgb") {
+		open, close := strings.Index(s, "("), strings.LastIndex(s, ")")
+		if open < 0 || close < open {
+			return color.NRGBA{}, false
+		}
+		parts := strings.Split(s[open+1:close], ",")
+		if len(parts) != 3 && len(parts) != 4 {
+			return color.NRGBA{}, false
+		}
+
+		var channels [3]uint8
+		for i := 0; i < 3; i++ {
+			v, err := strconv.ParseFloat(strings.TrimSpace(parts[i]), 64)
+			if err != nil {
+				return color.NRGBA{}, false
+			}
+			channels[i] = clampByte(v)
+		}
+
+		alpha := uint8(255)
+		if len(parts) == 4 {
+			a, err := strconv.ParseFloat(strings.TrimSpace(parts[3]), 64)
+			if err != nil {
+				return color.NRGBA{}, false
+			}
+			alpha = clampByte(a * 255)
+		}
+		return color.NRGBA{channels[0], channels[1], channels[2], alpha}, true
+	}
+
+	return color.NRGBA{}, false
+}
+
+func parseHex(hex string) (color.NRGBA, bool) {
+	if len(hex) == 3 || len(hex) == 4 {
+		expanded := make([]byte, 0, len(hex)*2)
+		for i := 0; i < len(hex); i++ {
+			expanded = append(expanded, hex[i], hex[i])
+		}
+		hex = string(expanded)
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, false
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+func clampByte(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+func lerpColor(a, b color.NRGBA, t float64) color.NRGBA {
+	mix := func(x, y uint8) uint8 {
+		return clampByte(float64(x) + (float64(y)-float64(x))*t)
+	}
+	return color.NRGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), mix(a.A, b.A)}
+}
@@ -0,0 +1,106 @@
+package render
+
+import (
+	"canvas-backend/storage"
+	"context"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"sync"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ImageFetcher loads the images a layout references.
+type ImageFetcher interface {
+	Fetch(ctx context.Context, image_url string) (image.Image, error)
+}
+
+// HTTPFetcher decodes data URLs inline and fetches http(s) URLs on public
+// hosts or the asset store, refusing images too large to decode safely.
+type HTTPFetcher struct{}
+
+func NewHTTPFetcher() *HTTPFetcher {
+	return &HTTPFetcher{}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, image_url string) (image.Image, error) {
+	data, err := storage.OpenSource(ctx, image_url)
+	if err != nil {
+		return nil, err
+	}
+	return storage.DecodeImage(data)
+}
+
+// MeasureImages fetches images side by side and returns their intrinsic
+// sizes by URL. Images that cannot be loaded are left out.
+func MeasureImages(ctx context.Context, fetcher ImageFetcher, urls []string) map[string]image.Point {
+	sizes := map[string]image.Point{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	seen := map[string]bool{"": true}
+	for _, image_url := range urls {
+		if seen[image_url] {
+			continue
+		}
+		seen[image_url] = true
+		wg.Add(1)
+		go func(image_url string) {
+			defer wg.Done()
+			img, err := fetcher.Fetch(ctx, image_url)
+			if err != nil {
+				log.Printf("WARN: Unable to measure the image %s: %v\n", image_url, err)
+				return
+			}
+			mu.Lock()
+			sizes[image_url] = img.Bounds().Size()
+			mu.Unlock()
+		}(image_url)
+	}
+	wg.Wait()
+	return sizes
+}
+
+// scaleImage resizes src to w x h with a high quality kernel.
+func scaleImage(src image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// applyFilters mirrors fabric's Brightness, Contrast and Blur image filters
+// on premultiplied pixels.
+func applyFilters(img *image.RGBA, brightness, contrast, blur float64) {
+	if brightness != 0 || contrast != 0 {
+		shift := brightness * 255
+		contrast_factor := 1.0
+		if contrast != 0 {
+			c := contrast * 255
+			contrast_factor = 259 * (c + 255) / (255 * (259 - c))
+		}
+
+		for i := 0; i < len(img.Pix); i += 4 {
+			a := img.Pix[i+3]
+			if a == 0 {
+				continue
+			}
+			for ch := 0; ch < 3; ch++ {
+				// Work on straight alpha so transparent edges stay clean.
+				v := float64(img.Pix[i+ch]) * 255 / float64(a)
+				v = contrast_factor*(v-128) + 128 + shift
+				v = math.Min(math.Max(v, 0), 255)
+				img.Pix[i+ch] = uint8(v*float64(a)/255 + 0.5)
+			}
+		}
+	}
+
+	if blur > 0 {
+		// Fabric's blur is a fraction of the image size.
+		b := img.Bounds()
+		blurRGBA(img, blur*0.05*float64(max(b.Dx(), b.Dy())))
+	}
+}
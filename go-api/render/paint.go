@@ -0,0 +1,232 @@
+package render
+
+import (
+	"canvas-backend/types"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"golang.org/x/image/vector"
+)
+
+// Cubic bezier control distance for a quarter ellipse.
+const KAPPA = 0.5522847498
+
+// gradientImage is an unbounded image that evaluates a fabric gradient. The
+// gradient coordinates are relative to offset, which lets element gradients
+// use object-local coordinates like fabric does.
+type gradientImage struct {
+	gradient *types.Gradient
+	stops    []types.GradientStop
+	colors   []color.NRGBA
+	offset   image.Point
+}
+
+func newGradientImage(g *types.Gradient, offset image.Point) *gradientImage {
+	stops := append([]types.GradientStop(nil), g.Stops...)
+	sort.SliceStable(stops, func(i, j int) bool { return stops[i].Offset < stops[j].Offset })
+
+	colors := make([]color.NRGBA, len(stops))
+	for i, stop := range stops {
+		c, ok := ParseColor(stop.Color)
+		if !ok {
+			c = color.NRGBA{0, 0, 0, 255}
+		}
+		colors[i] = c
+	}
+	return &gradientImage{gradient: g, stops: stops, colors: colors, offset: offset}
+}
+
+func (g *gradientImage) ColorModel() color.Model { return color.NRGBAModel }
+
+func (g *gradientImage) Bounds() image.Rectangle {
+	return image.Rect(-1e9, -1e9, 1e9, 1e9)
+}
+
+func (g *gradientImage) At(x, y int) color.Color {
+	if len(g.stops) == 0 {
+		return color.NRGBA{}
+	}
+
+	px := float64(x-g.offset.X) + 0.5
+	py := float64(y-g.offset.Y) + 0.5
+	c := g.gradient.Coords
+
+	var t float64
+	if g.gradient.Type == "radial" {
+		r2 := c.R2
+		if r2 <= c.R1 {
+			r2 = c.R1 + 1
+		}
+		t = (math.Hypot(px-c.X1, py-c.Y1) - c.R1) / (r2 - c.R1)
+	} else {
+		dx, dy := c.X2-c.X1, c.Y2-c.Y1
+		length := dx*dx + dy*dy
+		if length == 0 {
+			t = 0
+		} else {
+			t = ((px-c.X1)*dx + (py-c.Y1)*dy) / length
+		}
+	}
+
+	if t <= g.stops[0].Offset {
+		return g.colors[0]
+	}
+	last := len(g.stops) - 1
+	if t >= g.stops[last].Offset {
+		return g.colors[last]
+	}
+	for i := 1; i <= last; i++ {
+		if t <= g.stops[i].Offset {
+			span := g.stops[i].Offset - g.stops[i-1].Offset
+			if span <= 0 {
+				return g.colors[i]
+			}
+			return lerpColor(g.colors[i-1], g.colors[i], (t-g.stops[i-1].Offset)/span)
+		}
+	}
+	return g.colors[last]
+}
+
+// roundedRectPath adds a rectangle with elliptical corners to the rasterizer.
+// Reversed paths wind the other way, which cuts holes for strokes.
+func roundedRectPath(z *vector.Rasterizer, x, y, w, h, rx, ry float64, reverse bool) {
+	if w <= 0 || h <= 0 {
+		return
+	}
+	rx = math.Min(math.Max(rx, 0), w/2)
+	ry = math.Min(math.Max(ry, 0), h/2)
+	kx, ky := rx*KAPPA, ry*KAPPA
+
+	type segment struct {
+		line       [2]float64
+		c1, c2, to [2]float64
+	}
+
+	// Clockwise starting at the end of the top-left corner.
+	start := [2]float64{x + rx, y}
+	segments := []segment{
+		{line: [2]float64{x + w - rx, y}, c1: [2]float64{x + w - rx + kx, y}, c2: [2]float64{x + w, y + ry - ky}, to: [2]float64{x + w, y + ry}},
+		{line: [2]float64{x + w, y + h - ry}, c1: [2]float64{x + w, y + h - ry + ky}, c2: [2]float64{x + w - rx + kx, y + h}, to: [2]float64{x + w - rx, y + h}},
+		{line: [2]float64{x + rx, y + h}, c1: [2]float64{x + rx - kx, y + h}, c2: [2]float64{x, y + h - ry + ky}, to: [2]float64{x, y + h - ry}},
+		{line: [2]float64{x, y + ry}, c1: [2]float64{x, y + ry - ky}, c2: [2]float64{x + rx - kx, y}, to: [2]float64{x + rx, y}},
+	}
+
+	if !reverse {
+		z.MoveTo(float32(start[0]), float32(start[1]))
+		for _, s := range segments {
+			z.LineTo(float32(s.line[0]), float32(s.line[1]))
+			z.CubeTo(float32(s.c1[0]), float32(s.c1[1]), float32(s.c2[0]), float32(s.c2[1]), float32(s.to[0]), float32(s.to[1]))
+		}
+		z.ClosePath()
+		return
+	}
+
+	// Walk the same outline backwards: each curve runs from its end to the
+	// line end with swapped control points, then the line runs back.
+	z.MoveTo(float32(start[0]), float32(start[1]))
+	for i := len(segments) - 1; i >= 0; i-- {
+		s := segments[i]
+		var prev [2]float64
+		if i == 0 {
+			prev = start
+		} else {
+			prev = segments[i-1].to
+		}
+		z.CubeTo(float32(s.c2[0]), float32(s.c2[1]), float32(s.c1[0]), float32(s.c1[1]), float32(s.line[0]), float32(s.line[1]))
+		z.LineTo(float32(prev[0]), float32(prev[1]))
+	}
+	z.ClosePath()
+}
+
+// blurRGBA approximates a gaussian blur with the given sigma using three
+// box blur passes in each direction.
+func blurRGBA(img *image.RGBA, sigma float64) {
+	if sigma < 0.5 {
+		return
+	}
+
+	for _, box := range boxSizes(sigma, 3) {
+		radius := (box - 1) / 2
+		if radius < 1 {
+			continue
+		}
+		boxBlurHorizontal(img, radius)
+		boxBlurVertical(img, radius)
+	}
+}
+
+// boxSizes returns n box widths whose combined blur matches sigma.
+func boxSizes(sigma float64, n int) []int {
+	ideal := math.Sqrt(12*sigma*sigma/float64(n) + 1)
+	lower := int(math.Floor(ideal))
+	if lower%2 == 0 {
+		lower--
+	}
+	upper := lower + 2
+
+	m := math.Round((12*sigma*sigma - float64(n*lower*lower) - float64(4*n*lower) - float64(3*n)) / float64(-4*lower-4))
+	sizes := make([]int, n)
+	for i := range sizes {
+		if float64(i) < m {
+			sizes[i] = lower
+		} else {
+			sizes[i] = upper
+		}
+	}
+	return sizes
+}
+
+func boxBlurHorizontal(img *image.RGBA, radius int) {
+	b := img.Bounds()
+	w := b.Dx()
+	row := make([]uint8, w*4)
+	for y := 0; y < b.Dy(); y++ {
+		line := img.Pix[y*img.Stride : y*img.Stride+w*4]
+		copy(row, line)
+		for ch := 0; ch < 4; ch++ {
+			sum := 0
+			for x := -radius; x <= radius; x++ {
+				sum += int(row[clampIndex(x, w)*4+ch])
+			}
+			for x := 0; x < w; x++ {
+				line[x*4+ch] = uint8(sum / (2*radius + 1))
+				sum += int(row[clampIndex(x+radius+1, w)*4+ch]) - int(row[clampIndex(x-radius, w)*4+ch])
+			}
+		}
+	}
+}
+
+func boxBlurVertical(img *image.RGBA, radius int) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	col := make([]uint8, h*4)
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			copy(col[y*4:y*4+4], img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4])
+		}
+		for ch := 0; ch < 4; ch++ {
+			sum := 0
+			for y := -radius; y <= radius; y++ {
+				sum += int(col[clampIndex(y, h)*4+ch])
+			}
+			for y := 0; y < h; y++ {
+				img.Pix[y*img.Stride+x*4+ch] = uint8(sum / (2*radius + 1))
+				sum += int(col[clampIndex(y+radius+1, h)*4+ch]) - int(col[clampIndex(y-radius, h)*4+ch])
+			}
+		}
+	}
+}
+
+// clampIndex treats pixels outside the image as transparent edges by
+// clamping, which is fine because layers are padded before blurring.
+func clampIndex(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
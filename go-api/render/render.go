@@ -0,0 +1,512 @@
+// Package render rasterizes layouts without a browser, following the
+// fabric.js semantics the editor relies on.
+package render
+
+import (
+	"canvas-backend/types"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"math"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/vector"
+)
+
+const (
+	OUTPUT_PNG  = "png"
+	OUTPUT_JPEG = "jpeg"
+)
+
+// Canvases above this many pixels are refused (roughly 4K x 4K). Element
+// layers are clipped to what can reach the canvas and refused above it too.
+const MAX_CANVAS_PIXELS = 16_000_000
+
+// Font sizes and shadow blurs are clamped to these. Larger values draw
+// nothing a canvas could show and would only cost memory.
+const (
+	MAX_FONT_SIZE   = 2000
+	MAX_SHADOW_BLUR = 250
+)
+
+const DEFAULT_JPEG_QUALITY = 90
+
+// PREVIEW_WATERMARK marks renders of layouts nobody has signed off.
+const PREVIEW_WATERMARK = "PREVIEW"
+
+type Options struct {
+	Fetcher ImageFetcher
+	// Watermark, when set, is stamped across the canvas.
+	Watermark string
+}
+
+// layer is an element drawn in its own coordinate space. The element's
+// logical box (width x height, stroke included) starts at pixel (pad, pad).
+// img only covers the part of it that can reach the canvas, so its bounds
+// need not start at (0, 0).
+type layer struct {
+	img     *image.RGBA
+	width   float64
+	height  float64
+	pad     float64
+	scale_x float64
+	scale_y float64
+}
+
+// Render draws a single format at its exact canvas size. Elements that fail
+// to render, such as images that cannot be downloaded, are skipped the same
+// way the editor skips them.
+func Render(ctx context.Context, fl *types.FormatLayout, opts Options) (*image.RGBA, error) {
+	if fl.Width*fl.Height > MAX_CANVAS_PIXELS {
+		return nil, fmt.Errorf("canvas %vx%v is too large to render", fl.Width, fl.Height)
+	}
+	w, h := int(math.Round(fl.Width)), int(math.Round(fl.Height))
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("invalid canvas size %dx%d", w, h)
+	}
+
+	if opts.Fetcher == nil {
+		opts.Fetcher = NewHTTPFetcher()
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, w, h))
+	r := renderer{opts: opts, images: map[string]image.Image{}, canvas: canvas.Bounds()}
+
+	paintBackground(canvas, fl)
+
+	for i, el := range fl.Elements {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		l, err := r.elementLayer(ctx, el)
+		if err != nil {
+			log.Printf("WARN: Skipping element %d (%s) while rendering, error: %v\n", i, el.Type, err)
+			continue
+		}
+		if l == nil {
+			continue
+		}
+		drawLayer(canvas, el, l)
+	}
+
+	if opts.Watermark != "" {
+		el := watermarkElement(fl, opts.Watermark)
+		l, err := r.textLayer(el)
+		if err != nil {
+			return nil, fmt.Errorf("unable to draw the watermark: %v", err)
+		}
+		if l != nil {
+			drawLayer(canvas, el, l)
+		}
+	}
+
+	return canvas, nil
+}
+
+// watermarkElement is a translucent diagonal text across the middle of the
+// canvas, large enough that it cannot be cropped out.
+func watermarkElement(fl *types.FormatLayout, text string) types.Element {
+	opacity := 0.35
+	return types.Element{
+		Type:       types.ElementText,
+		Left:       fl.Width / 2,
+		Top:        fl.Height / 2,
+		OriginX:    "center",
+		OriginY:    "center",
+		Angle:      -30,
+		Opacity:    &opacity,
+		Content:    text,
+		FontSize:   math.Min(fl.Width, fl.Height) / 5,
+		FontWeight: "bold",
+		Fill:       "#808080",
+	}
+}
+
+// Encode writes the image as PNG or JPEG.
+func Encode(w io.Writer, img image.Image, output string, quality int) error {
+	switch output {
+	case "", OUTPUT_PNG:
+		return png.Encode(w, img)
+	case OUTPUT_JPEG, "jpg":
+		if quality <= 0 || quality > 100 {
+			quality = DEFAULT_JPEG_QUALITY
+		}
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	default:
+		return fmt.Errorf("unsupported output format %q", output)
+	}
+}
+
+func ContentType(output string) string {
+	if output == OUTPUT_JPEG || output == "jpg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+type renderer struct {
+	opts   Options
+	images map[string]image.Image
+	canvas image.Rectangle
+}
+
+func (r *renderer) elementLayer(ctx context.Context, el types.Element) (*layer, error) {
+	switch el.Type {
+	case types.ElementRect:
+		return r.shapeLayer(el, el.Width, el.Height, el.Rx, el.Ry)
+	case types.ElementCircle:
+		radius := el.Radius
+		if radius == 0 {
+			radius = 50
+		}
+		return r.shapeLayer(el, radius*2, radius*2, radius, radius)
+	case types.ElementText:
+		if el.Content == "" {
+			return nil, nil
+		}
+		return r.textLayer(el)
+	case types.ElementImage:
+		return r.imageLayer(ctx, el)
+	default:
+		return nil, fmt.Errorf("unknown element type %q", el.Type)
+	}
+}
+
+func paintBackground(canvas *image.RGBA, fl *types.FormatLayout) {
+	if fl.BackgroundGradient != nil && len(fl.BackgroundGradient.Stops) > 0 {
+		draw.Draw(canvas, canvas.Bounds(), newGradientImage(fl.BackgroundGradient, image.Point{}), image.Point{}, draw.Src)
+		return
+	}
+
+	background, ok := ParseColor(fl.BackgroundColor)
+	if !ok {
+		background = color.NRGBA{255, 255, 255, 255}
+	}
+	draw.Draw(canvas, canvas.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+}
+
+func elementScale(el types.Element) (float64, float64) {
+	sx, sy := el.ScaleX, el.ScaleY
+	if sx == 0 {
+		sx = 1
+	}
+	if sy == 0 {
+		sy = 1
+	}
+	return sx, sy
+}
+
+// shapeLayer draws a rect or circle with its fill and a stroke centred on
+// the outline, as fabric does.
+func (r *renderer) shapeLayer(el types.Element, w, h, rx, ry float64) (*layer, error) {
+	if w <= 0 || h <= 0 {
+		return nil, nil
+	}
+
+	stroke, has_stroke := ParseColor(el.Stroke)
+	sw := el.StrokeWidth
+	if !has_stroke || sw <= 0 {
+		sw = 0
+	}
+
+	const pad = 1.0
+	total_w, total_h := w+sw, h+sw
+	sx, sy := elementScale(el)
+	l := &layer{width: total_w, height: total_h, pad: pad, scale_x: sx, scale_y: sy}
+	bounds, err := r.clip(el, l, image.Rect(0, 0, pixels(total_w+2*pad), pixels(total_h+2*pad)))
+	if err != nil || bounds.Empty() {
+		return nil, err
+	}
+	img := image.NewRGBA(bounds)
+	l.img = img
+	size := bounds.Size()
+	// Paths are laid out in layer pixels and rasterized relative to the
+	// clipped bounds.
+	x, y := pad+sw/2, pad+sw/2
+	ox, oy := float64(bounds.Min.X), float64(bounds.Min.Y)
+
+	var fill image.Image
+	if el.Gradient != nil && len(el.Gradient.Stops) > 0 {
+		fill = newGradientImage(el.Gradient, image.Point{X: int(math.Round(x)), Y: int(math.Round(y))})
+	} else if c, ok := ParseColor(el.Fill); ok && c.A > 0 {
+		fill = image.NewUniform(c)
+	}
+
+	if fill != nil {
+		z := vector.NewRasterizer(size.X, size.Y)
+		roundedRectPath(z, x-ox, y-oy, w, h, rx, ry, false)
+		z.Draw(img, bounds, fill, bounds.Min)
+	}
+
+	if sw > 0 && stroke.A > 0 {
+		z := vector.NewRasterizer(size.X, size.Y)
+		roundedRectPath(z, pad-ox, pad-oy, total_w, total_h, rx+sw/2, ry+sw/2, false)
+		if w > sw && h > sw {
+			roundedRectPath(z, pad+sw-ox, pad+sw-oy, w-sw, h-sw, rx-sw/2, ry-sw/2, true)
+		}
+		z.Draw(img, bounds, image.NewUniform(stroke), bounds.Min)
+	}
+
+	return l, nil
+}
+
+func (r *renderer) textLayer(el types.Element) (*layer, error) {
+	size := fontSize(el)
+	t := measureText(el, size)
+	sx, sy := elementScale(el)
+	l := &layer{width: t.width, height: t.height, scale_x: sx, scale_y: sy}
+	bounds, err := r.clip(el, l, image.Rect(0, 0, pixels(t.width)+1, pixels(t.height)+1))
+	if err != nil || bounds.Empty() {
+		return nil, err
+	}
+	l.img = image.NewRGBA(bounds)
+	if err := drawText(l.img, el, size, t); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// clip is the part of a layer, in layer pixels within full, that can reach
+// the canvas, directly or through the element's shadow, with a margin for
+// filtering and the shadow's blur. It refuses layers whose visible part is
+// still larger than MAX_CANVAS_PIXELS.
+func (r *renderer) clip(el types.Element, l *layer, full image.Rectangle) (image.Rectangle, error) {
+	m := layerTransform(el, l, l.pad)
+	visible := inverseBounds(m, r.canvas)
+	margin := 2
+	if el.Shadow != nil {
+		offset := image.Pt(pixels(el.Shadow.OffsetX), pixels(el.Shadow.OffsetY))
+		visible = visible.Union(inverseBounds(m, r.canvas.Sub(offset)))
+		margin += shadowPad(el.Shadow)
+	}
+	if visible.Empty() {
+		return image.Rectangle{}, nil
+	}
+
+	visible = visible.Inset(-margin).Intersect(full)
+	if visible.Dx()*visible.Dy() > MAX_CANVAS_PIXELS {
+		return image.Rectangle{}, fmt.Errorf("element is too large to render (%dx%d visible pixels)", visible.Dx(), visible.Dy())
+	}
+	return visible, nil
+}
+
+// inverseBounds is the bounding box of the layer pixels m maps into
+// canvas. A transform that cannot be inverted maps nothing.
+func inverseBounds(m f64.Aff3, canvas image.Rectangle) image.Rectangle {
+	det := m[0]*m[4] - m[1]*m[3]
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return image.Rectangle{}
+	}
+
+	min_x, min_y := math.Inf(1), math.Inf(1)
+	max_x, max_y := math.Inf(-1), math.Inf(-1)
+	for _, p := range [4][2]float64{
+		{float64(canvas.Min.X), float64(canvas.Min.Y)},
+		{float64(canvas.Max.X), float64(canvas.Min.Y)},
+		{float64(canvas.Min.X), float64(canvas.Max.Y)},
+		{float64(canvas.Max.X), float64(canvas.Max.Y)},
+	} {
+		dx, dy := p[0]-m[2], p[1]-m[5]
+		x := (m[4]*dx - m[1]*dy) / det
+		y := (m[0]*dy - m[3]*dx) / det
+		min_x, max_x = math.Min(min_x, x), math.Max(max_x, x)
+		min_y, max_y = math.Min(min_y, y), math.Max(max_y, y)
+	}
+	return image.Rect(pixels(math.Floor(min_x)), pixels(math.Floor(min_y)), pixels(max_x), pixels(max_y))
+}
+
+// pixels rounds v up to whole pixels, saturating far beyond any canvas so
+// absurd sizes cannot overflow.
+func pixels(v float64) int {
+	const limit = 1 << 30
+	if math.IsNaN(v) {
+		return 0
+	}
+	return int(math.Max(math.Min(math.Ceil(v), limit), -limit))
+}
+
+// ImageSize is the size an image element is drawn at, from the image's
+// intrinsic size: the element width like fabric's scaleToWidth, falling
+// back to the height and then the intrinsic size. Only an image drawn at its
+// intrinsic size takes the element's scale as well.
+func ImageSize(el types.Element, intrinsic_width, intrinsic_height float64) (float64, float64) {
+	switch {
+	case el.Width > 0:
+		return el.Width, el.Width * intrinsic_height / intrinsic_width
+	case el.Height > 0:
+		return el.Height * intrinsic_width / intrinsic_height, el.Height
+	default:
+		return intrinsic_width, intrinsic_height
+	}
+}
+
+// SizeImages sets the width and height of every image in fl whose intrinsic
+// size is in sizes, by URL, to the size it is drawn at, so that the checks,
+// which never see the images, measure the boxes that are drawn. The scale of
+// an image drawn at its intrinsic size is folded into its width.
+func SizeImages(fl *types.FormatLayout, sizes map[string]image.Point) {
+	for i := range fl.Elements {
+		el := &fl.Elements[i]
+		size, ok := sizes[el.URL]
+		if el.Type != types.ElementImage || !ok || size.X <= 0 || size.Y <= 0 {
+			continue
+		}
+		if el.Width <= 0 && el.Height <= 0 {
+			sx, _ := elementScale(*el)
+			el.Width, el.ScaleX, el.ScaleY = float64(size.X)*sx, 0, 0
+		}
+		el.Width, el.Height = ImageSize(*el, float64(size.X), float64(size.Y))
+	}
+}
+
+// imageLayer scales an image to the size ImageSize gives it.
+func (r *renderer) imageLayer(ctx context.Context, el types.Element) (*layer, error) {
+	src, ok := r.images[el.URL]
+	if !ok {
+		var err error
+		src, err = r.opts.Fetcher.Fetch(ctx, el.URL)
+		if err != nil {
+			return nil, err
+		}
+		r.images[el.URL] = src
+	}
+
+	b := src.Bounds()
+	iw, ih := float64(b.Dx()), float64(b.Dy())
+	if iw == 0 || ih == 0 {
+		return nil, fmt.Errorf("image has no pixels")
+	}
+
+	w, h := ImageSize(el, iw, ih)
+	sx, sy := 1.0, 1.0
+	if el.Width <= 0 && el.Height <= 0 {
+		sx, sy = elementScale(el)
+	}
+	if w*h > MAX_CANVAS_PIXELS || w*h*sx*sy > MAX_CANVAS_PIXELS {
+		return nil, fmt.Errorf("image is too large to render")
+	}
+
+	img := scaleImage(src, int(math.Ceil(w)), int(math.Ceil(h)))
+
+	brightness, contrast, blur := el.Brightness, el.Contrast, el.Blur
+	for _, f := range el.Filters {
+		switch f.Type {
+		case "Brightness":
+			brightness += f.Brightness
+		case "Contrast":
+			contrast += f.Contrast
+		case "Blur":
+			blur = math.Max(blur, f.Blur)
+		}
+	}
+	// Fabric's blur runs from 0 to 1.
+	applyFilters(img, brightness, contrast, math.Min(math.Max(blur, 0), 1))
+
+	return &layer{img: img, width: w, height: h, scale_x: sx, scale_y: sy}, nil
+}
+
+// drawLayer composites a layer onto the canvas, shadow first, applying the
+// element's origin, scale, rotation and opacity.
+func drawLayer(canvas *image.RGBA, el types.Element, l *layer) {
+	opacity := 1.0
+	if el.Opacity != nil {
+		opacity = math.Min(math.Max(*el.Opacity, 0), 1)
+	}
+	if opacity == 0 {
+		return
+	}
+
+	if el.Shadow != nil {
+		if shadow := shadowLayer(l, el.Shadow); shadow != nil {
+			m := layerTransform(el, l, l.pad)
+			m[2] += el.Shadow.OffsetX
+			m[5] += el.Shadow.OffsetY
+			composite(canvas, shadow, m, opacity)
+		}
+	}
+
+	composite(canvas, l.img, layerTransform(el, l, l.pad), opacity)
+}
+
+// layerTransform maps layer pixels to canvas pixels: the origin point sits
+// at (left, top), the layer is scaled and then rotated about it.
+func layerTransform(el types.Element, l *layer, pad float64) f64.Aff3 {
+	ox := originOffset(el.OriginX, l.width)
+	oy := originOffset(el.OriginY, l.height)
+
+	rad := el.Angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	tx, ty := -pad-ox, -pad-oy
+
+	return f64.Aff3{
+		cos * l.scale_x, -sin * l.scale_y, el.Left + cos*l.scale_x*tx - sin*l.scale_y*ty,
+		sin * l.scale_x, cos * l.scale_y, el.Top + sin*l.scale_x*tx + cos*l.scale_y*ty,
+	}
+}
+
+func originOffset(origin string, size float64) float64 {
+	switch origin {
+	case "center":
+		return size / 2
+	case "right", "bottom":
+		return size
+	default:
+		return 0
+	}
+}
+
+// shadowLayer builds a blurred silhouette of the layer in the shadow color,
+// in the layer's pixels and padded so the blur is not clipped.
+func shadowLayer(l *layer, shadow *types.Shadow) *image.RGBA {
+	c, ok := ParseColor(shadow.Color)
+	if !ok {
+		c = color.NRGBA{0, 0, 0, 255}
+	}
+	if c.A == 0 {
+		return nil
+	}
+
+	pad := shadowPad(shadow)
+	b := l.img.Bounds()
+	img := image.NewRGBA(b.Inset(-pad))
+
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			a := uint32(l.img.Pix[y*l.img.Stride+x*4+3]) * uint32(c.A) / 255
+			if a == 0 {
+				continue
+			}
+			i := (y+pad)*img.Stride + (x+pad)*4
+			img.Pix[i] = uint8(uint32(c.R) * a / 255)
+			img.Pix[i+1] = uint8(uint32(c.G) * a / 255)
+			img.Pix[i+2] = uint8(uint32(c.B) * a / 255)
+			img.Pix[i+3] = uint8(a)
+		}
+	}
+
+	blurRGBA(img, shadowSigma(shadow))
+	return img
+}
+
+func shadowSigma(shadow *types.Shadow) float64 {
+	return math.Min(math.Max(shadow.Blur, 0), MAX_SHADOW_BLUR) / 2
+}
+
+// shadowPad is how far the blur spreads a shadow.
+func shadowPad(shadow *types.Shadow) int {
+	return int(math.Ceil(3 * shadowSigma(shadow)))
+}
+
+func composite(canvas *image.RGBA, src *image.RGBA, m f64.Aff3, opacity float64) {
+	opts := &draw.Options{}
+	if opacity < 1 {
+		opts.SrcMask = image.NewUniform(color.Alpha{A: uint8(opacity*255 + 0.5)})
+	}
+	draw.BiLinear.Transform(canvas, m, src, src.Bounds(), draw.Over, opts)
+}
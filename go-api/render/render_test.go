@@ -0,0 +1,141 @@
+package render
+
+import (
+	"canvas-backend/types"
+	"context"
+	"image/color"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// MAX_TEST_ALLOC bounds what rendering a small canvas may allocate, however
+// large its elements claim to be.
+const MAX_TEST_ALLOC = 256 << 20
+
+func rect(left, top, width, height float64, fill string) types.Element {
+	return types.Element{Type: types.ElementRect, Left: left, Top: top, Width: width, Height: height, Fill: fill}
+}
+
+func TestRender(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+
+	tests := []struct {
+		name     string
+		elements []types.Element
+		// pixels are sampled after rendering a 100x100 white canvas.
+		pixels map[[2]int]color.RGBA
+	}{
+		{
+			name:     "rect",
+			elements: []types.Element{rect(10, 10, 20, 20, "#ff0000")},
+			pixels:   map[[2]int]color.RGBA{{15, 15}: red, {5, 5}: white, {35, 35}: white},
+		},
+		{
+			name:     "rect mostly off the canvas",
+			elements: []types.Element{rect(-1000, -1000, 1010, 1010, "#ff0000")},
+			pixels:   map[[2]int]color.RGBA{{5, 5}: red, {15, 15}: white},
+		},
+		{
+			name:     "huge rect",
+			elements: []types.Element{rect(-20000, -20000, 40000, 40000, "#ff0000")},
+			pixels:   map[[2]int]color.RGBA{{0, 0}: red, {50, 50}: red, {99, 99}: red},
+		},
+		{
+			name:     "huge scaled rect",
+			elements: []types.Element{{Type: types.ElementRect, Left: 50 - 5e6, Top: 50 - 5e6, Width: 10, Height: 10, ScaleX: 1e6, ScaleY: 1e6, Fill: "#ff0000"}},
+			pixels:   map[[2]int]color.RGBA{{50, 50}: red},
+		},
+		{
+			name:     "huge centred circle",
+			elements: []types.Element{{Type: types.ElementCircle, Left: 50, Top: 50, OriginX: "center", OriginY: "center", Radius: 30000, Fill: "#ff0000"}},
+			pixels:   map[[2]int]color.RGBA{{0, 0}: red, {99, 99}: red},
+		},
+		{
+			name:     "rect off the canvas",
+			elements: []types.Element{rect(500, 500, 20000, 20000, "#ff0000")},
+			pixels:   map[[2]int]color.RGBA{{50, 50}: white, {99, 99}: white},
+		},
+		{
+			name: "huge shadow blur",
+			elements: []types.Element{{
+				Type: types.ElementRect, Left: 40, Top: 40, Width: 20, Height: 20, Fill: "#ff0000",
+				Shadow: &types.Shadow{Color: "#000000", Blur: 20000},
+			}},
+			pixels: map[[2]int]color.RGBA{{50, 50}: red},
+		},
+		{
+			name: "shadow of an element off the canvas",
+			elements: []types.Element{{
+				Type: types.ElementRect, Left: -200, Top: 10, Width: 100, Height: 20, Fill: "#ff0000",
+				Shadow: &types.Shadow{Color: "#000000", OffsetX: 250},
+			}},
+			pixels: map[[2]int]color.RGBA{{75, 20}: {0, 0, 0, 255}, {20, 50}: white},
+		},
+		{
+			name:     "huge font size",
+			elements: []types.Element{{Type: types.ElementText, Content: strings.Repeat("W", 50), FontSize: 20000, Fill: "#ff0000"}},
+		},
+		{
+			name:     "huge text far off the canvas",
+			elements: []types.Element{{Type: types.ElementText, Left: 1e9, Top: 1e9, Content: "Hello", FontSize: 20000}},
+			pixels:   map[[2]int]color.RGBA{{50, 50}: white},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fl := &types.FormatLayout{Width: 100, Height: 100, BackgroundColor: "#ffffff", Elements: tt.elements}
+
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			img, err := Render(context.Background(), fl, Options{})
+			runtime.ReadMemStats(&after)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if allocated := after.TotalAlloc - before.TotalAlloc; allocated > MAX_TEST_ALLOC {
+				t.Errorf("Render() allocated %d MB", allocated>>20)
+			}
+
+			for at, want := range tt.pixels {
+				if got := img.RGBAAt(at[0], at[1]); got != want {
+					t.Errorf("pixel %v = %v, want %v", at, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderRefusesLargeCanvases(t *testing.T) {
+	for _, size := range [][2]float64{{0, 100}, {100, -1}, {5000, 5000}, {1e300, 1e300}, {1 << 32, 1 << 32}} {
+		fl := &types.FormatLayout{Width: size[0], Height: size[1]}
+		if _, err := Render(context.Background(), fl, Options{}); err == nil {
+			t.Errorf("Render() of a %vx%v canvas succeeded", size[0], size[1])
+		}
+	}
+}
+
+func TestRenderWatermark(t *testing.T) {
+	fl := &types.FormatLayout{Width: 400, Height: 400, BackgroundColor: "#ffffff"}
+
+	clean, err := Render(context.Background(), fl, Options{})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	marked, err := Render(context.Background(), fl, Options{Watermark: PREVIEW_WATERMARK})
+	if err != nil {
+		t.Fatalf("Render() with a watermark error = %v", err)
+	}
+
+	changed := 0
+	for i := range clean.Pix {
+		if clean.Pix[i] != marked.Pix[i] {
+			changed++
+		}
+	}
+	if changed == 0 {
+		t.Error("the watermark drew nothing")
+	}
+}
@@ -0,0 +1,112 @@
+package render
+
+import (
+	"canvas-backend/textmetrics"
+	"canvas-backend/types"
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// newFace is the embedded font for the element's family, weight and style.
+func newFace(el types.Element, size float64) (font.Face, error) {
+	return opentype.NewFace(textmetrics.Font(textmetrics.ElementStyle(el)), &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingNone,
+	})
+}
+
+type textLayout struct {
+	lines       []string
+	widths      []float64
+	width       float64
+	height      float64
+	line_height float64
+	spacing     float64
+}
+
+func measureText(el types.Element, size float64) textLayout {
+	style := textmetrics.ElementStyle(el)
+	style.Size = size
+	box := textmetrics.Measure(el.Content, style)
+	return textLayout{
+		lines:       box.Lines,
+		widths:      box.LineWidths,
+		width:       box.Width,
+		height:      box.Height,
+		line_height: box.LineHeight,
+		spacing:     style.CharSpacing * size / 1000,
+	}
+}
+
+// fontSize is the size a text element is drawn at, clamped to
+// MAX_FONT_SIZE.
+func fontSize(el types.Element) float64 {
+	size := el.FontSize
+	if size <= 0 {
+		size = 40
+	}
+	return math.Min(size, MAX_FONT_SIZE)
+}
+
+// drawText draws the measured text of an element into layer. Glyphs outside
+// the layer's bounds, which may be clipped, are skipped.
+func drawText(layer *image.RGBA, el types.Element, size float64, t textLayout) error {
+	face, err := newFace(el, size)
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	fill := el.Fill
+	if fill == "" {
+		fill = el.Color
+	}
+	c, ok := ParseColor(fill)
+	if !ok {
+		c = color.NRGBA{0x33, 0x33, 0x33, 255}
+	}
+	src := image.NewUniform(c)
+
+	metrics := face.Metrics()
+	ascent := float64(metrics.Ascent) / 64
+	descent := float64(metrics.Descent) / 64
+	bounds := layer.Bounds()
+
+	for i, line := range t.lines {
+		x := 0.0
+		switch el.TextAlign {
+		case "center":
+			x = (t.width - t.widths[i]) / 2
+		case "right":
+			x = t.width - t.widths[i]
+		}
+		baseline := float64(i)*t.line_height + (t.line_height-(ascent+descent))/2 + ascent
+		if baseline+descent < float64(bounds.Min.Y) || baseline-ascent > float64(bounds.Max.Y) {
+			continue
+		}
+
+		d := font.Drawer{Dst: layer, Src: src, Face: face}
+		prev := rune(-1)
+		for _, r := range line {
+			if prev >= 0 {
+				x += float64(face.Kern(prev, r)) / 64
+			}
+			// Glyphs may overhang their advance, by less than the size.
+			advance, _ := face.GlyphAdvance(r)
+			if x+float64(advance)/64+size >= float64(bounds.Min.X) && x-size <= float64(bounds.Max.X) {
+				d.Dot = fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(baseline * 64)}
+				d.DrawString(string(r))
+			}
+			x += float64(advance)/64 + t.spacing
+			prev = r
+		}
+	}
+
+	return nil
+}
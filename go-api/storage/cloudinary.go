@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	"github.com/cloudinary/cloudinary-go/v2"
+	"github.com/cloudinary/cloudinary-go/v2/api/uploader"
+)
+
+type CloudinaryStore struct {
+	Cld *cloudinary.Cloudinary
+}
+
+func NewCloudinaryStore(cld *cloudinary.Cloudinary) *CloudinaryStore {
+	return &CloudinaryStore{Cld: cld}
+}
+
+func (c *CloudinaryStore) Name() string {
+	return "cloudinary"
+}
+
+func (c *CloudinaryStore) Put(ctx context.Context, data io.Reader, opts PutOptions) (*Asset, error) {
+	return c.upload(ctx, data, opts)
+}
+
+// PutURL hands the source straight to Cloudinary, which fetches remote and
+// data URLs itself.
+func (c *CloudinaryStore) PutURL(ctx context.Context, source string, opts PutOptions) (*Asset, error) {
+	return c.upload(ctx, source, opts)
+}
+
+func (c *CloudinaryStore) upload(ctx context.Context, file any, opts PutOptions) (*Asset, error) {
+	params := uploader.UploadParams{
+		PublicID: opts.Name,
+		Format:   opts.Format,
+	}
+	if opts.RemoveBackground {
+		params.Transformation = "e_background_removal/e_trim"
+	}
+
+	resp, err := c.Cld.Upload.Upload(ctx, file, params)
+	if err != nil {
+		return nil, err
+	}
+	return &Asset{Key: resp.PublicID, URL: resp.SecureURL}, nil
+}
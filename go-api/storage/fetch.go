@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Images with more pixels than this are refused before they are decoded, so
+// that a small compressed file cannot expand into gigabytes of pixels.
+const MAX_IMAGE_PIXELS = 40_000_000
+
+const MAX_REDIRECTS = 5
+
+// Ranges that are not reachable on the public internet, beyond those netip
+// classifies itself.
+var reserved_prefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+var (
+	trusted_mu      sync.RWMutex
+	trusted_origins = map[string]bool{}
+)
+
+// TrustOrigin lets sources on base_url's origin be fetched even though it
+// is not public, as the local asset store's is.
+func TrustOrigin(base_url string) {
+	parsed, err := url.Parse(base_url)
+	if err != nil || parsed.Host == "" {
+		return
+	}
+	trusted_mu.Lock()
+	defer trusted_mu.Unlock()
+	trusted_origins[parsed.Scheme+"://"+parsed.Host] = true
+}
+
+func trusted(source *url.URL) bool {
+	trusted_mu.RLock()
+	defer trusted_mu.RUnlock()
+	return trusted_origins[source.Scheme+"://"+source.Host]
+}
+
+// public_client only connects to public addresses. The check is made on the
+// address actually dialled, so redirects and DNS rebinding cannot reach the
+// internal network or a cloud metadata endpoint.
+var public_client = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second, Control: dialPublic}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: checkRedirect,
+}
+
+// trusted_client connects anywhere, so it only follows redirects that stay
+// on trusted origins.
+var trusted_client = &http.Client{
+	Timeout: 30 * time.Second,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if !trusted(req.URL) {
+			return fmt.Errorf("refusing to follow a redirect off the trusted origin")
+		}
+		return checkRedirect(req, via)
+	},
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= MAX_REDIRECTS {
+		return fmt.Errorf("stopped after %d redirects", MAX_REDIRECTS)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("unsupported redirect url")
+	}
+	return nil
+}
+
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublicAddr(ip) {
+		return fmt.Errorf("refusing to connect to the non-public address %s", ip)
+	}
+	return nil
+}
+
+// IsPublicAddr reports whether ip is reachable on the public internet.
+func IsPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reserved_prefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// OpenSource returns the bytes behind a data URL or an http(s) URL on a
+// public host or a trusted origin, refusing more than MAX_ASSET_BYTES.
+func OpenSource(ctx context.Context, source string) ([]byte, error) {
+	if strings.HasPrefix(source, "data:") {
+		meta, payload, ok := strings.Cut(source[len("data:"):], ",")
+		if !ok {
+			return nil, fmt.Errorf("malformed data url")
+		}
+		if strings.HasSuffix(meta, ";base64") {
+			if base64.StdEncoding.DecodedLen(len(payload)) > MAX_ASSET_BYTES {
+				return nil, fmt.Errorf("asset is larger than %d bytes", MAX_ASSET_BYTES)
+			}
+			return base64.StdEncoding.DecodeString(payload)
+		}
+		if len(payload) > 3*MAX_ASSET_BYTES {
+			return nil, fmt.Errorf("asset is larger than %d bytes", MAX_ASSET_BYTES)
+		}
+		decoded, err := url.PathUnescape(payload)
+		if len(decoded) > MAX_ASSET_BYTES {
+			return nil, fmt.Errorf("asset is larger than %d bytes", MAX_ASSET_BYTES)
+		}
+		return []byte(decoded), err
+	}
+
+	parsed, err := url.Parse(source)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("unsupported source url")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := public_client
+	if trusted(parsed) {
+		client = trusted_client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download the source, error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download the source, status: %s", resp.Status)
+	}
+	return readLimited(resp.Body)
+}
+
+// DecodeImage decodes data after checking from its header that it is not
+// too large to hold in memory.
+func DecodeImage(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the image, error: %v", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("image has no pixels")
+	}
+	if int64(config.Width)*int64(config.Height) > MAX_IMAGE_PIXELS {
+		return nil, fmt.Errorf("image is %dx%d, larger than %d pixels", config.Width, config.Height, MAX_IMAGE_PIXELS)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the image, error: %v", err)
+	}
+	return img, nil
+}
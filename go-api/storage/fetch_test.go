@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"1.1.1.1", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a9fe:a9fe", false},
+		{"2001:db8::1", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestDialPublic(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"8.8.8.8:443", true},
+		{"[2606:4700:4700::1111]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"169.254.169.254:80", false},
+		{"localhost:80", false},
+		{"8.8.8.8", false},
+	}
+
+	for _, tt := range tests {
+		err := dialPublic("tcp", tt.address, nil)
+		if (err == nil) != tt.allowed {
+			t.Errorf("dialPublic(%s) error = %v, want allowed %v", tt.address, err, tt.allowed)
+		}
+	}
+}
+
+func TestOpenSource(t *testing.T) {
+	content := []byte("image bytes")
+	serve := func(w http.ResponseWriter, r *http.Request) { w.Write(content) }
+
+	private := httptest.NewServer(http.HandlerFunc(serve))
+	defer private.Close()
+	trusted_server := httptest.NewServer(http.HandlerFunc(serve))
+	defer trusted_server.Close()
+	TrustOrigin(trusted_server.URL)
+	redirect := httptest.NewServer(http.RedirectHandler(private.URL, http.StatusFound))
+	defer redirect.Close()
+	TrustOrigin(redirect.URL)
+
+	tests := []struct {
+		name   string
+		source string
+		want   []byte
+	}{
+		{name: "base64 data url", source: "data:image/png;base64,aW1hZ2UgYnl0ZXM=", want: content},
+		{name: "percent-encoded data url", source: "data:text/plain,image%20bytes", want: content},
+		{name: "malformed data url", source: "data:image/png;base64"},
+		{name: "unsupported scheme", source: "file:///etc/passwd"},
+		{name: "private host", source: private.URL},
+		{name: "metadata endpoint", source: "http://169.254.169.254/latest/meta-data/"},
+		{name: "trusted origin", source: trusted_server.URL + "/image.png", want: content},
+		{name: "redirect off the trusted origin", source: redirect.URL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := OpenSource(context.Background(), tt.source)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("OpenSource(%s) = %q, want an error", tt.source, data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenSource(%s) error = %v", tt.source, err)
+			}
+			if !bytes.Equal(data, tt.want) {
+				t.Errorf("OpenSource(%s) = %q, want %q", tt.source, data, tt.want)
+			}
+		})
+	}
+}
+
+// pngOfSize encodes a 1x1 PNG whose header claims width x height pixels.
+func pngOfSize(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// The IHDR chunk follows the 8 byte signature: length, type, data, crc.
+	ihdr := data[8+8 : 8+8+13]
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	binary.BigEndian.PutUint32(data[8+8+13:], crc32.ChecksumIEEE(data[8+4:8+8+13]))
+	return data
+}
+
+func TestDecodeImage(t *testing.T) {
+	if _, err := DecodeImage(pngOfSize(t, 1, 1)); err != nil {
+		t.Errorf("DecodeImage() of a small image error = %v", err)
+	}
+	if _, err := DecodeImage(pngOfSize(t, 100_000, 100_000)); err == nil {
+		t.Error("DecodeImage() accepted an image larger than MAX_IMAGE_PIXELS")
+	}
+	if _, err := DecodeImage([]byte("not an image")); err == nil {
+		t.Error("DecodeImage() accepted data that is not an image")
+	}
+}
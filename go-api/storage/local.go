@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Keys are the sha256 of the stored bytes plus an extension, sharded by the
+// first two hex characters: "ab/abcdef....png".
+var localKeyPattern = regexp.MustCompile(`^[0-9a-f]{2}/[0-9a-f]{64}\.[a-z0-9]+$`)
+
+var extensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+}
+
+// LocalStore keeps assets on disk under Root with content-addressed keys and
+// serves them itself under /assets/. BaseURL is the public origin of the API.
+type LocalStore struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStore(root, base_url string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create the asset directory, error: %v", err)
+	}
+	// Assets are served by the API itself, which may be on a private host.
+	TrustOrigin(base_url)
+	return &LocalStore{Root: root, BaseURL: strings.TrimSuffix(base_url, "/")}, nil
+}
+
+func (l *LocalStore) Name() string {
+	return "local"
+}
+
+// Put stores the bytes as they are, except that images are converted when
+// a different format is requested. Background removal is not available
+// locally and is ignored.
+func (l *LocalStore) Put(ctx context.Context, data io.Reader, opts PutOptions) (*Asset, error) {
+	content, err := readLimited(data)
+	if err != nil {
+		return nil, err
+	}
+	return l.write(content, opts)
+}
+
+func (l *LocalStore) PutURL(ctx context.Context, source string, opts PutOptions) (*Asset, error) {
+	content, err := OpenSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	return l.write(content, opts)
+}
+
+func (l *LocalStore) write(content []byte, opts PutOptions) (*Asset, error) {
+	if len(content) == 0 {
+		return nil, fmt.Errorf("asset is empty")
+	}
+
+	content_type := detectContentType(content)
+	if opts.Format == "png" && content_type != "image/png" {
+		img, err := DecodeImage(content)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		content, content_type = buf.Bytes(), "image/png"
+	}
+
+	ext, ok := extensions[content_type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported asset type %s", content_type)
+	}
+
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	key := digest[:2] + "/" + digest + ext
+	full_path := filepath.Join(l.Root, filepath.FromSlash(key))
+
+	// Identical content always lands on the same key.
+	if _, err := os.Stat(full_path); err == nil {
+		return &Asset{Key: key, URL: l.url(key)}, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(full_path), 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(full_path), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), full_path); err != nil {
+		return nil, err
+	}
+
+	return &Asset{Key: key, URL: l.url(key)}, nil
+}
+
+func (l *LocalStore) url(key string) string {
+	return l.BaseURL + "/assets/" + key
+}
+
+// ServeHTTP serves stored assets. Keys never change content, so they are
+// cached for as long as browsers allow.
+func (l *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(path.Clean(r.URL.Path), "/assets/")
+	if !localKeyPattern.MatchString(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(filepath.Join(l.Root, filepath.FromSlash(key)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if path.Ext(key) == ".svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	}
+	http.ServeContent(w, r, key, info.ModTime(), file)
+}
+
+func detectContentType(content []byte) string {
+	content_type := http.DetectContentType(content)
+	if content_type == "text/xml; charset=utf-8" || strings.HasPrefix(content_type, "text/plain") {
+		if bytes.Contains(content[:min(len(content), 1024)], []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	}
+	return content_type
+}
@@ -0,0 +1,46 @@
+// Package storage keeps uploaded and exported images behind a single
+// interface so the API can run against Cloudinary or the local disk.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// Uploads larger than this are refused.
+const MAX_ASSET_BYTES = 25 << 20
+
+// PutOptions describe how an asset should be stored. Backends that cannot
+// apply a transformation store the original bytes.
+type PutOptions struct {
+	Name             string
+	Format           string
+	RemoveBackground bool
+}
+
+type Asset struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+type AssetStore interface {
+	// Put stores the bytes read from data.
+	Put(ctx context.Context, data io.Reader, opts PutOptions) (*Asset, error)
+	// PutURL stores the image at an http(s) or data URL.
+	PutURL(ctx context.Context, source string, opts PutOptions) (*Asset, error)
+	Name() string
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, MAX_ASSET_BYTES+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > MAX_ASSET_BYTES {
+		return nil, fmt.Errorf("asset is larger than %d bytes", MAX_ASSET_BYTES)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,102 @@
+// Command fetchfonts downloads the OFL families of textmetrics.FAMILIES
+// that are not in textmetrics/fonts yet, with their licenses. It is run by
+// go generate in the textmetrics package; files already present are kept.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FONTSOURCE_URL serves the static instances of Google Fonts families as
+// <id>@latest/<subset>-<weight>-<style>.ttf. Only the latin subset is
+// fetched, which covers the copy layouts carry.
+const FONTSOURCE_URL = "https://cdn.jsdelivr.net/fontsource/fonts/"
+
+// LICENSE_URL serves the OFL text that ships with each family's package.
+const LICENSE_URL = "https://cdn.jsdelivr.net/npm/@fontsource/%s/LICENSE"
+
+type family struct {
+	id     string
+	prefix string
+	// faces maps the face names textmetrics reads to fontsource files.
+	faces map[string]string
+}
+
+var FAMILIES = []family{
+	{
+		id:     "oswald",
+		prefix: "Oswald",
+		faces: map[string]string{
+			"Regular": "latin-400-normal.ttf",
+			"Bold":    "latin-700-normal.ttf",
+		},
+	},
+	{
+		id:     "playfair-display",
+		prefix: "PlayfairDisplay",
+		faces: map[string]string{
+			"Regular":    "latin-400-normal.ttf",
+			"Bold":       "latin-700-normal.ttf",
+			"Italic":     "latin-400-italic.ttf",
+			"BoldItalic": "latin-700-italic.ttf",
+		},
+	},
+}
+
+var client = &http.Client{Timeout: time.Minute}
+
+func main() {
+	dir := "fonts"
+	if len(os.Args) > 1 {
+		dir = os.Args[1]
+	}
+
+	for _, f := range FAMILIES {
+		for face, file := range f.faces {
+			url := FONTSOURCE_URL + f.id + "@latest/" + file
+			if err := download(url, filepath.Join(dir, f.prefix+"-"+face+".ttf")); err != nil {
+				log.Fatalf("ERROR: Unable to fetch %s %s, error: %v\n", f.prefix, face, err)
+			}
+		}
+		if err := download(fmt.Sprintf(LICENSE_URL, f.id), filepath.Join(dir, "LICENSE-"+f.prefix)); err != nil {
+			log.Fatalf("ERROR: Unable to fetch the %s license, error: %v\n", f.prefix, err)
+		}
+	}
+}
+
+// download writes url to path unless path exists.
+func download(url, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".fetch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	log.Printf("INFO: Fetched %s\n", filepath.Base(path))
+	return os.Rename(tmp.Name(), path)
+}
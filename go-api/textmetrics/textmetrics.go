@@ -0,0 +1,272 @@
+// Package textmetrics measures text the way it is set on the canvas, with
+// the fonts layouts are allowed to use embedded in the server.
+package textmetrics
+
+import (
+	"canvas-backend/types"
+	"embed"
+	"fmt"
+	"io/fs"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Fabric's default IText line height and font size.
+const (
+	DEFAULT_LINE_HEIGHT = 1.16
+	DEFAULT_FONT_SIZE   = 40
+)
+
+// DEFAULT_FAMILY is used for families that are not embedded. Its files are
+// Liberation Sans, which has the same metrics as Arial.
+const DEFAULT_FAMILY = "arial"
+
+// FAMILIES maps the font families layouts may use to the prefix of their
+// files in fonts/, which are named <prefix>-<Regular|Bold|Italic|BoldItalic>.ttf.
+var FAMILIES = map[string]string{
+	"oswald":           "Oswald",
+	"playfair display": "PlayfairDisplay",
+	"roboto":           "Roboto",
+	"arial":            "LiberationSans",
+}
+
+// Weights at or above this are set in the bold face.
+const BOLD_WEIGHT = 600
+
+var variants = [2][2]string{{"Regular", "Italic"}, {"Bold", "BoldItalic"}}
+
+// REQUIRED_FACES must be embedded for every family. Italics are optional,
+// since fabric slants the upright face when they are missing.
+var REQUIRED_FACES = []string{"Regular", "Bold"}
+
+//go:generate go run ./fetchfonts fonts
+
+//go:embed fonts
+var font_files embed.FS
+
+var embedded = map[string]*opentype.Font{}
+
+func init() {
+	names, err := fs.Glob(font_files, "fonts/*.ttf")
+	if err != nil {
+		panic(err)
+	}
+	for _, name := range names {
+		data, err := font_files.ReadFile(name)
+		if err != nil {
+			panic(err)
+		}
+		f, err := opentype.Parse(data)
+		if err != nil {
+			panic(err)
+		}
+		embedded[strings.TrimSuffix(path.Base(name), ".ttf")] = f
+	}
+	// Every other family falls back to the default one, so it must exist.
+	for _, face := range REQUIRED_FACES {
+		if _, ok := embedded[FAMILIES[DEFAULT_FAMILY]+"-"+face]; !ok {
+			panic(fmt.Sprintf("textmetrics: the default family has no %s face", face))
+		}
+	}
+}
+
+// Check reports the faces of FAMILIES that are not embedded. Text set in a
+// family without its files would be measured and drawn in the default
+// family, so the server refuses to start rather than lay out with the wrong
+// metrics.
+func Check() error {
+	var missing []string
+	for _, prefix := range FAMILIES {
+		for _, face := range REQUIRED_FACES {
+			if _, ok := embedded[prefix+"-"+face]; !ok {
+				missing = append(missing, prefix+"-"+face+".ttf")
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing embedded fonts %s; run go generate ./textmetrics and rebuild", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Style is how a text is set.
+type Style struct {
+	Family string
+	Size   float64
+	Weight int
+	Italic bool
+	// LineHeight is a multiple of Size; 0 is fabric's default.
+	LineHeight float64
+	// CharSpacing is in thousandths of an em, as in fabric.
+	CharSpacing float64
+}
+
+// ElementStyle is the style a text element is set in, with fabric's
+// defaults filled in.
+func ElementStyle(el types.Element) Style {
+	style := Style{
+		Family:      el.FontFamily,
+		Size:        el.FontSize,
+		Weight:      el.FontWeight.Numeric(),
+		Italic:      strings.EqualFold(el.FontStyle, "italic") || strings.EqualFold(el.FontStyle, "oblique"),
+		LineHeight:  el.LineHeight,
+		CharSpacing: el.CharSpacing,
+	}
+	if style.Size == 0 {
+		style.Size = DEFAULT_FONT_SIZE
+	}
+	if style.LineHeight == 0 {
+		style.LineHeight = DEFAULT_LINE_HEIGHT
+	}
+	return style
+}
+
+// Font is the embedded font for style. A missing italic falls back to the
+// upright face, since fabric slants those itself. Unknown families, and
+// families whose files are missing, which Check reports, are set in the
+// default family.
+func Font(style Style) *opentype.Font {
+	family := strings.ToLower(strings.Trim(strings.TrimSpace(strings.Split(style.Family, ",")[0]), `"'`))
+	prefix, ok := FAMILIES[family]
+	if !ok {
+		prefix = FAMILIES[DEFAULT_FAMILY]
+	}
+
+	bold, italic := 0, 0
+	if style.Weight >= BOLD_WEIGHT {
+		bold = 1
+	}
+	if style.Italic {
+		italic = 1
+	}
+	if f, ok := embedded[prefix+"-"+variants[bold][italic]]; ok {
+		return f
+	}
+	if f, ok := embedded[prefix+"-"+variants[bold][0]]; ok {
+		return f
+	}
+	return embedded[FAMILIES[DEFAULT_FAMILY]+"-"+variants[bold][0]]
+}
+
+// Box is a measured block of text. Each line is LineHeight tall.
+type Box struct {
+	Lines      []string
+	LineWidths []float64
+	Width      float64
+	Height     float64
+	LineHeight float64
+}
+
+// Measure sets text as given, one line per newline.
+func Measure(text string, style Style) Box {
+	m := newMeasurer(style)
+	box := Box{LineHeight: style.Size * lineHeight(style)}
+	for _, line := range strings.Split(text, "\n") {
+		box.add(line, m.width(line))
+	}
+	return box
+}
+
+// Wrap sets text in lines no wider than width, breaking between words. A
+// word wider than width is given a line of its own.
+func Wrap(text string, style Style, width float64) Box {
+	m := newMeasurer(style)
+	box := Box{LineHeight: style.Size * lineHeight(style)}
+	for _, paragraph := range strings.Split(text, "\n") {
+		line, line_width := "", 0.0
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			candidate_width := m.width(candidate)
+			if line != "" && candidate_width > width {
+				box.add(line, line_width)
+				candidate, candidate_width = word, m.width(word)
+			}
+			line, line_width = candidate, candidate_width
+		}
+		box.add(line, line_width)
+	}
+	return box
+}
+
+// Fit wraps text to width at the largest whole size, from style.Size down
+// to min_size, that takes at most max_lines lines, returning that size. It
+// reports false, with the text set at min_size, when no size fits.
+func Fit(text string, style Style, width float64, max_lines int, min_size float64) (Box, float64, bool) {
+	for size := math.Floor(style.Size); size > min_size; size-- {
+		style.Size = size
+		box := Wrap(text, style, width)
+		if len(box.Lines) <= max_lines && box.Width <= width {
+			return box, size, true
+		}
+	}
+	style.Size = min_size
+	box := Wrap(text, style, width)
+	return box, min_size, len(box.Lines) <= max_lines && box.Width <= width
+}
+
+func (b *Box) add(line string, width float64) {
+	b.Lines = append(b.Lines, line)
+	b.LineWidths = append(b.LineWidths, width)
+	b.Width = math.Max(b.Width, width)
+	b.Height += b.LineHeight
+}
+
+func lineHeight(style Style) float64 {
+	if style.LineHeight == 0 {
+		return DEFAULT_LINE_HEIGHT
+	}
+	return style.LineHeight
+}
+
+// measurer reads advances and kerning from a font at one size. It is not
+// safe for concurrent use.
+type measurer struct {
+	font    *sfnt.Font
+	buf     sfnt.Buffer
+	ppem    fixed.Int26_6
+	spacing float64
+}
+
+func newMeasurer(style Style) *measurer {
+	return &measurer{
+		font:    Font(style),
+		ppem:    fixed.Int26_6(style.Size * 64),
+		spacing: style.CharSpacing * style.Size / 1000,
+	}
+}
+
+// width is the advance of line with kerning and character spacing, as
+// the renderer draws it.
+func (m *measurer) width(line string) float64 {
+	width := fixed.Int26_6(0)
+	prev := sfnt.GlyphIndex(0)
+	n := 0
+	for _, r := range line {
+		glyph, err := m.font.GlyphIndex(&m.buf, r)
+		if err != nil {
+			glyph = 0
+		}
+		if n > 0 {
+			if kern, err := m.font.Kern(&m.buf, prev, glyph, m.ppem, font.HintingNone); err == nil {
+				width += kern
+			}
+		}
+		if advance, err := m.font.GlyphAdvance(&m.buf, glyph, m.ppem, font.HintingNone); err == nil {
+			width += advance
+		}
+		prev = glyph
+		n++
+	}
+	return float64(width)/64 + float64(n)*m.spacing
+}
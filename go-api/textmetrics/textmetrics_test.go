@@ -0,0 +1,150 @@
+package textmetrics
+
+import (
+	"canvas-backend/types"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/opentype"
+)
+
+// TestCheck fails while an allowed family has no files, as the server
+// would refuse to start.
+func TestCheck(t *testing.T) {
+	if err := Check(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFont(t *testing.T) {
+	regular := embedded["LiberationSans-Regular"]
+	bold := embedded["LiberationSans-Bold"]
+	roboto := embedded["Roboto-Regular"]
+
+	tests := []struct {
+		name  string
+		style Style
+		want  *opentype.Font
+	}{
+		{name: "family is matched in any case", style: Style{Family: "ROBOTO"}, want: roboto},
+		{name: "first family of a list", style: Style{Family: `"Roboto", sans-serif`}, want: roboto},
+		{name: "bold weight", style: Style{Family: "Arial", Weight: 700}, want: bold},
+		{name: "semibold is set bold", style: Style{Family: "Arial", Weight: BOLD_WEIGHT}, want: bold},
+		{name: "medium is set regular", style: Style{Family: "Arial", Weight: 500}, want: regular},
+		{name: "unknown family falls back", style: Style{Family: "Comic Sans MS"}, want: regular},
+		{name: "empty family falls back", style: Style{}, want: regular},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Font(tt.style); got != tt.want {
+				t.Errorf("Font(%+v) is not the expected face", tt.style)
+			}
+		})
+	}
+}
+
+func TestElementStyle(t *testing.T) {
+	style := ElementStyle(types.Element{FontFamily: "Roboto", FontWeight: "bold", FontStyle: "Italic"})
+	want := Style{Family: "Roboto", Size: DEFAULT_FONT_SIZE, Weight: 700, Italic: true, LineHeight: DEFAULT_LINE_HEIGHT}
+	if style != want {
+		t.Errorf("ElementStyle() = %+v, want %+v", style, want)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	style := Style{Family: "Roboto", Size: 40}
+
+	one := Measure("Hello", style)
+	if len(one.Lines) != 1 || one.Width <= 0 {
+		t.Fatalf("Measure() = %+v, want one line with a width", one)
+	}
+	if got, want := one.Height, 40*DEFAULT_LINE_HEIGHT; got != want {
+		t.Errorf("Measure() height = %v, want %v", got, want)
+	}
+
+	two := Measure("Hello\nHello", style)
+	if len(two.Lines) != 2 || two.Width != one.Width || two.Height != 2*one.Height {
+		t.Errorf("Measure() of two lines = %+v, want two lines of %+v", two, one)
+	}
+
+	larger := Measure("Hello", Style{Family: "Roboto", Size: 80})
+	if larger.Width <= one.Width {
+		t.Errorf("Measure() at twice the size is %v wide, not wider than %v", larger.Width, one.Width)
+	}
+
+	spaced := Measure("Hello", Style{Family: "Roboto", Size: 40, CharSpacing: 200})
+	if spaced.Width <= one.Width {
+		t.Errorf("Measure() with character spacing is %v wide, not wider than %v", spaced.Width, one.Width)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	style := Style{Family: "Roboto", Size: 40}
+	word := Measure("Everyday", style).Width
+
+	tests := []struct {
+		name  string
+		text  string
+		width float64
+		lines []string
+	}{
+		{name: "fits on one line", text: "Low prices", width: 1000, lines: []string{"Low prices"}},
+		{name: "breaks between words", text: "Everyday Everyday Everyday", width: word * 2.5, lines: []string{"Everyday Everyday", "Everyday"}},
+		{name: "long word gets its own line", text: "a Everyday b", width: word / 2, lines: []string{"a", "Everyday", "b"}},
+		{name: "keeps newlines", text: "Low\nprices", width: 1000, lines: []string{"Low", "prices"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box := Wrap(tt.text, style, tt.width)
+			if strings.Join(box.Lines, "|") != strings.Join(tt.lines, "|") {
+				t.Errorf("Wrap() lines = %q, want %q", box.Lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestFit(t *testing.T) {
+	style := Style{Family: "Roboto", Size: 72}
+	text := "Low everyday prices on the things you buy every week"
+
+	tests := []struct {
+		name      string
+		width     float64
+		max_lines int
+		fits      bool
+	}{
+		{name: "fits at full size", width: 4000, max_lines: 1, fits: true},
+		{name: "shrinks to fit", width: 900, max_lines: 2, fits: true},
+		{name: "never fits", width: 50, max_lines: 1, fits: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box, size, fits := Fit(text, style, tt.width, tt.max_lines, 20)
+			if fits != tt.fits {
+				t.Fatalf("Fit() fits = %v, want %v", fits, tt.fits)
+			}
+			if size > style.Size || size < 20 {
+				t.Errorf("Fit() size %v is outside 20..%v", size, style.Size)
+			}
+			if !tt.fits {
+				if size != 20 {
+					t.Errorf("Fit() size = %v, want the minimum when nothing fits", size)
+				}
+				return
+			}
+			if len(box.Lines) > tt.max_lines || box.Width > tt.width {
+				t.Errorf("Fit() box %v wide in %d lines, want at most %v in %d", box.Width, len(box.Lines), tt.width, tt.max_lines)
+			}
+			// The next size up must not fit, or Fit gave up too early.
+			if size < style.Size {
+				larger := Wrap(text, Style{Family: "Roboto", Size: size + 1}, tt.width)
+				if len(larger.Lines) <= tt.max_lines && larger.Width <= tt.width {
+					t.Errorf("Fit() chose %v, but %v fits too", size, size+1)
+				}
+			}
+		})
+	}
+}
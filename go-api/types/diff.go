@@ -0,0 +1,160 @@
+package types
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+)
+
+const (
+	ChangeAdded     = "added"
+	ChangeRemoved   = "removed"
+	ChangeModified  = "modified"
+	ChangeReordered = "reordered"
+)
+
+// LayoutChange is one difference between two layouts. Format-level changes
+// have no element id; field-level changes name the JSON field that changed.
+type LayoutChange struct {
+	Format    string `json:"format"`
+	ElementID string `json:"element_id,omitempty"`
+	Field     string `json:"field,omitempty"`
+	Op        string `json:"op"`
+	From      any    `json:"from,omitempty"`
+	To        any    `json:"to,omitempty"`
+}
+
+// DiffLayouts lists what changed from one layout to another. Elements are
+// matched by id, so both layouts should be stored versions, whose ids were
+// given by AssignElementIDs and carried over by the client.
+func DiffLayouts(from, to Layout) []LayoutChange {
+	changes := []LayoutChange{}
+
+	formats := map[string]bool{}
+	for format := range from {
+		formats[format] = true
+	}
+	for format := range to {
+		formats[format] = true
+	}
+	ordered := make([]string, 0, len(formats))
+	for format := range formats {
+		ordered = append(ordered, format)
+	}
+	sort.Strings(ordered)
+
+	for _, format := range ordered {
+		before, after := from[format], to[format]
+		switch {
+		case before == nil && after == nil:
+		case before == nil:
+			changes = append(changes, LayoutChange{Format: format, Op: ChangeAdded, To: after})
+		case after == nil:
+			changes = append(changes, LayoutChange{Format: format, Op: ChangeRemoved, From: before})
+		default:
+			changes = append(changes, diffFormat(format, before, after)...)
+		}
+	}
+	return changes
+}
+
+func diffFormat(format string, before, after *FormatLayout) []LayoutChange {
+	var changes []LayoutChange
+
+	// The canvas itself, without its elements.
+	before_canvas, after_canvas := *before, *after
+	before_canvas.Elements, after_canvas.Elements = nil, nil
+	for _, field := range diffFields(before_canvas, after_canvas) {
+		field.Format = format
+		changes = append(changes, field)
+	}
+
+	before_elements := map[string]Element{}
+	for _, el := range before.Elements {
+		before_elements[el.ID] = el
+	}
+	after_elements := map[string]Element{}
+	for _, el := range after.Elements {
+		after_elements[el.ID] = el
+	}
+
+	for _, el := range before.Elements {
+		if _, kept := after_elements[el.ID]; !kept {
+			changes = append(changes, LayoutChange{Format: format, ElementID: el.ID, Op: ChangeRemoved, From: el})
+		}
+	}
+	for _, el := range after.Elements {
+		previous, kept := before_elements[el.ID]
+		if !kept {
+			changes = append(changes, LayoutChange{Format: format, ElementID: el.ID, Op: ChangeAdded, To: el})
+			continue
+		}
+		for _, field := range diffFields(previous, el) {
+			field.Format = format
+			field.ElementID = el.ID
+			changes = append(changes, field)
+		}
+	}
+
+	// Stacking order only matters among the elements both sides share.
+	before_order, after_order := []string{}, []string{}
+	for _, el := range before.Elements {
+		if _, kept := after_elements[el.ID]; kept {
+			before_order = append(before_order, el.ID)
+		}
+	}
+	for _, el := range after.Elements {
+		if _, kept := before_elements[el.ID]; kept {
+			after_order = append(after_order, el.ID)
+		}
+	}
+	if !reflect.DeepEqual(before_order, after_order) {
+		changes = append(changes, LayoutChange{Format: format, Field: "elements", Op: ChangeReordered, From: before_order, To: after_order})
+	}
+
+	return changes
+}
+
+// diffFields compares two values field by field through their JSON form, so
+// the reported names are the ones clients see.
+func diffFields(before, after any) []LayoutChange {
+	before_fields, after_fields := jsonObject(before), jsonObject(after)
+
+	names := map[string]bool{}
+	for name := range before_fields {
+		names[name] = true
+	}
+	for name := range after_fields {
+		names[name] = true
+	}
+	ordered := make([]string, 0, len(names))
+	for name := range names {
+		ordered = append(ordered, name)
+	}
+	sort.Strings(ordered)
+
+	var changes []LayoutChange
+	for _, name := range ordered {
+		old_value, had := before_fields[name]
+		new_value, has := after_fields[name]
+		switch {
+		case !had:
+			changes = append(changes, LayoutChange{Field: name, Op: ChangeAdded, To: new_value})
+		case !has:
+			changes = append(changes, LayoutChange{Field: name, Op: ChangeRemoved, From: old_value})
+		case !reflect.DeepEqual(old_value, new_value):
+			changes = append(changes, LayoutChange{Field: name, Op: ChangeModified, From: old_value, To: new_value})
+		}
+	}
+	return changes
+}
+
+func jsonObject(value any) map[string]any {
+	fields := map[string]any{}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(data, &fields)
+	return fields
+}
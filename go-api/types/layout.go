@@ -0,0 +1,492 @@
+package types
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	ElementRect   = "rect"
+	ElementCircle = "circle"
+	ElementText   = "text"
+	ElementImage  = "image"
+)
+
+// Roles mark the text elements that carry the creative's copy. The copy
+// rules apply to these alone, not to price tiles, pills or other text.
+const (
+	RoleHeadline = "headline"
+	RoleSubhead  = "subhead"
+)
+
+// Layout is the document produced by the layout generator, keyed by format
+// ("instagram_story", "instagram_post", "facebook_ad").
+type Layout map[string]*FormatLayout
+
+type FormatLayout struct {
+	Width              float64   `json:"width"`
+	Height             float64   `json:"height"`
+	BackgroundColor    string    `json:"backgroundColor,omitempty"`
+	BackgroundGradient *Gradient `json:"backgroundGradient,omitempty"`
+	Texture            *Texture  `json:"texture,omitempty"`
+	Elements           []Element `json:"elements"`
+}
+
+type Element struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type" enum:"rect,circle,text,image"`
+	Role string `json:"role,omitempty" enum:"headline,subhead"`
+
+	Top     float64  `json:"top"`
+	Left    float64  `json:"left"`
+	Width   float64  `json:"width,omitempty"`
+	Height  float64  `json:"height,omitempty"`
+	OriginX string   `json:"originX,omitempty" enum:"left,center,right"`
+	OriginY string   `json:"originY,omitempty" enum:"top,center,bottom"`
+	Angle   float64  `json:"angle,omitempty"`
+	ScaleX  float64  `json:"scaleX,omitempty"`
+	ScaleY  float64  `json:"scaleY,omitempty"`
+	SkewX   float64  `json:"skewX,omitempty"`
+	SkewY   float64  `json:"skewY,omitempty"`
+	Opacity *float64 `json:"opacity,omitempty"`
+
+	Fill        string    `json:"fill,omitempty"`
+	Gradient    *Gradient `json:"gradient,omitempty"`
+	Stroke      string    `json:"stroke,omitempty"`
+	StrokeWidth float64   `json:"strokeWidth,omitempty"`
+	Rx          float64   `json:"rx,omitempty"`
+	Ry          float64   `json:"ry,omitempty"`
+	Radius      float64   `json:"radius,omitempty"`
+	Shadow      *Shadow   `json:"shadow,omitempty"`
+	Glow        *Glow     `json:"glow,omitempty"`
+	BlendMode   string    `json:"blendMode,omitempty"`
+	Selectable  *bool     `json:"selectable,omitempty"`
+
+	Content     string     `json:"content,omitempty"`
+	FontSize    float64    `json:"fontSize,omitempty"`
+	FontFamily  string     `json:"fontFamily,omitempty"`
+	FontWeight  FontWeight `json:"fontWeight,omitempty"`
+	FontStyle   string     `json:"fontStyle,omitempty"`
+	TextAlign   string     `json:"textAlign,omitempty"`
+	LineHeight  float64    `json:"lineHeight,omitempty"`
+	CharSpacing float64    `json:"charSpacing,omitempty"`
+	Color       string     `json:"color,omitempty"` // legacy alias of fill for text
+
+	URL        string  `json:"url,omitempty"`
+	Filters    Filters `json:"filters,omitempty"`
+	Blur       float64 `json:"blur,omitempty"`       // 0.0 to 1.0
+	Brightness float64 `json:"brightness,omitempty"` // -1.0 to 1.0
+	Contrast   float64 `json:"contrast,omitempty"`   // -1.0 to 1.0
+}
+
+type Gradient struct {
+	Type   string         `json:"type" enum:"linear,radial"`
+	Coords GradientCoords `json:"coords"`
+	Stops  []GradientStop `json:"stops"`
+}
+
+type GradientCoords struct {
+	X1 float64 `json:"x1"`
+	Y1 float64 `json:"y1"`
+	X2 float64 `json:"x2"`
+	Y2 float64 `json:"y2"`
+	R1 float64 `json:"r1,omitempty"`
+	R2 float64 `json:"r2,omitempty"`
+}
+
+type GradientStop struct {
+	Offset float64 `json:"offset"`
+	Color  string  `json:"color"`
+}
+
+type Shadow struct {
+	Color   string  `json:"color,omitempty"`
+	Blur    float64 `json:"blur,omitempty"`
+	OffsetX float64 `json:"offsetX,omitempty"`
+	OffsetY float64 `json:"offsetY,omitempty"`
+}
+
+type Glow struct {
+	Color string  `json:"color,omitempty"`
+	Blur  float64 `json:"blur,omitempty"`
+}
+
+type Texture struct {
+	URL       string  `json:"url"`
+	Opacity   float64 `json:"opacity,omitempty"`
+	BlendMode string  `json:"blendMode,omitempty"`
+}
+
+type Filter struct {
+	Type       string  `json:"type" enum:"Blur,Brightness,Contrast"`
+	Blur       float64 `json:"blur,omitempty"`
+	Brightness float64 `json:"brightness,omitempty"`
+	Contrast   float64 `json:"contrast,omitempty"`
+}
+
+// Filters accepts both the fabric array form ([{"type":"Blur","blur":0.5}])
+// and the shorthand object form ({"blur":0.5,"contrast":0.1}).
+type Filters []Filter
+
+func (f *Filters) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var short struct {
+			Blur       *float64 `json:"blur"`
+			Brightness *float64 `json:"brightness"`
+			Contrast   *float64 `json:"contrast"`
+		}
+		if err := json.Unmarshal(data, &short); err != nil {
+			return err
+		}
+		*f = nil
+		if short.Blur != nil {
+			*f = append(*f, Filter{Type: "Blur", Blur: *short.Blur})
+		}
+		if short.Brightness != nil {
+			*f = append(*f, Filter{Type: "Brightness", Brightness: *short.Brightness})
+		}
+		if short.Contrast != nil {
+			*f = append(*f, Filter{Type: "Contrast", Contrast: *short.Contrast})
+		}
+		return nil
+	}
+
+	var list []Filter
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*f = list
+	return nil
+}
+
+// FontWeight accepts either a keyword ("bold") or a numeric weight (700).
+type FontWeight string
+
+func (fw *FontWeight) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*fw = FontWeight(s)
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("fontWeight must be a string or a number")
+	}
+	*fw = FontWeight(n.String())
+	return nil
+}
+
+func (fw FontWeight) MarshalJSON() ([]byte, error) {
+	if _, err := strconv.Atoi(string(fw)); err == nil {
+		return []byte(fw), nil
+	}
+	return json.Marshal(string(fw))
+}
+
+// Numeric returns the CSS numeric weight (400 normal, 700 bold).
+func (fw FontWeight) Numeric() int {
+	if n, err := strconv.Atoi(string(fw)); err == nil {
+		return n
+	}
+	switch strings.ToLower(string(fw)) {
+	case "bold", "bolder":
+		return 700
+	case "lighter":
+		return 300
+	default:
+		return 400
+	}
+}
+
+// UnknownField is a JSON key that is not part of the layout model.
+type UnknownField struct {
+	Path string `json:"path"`
+}
+
+// LayoutProblem is a single structural error found while decoding a layout.
+type LayoutProblem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+type LayoutDecodeError struct {
+	Problems []LayoutProblem
+}
+
+func (e *LayoutDecodeError) Error() string {
+	messages := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		messages = append(messages, fmt.Sprintf("%s: %s", p.Path, p.Message))
+	}
+	return "invalid layout: " + strings.Join(messages, "; ")
+}
+
+// Details is what a failed generation reports besides its message, so
+// clients can point at the offending paths.
+func (e *LayoutDecodeError) Details() any {
+	return ErrorDetails{Problems: e.Problems}
+}
+
+type ErrorDetails struct {
+	Problems []LayoutProblem `json:"problems,omitempty"`
+}
+
+// DecodeLayout strictly decodes a layout document. Type mismatches and
+// structural problems fail the decode with a *LayoutDecodeError; keys that
+// are not part of the model are returned as unknown fields.
+func DecodeLayout(data []byte) (Layout, []UnknownField, error) {
+	var layout Layout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		path := "$"
+		var type_err *json.UnmarshalTypeError
+		if errors.As(err, &type_err) && type_err.Field != "" {
+			path = type_err.Field
+		}
+		return nil, nil, &LayoutDecodeError{Problems: []LayoutProblem{{Path: path, Message: err.Error()}}}
+	}
+
+	if problems := layout.Problems(); len(problems) > 0 {
+		return nil, nil, &LayoutDecodeError{Problems: problems}
+	}
+
+	var unknown []UnknownField
+	collectUnknownFields(data, reflect.TypeOf(layout), "", &unknown)
+
+	return layout, unknown, nil
+}
+
+// Problems reports structural errors: missing formats, non-positive canvas
+// sizes, unknown element types and elements without their required content.
+func (l Layout) Problems() []LayoutProblem {
+	var problems []LayoutProblem
+	if len(l) == 0 {
+		problems = append(problems, LayoutProblem{Path: "$", Message: "layout has no formats"})
+	}
+
+	for _, format := range l.Formats() {
+		fl := l[format]
+		if fl == nil {
+			problems = append(problems, LayoutProblem{Path: format, Message: "format must be an object"})
+			continue
+		}
+		problems = append(problems, fl.problems(format)...)
+	}
+	return problems
+}
+
+func (fl *FormatLayout) problems(path string) []LayoutProblem {
+	var problems []LayoutProblem
+	if fl.Width <= 0 {
+		problems = append(problems, LayoutProblem{Path: path + ".width", Message: "must be greater than 0"})
+	}
+	if fl.Height <= 0 {
+		problems = append(problems, LayoutProblem{Path: path + ".height", Message: "must be greater than 0"})
+	}
+
+	for i, el := range fl.Elements {
+		el_path := fmt.Sprintf("%s.elements[%d]", path, i)
+		switch el.Type {
+		case ElementRect, ElementCircle:
+		case ElementText:
+			if el.Content == "" {
+				problems = append(problems, LayoutProblem{Path: el_path + ".content", Message: "text element has no content"})
+			}
+		case ElementImage:
+			if el.URL == "" {
+				problems = append(problems, LayoutProblem{Path: el_path + ".url", Message: "image element has no url"})
+			}
+		default:
+			problems = append(problems, LayoutProblem{Path: el_path + ".type", Message: fmt.Sprintf("unknown element type %q", el.Type)})
+		}
+	}
+	return problems
+}
+
+// Formats returns the format keys in a stable order.
+func (l Layout) Formats() []string {
+	formats := make([]string, 0, len(l))
+	for format := range l {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// EnsureElementIDs gives every element without an id one derived from its
+// format and index, so that violations and repairs can refer to it. These
+// ids only hold within one layout; stored versions get theirs from
+// AssignElementIDs.
+func (l Layout) EnsureElementIDs() {
+	for format, fl := range l {
+		if fl == nil {
+			continue
+		}
+		for i := range fl.Elements {
+			if fl.Elements[i].ID == "" {
+				fl.Elements[i].ID = fmt.Sprintf("%s-%d", format, i)
+			}
+		}
+	}
+}
+
+// AssignElementIDs gives every element of a layout document that has no
+// id, or repeats one already used in its format, a new random id. The
+// document is otherwise kept as sent, including properties the layout model
+// does not know, so ids survive from version to version as long as clients
+// send back the ones they were given. data must already have passed
+// DecodeLayout.
+func AssignElementIDs(data []byte) ([]byte, error) {
+	var formats map[string]json.RawMessage
+	if err := json.Unmarshal(data, &formats); err != nil {
+		return nil, err
+	}
+	for _, format := range sortedKeys(formats) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(formats[format], &fields); err != nil {
+			return nil, err
+		}
+		if fields == nil {
+			continue
+		}
+		elements_key := foldedKey(fields, "elements")
+		var elements []map[string]json.RawMessage
+		if err := json.Unmarshal(fields[elements_key], &elements); err != nil {
+			return nil, err
+		}
+		if elements == nil {
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, el := range elements {
+			if el == nil {
+				continue
+			}
+			id_key := foldedKey(el, "id")
+			var id string
+			if raw, ok := el[id_key]; ok {
+				json.Unmarshal(raw, &id)
+			}
+			if id == "" || seen[id] {
+				delete(el, id_key)
+				id = newElementID()
+				el["id"], _ = json.Marshal(id)
+			}
+			seen[id] = true
+		}
+
+		var err error
+		if fields[elements_key], err = json.Marshal(elements); err != nil {
+			return nil, err
+		}
+		if formats[format], err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(formats)
+}
+
+// foldedKey returns the key of fields that encoding/json would decode into
+// a field named name, or name itself when there is none.
+func foldedKey(fields map[string]json.RawMessage, name string) string {
+	if _, ok := fields[name]; ok {
+		return name
+	}
+	for _, key := range sortedKeys(fields) {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+func newElementID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return "el-" + hex.EncodeToString(id)
+}
+
+func collectUnknownFields(data []byte, t reflect.Type, path string, out *[]UnknownField) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Map:
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) != nil {
+			return
+		}
+		for _, key := range sortedKeys(fields) {
+			collectUnknownFields(fields[key], t.Elem(), joinPath(path, key), out)
+		}
+
+	case reflect.Slice:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return
+		}
+		for i, item := range items {
+			collectUnknownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), out)
+		}
+
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(data, &fields) != nil {
+			return
+		}
+		known := jsonFields(t)
+		for _, key := range sortedKeys(fields) {
+			field, ok := known[strings.ToLower(key)]
+			if !ok {
+				*out = append(*out, UnknownField{Path: joinPath(path, key)})
+				continue
+			}
+			collectUnknownFields(fields[key], field.Type, joinPath(path, key), out)
+		}
+	}
+}
+
+// jsonFields maps lower-cased json names to struct fields, mirroring the
+// case-insensitive matching done by encoding/json.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field
+	}
+	return fields
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,249 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		problems []string
+		unknown  []string
+	}{
+		{
+			name:     "valid",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"rect","left":0,"top":0,"width":10,"height":10}]}}`,
+		},
+		{
+			name:     "numeric font weight and filter object",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"text","content":"Hi","fontWeight":700,"filters":{"blur":0.2}}]}}`,
+		},
+		{
+			name:     "unknown field",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"rect","left":0,"top":0,"shine":1}]}}`,
+			unknown:  []string{"post.elements[0].shine"},
+		},
+		{
+			name:     "type mismatch",
+			document: `{"post":{"width":"wide","height":1080}}`,
+			problems: []string{"post.width"},
+		},
+		{
+			name:     "text without content",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"text","left":0,"top":0}]}}`,
+			problems: []string{"post.elements[0].content"},
+		},
+		{
+			name:     "image without url",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"image","left":0,"top":0}]}}`,
+			problems: []string{"post.elements[0].url"},
+		},
+		{
+			name:     "unknown element type",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"star","left":0,"top":0}]}}`,
+			problems: []string{"post.elements[0].type"},
+		},
+		{
+			name:     "empty canvas",
+			document: `{"post":{"width":0,"height":0}}`,
+			problems: []string{"post.width", "post.height"},
+		},
+		{
+			name:     "null format",
+			document: `{"post":null}`,
+			problems: []string{"post"},
+		},
+		{
+			name:     "no formats",
+			document: `{}`,
+			problems: []string{"$"},
+		},
+		{
+			name:     "not an object",
+			document: `[1]`,
+			problems: []string{"$"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layout, unknown, err := DecodeLayout([]byte(tt.document))
+
+			if len(tt.problems) > 0 {
+				var decode_err *LayoutDecodeError
+				if !errors.As(err, &decode_err) {
+					t.Fatalf("DecodeLayout() error = %v, want a *LayoutDecodeError", err)
+				}
+				var paths []string
+				for _, problem := range decode_err.Problems {
+					paths = append(paths, problem.Path)
+				}
+				if !reflect.DeepEqual(paths, tt.problems) {
+					t.Errorf("problem paths = %v, want %v", paths, tt.problems)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("DecodeLayout() error = %v", err)
+			}
+			if layout == nil {
+				t.Fatal("DecodeLayout() returned no layout")
+			}
+			var paths []string
+			for _, field := range unknown {
+				paths = append(paths, field.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.unknown) {
+				t.Errorf("unknown fields = %v, want %v", paths, tt.unknown)
+			}
+		})
+	}
+}
+
+func TestDecodeLayoutRoundTrip(t *testing.T) {
+	document := `{"post":{"width":1080,"height":1080,"elements":[{"id":"a","type":"text","content":"Hi","fontSize":40,"left":10,"top":20,"shadow":{"color":"#000000","blur":4,"offsetX":1,"offsetY":2}}]}}`
+
+	layout, _, err := DecodeLayout([]byte(document))
+	if err != nil {
+		t.Fatalf("DecodeLayout() error = %v", err)
+	}
+	encoded, err := json.Marshal(layout)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	again, unknown, err := DecodeLayout(encoded)
+	if err != nil {
+		t.Fatalf("DecodeLayout() of the encoded layout error = %v", err)
+	}
+	if len(unknown) > 0 {
+		t.Errorf("encoded layout has unknown fields %v", unknown)
+	}
+	if !reflect.DeepEqual(layout, again) {
+		t.Errorf("layout changed on a round trip:\n%s", encoded)
+	}
+}
+
+func TestAssignElementIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		// elements of a single "post" format
+		elements string
+		// kept lists the ids that must survive; fresh is how many new ids
+		// must be given.
+		kept  []string
+		fresh int
+	}{
+		{name: "keeps ids", elements: `[{"id":"a","type":"rect"},{"id":"b","type":"rect"}]`, kept: []string{"a", "b"}},
+		{name: "gives missing ids", elements: `[{"id":"a","type":"rect"},{"type":"rect"}]`, kept: []string{"a"}, fresh: 1},
+		{name: "replaces empty ids", elements: `[{"id":"","type":"rect"}]`, fresh: 1},
+		{name: "replaces repeated ids", elements: `[{"id":"a","type":"rect"},{"id":"a","type":"rect"}]`, kept: []string{"a"}, fresh: 1},
+		{name: "reads ids in any case", elements: `[{"ID":"a","type":"rect"}]`, kept: []string{"a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := `{"post":{"width":100,"height":100,"elements":` + tt.elements + `}}`
+			assigned, err := AssignElementIDs([]byte(document))
+			if err != nil {
+				t.Fatalf("AssignElementIDs() error = %v", err)
+			}
+
+			var result map[string]struct {
+				Elements []map[string]any `json:"elements"`
+			}
+			if err := json.Unmarshal(assigned, &result); err != nil {
+				t.Fatalf("AssignElementIDs() returned invalid JSON: %v", err)
+			}
+
+			seen := map[string]bool{}
+			kept, fresh := []string{}, 0
+			for _, el := range result["post"].Elements {
+				var id string
+				for key, value := range el {
+					if strings.EqualFold(key, "id") {
+						id, _ = value.(string)
+					}
+				}
+				if id == "" || seen[id] {
+					t.Fatalf("element has a missing or repeated id %q: %s", id, assigned)
+				}
+				seen[id] = true
+				if strings.HasPrefix(id, "el-") {
+					fresh++
+				} else {
+					kept = append(kept, id)
+				}
+			}
+			if !reflect.DeepEqual(kept, append([]string{}, tt.kept...)) || fresh != tt.fresh {
+				t.Errorf("kept %v and gave %d new ids, want %v and %d", kept, fresh, tt.kept, tt.fresh)
+			}
+		})
+	}
+}
+
+func TestAssignElementIDsKeepsUnknownProperties(t *testing.T) {
+	document := `{"post":{"width":100,"height":100,"elements":[{"type":"rect","paintFirst":"stroke","shadow":{"blur":3,"nonScaling":true}}]}}`
+
+	assigned, err := AssignElementIDs([]byte(document))
+	if err != nil {
+		t.Fatalf("AssignElementIDs() error = %v", err)
+	}
+	for _, property := range []string{`"paintFirst":"stroke"`, `"nonScaling":true`} {
+		if !strings.Contains(string(assigned), property) {
+			t.Errorf("AssignElementIDs() dropped %s: %s", property, assigned)
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := LayoutSchema([]string{"post"})
+
+	tests := []struct {
+		name     string
+		document string
+		problems []string
+	}{
+		{
+			name:     "valid",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"text","top":0,"left":0,"content":"Hi","fontWeight":700}]}}`,
+		},
+		{
+			name:     "missing format",
+			document: `{}`,
+			problems: []string{"post"},
+		},
+		{
+			name:     "wrong kind",
+			document: `{"post":{"width":"wide","height":1080,"elements":[]}}`,
+			problems: []string{"post.width"},
+		},
+		{
+			name:     "not in enum",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"star","top":0,"left":0}]}}`,
+			problems: []string{"post.elements[0].type"},
+		},
+		{
+			name:     "missing required field",
+			document: `{"post":{"width":1080,"height":1080,"elements":[{"type":"rect","left":0}]}}`,
+			problems: []string{"post.elements[0].top"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var paths []string
+			for _, problem := range schema.Validate([]byte(tt.document)) {
+				paths = append(paths, problem.Path)
+			}
+			if !reflect.DeepEqual(paths, tt.problems) {
+				t.Errorf("problem paths = %v, want %v", paths, tt.problems)
+			}
+		})
+	}
+}
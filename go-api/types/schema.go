@@ -0,0 +1,216 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+const (
+	SCHEMA_OBJECT  = "object"
+	SCHEMA_ARRAY   = "array"
+	SCHEMA_STRING  = "string"
+	SCHEMA_NUMBER  = "number"
+	SCHEMA_BOOLEAN = "boolean"
+)
+
+// Schema is the subset of the OpenAPI schema object that describes the
+// layout model, for providers that constrain their output to a schema and
+// for checking what comes back.
+type Schema struct {
+	Type       string             `json:"type"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Enum       []string           `json:"enum,omitempty"`
+	// Order lists Properties in the order the model declares them.
+	Order []string `json:"-"`
+	// Also lists other shapes the decoder accepts, such as numeric font
+	// weights. Models are only asked for the main shape.
+	Also []*Schema `json:"-"`
+}
+
+// LayoutSchema describes a layout of exactly formats, derived from the
+// json and enum tags of the layout model.
+func LayoutSchema(formats []string) *Schema {
+	format := schemaFor(reflect.TypeOf(FormatLayout{}))
+	schema := &Schema{Type: SCHEMA_OBJECT, Properties: map[string]*Schema{}, Required: formats, Order: formats}
+	for _, id := range formats {
+		schema.Properties[id] = format
+	}
+	return schema
+}
+
+func schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(FontWeight("")):
+		return &Schema{Type: SCHEMA_STRING, Also: []*Schema{{Type: SCHEMA_NUMBER}}}
+	case reflect.TypeOf(Filters{}):
+		return &Schema{
+			Type:  SCHEMA_ARRAY,
+			Items: schemaFor(reflect.TypeOf(Filter{})),
+			Also: []*Schema{{Type: SCHEMA_OBJECT, Properties: map[string]*Schema{
+				"blur":       {Type: SCHEMA_NUMBER},
+				"brightness": {Type: SCHEMA_NUMBER},
+				"contrast":   {Type: SCHEMA_NUMBER},
+			}}},
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: SCHEMA_STRING}
+	case reflect.Bool:
+		return &Schema{Type: SCHEMA_BOOLEAN}
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return &Schema{Type: SCHEMA_NUMBER}
+	case reflect.Slice:
+		return &Schema{Type: SCHEMA_ARRAY, Items: schemaFor(t.Elem())}
+	case reflect.Struct:
+		schema := &Schema{Type: SCHEMA_OBJECT, Properties: map[string]*Schema{}}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			property := schemaFor(field.Type)
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property.Enum = strings.Split(enum, ",")
+			}
+			schema.Properties[name] = property
+			schema.Order = append(schema.Order, name)
+			if !strings.Contains(options, "omitempty") {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+		return schema
+	}
+	panic(fmt.Sprintf("no schema for %s", t))
+}
+
+// Validate checks a JSON document against the schema and reports every
+// problem with its path. Unknown keys are left to DecodeLayout, which
+// reports them as unknown fields, and null is accepted for any present key,
+// as encoding/json accepts it.
+func (s *Schema) Validate(data []byte) []LayoutProblem {
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return []LayoutProblem{{Path: "$", Message: err.Error()}}
+	}
+	return s.validate(document, "")
+}
+
+func (s *Schema) validate(value any, path string) []LayoutProblem {
+	problems := s.check(value, path)
+	if len(problems) == 0 {
+		return nil
+	}
+	for _, alternative := range s.Also {
+		if len(alternative.check(value, path)) == 0 {
+			return nil
+		}
+	}
+	return problems
+}
+
+func (s *Schema) check(value any, path string) []LayoutProblem {
+	if value == nil {
+		return nil
+	}
+	problem_path := path
+	if problem_path == "" {
+		problem_path = "$"
+	}
+	mismatch := []LayoutProblem{{Path: problem_path, Message: fmt.Sprintf("must be %s, got %s", kindName(s.Type), jsonKind(value))}}
+
+	switch s.Type {
+	case SCHEMA_OBJECT:
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return mismatch
+		}
+		present := make(map[string]string, len(fields))
+		for key := range fields {
+			present[strings.ToLower(key)] = key
+		}
+		var problems []LayoutProblem
+		for _, name := range s.Required {
+			if _, ok := present[strings.ToLower(name)]; !ok {
+				problems = append(problems, LayoutProblem{Path: joinPath(path, name), Message: "is required"})
+			}
+		}
+		for _, name := range s.Order {
+			if key, ok := present[strings.ToLower(name)]; ok {
+				problems = append(problems, s.Properties[name].validate(fields[key], joinPath(path, key))...)
+			}
+		}
+		return problems
+
+	case SCHEMA_ARRAY:
+		items, ok := value.([]any)
+		if !ok {
+			return mismatch
+		}
+		var problems []LayoutProblem
+		for i, item := range items {
+			problems = append(problems, s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+
+	case SCHEMA_STRING:
+		str, ok := value.(string)
+		if !ok {
+			return mismatch
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return []LayoutProblem{{Path: problem_path, Message: fmt.Sprintf("must be one of %s, got %q", strings.Join(s.Enum, ", "), str)}}
+		}
+
+	case SCHEMA_NUMBER:
+		if _, ok := value.(float64); !ok {
+			return mismatch
+		}
+
+	case SCHEMA_BOOLEAN:
+		if _, ok := value.(bool); !ok {
+			return mismatch
+		}
+	}
+	return nil
+}
+
+func kindName(kind string) string {
+	switch kind {
+	case SCHEMA_OBJECT, SCHEMA_ARRAY:
+		return "an " + kind
+	default:
+		return "a " + kind
+	}
+}
+
+func jsonKind(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return kindName(SCHEMA_OBJECT)
+	case []any:
+		return kindName(SCHEMA_ARRAY)
+	case string:
+		return kindName(SCHEMA_STRING)
+	case float64:
+		return kindName(SCHEMA_NUMBER)
+	case bool:
+		return kindName(SCHEMA_BOOLEAN)
+	default:
+		return "null"
+	}
+}
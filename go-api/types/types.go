@@ -3,6 +3,9 @@ package types
 import (
 	"canvas-backend/internal/db"
 	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 type APIResponse struct {
@@ -31,17 +34,124 @@ type BrandKitRequest struct {
 	RulesText  string          `json:"rules_text"`
 }
 
+// BrandKitUpdateRequest replaces every editable field of a kit. UpdatedAt
+// may be sent instead of an If-Match header.
+type BrandKitUpdateRequest struct {
+	Name       string             `json:"name"`
+	ColorsJson json.RawMessage    `json:"colors_json"`
+	LogoURL    string             `json:"logo_url"`
+	RulesText  string             `json:"rules_text"`
+	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
+}
+
+// BrandKitPatchRequest changes only the fields that are present. An empty
+// string clears rules_text or logo_url, and a null colors_json clears it.
+type BrandKitPatchRequest struct {
+	Name       *string            `json:"name"`
+	ColorsJson json.RawMessage    `json:"colors_json"`
+	LogoURL    *string            `json:"logo_url"`
+	RulesText  *string            `json:"rules_text"`
+	UpdatedAt  pgtype.Timestamptz `json:"updated_at"`
+}
+
+const (
+	IMAGE_ROLE_HERO      = "hero"
+	IMAGE_ROLE_SECONDARY = "secondary"
+	IMAGE_ROLE_LIFESTYLE = "lifestyle"
+)
+
+func ValidImageRole(role string) bool {
+	return role == IMAGE_ROLE_HERO || role == IMAGE_ROLE_SECONDARY || role == IMAGE_ROLE_LIFESTYLE
+}
+
+type ProductImageRequest struct {
+	ImageURL  string `json:"image_url"`
+	ImageName string `json:"image_name"`
+	Role      string `json:"role"`
+}
+
+type ProductImagePatch struct {
+	ID        pgtype.UUID `json:"id"`
+	ImageName *string     `json:"image_name"`
+	Role      *string     `json:"role"`
+}
+
+// ProductImagesPatchRequest renames and re-roles images, and reorders them
+// when Order lists every image id of the kit.
+type ProductImagesPatchRequest struct {
+	Images []ProductImagePatch `json:"images"`
+	Order  []pgtype.UUID       `json:"order"`
+}
+
+// ExportRequest renders the signed-off version of a design and uploads the
+// image. Only approved or published designs can be exported. Format can be
+// left out when the design has a single format.
 type ExportRequest struct {
-	URL string `json:"url"`
+	DesignID pgtype.UUID `json:"design_id"`
+	Format   string      `json:"format"`
+	Output   string      `json:"output"` // "png" or "jpeg"
+	Quality  int         `json:"quality"`
 }
 
 type ExportResponse struct {
 	URL string `json:"url"`
 }
 
+// DesignExportEvent is what the audit log keeps of an export.
+type DesignExportEvent struct {
+	Version int32  `json:"version"`
+	Status  string `json:"status"`
+	Format  string `json:"format"`
+	URL     string `json:"url"`
+}
+
+// GenerateLayoutRequest asks for a generation. Everything is optional: the
+// kit's rules cover whatever the request leaves out, and the default formats
+// are generated when it names none. Format is shorthand for one format.
 type GenerateLayoutRequest struct {
-	Prompt string `json:"prompt"`
-	Format string `json:"format"`
+	// Prompt is free-text creative direction for this run.
+	Prompt    string         `json:"prompt,omitempty"`
+	Format    string         `json:"format,omitempty"`
+	Formats   []string       `json:"formats,omitempty"`
+	Headline  *string        `json:"headline,omitempty"`
+	Subhead   *string        `json:"subhead,omitempty"`
+	ValueTile *ValueTileInfo `json:"value_tile,omitempty"`
+	// Variants is how many candidate layouts to generate and rank.
+	Variants int `json:"variants,omitempty"`
+}
+
+// GenerateLayoutResponse echoes the request it was generated for, with its
+// formats spelled out. Layout is the best scoring candidate; when several
+// were asked for, Variants lists them all, best first.
+type GenerateLayoutResponse struct {
+	Layout     Layout                `json:"layout"`
+	Repairs    any                   `json:"repairs"`
+	Violations any                   `json:"violations"`
+	Score      any                   `json:"score"`
+	Variants   []LayoutVariant       `json:"variants,omitempty"`
+	Prompt     PromptRef             `json:"prompt"`
+	Request    GenerateLayoutRequest `json:"request"`
+}
+
+// LayoutVariant is one ranked candidate. Variant numbers the candidates in
+// the order they were requested, so it stays the same whatever the rank.
+type LayoutVariant struct {
+	Variant     int      `json:"variant"`
+	Rank        int      `json:"rank"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	Seed        *int32   `json:"seed,omitempty"`
+	Score       any      `json:"score"`
+	Layout      Layout   `json:"layout"`
+	Repairs     any      `json:"repairs"`
+	Violations  any      `json:"violations"`
+}
+
+// PromptRef identifies the prompt version a result came from. Version 0 is
+// the template built into the server.
+type PromptRef struct {
+	Name    string `json:"name"`
+	Version int32  `json:"version"`
+	Hash    string `json:"hash,omitempty"`
 }
 
 type TemporaryResponse struct {
@@ -57,6 +167,19 @@ type JsonRequest struct {
 	Logo              string
 	ImageDescriptions map[string]string
 	ImageURLs         []string
+	HeroImage         string
+	ImageRoles        map[string]string
+	// Formats are the canvases to lay out, by format id.
+	Formats map[string]CanvasSize
+}
+
+// CanvasSize tells the model how big a format is and which bands at its
+// top and bottom must stay empty.
+type CanvasSize struct {
+	Width          float64
+	Height         float64
+	SafeZoneTop    float64
+	SafeZoneBottom float64
 }
 
 type ComplianceInfo struct {
@@ -71,6 +194,12 @@ type ComplianceInfo struct {
 	TescoFinalTag      string         `json:"tesco_final_tag"`
 }
 
+const (
+	VALUE_TILE_CLUBCARD = "clubcard"
+	VALUE_TILE_WHITE    = "white"
+	VALUE_TILE_NEW      = "new"
+)
+
 type ValueTileInfo struct {
 	Type         string `json:"type"` // "clubcard", "white", "new"
 	WhitePrice   string `json:"white_price"`
@@ -88,3 +217,454 @@ type RulesData struct {
 	PrimaryColor   string         `json:"primary_color"`
 	SecondaryColor string         `json:"secondary_color"`
 }
+
+type ValidateRequest struct {
+	Layout   json.RawMessage `json:"layout"`
+	Platform string          `json:"platform"`
+}
+
+type ValidateResponse struct {
+	Valid         bool           `json:"valid"`
+	Platform      string         `json:"platform"`
+	Violations    any            `json:"violations"`
+	UnknownFields []UnknownField `json:"unknown_fields"`
+}
+
+// RenderRequest renders either a layout, as a watermarked preview, or the
+// current version of an approved or published design.
+type RenderRequest struct {
+	Layout   json.RawMessage `json:"layout"`
+	DesignID pgtype.UUID     `json:"design_id"`
+	Format   string          `json:"format"`
+	Output   string          `json:"output"` // "png" or "jpeg"
+	Quality  int             `json:"quality"`
+}
+
+type GenerationJobResponse struct {
+	ID           pgtype.UUID        `json:"id"`
+	BrandKitID   pgtype.UUID        `json:"brand_kit_id"`
+	Status       string             `json:"status"`
+	Progress     int32              `json:"progress"`
+	Stage        string             `json:"stage"`
+	Error        string             `json:"error,omitempty"`
+	ErrorDetails json.RawMessage    `json:"error_details,omitempty"`
+	Result       json.RawMessage    `json:"result,omitempty"`
+	Attempts     int32              `json:"attempts"`
+	CreatedAt    pgtype.Timestamptz `json:"created_at"`
+	StartedAt    pgtype.Timestamptz `json:"started_at"`
+	FinishedAt   pgtype.Timestamptz `json:"finished_at"`
+}
+
+func NewGenerationJobResponse(job db.GenerationJob) GenerationJobResponse {
+	return GenerationJobResponse{
+		ID:           job.ID,
+		BrandKitID:   job.BrandKitID,
+		Status:       job.Status,
+		Progress:     job.Progress,
+		Stage:        job.Stage,
+		Error:        job.Error.String,
+		ErrorDetails: job.ErrorDetails,
+		Result:       job.ResultJson,
+		Attempts:     job.Attempts,
+		CreatedAt:    job.CreatedAt,
+		StartedAt:    job.StartedAt,
+		FinishedAt:   job.FinishedAt,
+	}
+}
+
+// GenerationEvent is a milestone in a layout generation, streamed to the
+// editor and used for job progress.
+type GenerationEvent struct {
+	Event    string `json:"event"`
+	Progress int    `json:"progress"`
+	Stage    string `json:"stage"`
+	Data     any    `json:"data,omitempty"`
+}
+
+type ImageDescribedEvent struct {
+	ImageURL    string `json:"image_url"`
+	Description string `json:"description"`
+	Cached      bool   `json:"cached"`
+	Fallback    bool   `json:"fallback"`
+}
+
+type AttemptEvent struct {
+	Attempt     int    `json:"attempt"`
+	MaxAttempts int    `json:"max_attempts"`
+	Error       string `json:"error,omitempty"`
+}
+
+type ErrorEvent struct {
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// FormatReadyEvent carries the candidate's number when several variants
+// are being generated.
+type FormatReadyEvent struct {
+	Variant    int           `json:"variant,omitempty"`
+	Format     string        `json:"format"`
+	Layout     *FormatLayout `json:"layout"`
+	Repairs    any           `json:"repairs"`
+	Violations any           `json:"violations"`
+}
+
+const (
+	DESIGN_SOURCE_GENERATED = "generated"
+	DESIGN_SOURCE_EDITED    = "edited"
+	DESIGN_SOURCE_RESTORED  = "restored"
+)
+
+// DesignCreateRequest saves a layout as a new design. The layout is either
+// given directly or taken from a finished generation job.
+type DesignCreateRequest struct {
+	Name   string          `json:"name"`
+	Layout json.RawMessage `json:"layout"`
+	JobID  pgtype.UUID     `json:"job_id"`
+	// Variant picks one of the job's candidates; 0 takes the best.
+	Variant int    `json:"variant"`
+	Note    string `json:"note"`
+}
+
+// DesignSaveRequest records an edit. BaseVersion is the version the edit
+// started from; when set, saving fails if someone else saved in between.
+type DesignSaveRequest struct {
+	Layout      json.RawMessage `json:"layout"`
+	Note        string          `json:"note"`
+	BaseVersion int32           `json:"base_version"`
+}
+
+type DesignRestoreRequest struct {
+	Note string `json:"note"`
+}
+
+type DesignVersionResponse struct {
+	Version         int32       `json:"version"`
+	Author          string      `json:"author"`
+	Source          string      `json:"source"`
+	Note            string      `json:"note,omitempty"`
+	GenerationJobID pgtype.UUID `json:"generation_job_id"`
+	RestoredFrom    *int32      `json:"restored_from,omitempty"`
+	// Prompt is the prompt version that generated the layout.
+	Prompt    *PromptRef         `json:"prompt,omitempty"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	Layout    json.RawMessage    `json:"layout,omitempty"`
+}
+
+// NewDesignVersionResponse describes a version, with its layout only when
+// with_layout is set so that version lists stay small.
+func NewDesignVersionResponse(version db.DesignVersion, with_layout bool) DesignVersionResponse {
+	response := DesignVersionResponse{
+		Version:         version.Version,
+		Author:          version.Author,
+		Source:          version.Source,
+		Note:            version.Note.String,
+		GenerationJobID: version.GenerationJobID,
+		CreatedAt:       version.CreatedAt,
+	}
+	if version.RestoredFrom.Valid {
+		response.RestoredFrom = &version.RestoredFrom.Int32
+	}
+	if version.PromptName.Valid {
+		response.Prompt = &PromptRef{Name: version.PromptName.String, Version: version.PromptVersion.Int32}
+	}
+	if with_layout {
+		response.Layout = version.LayoutJson
+	}
+	return response
+}
+
+type DesignResponse struct {
+	Design  db.Design             `json:"design"`
+	Version DesignVersionResponse `json:"version"`
+}
+
+type DesignDiffResponse struct {
+	From    int32          `json:"from"`
+	To      int32          `json:"to"`
+	Changes []LayoutChange `json:"changes"`
+}
+
+type MeResponse struct {
+	User      db.User      `json:"user"`
+	Workspace db.Workspace `json:"workspace"`
+	Role      string       `json:"role"`
+}
+
+type WorkspaceCreateRequest struct {
+	Name string `json:"name"`
+}
+
+// WorkspaceCreateResponse carries the first key of a new workspace, which
+// is never shown again.
+type WorkspaceCreateResponse struct {
+	Workspace db.Workspace `json:"workspace"`
+	APIKey    string       `json:"api_key"`
+}
+
+type WorkspaceMemberRequest struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Role  string `json:"role"`
+}
+
+type APIKeyCreateRequest struct {
+	Name   string      `json:"name"`
+	UserID pgtype.UUID `json:"user_id"`
+}
+
+// SessionTokenResponse carries a session token, which is never shown again.
+type SessionTokenResponse struct {
+	Token     string             `json:"token"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+// APIKeyResponse describes a key without its hash.
+type APIKeyResponse struct {
+	ID         pgtype.UUID        `json:"id"`
+	UserID     pgtype.UUID        `json:"user_id"`
+	Name       string             `json:"name"`
+	Prefix     string             `json:"prefix"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	RevokedAt  pgtype.Timestamptz `json:"revoked_at"`
+	// Generation limits of the key on top of the workspace's; null adds none.
+	GenerationRateLimit  pgtype.Int4 `json:"generation_rate_limit"`
+	GenerationDailyQuota pgtype.Int4 `json:"generation_daily_quota"`
+	Key                  string      `json:"key,omitempty"`
+}
+
+func NewAPIKeyResponse(key db.ApiKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		UserID:     key.UserID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+
+		GenerationRateLimit:  key.GenerationRateLimit,
+		GenerationDailyQuota: key.GenerationDailyQuota,
+	}
+}
+
+// DesignTransitionRequest moves a design through the approval workflow.
+// Version is the version the actor looked at; it defaults to the current
+// one and the action fails if the design has changed since.
+type DesignTransitionRequest struct {
+	Action  string `json:"action"`
+	Reason  string `json:"reason"`
+	Version int32  `json:"version"`
+}
+
+type DesignTransitionResponse struct {
+	Design db.Design       `json:"design"`
+	Review db.DesignReview `json:"review"`
+}
+
+type ApprovalRolesRequest struct {
+	ApprovalRoles []string `json:"approval_roles"`
+}
+
+type AuditEventResponse struct {
+	ID          pgtype.UUID        `json:"id"`
+	ActorUserID pgtype.UUID        `json:"actor_user_id"`
+	ActorEmail  string             `json:"actor_email"`
+	APIKeyID    pgtype.UUID        `json:"api_key_id"`
+	Action      string             `json:"action"`
+	TargetType  string             `json:"target_type"`
+	TargetID    pgtype.UUID        `json:"target_id"`
+	RequestID   string             `json:"request_id"`
+	Before      json.RawMessage    `json:"before"`
+	After       json.RawMessage    `json:"after"`
+	Changes     json.RawMessage    `json:"changes"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+func NewAuditEventResponse(event db.AuditEvent) AuditEventResponse {
+	return AuditEventResponse{
+		ID:          event.ID,
+		ActorUserID: event.ActorUserID,
+		ActorEmail:  event.ActorEmail,
+		APIKeyID:    event.ApiKeyID,
+		Action:      event.Action,
+		TargetType:  event.TargetType,
+		TargetID:    event.TargetID,
+		RequestID:   event.RequestID,
+		Before:      event.BeforeJson,
+		After:       event.AfterJson,
+		Changes:     event.ChangesJson,
+		CreatedAt:   event.CreatedAt,
+	}
+}
+
+// GenerationLimitsRequest sets generations per minute and per day. A null
+// or missing limit resets a workspace to the server default and removes a
+// key's own limit; 0 is unlimited.
+type GenerationLimitsRequest struct {
+	GenerationRateLimit  *int32 `json:"generation_rate_limit"`
+	GenerationDailyQuota *int32 `json:"generation_daily_quota"`
+}
+
+// GenerationUsage is a scope's limits in effect, 0 meaning unlimited, and
+// how much of them has been used.
+type GenerationUsage struct {
+	GenerationRateLimit  int32 `json:"generation_rate_limit"`
+	GenerationDailyQuota int32 `json:"generation_daily_quota"`
+	UsedThisMinute       int32 `json:"used_this_minute"`
+	UsedToday            int32 `json:"used_today"`
+}
+
+type GenerationUsageResponse struct {
+	Workspace GenerationUsage `json:"workspace"`
+	APIKey    GenerationUsage `json:"api_key"`
+	// DayResetsAt is when the daily quotas start over, at midnight UTC.
+	DayResetsAt time.Time `json:"day_resets_at"`
+}
+
+// ModelUsage adds up model calls. Day is empty on totals that span days.
+type ModelUsage struct {
+	Day            string      `json:"day,omitempty"`
+	BrandKitID     pgtype.UUID `json:"brand_kit_id"`
+	BrandKitName   string      `json:"brand_kit_name"`
+	Calls          int64       `json:"calls"`
+	FailedCalls    int64       `json:"failed_calls"`
+	Retries        int64       `json:"retries"`
+	PromptTokens   int64       `json:"prompt_tokens"`
+	ResponseTokens int64       `json:"response_tokens"`
+	// The cost is summed in millionths of a dollar, so totals stay exact.
+	EstimatedCostMicros int64   `json:"estimated_cost_micros"`
+	EstimatedCostUSD    float64 `json:"estimated_cost_usd"`
+}
+
+// ModelUsageReport covers the days from Since to Until, both included.
+type ModelUsageReport struct {
+	Since  string       `json:"since"`
+	Until  string       `json:"until"`
+	Days   []ModelUsage `json:"days"`
+	Kits   []ModelUsage `json:"kits"`
+	Totals ModelUsage   `json:"totals"`
+}
+
+// PromptSummary is a prompt with the variables its templates can use and
+// the version the workspace has active.
+type PromptSummary struct {
+	Name          string   `json:"name"`
+	Variables     []string `json:"variables"`
+	ActiveVersion int32    `json:"active_version"`
+}
+
+// PromptTemplateResponse is one version of a prompt. Version 0, the
+// built-in template, has no note, author or creation time.
+type PromptTemplateResponse struct {
+	Name      string             `json:"name"`
+	Version   int32              `json:"version"`
+	Hash      string             `json:"hash"`
+	Body      string             `json:"body,omitempty"`
+	Note      string             `json:"note,omitempty"`
+	Author    string             `json:"author,omitempty"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+}
+
+func NewPromptTemplateResponse(template db.PromptTemplate, with_body bool) PromptTemplateResponse {
+	response := PromptTemplateResponse{
+		Name:      template.Name,
+		Version:   template.Version,
+		Hash:      template.Hash,
+		Note:      template.Note.String,
+		Author:    template.Author,
+		CreatedAt: template.CreatedAt,
+	}
+	if with_body {
+		response.Body = template.Body
+	}
+	return response
+}
+
+// PromptPublishRequest publishes a new version of a prompt, which becomes
+// the active one unless Activate is false.
+type PromptPublishRequest struct {
+	Body     string `json:"body"`
+	Note     string `json:"note"`
+	Activate *bool  `json:"activate"`
+}
+
+// PromptVersionRequest picks a version of a prompt; 0 is the built-in one.
+type PromptVersionRequest struct {
+	Version *int32 `json:"version"`
+}
+
+// BrandKitPrompt is the version of a prompt a kit generates with, and
+// whether the kit is pinned to it.
+type BrandKitPrompt struct {
+	Name    string `json:"name"`
+	Version int32  `json:"version"`
+	Pinned  bool   `json:"pinned"`
+}
+
+// StaticAssetResponse is a compliance image layouts place by key. Custom is
+// set when the workspace has replaced the default.
+type StaticAssetResponse struct {
+	Key       string             `json:"key"`
+	URL       string             `json:"url"`
+	Width     int32              `json:"width,omitempty"`
+	Height    int32              `json:"height,omitempty"`
+	Formats   []string           `json:"formats"`
+	Retailer  string             `json:"retailer"`
+	Custom    bool               `json:"custom"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+func NewStaticAssetResponse(asset db.StaticAsset) StaticAssetResponse {
+	formats := asset.Formats
+	if formats == nil {
+		formats = []string{}
+	}
+	return StaticAssetResponse{
+		Key:       asset.Key,
+		URL:       asset.Url,
+		Width:     asset.Width.Int32,
+		Height:    asset.Height.Int32,
+		Formats:   formats,
+		Retailer:  asset.Retailer,
+		Custom:    asset.WorkspaceID.Valid,
+		UpdatedAt: asset.UpdatedAt,
+	}
+}
+
+// StaticAssetRequest replaces a static asset's image. Formats and Retailer
+// keep their current values when omitted.
+type StaticAssetRequest struct {
+	URL      string    `json:"url"`
+	Formats  *[]string `json:"formats"`
+	Retailer *string   `json:"retailer"`
+}
+
+// LayoutFormatResponse is a format layouts can be generated for. Custom is
+// set for the workspace's own formats, which alone have a creation time.
+type LayoutFormatResponse struct {
+	ID             string              `json:"id"`
+	Name           string              `json:"name"`
+	Width          float64             `json:"width"`
+	Height         float64             `json:"height"`
+	SafeZoneTop    float64             `json:"safe_zone_top"`
+	SafeZoneBottom float64             `json:"safe_zone_bottom"`
+	MinFontSize    float64             `json:"min_font_size"`
+	Platform       string              `json:"platform"`
+	Custom         bool                `json:"custom"`
+	CreatedAt      *pgtype.Timestamptz `json:"created_at,omitempty"`
+}
+
+// LayoutFormatRequest registers a custom format. Platform defaults to
+// social.
+type LayoutFormatRequest struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	Width          int32  `json:"width"`
+	Height         int32  `json:"height"`
+	SafeZoneTop    int32  `json:"safe_zone_top"`
+	SafeZoneBottom int32  `json:"safe_zone_bottom"`
+	MinFontSize    int32  `json:"min_font_size"`
+	Platform       string `json:"platform"`
+}
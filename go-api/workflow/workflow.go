@@ -0,0 +1,91 @@
+// Package workflow holds the approval rules for designs: which statuses a
+// design moves through and which approval roles may move it.
+package workflow
+
+import (
+	"errors"
+	"slices"
+)
+
+const (
+	STATUS_DRAFT     = "draft"
+	STATUS_IN_REVIEW = "in_review"
+	STATUS_APPROVED  = "approved"
+	STATUS_REJECTED  = "rejected"
+	STATUS_PUBLISHED = "published"
+)
+
+const (
+	ROLE_DESIGNER            = "designer"
+	ROLE_BRAND_MANAGER       = "brand_manager"
+	ROLE_COMPLIANCE_REVIEWER = "compliance_reviewer"
+)
+
+const (
+	ACTION_SUBMIT   = "submit"
+	ACTION_WITHDRAW = "withdraw"
+	ACTION_APPROVE  = "approve"
+	ACTION_REJECT   = "reject"
+	ACTION_PUBLISH  = "publish"
+	// ACTION_EDIT is recorded when saving a new version sends a design
+	// back to draft. Nobody requests it directly.
+	ACTION_EDIT = "edit"
+)
+
+var (
+	ErrUnknownAction     = errors.New("unknown action")
+	ErrInvalidTransition = errors.New("action not allowed in this status")
+	ErrRoleRequired      = errors.New("missing approval role")
+	ErrReasonRequired    = errors.New("a reason is required")
+)
+
+type Transition struct {
+	Action string
+	From   []string
+	To     string
+	// Roles lists the approval roles allowed to take the action; any one
+	// of them is enough.
+	Roles       []string
+	NeedsReason bool
+}
+
+var TRANSITIONS = []Transition{
+	{Action: ACTION_SUBMIT, From: []string{STATUS_DRAFT, STATUS_REJECTED}, To: STATUS_IN_REVIEW, Roles: []string{ROLE_DESIGNER}},
+	{Action: ACTION_WITHDRAW, From: []string{STATUS_IN_REVIEW}, To: STATUS_DRAFT, Roles: []string{ROLE_DESIGNER}},
+	{Action: ACTION_APPROVE, From: []string{STATUS_IN_REVIEW}, To: STATUS_APPROVED, Roles: []string{ROLE_COMPLIANCE_REVIEWER}},
+	{Action: ACTION_REJECT, From: []string{STATUS_IN_REVIEW, STATUS_APPROVED}, To: STATUS_REJECTED, Roles: []string{ROLE_BRAND_MANAGER, ROLE_COMPLIANCE_REVIEWER}, NeedsReason: true},
+	{Action: ACTION_PUBLISH, From: []string{STATUS_APPROVED}, To: STATUS_PUBLISHED, Roles: []string{ROLE_BRAND_MANAGER}},
+}
+
+func ValidRole(role string) bool {
+	return role == ROLE_DESIGNER || role == ROLE_BRAND_MANAGER || role == ROLE_COMPLIANCE_REVIEWER
+}
+
+// Exportable reports whether a design in this status has been signed off.
+func Exportable(status string) bool {
+	return status == STATUS_APPROVED || status == STATUS_PUBLISHED
+}
+
+// Check decides whether someone holding roles may take action on a design
+// in status from. It returns the transition and the role that allowed it.
+func Check(action, from string, roles []string, reason string) (Transition, string, error) {
+	index := slices.IndexFunc(TRANSITIONS, func(t Transition) bool { return t.Action == action })
+	if index < 0 {
+		return Transition{}, "", ErrUnknownAction
+	}
+	transition := TRANSITIONS[index]
+
+	if !slices.Contains(transition.From, from) {
+		return transition, "", ErrInvalidTransition
+	}
+
+	role_index := slices.IndexFunc(transition.Roles, func(role string) bool { return slices.Contains(roles, role) })
+	if role_index < 0 {
+		return transition, "", ErrRoleRequired
+	}
+
+	if transition.NeedsReason && reason == "" {
+		return transition, "", ErrReasonRequired
+	}
+	return transition, transition.Roles[role_index], nil
+}
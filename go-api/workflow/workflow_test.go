@@ -0,0 +1,73 @@
+package workflow
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		from   string
+		roles  []string
+		reason string
+		to     string
+		role   string
+		err    error
+	}{
+		{name: "designer submits a draft", action: ACTION_SUBMIT, from: STATUS_DRAFT, roles: []string{ROLE_DESIGNER}, to: STATUS_IN_REVIEW, role: ROLE_DESIGNER},
+		{name: "designer resubmits a rejected design", action: ACTION_SUBMIT, from: STATUS_REJECTED, roles: []string{ROLE_DESIGNER}, to: STATUS_IN_REVIEW, role: ROLE_DESIGNER},
+		{name: "designer withdraws", action: ACTION_WITHDRAW, from: STATUS_IN_REVIEW, roles: []string{ROLE_DESIGNER}, to: STATUS_DRAFT, role: ROLE_DESIGNER},
+		{name: "reviewer approves", action: ACTION_APPROVE, from: STATUS_IN_REVIEW, roles: []string{ROLE_COMPLIANCE_REVIEWER}, to: STATUS_APPROVED, role: ROLE_COMPLIANCE_REVIEWER},
+		{name: "brand manager rejects with a reason", action: ACTION_REJECT, from: STATUS_IN_REVIEW, roles: []string{ROLE_BRAND_MANAGER}, reason: "Wrong price", to: STATUS_REJECTED, role: ROLE_BRAND_MANAGER},
+		{name: "reviewer rejects an approved design", action: ACTION_REJECT, from: STATUS_APPROVED, roles: []string{ROLE_COMPLIANCE_REVIEWER}, reason: "Recalled", to: STATUS_REJECTED, role: ROLE_COMPLIANCE_REVIEWER},
+		{name: "brand manager publishes", action: ACTION_PUBLISH, from: STATUS_APPROVED, roles: []string{ROLE_BRAND_MANAGER}, to: STATUS_PUBLISHED, role: ROLE_BRAND_MANAGER},
+		{name: "first matching role is reported", action: ACTION_REJECT, from: STATUS_IN_REVIEW, roles: []string{ROLE_COMPLIANCE_REVIEWER, ROLE_BRAND_MANAGER}, reason: "No", to: STATUS_REJECTED, role: ROLE_BRAND_MANAGER},
+
+		{name: "unknown action", action: "archive", from: STATUS_DRAFT, roles: []string{ROLE_DESIGNER}, err: ErrUnknownAction},
+		{name: "edit is not requested directly", action: ACTION_EDIT, from: STATUS_APPROVED, roles: []string{ROLE_DESIGNER}, err: ErrUnknownAction},
+		{name: "drafts cannot be approved", action: ACTION_APPROVE, from: STATUS_DRAFT, roles: []string{ROLE_COMPLIANCE_REVIEWER}, err: ErrInvalidTransition},
+		{name: "published designs cannot be rejected", action: ACTION_REJECT, from: STATUS_PUBLISHED, roles: []string{ROLE_BRAND_MANAGER}, reason: "No", err: ErrInvalidTransition},
+		{name: "designers cannot approve", action: ACTION_APPROVE, from: STATUS_IN_REVIEW, roles: []string{ROLE_DESIGNER}, err: ErrRoleRequired},
+		{name: "no roles", action: ACTION_SUBMIT, from: STATUS_DRAFT, err: ErrRoleRequired},
+		{name: "rejection needs a reason", action: ACTION_REJECT, from: STATUS_IN_REVIEW, roles: []string{ROLE_BRAND_MANAGER}, err: ErrReasonRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transition, role, err := Check(tt.action, tt.from, tt.roles, tt.reason)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Check() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if transition.To != tt.to {
+				t.Errorf("Check() moves to %q, want %q", transition.To, tt.to)
+			}
+			if role != tt.role {
+				t.Errorf("Check() allowed by %q, want %q", role, tt.role)
+			}
+		})
+	}
+}
+
+func TestExportable(t *testing.T) {
+	tests := []struct {
+		status string
+		want   bool
+	}{
+		{STATUS_DRAFT, false},
+		{STATUS_IN_REVIEW, false},
+		{STATUS_APPROVED, true},
+		{STATUS_REJECTED, false},
+		{STATUS_PUBLISHED, true},
+	}
+
+	for _, tt := range tests {
+		if got := Exportable(tt.status); got != tt.want {
+			t.Errorf("Exportable(%q) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}